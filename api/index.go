@@ -22,6 +22,8 @@ import (
 	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model/file"
 	"github.com/volcengine/volcengine-go-sdk/service/arkruntime/model/responses"
 	"github.com/volcengine/volcengine-go-sdk/volcengine"
+
+	"bkp-drive/pkg/mimetypes"
 )
 
 type Claims struct {
@@ -334,8 +336,9 @@ func handleFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证JWT token
-	if !validateJWTToken(r) {
+	// 验证JWT token，文件位于用户自己的空间 users/<user_id>/ 下
+	userPrefix, ok := userPrefixFromToken(r)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -366,7 +369,15 @@ func handleFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prefix := r.URL.Query().Get("prefix")
+	prefix, err := userFolder(userPrefix, r.URL.Query().Get("prefix"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "路径不合法: " + err.Error(),
+		})
+		return
+	}
 
 	// 调用TOS列出对象
 	ctx := context.Background()
@@ -400,11 +411,11 @@ func handleFiles(w http.ResponseWriter, r *http.Request) {
 		}
 
 		files = append(files, map[string]interface{}{
-			"key":          obj.Key,
+			"key":          strings.TrimPrefix(obj.Key, userPrefix),
 			"name":         filepath.Base(obj.Key),
 			"size":         obj.Size,
 			"lastModified": obj.LastModified,
-			"contentType":  getContentTypeFromKey(obj.Key),
+			"contentType":  mimetypes.TypeByKey(obj.Key),
 			"isFolder":     false,
 			"etag":         strings.Trim(obj.ETag, "\""),
 		})
@@ -437,8 +448,9 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证JWT token
-	if !validateJWTToken(r) {
+	// 验证JWT token，文件位于用户自己的空间 users/<user_id>/ 下
+	userPrefix, ok := userPrefixFromToken(r)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -470,15 +482,24 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	folder := r.FormValue("folder")
-	if folder == "" {
-		folder = ""
-	} else if !strings.HasSuffix(folder, "/") {
+	if folder != "" && !strings.HasSuffix(folder, "/") {
 		folder += "/"
 	}
 
-	// 构造文件路径
+	// 构造文件路径，文件名不能包含 /
 	fileName := fileHeader.Filename
-	filePath := folder + fileName
+	if strings.Contains(fileName, "/") {
+		fileName = filepath.Base(fileName)
+	}
+	filePath, err := userKey(userPrefix, folder+fileName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "路径不合法: " + err.Error(),
+		})
+		return
+	}
 
 	// 获取TOS客户端
 	tosClient, err := getTOSClient()
@@ -501,8 +522,16 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 推测Content-Type
-	contentType := getContentTypeFromKey(fileName)
+	// 按文件内容检测Content-Type
+	contentType, content, err := mimetypes.Detect(file, fileName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "读取文件失败: " + err.Error(),
+		})
+		return
+	}
 
 	// 上传文件到TOS
 	ctx := context.Background()
@@ -512,7 +541,7 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 			Key:         filePath,
 			ContentType: contentType,
 		},
-		Content: file,
+		Content: content,
 	}
 
 	output, err := tosClient.PutObjectV2(ctx, input)
@@ -528,7 +557,7 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": "文件上传成功",
-		"key":     filePath,
+		"key":     strings.TrimPrefix(filePath, userPrefix),
 		"etag":    strings.Trim(output.ETag, "\""),
 		"size":    fileHeader.Size,
 	})
@@ -544,8 +573,9 @@ func handleFolders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证JWT token
-	if !validateJWTToken(r) {
+	// 验证JWT token，文件位于用户自己的空间 users/<user_id>/ 下
+	userPrefix, ok := userPrefixFromToken(r)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -580,6 +610,15 @@ func handleFolders(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasSuffix(req.FolderPath, "/") {
 		req.FolderPath += "/"
 	}
+	folderKey, err := userKey(userPrefix, req.FolderPath)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "路径不合法: " + err.Error(),
+		})
+		return
+	}
 
 	// 获取TOS客户端
 	tosClient, err := getTOSClient()
@@ -607,7 +646,7 @@ func handleFolders(w http.ResponseWriter, r *http.Request) {
 	input := &tos.PutObjectV2Input{
 		PutObjectBasicInput: tos.PutObjectBasicInput{
 			Bucket: bucketName,
-			Key:    req.FolderPath,
+			Key:    folderKey,
 		},
 		Content: strings.NewReader(""),
 	}
@@ -639,8 +678,9 @@ func handleDeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证JWT token
-	if !validateJWTToken(r) {
+	// 验证JWT token，文件位于用户自己的空间 users/<user_id>/ 下
+	userPrefix, ok := userPrefixFromToken(r)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -670,6 +710,15 @@ func handleDeleteFile(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	key, err := userKey(userPrefix, decodedPath)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "路径不合法: " + err.Error(),
+		})
+		return
+	}
 
 	// 获取TOS客户端
 	tosClient, err := getTOSClient()
@@ -692,14 +741,9 @@ func handleDeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 删除文件/文件夹
+	// 删除文件/文件夹，以 / 结尾的路径递归删除文件夹下的所有对象
 	ctx := context.Background()
-	input := &tos.DeleteObjectV2Input{
-		Bucket: bucketName,
-		Key:    decodedPath,
-	}
-
-	_, err = tosClient.DeleteObjectV2(ctx, input)
+	err = deleteObjectOrFolder(ctx, tosClient, bucketName, key)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -726,8 +770,9 @@ func handleBatchDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证JWT token
-	if !validateJWTToken(r) {
+	// 验证JWT token，文件位于用户自己的空间 users/<user_id>/ 下
+	userPrefix, ok := userPrefixFromToken(r)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -786,12 +831,13 @@ func handleBatchDelete(w http.ResponseWriter, r *http.Request) {
 	var errors []string
 
 	for _, item := range req.Items {
-		input := &tos.DeleteObjectV2Input{
-			Bucket: bucketName,
-			Key:    item,
+		key, keyErr := userKey(userPrefix, item)
+		if keyErr != nil {
+			failCount++
+			errors = append(errors, fmt.Sprintf("%s: %s", item, keyErr.Error()))
+			continue
 		}
-
-		_, err = tosClient.DeleteObjectV2(ctx, input)
+		err = deleteObjectOrFolder(ctx, tosClient, bucketName, key)
 		if err != nil {
 			failCount++
 			errors = append(errors, fmt.Sprintf("%s: %s", item, err.Error()))
@@ -818,6 +864,55 @@ func handleBatchDelete(w http.ResponseWriter, r *http.Request) {
 }
 
 // 辅助函数
+
+// deleteObjectOrFolder 删除单个对象；key 以 / 结尾时逐页列出并删除文件夹下的所有对象，
+// 文件夹标记对象最后删除，失败后重试只会处理剩余的对象
+func deleteObjectOrFolder(ctx context.Context, tosClient *tos.ClientV2, bucketName, key string) error {
+	if !strings.HasSuffix(key, "/") {
+		_, err := tosClient.DeleteObjectV2(ctx, &tos.DeleteObjectV2Input{Bucket: bucketName, Key: key})
+		return err
+	}
+	if strings.Trim(key, "/") == "" {
+		return fmt.Errorf("文件夹路径不能为空")
+	}
+
+	var keys []string
+	continuationToken := ""
+	for {
+		output, err := tosClient.ListObjectsType2(ctx, &tos.ListObjectsType2Input{
+			Bucket:            bucketName,
+			Prefix:            key,
+			ContinuationToken: continuationToken,
+			ListOnlyOnce:      true,
+		})
+		if err != nil {
+			return err
+		}
+		for _, obj := range output.Contents {
+			if obj.Key != key {
+				keys = append(keys, obj.Key)
+			}
+		}
+		if !output.IsTruncated {
+			break
+		}
+		continuationToken = output.NextContinuationToken
+	}
+
+	var failed []string
+	for _, objectKey := range keys {
+		if _, err := tosClient.DeleteObjectV2(ctx, &tos.DeleteObjectV2Input{Bucket: bucketName, Key: objectKey}); err != nil {
+			failed = append(failed, objectKey)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d 个对象删除失败: %s", len(failed), strings.Join(failed, ", "))
+	}
+
+	_, err := tosClient.DeleteObjectV2(ctx, &tos.DeleteObjectV2Input{Bucket: bucketName, Key: key})
+	return err
+}
+
 func getDBConnection() (*sql.DB, error) {
 	// 优先使用完整的DATABASE_URL
 	databaseURL := os.Getenv("DATABASE_URL")
@@ -905,21 +1000,72 @@ func generateJWTToken(userID, username string) (string, error) {
 }
 
 func validateJWTToken(r *http.Request) bool {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return false
-	}
+	_, ok := userPrefixFromToken(r)
+	return ok
+}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		return false
+// userPrefixFromToken 验证JWT token，返回用户空间的前缀 users/<user_id>/
+func userPrefixFromToken(r *http.Request) (string, bool) {
+	tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if tokenString == r.Header.Get("Authorization") {
+		return "", false
 	}
 
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(os.Getenv("JWT_SECRET")), nil
 	})
+	if err != nil || !token.Valid {
+		return "", false
+	}
+	userID := claims.UserID
+	if userID == "" || userID == "." || userID == ".." || strings.ContainsAny(userID, "/\\") {
+		return "", false
+	}
+	return "users/" + userID + "/", true
+}
+
+// cleanUserPath 校验用户传入的相对路径，拒绝路径穿越和绝对路径（与 Go 服务器的规则一致）
+func cleanUserPath(p string) error {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") {
+		return fmt.Errorf("路径不能以 / 开头: %s", p)
+	}
+	if strings.ContainsAny(p, "\\\x00") {
+		return fmt.Errorf("路径包含非法字符: %s", p)
+	}
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("路径不能包含 . 或 ..: %s", p)
+		}
+		// 只允许末尾的空段（表示文件夹）
+		if segment == "" && i != len(segments)-1 {
+			return fmt.Errorf("路径包含空的层级: %s", p)
+		}
+	}
+	return nil
+}
+
+// userKey 将用户相对路径转换为完整对象键，路径不能为空
+func userKey(userPrefix, p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("路径不能为空")
+	}
+	if err := cleanUserPath(p); err != nil {
+		return "", err
+	}
+	return userPrefix + p, nil
+}
 
-	return err == nil && token.Valid
+// userFolder 将用户相对文件夹路径转换为完整前缀，空路径表示用户根目录
+func userFolder(userPrefix, p string) (string, error) {
+	if p == "" || p == "/" {
+		return userPrefix, nil
+	}
+	if err := cleanUserPath(p); err != nil {
+		return "", err
+	}
+	return userPrefix + p, nil
 }
 
 // getTOSClient 获取TOS客户端
@@ -945,41 +1091,6 @@ func getTOSClient() (*tos.ClientV2, error) {
 	return tosClient, nil
 }
 
-// getContentTypeFromKey 根据文件扩展名推测Content-Type
-func getContentTypeFromKey(key string) string {
-	ext := strings.ToLower(filepath.Ext(key))
-	switch ext {
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".png":
-		return "image/png"
-	case ".gif":
-		return "image/gif"
-	case ".pdf":
-		return "application/pdf"
-	case ".txt":
-		return "text/plain"
-	case ".html", ".htm":
-		return "text/html"
-	case ".css":
-		return "text/css"
-	case ".js":
-		return "application/javascript"
-	case ".json":
-		return "application/json"
-	case ".xml":
-		return "application/xml"
-	case ".zip":
-		return "application/zip"
-	case ".mp4":
-		return "video/mp4"
-	case ".mp3":
-		return "audio/mpeg"
-	default:
-		return "application/octet-stream"
-	}
-}
-
 // getEnvOrDefault 获取环境变量，如果不存在则返回默认值
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -999,8 +1110,9 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证JWT token
-	if !validateJWTToken(r) {
+	// 验证JWT token，文件位于用户自己的空间 users/<user_id>/ 下
+	userPrefix, ok := userPrefixFromToken(r)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -1030,6 +1142,15 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	key, err := userKey(userPrefix, decodedPath)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "路径不合法: " + err.Error(),
+		})
+		return
+	}
 
 	// 获取TOS客户端
 	tosClient, err := getTOSClient()
@@ -1052,7 +1173,7 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		// 使用TOS处理功能（缩略图/视频截图）
 		processInput := &tos.GetObjectV2Input{
 			Bucket:  bucketName,
-			Key:     decodedPath,
+			Key:     key,
 			Process: processParam,
 		}
 		
@@ -1075,7 +1196,7 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 			if strings.Contains(processParam, "video/snapshot") {
 				w.Header().Set("Content-Type", "image/jpeg")
 			} else if strings.Contains(processParam, "image/resize") {
-				w.Header().Set("Content-Type", getContentTypeFromKey(decodedPath))
+				w.Header().Set("Content-Type", mimetypes.TypeByKey(decodedPath))
 			}
 		}
 
@@ -1100,7 +1221,7 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		// 普通文件下载
 		input := &tos.GetObjectV2Input{
 			Bucket: bucketName,
-			Key:    decodedPath,
+			Key:    key,
 		}
 		
 		output, err := tosClient.GetObjectV2(ctx, input)
@@ -1118,7 +1239,7 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 		if output.ContentType != "" {
 			w.Header().Set("Content-Type", output.ContentType)
 		} else {
-			w.Header().Set("Content-Type", getContentTypeFromKey(decodedPath))
+			w.Header().Set("Content-Type", mimetypes.TypeByKey(decodedPath))
 		}
 		
 		if output.ContentLength > 0 {
@@ -1148,8 +1269,9 @@ func handleArkUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证JWT token
-	if !validateJWTToken(r) {
+	// 验证JWT token，文件位于用户自己的空间 users/<user_id>/ 下
+	userPrefix, ok := userPrefixFromToken(r)
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
@@ -1168,6 +1290,15 @@ func handleArkUpload(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	fileKey, err := userKey(userPrefix, filePath)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "路径不合法: " + err.Error(),
+		})
+		return
+	}
 
 	fmt.Printf("[ARK Upload] Uploading file: %s\n", filePath)
 
@@ -1188,7 +1319,7 @@ func handleArkUpload(w http.ResponseWriter, r *http.Request) {
 
 	getObjectInput := &tos.GetObjectV2Input{
 		Bucket: bucketName,
-		Key:    filePath,
+		Key:    fileKey,
 	}
 
 	fmt.Printf("[ARK Upload] Downloading from TOS bucket: %s, key: %s\n", bucketName, filePath)
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserPrefixFromToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	token, err := generateJWTToken("bkp-alice", "alice")
+	if err != nil {
+		t.Fatalf("生成 token 失败: %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/files", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if prefix, ok := userPrefixFromToken(r); !ok || prefix != "users/bkp-alice/" {
+		t.Errorf("prefix = %q, %v", prefix, ok)
+	}
+
+	for _, header := range []string{"", token, "Bearer bad"} {
+		r.Header.Set("Authorization", header)
+		if _, ok := userPrefixFromToken(r); ok {
+			t.Errorf("Authorization %q 应验证失败", header)
+		}
+	}
+
+	// 不同密钥签发的 token 无效
+	t.Setenv("JWT_SECRET", "other-secret")
+	r.Header.Set("Authorization", "Bearer "+token)
+	if _, ok := userPrefixFromToken(r); ok {
+		t.Error("密钥不同的 token 应验证失败")
+	}
+}
+
+func TestUserKey(t *testing.T) {
+	const prefix = "users/bkp-alice/"
+	for p, want := range map[string]string{
+		"a.txt":      "users/bkp-alice/a.txt",
+		"docs/a.txt": "users/bkp-alice/docs/a.txt",
+		"docs/":      "users/bkp-alice/docs/",
+		"年度/报告.pdf":  "users/bkp-alice/年度/报告.pdf",
+	} {
+		if got, err := userKey(prefix, p); err != nil || got != want {
+			t.Errorf("userKey(%q) = %q, %v", p, got, err)
+		}
+	}
+	for _, p := range []string{"", "/", "/etc/passwd", "../bkp-bob/a.txt", "docs/../../bkp-bob/", "a//b", "a\\b", "./a"} {
+		if got, err := userKey(prefix, p); err == nil {
+			t.Errorf("userKey(%q) = %q, 应返回错误", p, got)
+		}
+	}
+
+	if got, err := userFolder(prefix, ""); err != nil || got != prefix {
+		t.Errorf("userFolder(\"\") = %q, %v", got, err)
+	}
+	if got, err := userFolder(prefix, "docs/"); err != nil || got != "users/bkp-alice/docs/" {
+		t.Errorf("userFolder(docs/) = %q, %v", got, err)
+	}
+	if _, err := userFolder(prefix, "../bkp-bob/"); err == nil {
+		t.Error("userFolder 应拒绝 ..")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"bkp-drive/internal/services"
+	"bkp-drive/pkg/config"
+	"bkp-drive/pkg/database"
+	"bkp-drive/pkg/tos"
+)
+
+const usage = `用法: bkp-admin <命令> [参数]
+
+命令:
+  reindex   比对存储桶与数据库中的元数据索引并修正不一致
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "reindex":
+		reindex(os.Args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+// reindex 分页遍历存储桶，为没有记录的对象插入记录、更新过期记录、删除对象已不存在的记录
+// 默认处理用户文件以及计入占用空间的回收站和历史版本（只索引元数据）
+func reindex(args []string) {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "只报告不一致，不修改数据库")
+	prefix := flags.String("prefix", "", "只处理该前缀下的对象，必须在 users/ 或 "+strings.Join(services.UsagePrefixes, "、")+" 下；默认处理全部")
+	pageSize := flags.Int("page-size", 1000, "每次列举的数量")
+	flags.Parse(args)
+
+	// 要处理的前缀及是否只索引元数据
+	prefixes := map[string]bool{"users/": false}
+	for _, usagePrefix := range services.UsagePrefixes {
+		prefixes[usagePrefix] = true
+	}
+	if *prefix != "" {
+		selected := map[string]bool{}
+		for root, metadataOnly := range prefixes {
+			if strings.HasPrefix(*prefix, root) {
+				selected[*prefix] = metadataOnly
+			}
+		}
+		if len(selected) == 0 {
+			log.Fatalf("前缀不在元数据索引范围内: %s", *prefix)
+		}
+		prefixes = selected
+	}
+
+	cfg := config.LoadConfig()
+	if err := database.InitDB(cfg); err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	defer database.CloseDB()
+
+	// 直接遍历存储后端，不经过元数据索引
+	store, err := tos.NewObjectStore(cfg)
+	if err != nil {
+		log.Fatalf("创建存储后端失败: %v", err)
+	}
+
+	labels := map[string]string{
+		tos.ReindexOrphaned: "孤立对象",
+		tos.ReindexDangling: "悬空记录",
+		tos.ReindexStale:    "过期记录",
+	}
+	roots := make([]string, 0, len(prefixes))
+	for root := range prefixes {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	report := &tos.ReindexReport{}
+	for _, root := range roots {
+		part, err := tos.Reindex(store, database.NewFileIndex(database.DB), tos.ReindexOptions{
+			Prefix:       root,
+			PageSize:     *pageSize,
+			DryRun:       *dryRun,
+			MetadataOnly: prefixes[root],
+			OnChange: func(kind, key string) {
+				fmt.Printf("%s\t%s\n", labels[kind], key)
+			},
+		})
+		if err != nil {
+			log.Fatalf("重建 %s 的索引失败: %v", root, err)
+		}
+		report.Objects += part.Objects
+		report.Records += part.Records
+		report.Orphaned += part.Orphaned
+		report.Dangling += part.Dangling
+		report.Stale += part.Stale
+	}
+
+	action := "已修正"
+	if *dryRun {
+		action = "试运行，未修改"
+	}
+	log.Printf("对象 %d 个，记录 %d 条；孤立对象 %d 个，悬空记录 %d 条，过期记录 %d 条（%s）",
+		report.Objects, report.Records, report.Orphaned, report.Dangling, report.Stale, action)
+}
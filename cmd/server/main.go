@@ -2,6 +2,8 @@ package main
 
 import (
 	"log"
+	"time"
+	_ "time/tzdata" // 运行环境没有时区数据库时使用内置的时区数据
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -11,6 +13,7 @@ import (
 	_ "bkp-drive/docs" // 导入生成的swagger文档
 	"bkp-drive/internal/handlers"
 	"bkp-drive/internal/middleware"
+	"bkp-drive/internal/models"
 	"bkp-drive/internal/services"
 	"bkp-drive/pkg/config"
 	"bkp-drive/pkg/database"
@@ -51,12 +54,21 @@ func main() {
 	// 初始化JWT
 	middleware.InitJWT(cfg.JWTSecret)
 
-	tosClient, err := tos.NewTOSClient(cfg)
+	store, err := tos.NewObjectStore(cfg)
 	if err != nil {
-		log.Fatalf("创建TOS客户端失败: %v", err)
+		log.Fatalf("创建存储后端失败: %v", err)
+	}
+	log.Printf("存储后端: %s", cfg.StorageBackend)
+	if cfg.StorageDedup {
+		log.Println("已开启按内容去重存储")
+	}
+	// 用户文件的列举、搜索和统计查询数据库中的元数据索引
+	if cfg.MetadataIndex {
+		store = tos.NewIndexedStore(store, database.NewFileIndex(database.DB), "users/", services.UsagePrefixes...)
+		log.Println("已开启元数据索引")
 	}
 
-	if err := tosClient.EnsureBucketExists(); err != nil {
+	if err := store.EnsureBucketExists(); err != nil {
 		log.Fatalf("存储桶操作失败: %v", err)
 	}
 
@@ -64,9 +76,9 @@ func main() {
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified", "Content-Disposition", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Checksum-Algorithm", "Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires"},
 		AllowCredentials: true,
 	}))
 
@@ -79,10 +91,54 @@ func main() {
 	r.StaticFile("/register.html", "./public/register.html")
 	r.StaticFile("/swagger.html", "./public/swagger.html")
 
+	// 历史版本，超过保留天数的版本每小时清理一次
+	versionService := services.NewVersionService(store, models.VersionPolicy{
+		KeepLast: cfg.VersionKeepLast,
+		KeepDays: cfg.VersionKeepDays,
+	})
+	stopPrune := versionService.StartPrune(time.Hour)
+	defer stopPrune()
+
+	// 回收站，超过保留时间的条目每小时清理一次
+	trashService := services.NewTrashService(store, versionService, cfg.TrashRetention)
+	if cfg.TrashRetention > 0 {
+		stopPurge := trashService.StartPurge(time.Hour)
+		defer stopPurge()
+	}
+
+	// 用户配额，未单独设置的用户使用默认配额
+	quotaService := services.NewQuotaService(store, services.NewDBQuotaStore(database.DB), cfg.UserQuota)
+
+	// 用户偏好设置，未设置时区的用户按默认时区计算今天、本周等时间范围
+	defaultLocation, err := time.LoadLocation(cfg.DefaultTimezone)
+	if err != nil {
+		log.Fatalf("默认时区无效: %v", err)
+	}
+	preferenceService := services.NewPreferenceService(store, defaultLocation)
+
+	// 保存的搜索（智能文件夹），共享时按用户名查找接收者
+	savedSearchService := services.NewSavedSearchService(store, services.NewDBUserDirectory(database.DB))
+
 	// 创建处理器
-	fileHandler := handlers.NewFileHandler(tosClient)
-	advancedHandler := handlers.NewAdvancedHandler(tosClient)
-	shareHandler := handlers.NewShareHandler(tosClient)
+	fileHandler := handlers.NewFileHandler(store, trashService, versionService, quotaService, savedSearchService, preferenceService)
+	advancedHandler := handlers.NewAdvancedHandler(store, trashService, versionService, quotaService, preferenceService)
+	trashHandler := handlers.NewTrashHandler(trashService)
+	versionHandler := handlers.NewVersionHandler(store, versionService)
+	shareHandler := handlers.NewShareHandler(store)
+	savedSearchHandler := handlers.NewSavedSearchHandler(savedSearchService, preferenceService)
+	preferenceHandler := handlers.NewPreferenceHandler(preferenceService)
+	uploadHandler := handlers.NewUploadHandler(services.NewUploadService(store, versionService, quotaService))
+	tusHandler := handlers.NewTusHandler(services.NewTusService(store, versionService, quotaService))
+	presignHandler := handlers.NewPresignHandler(services.NewPresignService(store, versionService, quotaService))
+
+	// 压缩、解压等耗时操作以后台任务执行
+	jobService := services.NewJobService()
+	jobHandler := handlers.NewJobHandler(jobService)
+	archiveHandler := handlers.NewArchiveHandler(services.NewArchiveService(store, jobService, versionService, quotaService, services.ExtractLimits{
+		MaxBytes: cfg.ExtractMaxBytes,
+		MaxFiles: cfg.ExtractMaxFiles,
+		MaxRatio: cfg.ExtractMaxRatio,
+	}))
 
 	// 用户服务和认证处理器
 	userService := services.NewUserService(cfg.JWTSecret)
@@ -107,9 +163,39 @@ func main() {
 			protected.POST("/upload", fileHandler.UploadFile)
 			protected.GET("/files", fileHandler.ListFiles)
 			protected.GET("/download/*key", fileHandler.DownloadFile)
+			protected.POST("/download/zip", archiveHandler.DownloadZip)
 			protected.DELETE("/files/*key", fileHandler.DeleteFile)
 			protected.POST("/folders", fileHandler.CreateFolder)
 
+			// 可续传的分片上传
+			uploads := protected.Group("/uploads")
+			{
+				uploads.POST("", uploadHandler.InitiateUpload)
+				uploads.GET("", uploadHandler.ListUploads)
+				uploads.GET("/:sessionId", uploadHandler.GetUpload)
+				uploads.PUT("/:sessionId/parts/:partNumber", uploadHandler.UploadPart)
+				uploads.POST("/:sessionId/complete", uploadHandler.CompleteUpload)
+				uploads.DELETE("/:sessionId", uploadHandler.AbortUpload)
+			}
+
+			// tus 1.0 可续传上传协议
+			tus := protected.Group("/tus")
+			{
+				tus.OPTIONS("/", tusHandler.Options)
+				tus.POST("/", tusHandler.Create)
+				tus.HEAD("/:id", tusHandler.Head)
+				tus.PATCH("/:id", tusHandler.Patch)
+				tus.DELETE("/:id", tusHandler.Delete)
+			}
+
+			// 预签名直传（文件内容不经过本服务）
+			presign := protected.Group("/presign")
+			{
+				presign.POST("/upload", presignHandler.PresignUpload)
+				presign.POST("/download", presignHandler.PresignDownload)
+				presign.POST("/complete", presignHandler.CompletePresignedUpload)
+			}
+
 			// 高级文件操作
 			protected.PUT("/files/move", advancedHandler.MoveFile)
 			protected.PUT("/files/copy", advancedHandler.CopyFile)
@@ -123,14 +209,57 @@ func main() {
 				batch.POST("/copy", advancedHandler.BatchCopy)
 			}
 
+			// 回收站
+			trash := protected.Group("/trash")
+			{
+				trash.GET("", trashHandler.ListTrash)
+				trash.POST("/restore", trashHandler.RestoreTrash)
+				trash.DELETE("", trashHandler.EmptyTrash)
+				trash.DELETE("/:id", trashHandler.DeleteTrashItem)
+			}
+
+			// 历史版本
+			versions := protected.Group("/versions")
+			{
+				versions.GET("", versionHandler.ListVersions)
+				versions.GET("/download", versionHandler.DownloadVersion)
+				versions.POST("/restore", versionHandler.RestoreVersion)
+				versions.DELETE("", versionHandler.DeleteVersion)
+				versions.GET("/policy", versionHandler.GetVersionPolicy)
+				versions.PUT("/policy", versionHandler.SetVersionPolicy)
+			}
+
+			// 压缩包和后台任务
+			protected.POST("/archives/compress", archiveHandler.Compress)
+			protected.POST("/archives/extract", archiveHandler.Extract)
+			protected.GET("/jobs", jobHandler.ListJobs)
+			protected.GET("/jobs/:id", jobHandler.GetJob)
+
 			// 搜索和过滤
 			protected.GET("/search", advancedHandler.SearchFiles)
 			protected.GET("/files/recent", advancedHandler.GetRecentFiles)
 			protected.GET("/files/filter", advancedHandler.FilterFiles)
 
+			// 保存的搜索（智能文件夹）
+			savedSearches := protected.Group("/saved-searches")
+			{
+				savedSearches.GET("", savedSearchHandler.ListSavedSearches)
+				savedSearches.POST("", savedSearchHandler.CreateSavedSearch)
+				savedSearches.GET("/:id", savedSearchHandler.GetSavedSearch)
+				savedSearches.PUT("/:id", savedSearchHandler.UpdateSavedSearch)
+				savedSearches.DELETE("/:id", savedSearchHandler.DeleteSavedSearch)
+				savedSearches.GET("/:id/results", savedSearchHandler.GetSavedSearchResults)
+				savedSearches.POST("/:id/share", savedSearchHandler.ShareSavedSearch)
+				savedSearches.DELETE("/:id/share", savedSearchHandler.UnshareSavedSearch)
+			}
+
 			// 存储统计
 			protected.GET("/stats/storage", advancedHandler.GetStorageStats)
 
+			// 偏好设置
+			protected.GET("/preferences", preferenceHandler.GetPreferences)
+			protected.PUT("/preferences", preferenceHandler.SetPreferences)
+
 			// 分享功能
 			share := protected.Group("/share")
 			{
@@ -214,6 +343,8 @@ func main() {
 	log.Printf("    POST   /api/v1/batch/delete    - 批量删除")
 	log.Printf("    POST   /api/v1/batch/move      - 批量移动")
 	log.Printf("    POST   /api/v1/batch/copy      - 批量复制")
+	log.Printf("  打包下载:")
+	log.Printf("    POST   /api/v1/download/zip    - 多个文件和文件夹打包为 zip 下载")
 	log.Printf("  高级操作:")
 	log.Printf("    PUT    /api/v1/files/move      - 移动文件")
 	log.Printf("    PUT    /api/v1/files/copy      - 复制文件")
@@ -222,10 +353,27 @@ func main() {
 	log.Printf("    GET    /api/v1/search          - 搜索文件")
 	log.Printf("    GET    /api/v1/files/recent    - 最近文件")
 	log.Printf("    GET    /api/v1/files/filter    - 过滤文件")
+	log.Printf("    GET    /api/v1/saved-searches  - 保存的搜索（智能文件夹）")
+	log.Printf("    POST   /api/v1/saved-searches/:id/share - 共享保存的搜索")
+	log.Printf("  回收站:")
+	log.Printf("    GET    /api/v1/trash           - 列出回收站")
+	log.Printf("    POST   /api/v1/trash/restore   - 恢复条目")
+	log.Printf("    DELETE /api/v1/trash/:id       - 永久删除条目")
+	log.Printf("    DELETE /api/v1/trash           - 清空回收站")
+	log.Printf("  历史版本:")
+	log.Printf("    GET    /api/v1/versions        - 列出文件版本")
+	log.Printf("    POST   /api/v1/versions/restore - 恢复版本")
+	log.Printf("    PUT    /api/v1/versions/policy - 设置保留策略")
+	log.Printf("  压缩和后台任务:")
+	log.Printf("    POST   /api/v1/archives/compress - 创建压缩包")
+	log.Printf("    POST   /api/v1/archives/extract - 解压压缩包")
+	log.Printf("    GET    /api/v1/jobs/:id        - 查询任务进度")
 	log.Printf("  分享功能:")
 	log.Printf("    POST   /api/v1/share/create    - 创建分享")
 	log.Printf("    GET    /api/v1/share/:id       - 访问分享")
 	log.Printf("    DELETE /api/v1/share/:id       - 删除分享")
+	log.Printf("  偏好设置:")
+	log.Printf("    PUT    /api/v1/preferences     - 设置时区")
 	log.Printf("  统计功能:")
 	log.Printf("    GET    /api/v1/stats/storage   - 存储统计")
 
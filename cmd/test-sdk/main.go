@@ -162,7 +162,7 @@ func testDeleteObjectV2(client *tos.ClientV2, ctx context.Context, bucket string
 
 func testWrapper(client *tosClient.TOSClient) {
 	// 测试ListObjects包装器
-	resp, err := client.ListObjects("test/")
+	resp, err := tosClient.ListFiles(client, "test/", tosClient.ListFilesOptions{})
 	if err != nil {
 		fmt.Printf("ListObjects包装器错误: %v\n", err)
 	} else {
@@ -170,7 +170,7 @@ func testWrapper(client *tosClient.TOSClient) {
 	}
 
 	// 测试CreateFolder包装器
-	err = client.CreateFolder("test/wrapper-folder/")
+	err = tosClient.CreateFolder(client, "test/wrapper-folder/")
 	if err != nil {
 		fmt.Printf("CreateFolder包装器错误: %v\n", err)
 	} else {
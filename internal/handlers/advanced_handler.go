@@ -1,29 +1,43 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+	"bkp-drive/pkg/daterange"
+	"bkp-drive/pkg/mimetypes"
+	"bkp-drive/pkg/searchquery"
 	"bkp-drive/pkg/tos"
 )
 
 type AdvancedHandler struct {
-	tosClient *tos.TOSClient
+	store       tos.ObjectStore
+	trash       *services.TrashService
+	versions    *services.VersionService
+	quotas      *services.QuotaService
+	preferences *services.PreferenceService
 }
 
-func NewAdvancedHandler(tosClient *tos.TOSClient) *AdvancedHandler {
+func NewAdvancedHandler(store tos.ObjectStore, trash *services.TrashService, versions *services.VersionService, quotas *services.QuotaService, preferences *services.PreferenceService) *AdvancedHandler {
 	return &AdvancedHandler{
-		tosClient: tosClient,
+		store:       store,
+		trash:       trash,
+		versions:    versions,
+		quotas:      quotas,
+		preferences: preferences,
 	}
 }
 
 // BatchDelete 批量删除文件
 // @Summary      批量删除文件
-// @Description  一次性删除多个文件或文件夹
+// @Description  将多个文件或文件夹移到回收站
 // @Tags         批量操作
 // @Accept       json
 // @Produce      json
@@ -42,15 +56,20 @@ func (h *AdvancedHandler) BatchDelete(c *gin.Context) {
 		return
 	}
 
-	result, err := h.tosClient.BatchDeleteObjects(req.Items)
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	keys, err := scope.keys(req.Items)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		badPath(c, err)
 		return
 	}
 
+	result := h.trash.TrashBatch(scope.userID, keys)
+	result.FailedItems = scope.stripAll(result.FailedItems)
+
 	if result.Success {
 		c.JSON(http.StatusOK, result)
 	} else {
@@ -69,7 +88,24 @@ func (h *AdvancedHandler) BatchMove(c *gin.Context) {
 		return
 	}
 
-	result, err := h.tosClient.BatchMoveObjects(req.Items, req.Destination)
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	keys, err := scope.keys(req.Items)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	destination, err := scope.folder(req.Destination)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	result, err := tos.BatchMoveObjects(h.store, keys, destination, h.snapshotFunc(scope))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -78,6 +114,8 @@ func (h *AdvancedHandler) BatchMove(c *gin.Context) {
 		return
 	}
 
+	result.FailedItems = scope.stripAll(result.FailedItems)
+
 	if result.Success {
 		c.JSON(http.StatusOK, result)
 	} else {
@@ -96,7 +134,28 @@ func (h *AdvancedHandler) BatchCopy(c *gin.Context) {
 		return
 	}
 
-	result, err := h.tosClient.BatchCopyObjects(req.Items, req.Destination)
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	keys, err := scope.keys(req.Items)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	destination, err := scope.folder(req.Destination)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	if !checkQuota(c, h.quotas.CheckCopy(scope.userID, keys)) {
+		return
+	}
+
+	result, err := tos.BatchCopyObjects(h.store, keys, destination, h.snapshotFunc(scope))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -105,6 +164,8 @@ func (h *AdvancedHandler) BatchCopy(c *gin.Context) {
 		return
 	}
 
+	result.FailedItems = scope.stripAll(result.FailedItems)
+
 	if result.Success {
 		c.JSON(http.StatusOK, result)
 	} else {
@@ -123,7 +184,37 @@ func (h *AdvancedHandler) MoveFile(c *gin.Context) {
 		return
 	}
 
-	if err := h.tosClient.MoveObject(req.Source, req.Destination); err != nil {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	sourceKey, err := scope.key(req.Source)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	destKey, err := scope.key(req.Destination)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	folder, ok := isFolder(c, h.store, sourceKey)
+	if !ok {
+		return
+	}
+	if folder {
+		result, err := tos.MoveFolder(h.store, sourceKey, destKey, h.snapshotFunc(scope))
+		folderResult(c, scope, result, err)
+		return
+	}
+
+	if !h.snapshot(c, scope, sourceKey, destKey) {
+		return
+	}
+	if err := tos.MoveObject(h.store, sourceKey, destKey); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   err.Error(),
@@ -150,7 +241,40 @@ func (h *AdvancedHandler) CopyFile(c *gin.Context) {
 		return
 	}
 
-	if err := h.tosClient.CopyObject(req.Source, req.Destination); err != nil {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	sourceKey, err := scope.key(req.Source)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	destKey, err := scope.key(req.Destination)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	folder, ok := resolveSource(c, h.store, sourceKey)
+	if !ok {
+		return
+	}
+	if !checkQuota(c, h.quotas.CheckCopy(scope.userID, []string{sourceKey})) {
+		return
+	}
+	if folder {
+		result, err := tos.CopyFolder(h.store, sourceKey, destKey, h.snapshotFunc(scope))
+		folderResult(c, scope, result, err)
+		return
+	}
+
+	if !h.snapshot(c, scope, sourceKey, destKey) {
+		return
+	}
+	if err := h.store.CopyObject(sourceKey, destKey); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   err.Error(),
@@ -177,7 +301,37 @@ func (h *AdvancedHandler) RenameFile(c *gin.Context) {
 		return
 	}
 
-	if err := h.tosClient.RenameObject(req.OldKey, req.NewKey); err != nil {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	sourceKey, err := scope.key(req.OldKey)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	destKey, err := scope.key(req.NewKey)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	folder, ok := isFolder(c, h.store, sourceKey)
+	if !ok {
+		return
+	}
+	if folder {
+		result, err := tos.MoveFolder(h.store, sourceKey, destKey, h.snapshotFunc(scope))
+		folderResult(c, scope, result, err)
+		return
+	}
+
+	if !h.snapshot(c, scope, sourceKey, destKey) {
+		return
+	}
+	if err := tos.RenameObject(h.store, sourceKey, destKey); err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
 			Error:   err.Error(),
@@ -193,24 +347,60 @@ func (h *AdvancedHandler) RenameFile(c *gin.Context) {
 	})
 }
 
+// snapshot 目标文件将被覆盖时保存为历史版本，失败时直接写入500响应
+func (h *AdvancedHandler) snapshot(c *gin.Context, scope *userScope, sourceKey, destKey string) bool {
+	if sourceKey == destKey {
+		return true
+	}
+	if err := h.versions.Snapshot(scope.userID, destKey); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// snapshotFunc 文件夹和批量操作覆盖目标中已存在的文件前保存历史版本
+func (h *AdvancedHandler) snapshotFunc(scope *userScope) tos.SnapshotFunc {
+	return func(key string) error {
+		return h.versions.Snapshot(scope.userID, key)
+	}
+}
+
 // SearchFiles 搜索文件
 // @Summary      搜索文件
 // @Description  根据查询条件搜索文件，支持文件名、文件类型等多种筛选条件
 // @Tags         搜索功能
 // @Accept       json
 // @Produce      json
-// @Param        q          query     string  false  "搜索关键词"
+// @Param        q          query     string  false  "搜索条件，如 report type:pdf size:>10MB modified:<2026-01-01 in:projects/ -tag:draft sort:size，语法见 README"
 // @Param        folder     query     string  false  "搜索的文件夹"
 // @Param        fileType   query     string  false  "文件类型过滤"
+// @Param        startDate  query     string  false  "修改时间不早于该日期的开始，如 2026-01-01、this-month，按用户时区计算"
+// @Param        endDate    query     string  false  "修改时间不晚于该日期的结束（包括当天），如 2026-01-31、yesterday"
 // @Param        limit      query     int     false  "返回结果数量限制"
+// @Param        content    query     bool    false  "在文件内容（文本、Markdown、代码、PDF、docx）中搜索关键词，结果按相关度排序并带摘要，需要开启元数据索引"
 // @Success      200        {object}  models.SearchResponse
+// @Failure      400        {object}  models.ErrorResponse
 // @Failure      500        {object}  models.ErrorResponse
 // @Router       /search [get]
 func (h *AdvancedHandler) SearchFiles(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	folder, err := scope.folder(c.Query("folder"))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
 	// 从URL参数构建搜索请求
 	req := &models.SearchRequest{
-		Query:     c.Query("q"),
-		Folder:    c.Query("folder"),
+		Folder:    folder,
 	}
 
 	// 处理文件类型过滤
@@ -230,9 +420,25 @@ func (h *AdvancedHandler) SearchFiles(c *gin.Context) {
 		}
 	}
 
-	// 处理时间范围
-	req.StartDate = c.Query("startDate")
-	req.EndDate = c.Query("endDate")
+	// 处理时间范围，相对日期和日期的起止按用户时区计算
+	now, ok := userNow(c, h.preferences, scope)
+	if !ok {
+		return
+	}
+	if startDate := c.Query("startDate"); startDate != "" {
+		r, ok := parseTimeRange(c, "startDate", startDate, now)
+		if !ok {
+			return
+		}
+		req.Modified.Start = r.Start
+	}
+	if endDate := c.Query("endDate"); endDate != "" {
+		r, ok := parseTimeRange(c, "endDate", endDate, now)
+		if !ok {
+			return
+		}
+		req.Modified.End = r.End
+	}
 
 	// 处理限制
 	if limit := c.Query("limit"); limit != "" {
@@ -241,7 +447,34 @@ func (h *AdvancedHandler) SearchFiles(c *gin.Context) {
 		}
 	}
 
-	result, err := h.tosClient.SearchObjects(req)
+	// 全文检索
+	content, _ := strconv.ParseBool(c.DefaultQuery("content", "false"))
+	if err := services.ApplySearchQuery(req, c.Query("q"), content, now); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if content {
+		if req.Query == "" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "全文检索需要提供搜索关键词",
+			})
+			return
+		}
+		if !tos.SupportsContentSearch(h.store, folder) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "全文检索需要开启元数据索引",
+			})
+			return
+		}
+		req.Content = true
+	}
+
+	result, err := tos.SearchObjects(h.store, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -250,12 +483,26 @@ func (h *AdvancedHandler) SearchFiles(c *gin.Context) {
 		return
 	}
 
+	scope.stripResults(result.Results)
+	result.Query = c.Query("q")
 	c.JSON(http.StatusOK, result)
 }
 
-// GetStorageStats 获取存储空间统计
+// GetStorageStats 获取当前用户的存储空间统计
+// @Summary      存储统计
+// @Description  统计当前用户的文件数量和类型分布，以及占用空间（包括回收站和历史版本）和配额，totalSpace 为 0 表示不限制
+// @Tags         统计功能
+// @Produce      json
+// @Success      200  {object}  models.StorageStats
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /stats/storage [get]
 func (h *AdvancedHandler) GetStorageStats(c *gin.Context) {
-	stats, err := h.tosClient.GetStorageStats()
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	stats, err := tos.GetStorageStats(h.store, scope.prefix)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -264,6 +511,22 @@ func (h *AdvancedHandler) GetStorageStats(c *gin.Context) {
 		return
 	}
 
+	usage, err := h.quotas.Usage(scope.userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	stats.TotalSpace = usage.Quota
+	stats.UsedSpace = usage.UsedSize
+	stats.TrashSize = usage.TrashSize
+	stats.VersionSize = usage.VersionSize
+	if usage.Quota > 0 {
+		stats.FreeSpace = max(usage.Quota-usage.UsedSize, 0)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "获取存储统计成功",
@@ -271,7 +534,17 @@ func (h *AdvancedHandler) GetStorageStats(c *gin.Context) {
 	})
 }
 
-// GetRecentFiles 获取最近访问的文件
+// GetRecentFiles 获取最近修改的文件
+// @Summary      最近文件
+// @Description  按修改时间从新到旧列出文件，time 限制修改时间范围（语法同 /files/filter）
+// @Tags         搜索功能
+// @Produce      json
+// @Param        limit  query     int     false  "返回数量（默认20）"
+// @Param        time   query     string  false  "修改时间范围，如 today、this-week、last-7-days、2026-01-01..2026-01-31"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      400    {object}  models.ErrorResponse
+// @Failure      500    {object}  models.ErrorResponse
+// @Router       /files/recent [get]
 func (h *AdvancedHandler) GetRecentFiles(c *gin.Context) {
 	limit := 20 // 默认20个
 	if l := c.Query("limit"); l != "" {
@@ -280,12 +553,28 @@ func (h *AdvancedHandler) GetRecentFiles(c *gin.Context) {
 		}
 	}
 
-	// 使用搜索功能，按修改时间排序
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	// 使用搜索功能，按修改时间排序（最新的在前面）
 	req := &models.SearchRequest{
-		Limit: limit,
+		Folder: scope.prefix,
+		Limit:  limit,
+		Sort:   []searchquery.Sort{{Field: searchquery.SortModified, Desc: true}},
+	}
+	if timeRange := c.Query("time"); timeRange != "" {
+		now, ok := userNow(c, h.preferences, scope)
+		if !ok {
+			return
+		}
+		if req.Modified, ok = parseTimeRange(c, "time", timeRange, now); !ok {
+			return
+		}
 	}
 
-	result, err := h.tosClient.SearchObjects(req)
+	result, err := tos.SearchObjects(h.store, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -294,12 +583,10 @@ func (h *AdvancedHandler) GetRecentFiles(c *gin.Context) {
 		return
 	}
 
-	// 按修改时间排序（最新的在前面）
+	scope.stripResults(result.Results)
 	files := result.Results
-	for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
-		if files[i].LastModified.Before(files[j].LastModified) {
-			files[i], files[j] = files[j], files[i]
-		}
+	if files == nil {
+		files = []models.ExtendedFileInfo{}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -311,27 +598,49 @@ func (h *AdvancedHandler) GetRecentFiles(c *gin.Context) {
 }
 
 // FilterFiles 按条件过滤文件
+// @Summary      过滤文件
+// @Description  按分类、大小和修改时间过滤文件，time 按用户时区计算：today、yesterday、this-week、last-week、this-month、last-month、this-year、last-year、last-N-days、日期（2026-01-01、2026-01、2026）或范围（a..b，包括两端）
+// @Tags         搜索功能
+// @Produce      json
+// @Param        type    query     string  false  "分类：image、video、audio、document、archive、code、other"
+// @Param        size    query     string  false  "small（<10MB）、medium、large（>100MB）"
+// @Param        time    query     string  false  "修改时间范围，如 today、this-week、last-7-days、2026-01-01..2026-01-31"
+// @Param        folder  query     string  false  "过滤的文件夹"
+// @Success      200     {object}  models.SearchResponse
+// @Failure      400     {object}  models.ErrorResponse
+// @Failure      500     {object}  models.ErrorResponse
+// @Router       /files/filter [get]
 func (h *AdvancedHandler) FilterFiles(c *gin.Context) {
-	fileType := c.Query("type")     // image, video, document, etc.
+	fileType := c.Query("type")     // image, video, audio, document, archive, code, other
 	sizeRange := c.Query("size")    // small, medium, large
-	timeRange := c.Query("time")    // today, week, month, year
-	folder := c.Query("folder")
+	timeRange := c.Query("time")    // today, this-week, last-7-days, 2026-01-01..2026-01-31 等
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	folder, err := scope.folder(c.Query("folder"))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
 
 	req := &models.SearchRequest{
 		Folder: folder,
 		Limit:  100,
 	}
 
-	// 根据文件类型过滤
-	switch fileType {
-	case "image":
-		req.FileTypes = []string{"image"}
-	case "video":
-		req.FileTypes = []string{"video"}
-	case "document":
-		req.FileTypes = []string{"application/pdf", "text", "application/msword", "application/vnd.openxmlformats"}
-	case "audio":
-		req.FileTypes = []string{"audio"}
+	// 根据文件分类过滤
+	if fileType != "" {
+		if !mimetypes.IsCategory(fileType) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   fmt.Sprintf("不支持的文件类型: %s，可选: %s", fileType, strings.Join(mimetypes.Categories, ", ")),
+			})
+			return
+		}
+		req.FileTypes = []string{fileType}
 	}
 
 	// 根据大小范围过滤
@@ -345,20 +654,18 @@ func (h *AdvancedHandler) FilterFiles(c *gin.Context) {
 		req.MinSize = 100 * 1024 * 1024 // 100MB
 	}
 
-	// 根据时间范围过滤
-	now := gin.H{}
-	switch timeRange {
-	case "today":
-		req.StartDate = now["today"].(string)
-	case "week":
-		req.StartDate = now["week"].(string)
-	case "month":
-		req.StartDate = now["month"].(string)
-	case "year":
-		req.StartDate = now["year"].(string)
+	// 根据时间范围过滤，按用户时区计算
+	if timeRange != "" {
+		now, ok := userNow(c, h.preferences, scope)
+		if !ok {
+			return
+		}
+		if req.Modified, ok = parseTimeRange(c, "time", timeRange, now); !ok {
+			return
+		}
 	}
 
-	result, err := h.tosClient.SearchObjects(req)
+	result, err := tos.SearchObjects(h.store, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -367,9 +674,23 @@ func (h *AdvancedHandler) FilterFiles(c *gin.Context) {
 		return
 	}
 
+	scope.stripResults(result.Results)
 	c.JSON(http.StatusOK, result)
 }
 
+// parseTimeRange 按 pkg/daterange 的语法解析参数 name 的时间范围，失败时直接写入400响应
+func parseTimeRange(c *gin.Context, name, value string, now time.Time) (daterange.Range, bool) {
+	r, err := daterange.Parse(value, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   fmt.Sprintf("%s 的值无效 %q: %v", name, value, err),
+		})
+		return r, false
+	}
+	return r, true
+}
+
 // 辅助函数
 func min(a, b int) int {
 	if a < b {
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+	"bkp-drive/pkg/tos"
+)
+
+// ArchiveHandler 压缩包的创建和解压
+type ArchiveHandler struct {
+	archives *services.ArchiveService
+}
+
+func NewArchiveHandler(archives *services.ArchiveService) *ArchiveHandler {
+	return &ArchiveHandler{
+		archives: archives,
+	}
+}
+
+// Compress 将文件和文件夹打包成压缩包
+// @Summary      创建压缩包
+// @Description  在后台将选中的文件和文件夹（递归）打包成 zip、tar 或 tar.gz 保存到 outputName，outputName 缺少扩展名时自动补上；返回任务，通过 /jobs/{id} 查询进度和结果路径
+// @Tags         压缩解压
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.CompressRequest  true  "压缩请求"
+// @Success      202      {object}  models.JobResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Router       /archives/compress [post]
+func (h *ArchiveHandler) Compress(c *gin.Context) {
+	var req models.CompressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+	keys, err := scope.keys(req.Items)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+	outputKey, err := scope.key(req.OutputName)
+	if err == nil && strings.HasSuffix(outputKey, "/") {
+		err = errors.New("压缩包名称不能以 / 结尾")
+	}
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	job, err := h.archives.Compress(scope.userID, keys, outputKey, req.Format)
+	if err != nil {
+		archiveError(c, err)
+		return
+	}
+	jobAccepted(c, scope, job)
+}
+
+// Extract 解压存储中的压缩包
+// @Summary      解压压缩包
+// @Description  在后台将 zip、tar、tar.gz 或 tar.zst 解压到 outputPath，为空时解压到压缩包旁边的同名文件夹；
+// @Description  已存在的同名文件按 onConflict 处理：rename（默认）、overwrite 或 fail。包含 .. 或绝对路径、超过大小/文件数/压缩比限制的压缩包会被拒绝
+// @Tags         压缩解压
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.ExtractRequest  true  "解压请求"
+// @Success      202      {object}  models.JobResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Router       /archives/extract [post]
+func (h *ArchiveHandler) Extract(c *gin.Context) {
+	var req models.ExtractRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+	archiveKey, err := scope.key(req.ArchiveKey)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+	outputFolder := ""
+	if req.OutputPath != "" {
+		if outputFolder, err = scope.folder(req.OutputPath); err != nil {
+			badPath(c, err)
+			return
+		}
+	}
+
+	job, err := h.archives.Extract(scope.userID, archiveKey, outputFolder, req.OnConflict)
+	if err != nil {
+		archiveError(c, err)
+		return
+	}
+	jobAccepted(c, scope, job)
+}
+
+// DownloadZip 将多个文件和文件夹打包为 zip 下载
+// @Summary      打包下载
+// @Description  边读取边压缩输出 zip，不落盘也不在内存中缓存整个压缩包；文件夹递归打包并保留相对路径，超过4GB时使用 ZIP64，文件名使用 UTF-8
+// @Tags         文件操作
+// @Accept       json
+// @Produce      application/zip
+// @Param        request  body      models.DownloadZipRequest  true  "打包下载请求"
+// @Success      200      {file}    binary  "zip 内容"
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Router       /download/zip [post]
+func (h *ArchiveHandler) DownloadZip(c *gin.Context) {
+	var req models.DownloadZipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+	keys, err := scope.keys(req.Items)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	// 开始输出后无法再返回错误状态码，先列出所有条目
+	entries, err := h.archives.CollectEntries(keys)
+	if err != nil {
+		archiveError(c, err)
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "download"
+		if len(keys) == 1 {
+			name = path.Base(strings.TrimSuffix(keys[0], "/"))
+		}
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Status(http.StatusOK)
+
+	if err := h.archives.WriteArchive(c.Writer, services.ArchiveZip, entries, nil); err != nil {
+		// 响应已经开始，无法再返回错误；缺少中央目录的 zip 会被客户端识别为损坏
+		log.Printf("打包下载失败: %v", err)
+		c.Abort()
+	}
+}
+
+func archiveError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrUnsupportedArchiveFormat), errors.Is(err, services.ErrEmptyArchive),
+		errors.Is(err, services.ErrInvalidConflictPolicy):
+		status = http.StatusBadRequest
+	case errors.Is(err, tos.ErrObjectNotFound):
+		status = http.StatusNotFound
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/tos"
+)
+
+// serveObject 输出对象内容，支持 Range（含多段）、If-None-Match、If-Modified-Since 和 If-Range，
+// 只有被请求的字节范围会从存储后端读取
+func serveObject(c *gin.Context, store tos.ObjectStore, key, filename string) {
+	info, err := store.HeadObject(key)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{
+			Success: false,
+			Error:   "文件下载失败: " + err.Error(),
+		})
+		return
+	}
+
+	content := tos.NewObjectReadSeeker(store, key, info.Size)
+	defer content.Close()
+
+	header := c.Writer.Header()
+	header.Set("Content-Description", "File Transfer")
+	header.Set("Content-Disposition", "attachment; filename="+filename)
+	header.Set("Content-Type", info.ContentType)
+	header.Set("Accept-Ranges", "bytes")
+	if info.ETag != "" {
+		header.Set("ETag", `"`+info.ETag+`"`)
+	}
+
+	http.ServeContent(c.Writer, c.Request, filename, info.LastModified, content)
+}
@@ -1,10 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -12,16 +12,27 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
 	"bkp-drive/pkg/tos"
 )
 
 type FileHandler struct {
-	tosClient *tos.TOSClient
+	store         tos.ObjectStore
+	trash         *services.TrashService
+	versions      *services.VersionService
+	quotas        *services.QuotaService
+	savedSearches *services.SavedSearchService
+	preferences   *services.PreferenceService
 }
 
-func NewFileHandler(tosClient *tos.TOSClient) *FileHandler {
+func NewFileHandler(store tos.ObjectStore, trash *services.TrashService, versions *services.VersionService, quotas *services.QuotaService, savedSearches *services.SavedSearchService, preferences *services.PreferenceService) *FileHandler {
 	return &FileHandler{
-		tosClient: tosClient,
+		store:         store,
+		trash:         trash,
+		versions:      versions,
+		quotas:        quotas,
+		savedSearches: savedSearches,
+		preferences:   preferences,
 	}
 }
 
@@ -35,6 +46,7 @@ func NewFileHandler(tosClient *tos.TOSClient) *FileHandler {
 // @Param        folder   formData  string  false "目标文件夹路径"
 // @Success      200      {object}  models.UploadResponse
 // @Failure      400      {object}  models.ErrorResponse
+// @Failure      413      {object}  models.ErrorResponse
 // @Failure      500      {object}  models.ErrorResponse
 // @Router       /upload [post]
 func (h *FileHandler) UploadFile(c *gin.Context) {
@@ -48,9 +60,36 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 	defer file.Close()
 
-	folder := c.DefaultPostForm("folder", "")
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if _, err := cleanUserPath(header.Filename); err != nil {
+		badPath(c, err)
+		return
+	}
+
+	folder, err := scope.folder(c.DefaultPostForm("folder", ""))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	if !checkQuota(c, h.quotas.Check(scope.userID, header.Size)) {
+		return
+	}
 	
-	result, err := h.tosClient.UploadFile(file, header, folder)
+	// 同名文件被覆盖前保存为历史版本
+	if err := h.versions.Snapshot(scope.userID, strings.TrimSuffix(folder, "/")+"/"+header.Filename); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := tos.UploadFile(h.store, file, header, folder)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -64,23 +103,68 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		return
 	}
 
+	result.Key = scope.strip(result.Key)
 	c.JSON(http.StatusOK, result)
 }
 
 // ListFiles 列出文件和文件夹
 // @Summary      列出文件
-// @Description  列出指定前缀下的文件和文件夹
+// @Description  分页列出指定前缀下的文件和文件夹，hasMore 为 true 时将 nextToken 作为 token 参数获取下一页；根目录的第一页同时返回保存的搜索（smartFolders），以其 path 作为 prefix 时返回实时的搜索结果
 // @Tags         文件操作
 // @Accept       json
 // @Produce      json
-// @Param        prefix   query     string  false  "文件夹前缀路径"
+// @Param        prefix        query     string  false  "文件夹前缀路径"
+// @Param        pageSize      query     int     false  "每页条目数（默认1000，最大1000）"
+// @Param        token         query     string  false  "上一页返回的 nextToken"
+// @Param        sortBy        query     string  false  "排序字段：name（默认）、size、modified"
+// @Param        order         query     string  false  "asc（默认）或 desc"
+// @Param        foldersFirst  query     bool    false  "文件夹置顶"
 // @Success      200      {object}  models.ListResponse
+// @Failure      400      {object}  models.ErrorResponse
 // @Failure      500      {object}  models.ErrorResponse
 // @Router       /files [get]
 func (h *FileHandler) ListFiles(c *gin.Context) {
-	prefix := c.DefaultQuery("prefix", "")
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	// 智能文件夹，没有对应的搜索时按普通文件夹列出
+	if id, ok := services.SmartFolderID(c.Query("prefix")); ok {
+		search, err := h.savedSearches.Get(scope.userID, id)
+		if err == nil {
+			h.listSmartFolder(c, scope, search)
+			return
+		}
+		if !errors.Is(err, services.ErrSavedSearchNotFound) {
+			savedSearchError(c, err)
+			return
+		}
+	}
+
+	prefix, err := scope.folder(c.DefaultQuery("prefix", ""))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
 	
-	result, err := h.tosClient.ListObjects(prefix)
+	opts, err := listFilesOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := tos.ListFiles(h.store, prefix, opts)
+	if errors.Is(err, tos.ErrInvalidListToken) || errors.Is(err, tos.ErrInvalidSortField) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -94,18 +178,91 @@ func (h *FileHandler) ListFiles(c *gin.Context) {
 		return
 	}
 
+	for i := range result.Files {
+		result.Files[i].Key = scope.strip(result.Files[i].Key)
+	}
+	if prefix == scope.prefix && opts.Token == "" {
+		if result.SmartFolders, err = h.savedSearches.List(scope.userID); err != nil {
+			savedSearchError(c, err)
+			return
+		}
+	}
 	c.JSON(http.StatusOK, result)
 }
 
+// listSmartFolder 以文件列表的形式返回保存的搜索的结果
+func (h *FileHandler) listSmartFolder(c *gin.Context, scope *userScope, search *models.SavedSearch) {
+	now, ok := userNow(c, h.preferences, scope)
+	if !ok {
+		return
+	}
+	result, err := h.savedSearches.Run(search, scope.prefix, now)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+
+	files := make([]models.FileInfo, 0, len(result.Results))
+	for _, r := range result.Results {
+		r.Key = scope.strip(r.Key)
+		files = append(files, r.FileInfo)
+	}
+	c.JSON(http.StatusOK, models.ListResponse{
+		Success: true,
+		Message: "保存的搜索: " + search.Name,
+		Files:   files,
+		Total:   len(files),
+	})
+}
+
+// listFilesOptions 解析文件列表的分页和排序参数
+func listFilesOptions(c *gin.Context) (tos.ListFilesOptions, error) {
+	opts := tos.ListFilesOptions{
+		Token:  c.Query("token"),
+		SortBy: c.Query("sortBy"),
+	}
+
+	if pageSize := c.Query("pageSize"); pageSize != "" {
+		n, err := strconv.Atoi(pageSize)
+		if err != nil || n <= 0 || n > tos.MaxListPageSize {
+			return opts, fmt.Errorf("pageSize 必须在 1 到 %d 之间", tos.MaxListPageSize)
+		}
+		opts.PageSize = n
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, fmt.Errorf("order 只能为 asc 或 desc")
+	}
+
+	if foldersFirst := c.Query("foldersFirst"); foldersFirst != "" {
+		v, err := strconv.ParseBool(foldersFirst)
+		if err != nil {
+			return opts, fmt.Errorf("foldersFirst 必须为布尔值")
+		}
+		opts.FoldersFirst = v
+	}
+
+	return opts, nil
+}
+
 // DownloadFile 下载文件或获取处理后的内容
 // @Summary      下载文件
-// @Description  下载原文件或获取TOS处理后的内容（如缩略图、视频截图等）
+// @Description  下载原文件或获取TOS处理后的内容（如缩略图、视频截图等）；原文件下载支持 Range 和条件请求
 // @Tags         文件操作
 // @Accept       json
 // @Produce      octet-stream
 // @Param        key           path      string  true   "文件路径（URL编码）"
 // @Param        x-tos-process query     string  false  "TOS处理参数，如image/resize,w_128或video/snapshot,t_0,w_128,h_128,f_jpg"
+// @Param        Range         header    string  false  "字节范围，如 bytes=0-1023，支持多段"
+// @Param        If-None-Match header    string  false  "ETag 匹配时返回304"
 // @Success      200           {file}    binary  "文件内容或处理后的内容"
+// @Success      206           {file}    binary  "部分内容"
+// @Success      304           "未修改"
+// @Failure      416           "请求的范围无效"
 // @Failure      400           {object}  models.ErrorResponse
 // @Failure      404           {object}  models.ErrorResponse
 // @Failure      500           {object}  models.ErrorResponse
@@ -120,7 +277,16 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 
-	key = strings.TrimPrefix(key, "/")
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	key, err := scope.key(strings.TrimPrefix(key, "/"))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
 	
 	// 检查是否有TOS处理参数（如图片处理、视频截图等）
 	tosProcess := c.Query("x-tos-process")
@@ -129,8 +295,17 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 	fmt.Printf("DownloadFile - Key: %s, TOS Process: %s\n", key, tosProcess)
 	
 	if tosProcess != "" {
+		processor, ok := h.store.(tos.ProcessedObjectGetter)
+		if !ok {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Success: false,
+				Error:   "当前存储后端不支持内容处理",
+			})
+			return
+		}
+
 		// 如果有TOS处理参数，使用SDK的GetProcessedObject方法（包含正确签名）
-		reader, contentLength, contentType, err := h.tosClient.GetProcessedObject(key, tosProcess)
+		reader, contentLength, contentType, err := processor.GetProcessedObject(key, tosProcess)
 		if err != nil {
 			fmt.Printf("GetProcessedObject 失败: %v\n", err)
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
@@ -162,41 +337,18 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 	
-	reader, contentLength, contentType, err := h.tosClient.GetObject(key)
-	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
-		return
-	}
-	defer reader.Close()
-
-	filename := filepath.Base(key)
-	
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Disposition", "attachment; filename="+filename)
-	c.Header("Content-Type", contentType)
-	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
-
-	_, err = io.Copy(c.Writer, reader)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Success: false,
-			Error:   "文件下载失败: " + err.Error(),
-		})
-		return
-	}
+	serveObject(c, h.store, key, filepath.Base(key))
 }
 
 // DeleteFile 删除文件或文件夹
 // @Summary      删除文件
-// @Description  删除指定的文件或空文件夹
+// @Description  将指定的文件移到回收站；路径以 / 结尾或指向文件夹时将整个文件夹移到回收站，部分失败时返回206
 // @Tags         文件操作
 // @Accept       json
 // @Produce      json
 // @Param        key   path      string  true  "要删除的文件路径（URL编码）"
 // @Success      200   {object}  models.DeleteResponse
+// @Success      206   {object}  models.BatchOperationResponse
 // @Failure      400   {object}  models.ErrorResponse
 // @Failure      500   {object}  models.ErrorResponse
 // @Router       /files/{key} [delete]
@@ -210,9 +362,26 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 		return
 	}
 
-	key = strings.TrimPrefix(key, "/")
-	
-	err := h.tosClient.DeleteObject(key)
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	key, err := scope.key(strings.TrimPrefix(key, "/"))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	folder, ok := isFolder(c, h.store, key)
+	if !ok {
+		return
+	}
+	result, err := h.trash.Trash(scope.userID, key, folder)
+	if folder {
+		folderResult(c, scope, result, err)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -223,7 +392,7 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, models.DeleteResponse{
 		Success: true,
-		Message: "文件删除成功",
+		Message: "文件已移到回收站",
 	})
 }
 
@@ -251,7 +420,18 @@ func (h *FileHandler) CreateFolder(c *gin.Context) {
 		return
 	}
 
-	err := h.tosClient.CreateFolder(request.FolderPath)
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	folderKey, err := scope.key(request.FolderPath)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	err = tos.CreateFolder(h.store, folderKey)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -266,71 +446,3 @@ func (h *FileHandler) CreateFolder(c *gin.Context) {
 		"folder":  request.FolderPath,
 	})
 }
-
-// serveProcessedContent 获取TOS处理后的内容并返回给客户端
-func (h *FileHandler) serveProcessedContent(c *gin.Context, key string, tosProcess string) error {
-	// URL编码文件路径，特别是处理包含斜杠的路径
-	encodedKey := url.PathEscape(key)
-	
-	// 构建完整的TOS处理URL
-	tosURL := fmt.Sprintf("https://%s.%s/%s?x-tos-process=%s", 
-		h.tosClient.GetBucketName(), 
-		h.tosClient.GetEndpoint(), 
-		encodedKey, 
-		tosProcess)
-	
-	// 添加详细调试日志
-	fmt.Printf("获取TOS处理内容:\n")
-	fmt.Printf("  原始Key: %s\n", key)
-	fmt.Printf("  编码后Key: %s\n", encodedKey)
-	fmt.Printf("  处理参数: %s\n", tosProcess)
-	fmt.Printf("  完整URL: %s\n", tosURL)
-	
-	// 创建HTTP客户端请求TOS处理后的内容
-	resp, err := http.Get(tosURL)
-	if err != nil {
-		fmt.Printf("  HTTP请求失败: %v\n", err)
-		return fmt.Errorf("请求TOS处理内容失败: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	fmt.Printf("  HTTP响应状态: %d %s\n", resp.StatusCode, resp.Status)
-	fmt.Printf("  Content-Type: %s\n", resp.Header.Get("Content-Type"))
-	fmt.Printf("  Content-Length: %s\n", resp.Header.Get("Content-Length"))
-	
-	// 检查响应状态码
-	if resp.StatusCode != 200 {
-		fmt.Printf("  TOS处理请求失败，状态码: %d\n", resp.StatusCode)
-		return fmt.Errorf("TOS处理请求失败，状态码: %d", resp.StatusCode)
-	}
-	
-	// 设置适当的头部
-	c.Header("Content-Type", resp.Header.Get("Content-Type"))
-	
-	// 将TOS的响应内容流式传输给客户端
-	bytesWritten, err := io.Copy(c.Writer, resp.Body)
-	fmt.Printf("  传输字节数: %d\n", bytesWritten)
-	if err != nil {
-		fmt.Printf("  内容传输失败: %v\n", err)
-	} else {
-		fmt.Printf("  内容传输成功\n")
-	}
-	
-	return err
-}
-
-// redirectToTOSProcessedURL 重定向到TOS处理过的URL（备用方法）
-func (h *FileHandler) redirectToTOSProcessedURL(c *gin.Context, key string, tosProcess string) {
-	// 构建完整的TOS URL
-	tosURL := fmt.Sprintf("https://%s.%s/%s?x-tos-process=%s", 
-		h.tosClient.GetBucketName(), 
-		h.tosClient.GetEndpoint(), 
-		key, 
-		tosProcess)
-	
-	// 添加调试日志
-	fmt.Printf("重定向到TOS处理URL: %s\n", tosURL)
-	
-	// 302重定向到TOS处理URL
-	c.Redirect(http.StatusFound, tosURL)
-}
\ No newline at end of file
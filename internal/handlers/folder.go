@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/tos"
+)
+
+// isFolder 判断完整对象键是否指向文件夹，失败时直接写入500响应
+func isFolder(c *gin.Context, store tos.ObjectStore, key string) (bool, bool) {
+	folder, err := tos.IsFolder(store, key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return false, false
+	}
+	return folder, true
+}
+
+// resolveSource 判断源路径是文件还是文件夹，两者都不存在时写入404响应
+func resolveSource(c *gin.Context, store tos.ObjectStore, key string) (bool, bool) {
+	folder, ok := isFolder(c, store, key)
+	if !ok || folder {
+		return folder, ok
+	}
+	if _, err := store.HeadObject(key); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.ErrorResponse{
+			Success: false,
+			Error:   "源文件不存在: " + err.Error(),
+		})
+		return false, false
+	}
+	return false, true
+}
+
+// folderResult 写入递归文件夹操作的结果，部分失败时返回206和失败的对象
+func folderResult(c *gin.Context, scope *userScope, result *models.BatchOperationResponse, err error) {
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, tos.ErrFolderIntoItself) || errors.Is(err, tos.ErrEmptyFolderPrefix) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result.FailedItems = scope.stripAll(result.FailedItems)
+
+	if result.Success {
+		c.JSON(http.StatusOK, result)
+	} else {
+		c.JSON(http.StatusPartialContent, result)
+	}
+}
@@ -0,0 +1,2284 @@
+package handlers_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/klauspost/compress/zstd"
+
+	"bkp-drive/internal/handlers"
+	"bkp-drive/internal/middleware"
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+	"bkp-drive/pkg/tos"
+)
+
+const testJWTSecret = "handlers-test-secret"
+
+// testServer 使用内存存储驱动完整的 gin 路由
+type testServer struct {
+	t        *testing.T
+	router   *gin.Engine
+	store    *tos.MemoryStore
+	trash    *services.TrashService
+	versions *services.VersionService
+	quotas   quotaStore
+	prefs    *services.PreferenceService
+}
+
+// userDirectory 测试中的用户名即用户ID，只有出现在集合中的用户存在
+type userDirectory map[string]bool
+
+func (d userDirectory) UserID(username string) (string, bool, error) {
+	return username, d[username], nil
+}
+
+// quotaStore 按用户 ID 保存单独设置的配额，未设置的用户不限制
+type quotaStore map[string]int64
+
+func (s quotaStore) UserQuota(userID string) (int64, bool, error) {
+	quota, ok := s[userID]
+	return quota, ok, nil
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWithStore(t, tos.NewMemoryStore())
+}
+
+// newTestServerWithStore 基于已有存储创建服务，用于模拟服务重启
+// 服务使用带元数据索引的存储，直接写入 backend 相当于绕过本服务写入存储
+func newTestServerWithStore(t *testing.T, backend *tos.MemoryStore) *testServer {
+	t.Helper()
+	// 数据库中的索引记录在服务重启后仍然存在
+	index := tos.NewMemoryIndex()
+	for _, prefix := range append([]string{"users/"}, services.UsagePrefixes...) {
+		existing, err := tos.ListAllObjects(backend, prefix)
+		if err != nil {
+			t.Fatalf("列举已有对象失败: %v", err)
+		}
+		for _, obj := range existing {
+			index.PutObject(obj)
+		}
+	}
+	return newTestServerOn(t, backend, tos.NewIndexedStore(presignStore{backend}, index, "users/", services.UsagePrefixes...))
+}
+
+// newUnindexedTestServer 创建不带元数据索引的服务，搜索和统计通过列举存储完成
+func newUnindexedTestServer(t *testing.T) *testServer {
+	t.Helper()
+	backend := tos.NewMemoryStore()
+	return newTestServerOn(t, backend, presignStore{backend})
+}
+
+func newTestServerOn(t *testing.T, backend *tos.MemoryStore, store tos.ObjectStore) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	middleware.InitJWT(testJWTSecret)
+
+	versionService := services.NewVersionService(store, models.VersionPolicy{KeepLast: 10})
+	trashService := services.NewTrashService(store, versionService, services.DefaultTrashRetention)
+	quotas := quotaStore{}
+	quotaService := services.NewQuotaService(store, quotas, 0)
+	preferenceService := services.NewPreferenceService(store, time.UTC)
+	savedSearchService := services.NewSavedSearchService(store, userDirectory{"bkp-alice": true, "bkp-bob": true})
+	fileHandler := handlers.NewFileHandler(store, trashService, versionService, quotaService, savedSearchService, preferenceService)
+	advancedHandler := handlers.NewAdvancedHandler(store, trashService, versionService, quotaService, preferenceService)
+	trashHandler := handlers.NewTrashHandler(trashService)
+	versionHandler := handlers.NewVersionHandler(store, versionService)
+	shareHandler := handlers.NewShareHandler(store)
+	savedSearchHandler := handlers.NewSavedSearchHandler(savedSearchService, preferenceService)
+	preferenceHandler := handlers.NewPreferenceHandler(preferenceService)
+	uploadHandler := handlers.NewUploadHandler(services.NewUploadService(store, versionService, quotaService))
+	tusHandler := handlers.NewTusHandler(services.NewTusService(store, versionService, quotaService))
+	presignHandler := handlers.NewPresignHandler(services.NewPresignService(store, versionService, quotaService))
+	jobService := services.NewJobService()
+	jobHandler := handlers.NewJobHandler(jobService)
+	archiveHandler := handlers.NewArchiveHandler(services.NewArchiveService(store, jobService, versionService, quotaService, services.DefaultExtractLimits))
+
+	r := gin.New()
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthMiddleware())
+	{
+		protected.POST("/upload", fileHandler.UploadFile)
+		protected.GET("/files", fileHandler.ListFiles)
+		protected.GET("/download/*key", fileHandler.DownloadFile)
+		protected.POST("/download/zip", archiveHandler.DownloadZip)
+		protected.DELETE("/files/*key", fileHandler.DeleteFile)
+		protected.POST("/folders", fileHandler.CreateFolder)
+
+		protected.POST("/uploads", uploadHandler.InitiateUpload)
+		protected.GET("/uploads", uploadHandler.ListUploads)
+		protected.GET("/uploads/:sessionId", uploadHandler.GetUpload)
+		protected.PUT("/uploads/:sessionId/parts/:partNumber", uploadHandler.UploadPart)
+		protected.POST("/uploads/:sessionId/complete", uploadHandler.CompleteUpload)
+		protected.DELETE("/uploads/:sessionId", uploadHandler.AbortUpload)
+
+		protected.OPTIONS("/tus/", tusHandler.Options)
+		protected.POST("/tus/", tusHandler.Create)
+		protected.HEAD("/tus/:id", tusHandler.Head)
+		protected.PATCH("/tus/:id", tusHandler.Patch)
+		protected.DELETE("/tus/:id", tusHandler.Delete)
+
+		protected.POST("/presign/upload", presignHandler.PresignUpload)
+		protected.POST("/presign/download", presignHandler.PresignDownload)
+		protected.POST("/presign/complete", presignHandler.CompletePresignedUpload)
+
+		protected.PUT("/files/move", advancedHandler.MoveFile)
+		protected.PUT("/files/copy", advancedHandler.CopyFile)
+		protected.PUT("/files/rename", advancedHandler.RenameFile)
+
+		protected.POST("/batch/delete", advancedHandler.BatchDelete)
+		protected.POST("/batch/move", advancedHandler.BatchMove)
+		protected.POST("/batch/copy", advancedHandler.BatchCopy)
+
+		protected.GET("/trash", trashHandler.ListTrash)
+		protected.POST("/trash/restore", trashHandler.RestoreTrash)
+		protected.DELETE("/trash", trashHandler.EmptyTrash)
+		protected.DELETE("/trash/:id", trashHandler.DeleteTrashItem)
+
+		protected.GET("/versions", versionHandler.ListVersions)
+		protected.GET("/versions/download", versionHandler.DownloadVersion)
+		protected.POST("/versions/restore", versionHandler.RestoreVersion)
+		protected.DELETE("/versions", versionHandler.DeleteVersion)
+		protected.GET("/versions/policy", versionHandler.GetVersionPolicy)
+		protected.PUT("/versions/policy", versionHandler.SetVersionPolicy)
+
+		protected.POST("/archives/compress", archiveHandler.Compress)
+		protected.POST("/archives/extract", archiveHandler.Extract)
+		protected.GET("/jobs", jobHandler.ListJobs)
+		protected.GET("/jobs/:id", jobHandler.GetJob)
+
+		protected.GET("/search", advancedHandler.SearchFiles)
+		protected.GET("/files/recent", advancedHandler.GetRecentFiles)
+		protected.GET("/files/filter", advancedHandler.FilterFiles)
+
+		protected.GET("/saved-searches", savedSearchHandler.ListSavedSearches)
+		protected.POST("/saved-searches", savedSearchHandler.CreateSavedSearch)
+		protected.GET("/saved-searches/:id", savedSearchHandler.GetSavedSearch)
+		protected.PUT("/saved-searches/:id", savedSearchHandler.UpdateSavedSearch)
+		protected.DELETE("/saved-searches/:id", savedSearchHandler.DeleteSavedSearch)
+		protected.GET("/saved-searches/:id/results", savedSearchHandler.GetSavedSearchResults)
+		protected.POST("/saved-searches/:id/share", savedSearchHandler.ShareSavedSearch)
+		protected.DELETE("/saved-searches/:id/share", savedSearchHandler.UnshareSavedSearch)
+
+		protected.GET("/stats/storage", advancedHandler.GetStorageStats)
+
+		protected.GET("/preferences", preferenceHandler.GetPreferences)
+		protected.PUT("/preferences", preferenceHandler.SetPreferences)
+
+		protected.POST("/share/create", shareHandler.CreateShare)
+		protected.GET("/share/:shareId/download", shareHandler.DownloadSharedFile)
+		protected.GET("/share/", shareHandler.ListShares)
+	}
+
+	return &testServer{t: t, router: r, store: backend, trash: trashService, versions: versionService, quotas: quotas, prefs: preferenceService}
+}
+
+// presignStore 为内存存储提供假的预签名能力，测试中直接写入存储模拟客户端直传
+type presignStore struct {
+	*tos.MemoryStore
+}
+
+func (presignStore) PresignPutObject(key string, expires time.Duration, contentType string, contentLength int64) (*tos.PresignedRequest, error) {
+	return &tos.PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       "https://storage.example.com/" + key + "?signature=put",
+		Headers:   map[string]string{"Content-Type": contentType, "Content-Length": strconv.FormatInt(contentLength, 10)},
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+func (presignStore) PresignGetObject(key string, expires time.Duration, filename string) (*tos.PresignedRequest, error) {
+	return &tos.PresignedRequest{
+		Method:    http.MethodGet,
+		URL:       "https://storage.example.com/" + key + "?filename=" + url.QueryEscape(filename),
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+func tokenFor(t *testing.T, userID string) string {
+	t.Helper()
+	claims := &middleware.Claims{
+		UserID:   userID,
+		Username: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("签发令牌失败: %v", err)
+	}
+	return token
+}
+
+func (s *testServer) do(userID, method, target string, body io.Reader, contentType string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if userID != "" {
+		req.Header.Set("Authorization", "Bearer "+tokenFor(s.t, userID))
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *testServer) doWithHeaders(userID, method, target string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer "+tokenFor(s.t, userID))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *testServer) doJSON(userID, method, target string, payload interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		s.t.Fatalf("序列化请求失败: %v", err)
+	}
+	return s.do(userID, method, target, bytes.NewReader(data), "application/json")
+}
+
+func (s *testServer) upload(userID, folder, filename, content string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		s.t.Fatalf("创建表单失败: %v", err)
+	}
+	part.Write([]byte(content))
+	if folder != "" {
+		mw.WriteField("folder", folder)
+	}
+	mw.Close()
+	return s.do(userID, http.MethodPost, "/api/v1/upload", &body, mw.FormDataContentType())
+}
+
+func (s *testServer) list(userID, prefix string) models.ListResponse {
+	s.t.Helper()
+	w := s.do(userID, http.MethodGet, "/api/v1/files?prefix="+url.QueryEscape(prefix), nil, "")
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("列出文件失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp models.ListResponse
+	decode(s.t, w, &resp)
+	return resp
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("解析响应失败: %v (%s)", err, w.Body.String())
+	}
+}
+
+func fileKeys(files []models.FileInfo) []string {
+	keys := []string{}
+	for _, f := range files {
+		keys = append(keys, f.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestUploadAndList(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.upload("bkp-alice", "docs", "report.txt", "hello")
+	if w.Code != http.StatusOK {
+		t.Fatalf("上传失败: %d %s", w.Code, w.Body.String())
+	}
+	var upload models.UploadResponse
+	decode(t, w, &upload)
+	if upload.Key != "docs/report.txt" {
+		t.Errorf("upload key = %q, want user-relative key", upload.Key)
+	}
+
+	if _, err := s.store.HeadObject("users/bkp-alice/docs/report.txt"); err != nil {
+		t.Errorf("对象应位于用户前缀下: %v", err)
+	}
+
+	s.upload("bkp-alice", "", "root.txt", "root")
+
+	root := s.list("bkp-alice", "")
+	if got := fileKeys(root.Files); len(got) != 1 || got[0] != "root.txt" {
+		t.Errorf("root files = %v", got)
+	}
+	if len(root.Folders) != 1 || root.Folders[0] != "docs" {
+		t.Errorf("root folders = %v", root.Folders)
+	}
+
+	docs := s.list("bkp-alice", "docs/")
+	if got := fileKeys(docs.Files); len(got) != 1 || got[0] != "docs/report.txt" {
+		t.Errorf("docs files = %v", got)
+	}
+	if docs.Files[0].Size != 5 || docs.Files[0].ETag == "" || docs.Files[0].LastModified.IsZero() {
+		t.Errorf("file info = %+v", docs.Files[0])
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	s := newTestServer(t)
+	for i := 0; i < 5; i++ {
+		s.upload("bkp-alice", "photos", fmt.Sprintf("img-%d.jpg", i), strings.Repeat("x", i+1))
+	}
+	s.upload("bkp-alice", "photos/2026", "a.jpg", "a")
+
+	var names []string
+	token := ""
+	for pages := 1; ; pages++ {
+		w := s.do("bkp-alice", http.MethodGet, "/api/v1/files?prefix=photos/&pageSize=2&sortBy=size&order=desc&foldersFirst=true&token="+url.QueryEscape(token), nil, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("列出第 %d 页失败: %d %s", pages, w.Code, w.Body.String())
+		}
+		var page models.ListResponse
+		decode(t, w, &page)
+		if page.Total > 2 {
+			t.Fatalf("第 %d 页有 %d 条", pages, page.Total)
+		}
+		names = append(names, page.Folders...)
+		for _, f := range page.Files {
+			names = append(names, f.Key)
+		}
+		if !page.HasMore {
+			break
+		}
+		token = page.NextToken
+	}
+
+	want := []string{"2026", "photos/img-4.jpg", "photos/img-3.jpg", "photos/img-2.jpg", "photos/img-1.jpg", "photos/img-0.jpg"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("分页结果 = %v, want %v", names, want)
+	}
+
+	for _, query := range []string{"pageSize=0", "pageSize=5000", "sortBy=color", "order=up", "token=bogus"} {
+		if w := s.do("bkp-alice", http.MethodGet, "/api/v1/files?prefix=photos/&"+query, nil, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "docs", "report.txt", "hello world")
+
+	w := s.do("bkp-alice", http.MethodGet, "/api/v1/download/docs/report.txt", nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("下载失败: %d %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "hello world" {
+		t.Errorf("body = %q", w.Body.String())
+	}
+
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/download/docs/missing.txt", nil, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("下载不存在的文件 status = %d, want 404", w.Code)
+	}
+}
+
+func TestDownloadRangeAndConditional(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "videos", "clip.mp4", "0123456789abcdefghij")
+	target := "/api/v1/download/videos/clip.mp4"
+
+	w := s.do("bkp-alice", http.MethodGet, target, nil, "")
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || w.Header().Get("Accept-Ranges") != "bytes" || etag == "" || lastModified == "" {
+		t.Fatalf("完整下载: %d %v", w.Code, w.Header())
+	}
+
+	w = s.doWithHeaders("bkp-alice", http.MethodGet, target, nil, map[string]string{"Range": "bytes=10-14"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "abcde" || w.Header().Get("Content-Range") != "bytes 10-14/20" {
+		t.Errorf("单段 Range: %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = s.doWithHeaders("bkp-alice", http.MethodGet, target, nil, map[string]string{"Range": "bytes=-3"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "hij" {
+		t.Errorf("后缀 Range: %d %q", w.Code, w.Body.String())
+	}
+
+	w = s.doWithHeaders("bkp-alice", http.MethodGet, target, nil, map[string]string{"Range": "bytes=0-1,18-"})
+	if w.Code != http.StatusPartialContent || !strings.HasPrefix(w.Header().Get("Content-Type"), "multipart/byteranges") {
+		t.Fatalf("多段 Range: %d %v", w.Code, w.Header())
+	}
+	_, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+"="+string(data))
+	}
+	if want := []string{"bytes 0-1/20=01", "bytes 18-19/20=ij"}; strings.Join(parts, ";") != strings.Join(want, ";") {
+		t.Errorf("多段内容 = %v, want %v", parts, want)
+	}
+
+	w = s.doWithHeaders("bkp-alice", http.MethodGet, target, nil, map[string]string{"Range": "bytes=50-60"})
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("越界 Range: %d, want 416", w.Code)
+	}
+
+	w = s.doWithHeaders("bkp-alice", http.MethodGet, target, nil, map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match: %d, want 304", w.Code)
+	}
+	w = s.doWithHeaders("bkp-alice", http.MethodGet, target, nil, map[string]string{"If-Modified-Since": lastModified})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: %d, want 304", w.Code)
+	}
+	w = s.doWithHeaders("bkp-alice", http.MethodGet, target, nil, map[string]string{"If-None-Match": `"stale"`})
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789abcdefghij" {
+		t.Errorf("ETag 不匹配时应返回完整内容: %d", w.Code)
+	}
+
+	// If-Range 不匹配时忽略 Range，返回完整内容
+	w = s.doWithHeaders("bkp-alice", http.MethodGet, target, nil, map[string]string{"Range": "bytes=0-1", "If-Range": `"stale"`})
+	if w.Code != http.StatusOK || w.Body.Len() != 20 {
+		t.Errorf("If-Range 不匹配: %d %d 字节", w.Code, w.Body.Len())
+	}
+}
+
+func TestUserIsolation(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "private", "secret.txt", "alice only")
+
+	if files := s.list("bkp-bob", "private/"); len(files.Files) != 0 {
+		t.Errorf("bob 不应看到 alice 的文件: %v", fileKeys(files.Files))
+	}
+
+	w := s.do("bkp-bob", http.MethodGet, "/api/v1/download/private/secret.txt", nil, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("bob 下载 alice 的文件 status = %d, want 404", w.Code)
+	}
+
+	w = s.do("bkp-bob", http.MethodDelete, "/api/v1/files/private/secret.txt", nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("删除请求失败: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := s.store.HeadObject("users/bkp-alice/private/secret.txt"); err != nil {
+		t.Errorf("bob 的删除不应影响 alice 的文件: %v", err)
+	}
+}
+
+func TestPathTraversalRejected(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "", "secret.txt", "alice only")
+
+	cases := []struct {
+		name string
+		w    *httptest.ResponseRecorder
+	}{
+		{"list parent", s.do("bkp-bob", http.MethodGet, "/api/v1/files?prefix="+url.QueryEscape("../bkp-alice/"), nil, "")},
+		{"list absolute", s.do("bkp-bob", http.MethodGet, "/api/v1/files?prefix="+url.QueryEscape("/users/"), nil, "")},
+		{"upload folder", s.upload("bkp-bob", "../bkp-alice", "x.txt", "x")},
+		{"download", s.do("bkp-bob", http.MethodGet, "/api/v1/download/..%2Fbkp-alice%2Fsecret.txt", nil, "")},
+		{"delete", s.do("bkp-bob", http.MethodDelete, "/api/v1/files/a/../../bkp-alice/secret.txt", nil, "")},
+		{"move", s.doJSON("bkp-bob", http.MethodPut, "/api/v1/files/move", models.MoveRequest{Source: "../bkp-alice/secret.txt", Destination: "stolen.txt"})},
+		{"batch delete", s.doJSON("bkp-bob", http.MethodPost, "/api/v1/batch/delete", models.BatchOperationRequest{Items: []string{"ok.txt", "/users/bkp-alice/secret.txt"}})},
+		{"search folder", s.do("bkp-bob", http.MethodGet, "/api/v1/search?folder=..", nil, "")},
+	}
+	for _, tc := range cases {
+		if tc.w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400 (%s)", tc.name, tc.w.Code, tc.w.Body.String())
+		}
+	}
+
+	if _, err := s.store.HeadObject("users/bkp-alice/secret.txt"); err != nil {
+		t.Errorf("alice 的文件不应被修改: %v", err)
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	s := newTestServer(t)
+	w := s.do("", http.MethodGet, "/api/v1/files", nil, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}
+
+func TestMoveCopyRename(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "", "a.txt", "content")
+
+	w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/move", models.MoveRequest{Source: "a.txt", Destination: "archive/a.txt"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("移动失败: %d %s", w.Code, w.Body.String())
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/copy", models.CopyRequest{Source: "archive/a.txt", Destination: "b.txt"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("复制失败: %d %s", w.Code, w.Body.String())
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/rename", models.RenameRequest{OldKey: "b.txt", NewKey: "c.txt"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("重命名失败: %d %s", w.Code, w.Body.String())
+	}
+
+	if got := fileKeys(s.list("bkp-alice", "").Files); len(got) != 1 || got[0] != "c.txt" {
+		t.Errorf("root files = %v, want [c.txt]", got)
+	}
+	if got := fileKeys(s.list("bkp-alice", "archive/").Files); len(got) != 1 || got[0] != "archive/a.txt" {
+		t.Errorf("archive files = %v, want [archive/a.txt]", got)
+	}
+}
+
+func TestFolderOperations(t *testing.T) {
+	s := newTestServer(t)
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/folders", map[string]string{"folderPath": "docs"}); w.Code != http.StatusOK {
+		t.Fatalf("创建文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	s.upload("bkp-alice", "docs", "a.txt", "a")
+	s.upload("bkp-alice", "docs/sub", "b.txt", "b")
+
+	w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/rename", models.RenameRequest{OldKey: "docs", NewKey: "papers"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("重命名文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	if root := s.list("bkp-alice", ""); len(root.Folders) != 1 || root.Folders[0] != "papers" {
+		t.Errorf("root folders = %v, want [papers]", root.Folders)
+	}
+	if got := fileKeys(s.list("bkp-alice", "papers/sub/").Files); len(got) != 1 || got[0] != "papers/sub/b.txt" {
+		t.Errorf("papers/sub files = %v", got)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/copy", models.CopyRequest{Source: "papers/", Destination: "backup/papers"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("复制文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	var copied models.BatchOperationResponse
+	decode(t, w, &copied)
+	if copied.Processed != 3 {
+		t.Errorf("复制结果 = %+v", copied)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/move", models.MoveRequest{Source: "papers", Destination: "papers/inner"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("移动到子文件夹 status = %d, want 400", w.Code)
+	}
+
+	if w := s.do("bkp-alice", http.MethodDelete, "/api/v1/files/papers/", nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("删除文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	if root := s.list("bkp-alice", ""); len(root.Folders) != 1 || root.Folders[0] != "backup" {
+		t.Errorf("root folders = %v, want [backup]", root.Folders)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/delete", models.BatchOperationRequest{Items: []string{"backup/"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("批量删除文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	if root := s.list("bkp-alice", ""); len(root.Folders) != 0 || len(root.Files) != 0 {
+		t.Errorf("root = %+v, want empty", root)
+	}
+}
+
+func (s *testServer) listTrash(userID string) []models.TrashItem {
+	s.t.Helper()
+	w := s.do(userID, http.MethodGet, "/api/v1/trash", nil, "")
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("列出回收站失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp models.TrashListResponse
+	decode(s.t, w, &resp)
+	return resp.Items
+}
+
+func TestTrashRestore(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "docs", "a.txt", "old")
+	s.upload("bkp-alice", "docs/sub", "b.txt", "b")
+
+	if w := s.do("bkp-alice", http.MethodDelete, "/api/v1/files/docs/a.txt", nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("删除文件失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.do("bkp-alice", http.MethodDelete, "/api/v1/files/docs/sub/", nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("删除文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	if root := s.list("bkp-alice", "docs/"); len(root.Files) != 0 || len(root.Folders) != 0 {
+		t.Errorf("删除后 docs = %+v", root)
+	}
+
+	items := s.listTrash("bkp-alice")
+	if len(items) != 2 {
+		t.Fatalf("回收站条目 = %+v", items)
+	}
+	byPath := map[string]models.TrashItem{}
+	for _, item := range items {
+		byPath[item.OriginalPath] = item
+	}
+	file, folder := byPath["docs/a.txt"], byPath["docs/sub/"]
+	if file.Size != 3 || file.IsFolder || !folder.IsFolder || folder.ExpiresAt == nil {
+		t.Errorf("回收站条目 = %+v", items)
+	}
+	if len(s.listTrash("bkp-bob")) != 0 {
+		t.Error("bob 不应看到 alice 的回收站")
+	}
+
+	// 原路径已被占用：fail 不恢复，默认 rename 恢复为新名称
+	s.upload("bkp-alice", "docs", "a.txt", "new")
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/trash/restore", models.RestoreRequest{Items: []string{file.Key}, OnConflict: "fail"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("fail 策略 status = %d, want 206 (%s)", w.Code, w.Body.String())
+	}
+	w = s.doJSON("bkp-bob", http.MethodPost, "/api/v1/trash/restore", models.RestoreRequest{Items: []string{file.Key}})
+	if w.Code != http.StatusPartialContent {
+		t.Errorf("bob 恢复 alice 的条目 status = %d, want 206", w.Code)
+	}
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/trash/restore", models.RestoreRequest{Items: []string{file.Key, folder.Key}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("恢复失败: %d %s", w.Code, w.Body.String())
+	}
+	var restored models.RestoreResponse
+	decode(t, w, &restored)
+	if restored.Restored[file.Key] != "docs/a (1).txt" || restored.Restored[folder.Key] != "docs/sub/" {
+		t.Errorf("恢复结果 = %+v", restored)
+	}
+	if got := fileKeys(s.list("bkp-alice", "docs/").Files); len(got) != 2 || got[0] != "docs/a (1).txt" || got[1] != "docs/a.txt" {
+		t.Errorf("docs files = %v", got)
+	}
+	if got := fileKeys(s.list("bkp-alice", "docs/sub/").Files); len(got) != 1 || got[0] != "docs/sub/b.txt" {
+		t.Errorf("docs/sub files = %v", got)
+	}
+	if len(s.listTrash("bkp-alice")) != 0 {
+		t.Error("恢复后回收站应为空")
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/trash/restore", models.RestoreRequest{Items: []string{file.Key}, OnConflict: "merge"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("无效的冲突策略 status = %d, want 400", w.Code)
+	}
+}
+
+func TestTrashRestoreOverwriteVersions(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "docs", "a.txt", "old")
+	s.upload("bkp-alice", "docs/sub", "b.txt", "b1")
+	s.do("bkp-alice", http.MethodDelete, "/api/v1/files/docs/a.txt", nil, "")
+	s.do("bkp-alice", http.MethodDelete, "/api/v1/files/docs/sub/", nil, "")
+	keys := []string{}
+	for _, item := range s.listTrash("bkp-alice") {
+		keys = append(keys, item.Key)
+	}
+
+	// 覆盖恢复前原路径上的文件保存为历史版本
+	s.upload("bkp-alice", "docs", "a.txt", "new")
+	s.upload("bkp-alice", "docs/sub", "b.txt", "b2")
+	before := len(s.listVersions("bkp-alice", "docs/a.txt"))
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/trash/restore", models.RestoreRequest{Items: keys, OnConflict: "overwrite"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("覆盖恢复失败: %d %s", w.Code, w.Body.String())
+	}
+
+	if got := s.content("bkp-alice", "docs/a.txt"); got != "old" {
+		t.Errorf("docs/a.txt = %q, want old", got)
+	}
+	versions := s.listVersions("bkp-alice", "docs/a.txt")
+	if len(versions) != before+1 {
+		t.Fatalf("docs/a.txt versions = %+v", versions)
+	}
+	if w := s.do("bkp-alice", http.MethodGet, "/api/v1/versions/download?key=docs/a.txt&versionId="+versions[1].VersionId, nil, ""); w.Body.String() != "new" {
+		t.Errorf("被覆盖的版本内容 = %q, want new", w.Body.String())
+	}
+
+	if got := s.content("bkp-alice", "docs/sub/b.txt"); got != "b1" {
+		t.Errorf("docs/sub/b.txt = %q, want b1", got)
+	}
+	versions = s.listVersions("bkp-alice", "docs/sub/b.txt")
+	if len(versions) < 2 {
+		t.Fatalf("docs/sub/b.txt versions = %+v", versions)
+	}
+	if w := s.do("bkp-alice", http.MethodGet, "/api/v1/versions/download?key=docs/sub/b.txt&versionId="+versions[1].VersionId, nil, ""); w.Body.String() != "b2" {
+		t.Errorf("文件夹内被覆盖的版本内容 = %q, want b2", w.Body.String())
+	}
+}
+
+func TestTrashDeleteAndPurge(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.trash.SetClock(func() time.Time { return now })
+
+	s.upload("bkp-alice", "", "old.txt", "old")
+	s.upload("bkp-alice", "", "one.txt", "one")
+	s.upload("bkp-alice", "", "two.txt", "two")
+	s.do("bkp-alice", http.MethodDelete, "/api/v1/files/old.txt", nil, "")
+
+	now = now.Add(29 * 24 * time.Hour)
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/delete", models.BatchOperationRequest{Items: []string{"one.txt", "two.txt"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("批量删除失败: %d %s", w.Code, w.Body.String())
+	}
+
+	// 只有超过30天的条目被清理
+	now = now.Add(2 * 24 * time.Hour)
+	result, err := s.trash.PurgeExpired()
+	if err != nil || result.Processed != 1 {
+		t.Fatalf("PurgeExpired = %+v, %v", result, err)
+	}
+	items := s.listTrash("bkp-alice")
+	if len(items) != 2 {
+		t.Fatalf("清理后回收站条目 = %+v", items)
+	}
+	if objects, _ := tos.ListAllObjects(s.store, "system/trash/"); len(objects) != 2 {
+		t.Errorf("回收站内容 = %d 个对象, want 2", len(objects))
+	}
+
+	if w := s.do("bkp-alice", http.MethodDelete, "/api/v1/trash/"+items[0].Key, nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("永久删除失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.do("bkp-alice", http.MethodDelete, "/api/v1/trash/"+items[0].Key, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("重复永久删除 status = %d, want 404", w.Code)
+	}
+	if w := s.do("bkp-alice", http.MethodDelete, "/api/v1/trash", nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("清空回收站失败: %d %s", w.Code, w.Body.String())
+	}
+	if objects, _ := tos.ListAllObjects(s.store, "system/trash"); len(objects) != 0 {
+		t.Errorf("清空后仍有对象: %v", objects)
+	}
+}
+
+func (s *testServer) listVersions(userID, key string) []models.FileVersion {
+	s.t.Helper()
+	w := s.do(userID, http.MethodGet, "/api/v1/versions?key="+url.QueryEscape(key), nil, "")
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("列出版本失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp models.VersionListResponse
+	decode(s.t, w, &resp)
+	return resp.Versions
+}
+
+func TestFileVersions(t *testing.T) {
+	s := newTestServer(t)
+	for _, content := range []string{"v1", "v2", "v3"} {
+		s.upload("bkp-alice", "docs", "a.txt", content)
+	}
+
+	versions := s.listVersions("bkp-alice", "docs/a.txt")
+	if len(versions) != 3 || versions[0].VersionId != "current" || !versions[0].IsLatest || versions[1].IsLatest {
+		t.Fatalf("versions = %+v", versions)
+	}
+	v1 := versions[2].VersionId
+
+	w := s.do("bkp-alice", http.MethodGet, "/api/v1/versions/download?key=docs/a.txt&versionId="+v1, nil, "")
+	if w.Code != http.StatusOK || w.Body.String() != "v1" {
+		t.Fatalf("下载历史版本 = %d %q", w.Code, w.Body.String())
+	}
+	if w := s.do("bkp-bob", http.MethodGet, "/api/v1/versions/download?key=docs/a.txt&versionId="+v1, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("bob 下载 alice 的版本 status = %d, want 404", w.Code)
+	}
+
+	// 恢复 v1，被替换的 v3 成为新的历史版本
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/versions/restore", models.RestoreVersionRequest{Key: "docs/a.txt", VersionId: v1})
+	if w.Code != http.StatusOK {
+		t.Fatalf("恢复版本失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.do("bkp-alice", http.MethodGet, "/api/v1/download/docs/a.txt", nil, ""); w.Body.String() != "v1" {
+		t.Errorf("恢复后内容 = %q, want v1", w.Body.String())
+	}
+	if versions = s.listVersions("bkp-alice", "docs/a.txt"); len(versions) != 4 {
+		t.Fatalf("恢复后 versions = %+v", versions)
+	}
+
+	// 复制覆盖已有文件同样保留历史版本
+	s.upload("bkp-alice", "", "b.txt", "other")
+	s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/copy", models.CopyRequest{Source: "b.txt", Destination: "docs/a.txt"})
+	if versions = s.listVersions("bkp-alice", "docs/a.txt"); len(versions) != 5 {
+		t.Fatalf("复制覆盖后 versions = %+v", versions)
+	}
+
+	w = s.do("bkp-alice", http.MethodDelete, "/api/v1/versions?key=docs/a.txt&versionId="+versions[1].VersionId, nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("删除版本失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.do("bkp-alice", http.MethodDelete, "/api/v1/versions?key=docs/a.txt&versionId=current", nil, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("删除当前版本 status = %d, want 400", w.Code)
+	}
+	if versions = s.listVersions("bkp-alice", "docs/a.txt"); len(versions) != 4 {
+		t.Fatalf("删除后 versions = %+v", versions)
+	}
+	if w := s.do("bkp-alice", http.MethodGet, "/api/v1/versions?key=missing.txt", nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的文件 status = %d, want 404", w.Code)
+	}
+}
+
+func TestFolderAndBatchOverwriteVersions(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "docs", "a.txt", "v1")
+	s.upload("bkp-alice", "docs", "b.txt", "b1")
+
+	// 文件夹复制、移动以及批量复制、移动覆盖已有文件时都保留历史版本
+	s.upload("bkp-alice", "src", "a.txt", "v2")
+	if w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/copy", models.CopyRequest{Source: "src", Destination: "docs"}); w.Code != http.StatusOK {
+		t.Fatalf("复制文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	s.upload("bkp-alice", "", "a.txt", "v3")
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/move", models.BatchMoveRequest{Items: []string{"a.txt"}, Destination: "docs"}); w.Code != http.StatusOK {
+		t.Fatalf("批量移动失败: %d %s", w.Code, w.Body.String())
+	}
+	s.upload("bkp-alice", "other", "a.txt", "v4")
+	if w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/move", models.MoveRequest{Source: "other", Destination: "docs"}); w.Code != http.StatusOK {
+		t.Fatalf("移动文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	s.upload("bkp-alice", "", "b.txt", "b2")
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/copy", models.BatchCopyRequest{Items: []string{"b.txt"}, Destination: "docs"}); w.Code != http.StatusOK {
+		t.Fatalf("批量复制失败: %d %s", w.Code, w.Body.String())
+	}
+
+	if got := s.content("bkp-alice", "docs/a.txt"); got != "v4" {
+		t.Errorf("docs/a.txt = %q, want v4", got)
+	}
+	if versions := s.listVersions("bkp-alice", "docs/a.txt"); len(versions) != 4 {
+		t.Errorf("docs/a.txt versions = %+v, want 4", versions)
+	}
+	if versions := s.listVersions("bkp-alice", "docs/b.txt"); len(versions) != 2 {
+		t.Errorf("docs/b.txt versions = %+v, want 2", versions)
+	}
+}
+
+func TestVersionRetentionPolicy(t *testing.T) {
+	s := newTestServer(t)
+	for _, content := range []string{"v1", "v2", "v3", "v4"} {
+		s.upload("bkp-alice", "", "a.txt", content)
+		s.upload("bkp-bob", "", "a.txt", content)
+	}
+
+	w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/versions/policy", models.VersionPolicy{KeepLast: 1, KeepDays: 7})
+	if w.Code != http.StatusOK {
+		t.Fatalf("设置保留策略失败: %d %s", w.Code, w.Body.String())
+	}
+	versions := s.listVersions("bkp-alice", "a.txt")
+	if len(versions) != 2 {
+		t.Fatalf("按 keepLast 清理后 versions = %+v", versions)
+	}
+	if w := s.do("bkp-alice", http.MethodGet, "/api/v1/versions/download?key=a.txt&versionId="+versions[1].VersionId, nil, ""); w.Body.String() != "v3" {
+		t.Errorf("保留的版本内容 = %q, want v3", w.Body.String())
+	}
+	if got := len(s.listVersions("bkp-bob", "a.txt")); got != 4 {
+		t.Errorf("bob 使用默认策略，versions = %d, want 4", got)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPut, "/api/v1/versions/policy", models.VersionPolicy{KeepLast: -1})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("无效的保留策略 status = %d, want 400", w.Code)
+	}
+
+	// 超过 keepDays 的版本由后台任务清理，只影响设置了保留天数的用户
+	s.versions.SetClock(func() time.Time { return time.Now().Add(8 * 24 * time.Hour) })
+	if deleted, err := s.versions.PruneExpired(); err != nil || deleted != 1 {
+		t.Fatalf("PruneExpired = %d, %v", deleted, err)
+	}
+	if got := len(s.listVersions("bkp-alice", "a.txt")); got != 1 {
+		t.Errorf("过期清理后 versions = %d, want 1", got)
+	}
+	if got := len(s.listVersions("bkp-bob", "a.txt")); got != 4 {
+		t.Errorf("bob 的 versions = %d, want 4", got)
+	}
+}
+
+// waitJob 轮询任务直到结束
+func (s *testServer) waitJob(userID string, w *httptest.ResponseRecorder) models.Job {
+	s.t.Helper()
+	if w.Code != http.StatusAccepted {
+		s.t.Fatalf("创建任务失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp models.JobResponse
+	decode(s.t, w, &resp)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		w := s.do(userID, http.MethodGet, "/api/v1/jobs/"+resp.Job.JobId, nil, "")
+		if w.Code != http.StatusOK {
+			s.t.Fatalf("查询任务失败: %d %s", w.Code, w.Body.String())
+		}
+		decode(s.t, w, &resp)
+		if resp.Job.Status == services.JobCompleted || resp.Job.Status == services.JobFailed {
+			return resp.Job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.t.Fatalf("任务 %s 未在期限内结束: %+v", resp.Job.JobId, resp.Job)
+	return resp.Job
+}
+
+func TestCompress(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "docs", "a.txt", "hello")
+	s.upload("bkp-alice", "docs/子目录", "b.txt", "world")
+	s.upload("bkp-alice", "", "c.txt", "root")
+	s.upload("bkp-alice", "other", "c.txt", "other")
+
+	job := s.waitJob("bkp-alice", s.doJSON("bkp-alice", http.MethodPost, "/api/v1/archives/compress", models.CompressRequest{
+		Items:      []string{"docs", "c.txt", "other/c.txt"},
+		OutputName: "out/backup",
+	}))
+	if job.Status != services.JobCompleted || job.ResultKey != "out/backup.zip" {
+		t.Fatalf("job = %+v", job)
+	}
+	if job.Progress.ProcessedFiles != 4 || job.Progress.TotalFiles != 4 || job.Progress.ProcessedBytes != 19 || job.Progress.Percent != 100 {
+		t.Errorf("progress = %+v", job.Progress)
+	}
+
+	w := s.do("bkp-alice", http.MethodGet, "/api/v1/download/out/backup.zip", nil, "")
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("读取 zip 失败: %v", err)
+	}
+	got := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(data)
+	}
+	want := map[string]string{
+		"docs/":          "",
+		"docs/a.txt":     "hello",
+		"docs/子目录/b.txt": "world",
+		"c.txt":          "root",
+		"c (1).txt":      "other",
+	}
+	if len(got) != len(want) {
+		t.Errorf("zip 条目 = %v, want %v", got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("zip 条目 %q = %q, want %q", name, got[name], content)
+		}
+	}
+
+	// tar.gz，覆盖时生成历史版本
+	job = s.waitJob("bkp-alice", s.doJSON("bkp-alice", http.MethodPost, "/api/v1/archives/compress", models.CompressRequest{
+		Items:      []string{"docs/"},
+		OutputName: "out/backup.tar.gz",
+		Format:     "tar.gz",
+	}))
+	if job.Status != services.JobCompleted || job.ResultKey != "out/backup.tar.gz" {
+		t.Fatalf("job = %+v", job)
+	}
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/download/out/backup.tar.gz", nil, "")
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("读取 gzip 失败: %v", err)
+	}
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	if strings.Join(names, ",") != "docs/,docs/a.txt,docs/子目录/b.txt" {
+		t.Errorf("tar 条目 = %v", names)
+	}
+
+	// 其他用户看不到任务，也不能打包别人的文件
+	if w := s.do("bkp-bob", http.MethodGet, "/api/v1/jobs/"+job.JobId, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("bob 查询 alice 的任务 status = %d, want 404", w.Code)
+	}
+	job = s.waitJob("bkp-bob", s.doJSON("bkp-bob", http.MethodPost, "/api/v1/archives/compress", models.CompressRequest{
+		Items:      []string{"docs"},
+		OutputName: "stolen",
+	}))
+	if job.Status != services.JobFailed || job.Error == "" {
+		t.Errorf("打包不存在的文件 job = %+v", job)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/archives/compress", models.CompressRequest{
+		Items:      []string{"docs"},
+		OutputName: "x",
+		Format:     "rar",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("不支持的格式 status = %d, want 400", w.Code)
+	}
+
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/jobs", nil, "")
+	var jobs models.JobListResponse
+	decode(t, w, &jobs)
+	if jobs.Total != 2 {
+		t.Errorf("jobs = %+v", jobs)
+	}
+}
+
+// archiveFile 测试压缩包中的条目，content 为空且名称以 / 结尾表示文件夹
+type archiveFile struct {
+	name    string
+	content string
+	symlink bool
+}
+
+func makeZip(t *testing.T, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		header := &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+		if f.symlink {
+			header.SetMode(os.ModeSymlink | 0o777)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, f.content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func makeTar(t *testing.T, w io.Writer, files []archiveFile) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		header := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		switch {
+		case f.symlink:
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, "/etc/passwd", 0
+		case strings.HasSuffix(f.name, "/"):
+			header.Typeflag = tar.TypeDir
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(tw, f.content)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *testServer) extract(userID string, req models.ExtractRequest) models.Job {
+	s.t.Helper()
+	return s.waitJob(userID, s.doJSON(userID, http.MethodPost, "/api/v1/archives/extract", req))
+}
+
+func (s *testServer) content(userID, key string) string {
+	s.t.Helper()
+	w := s.do(userID, http.MethodGet, "/api/v1/download/"+strings.ReplaceAll(key, " ", "%20"), nil, "")
+	if w.Code != http.StatusOK {
+		return fmt.Sprintf("<%d>", w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestExtract(t *testing.T) {
+	s := newTestServer(t)
+	files := []archiveFile{
+		{name: "dir/"},
+		{name: "dir/b.txt", content: "bbb"},
+		{name: "./a.txt", content: "aaa"},
+		{name: "empty/"},
+		{name: "link", symlink: true},
+	}
+	s.upload("bkp-alice", "in", "pkg.zip", makeZip(t, files))
+
+	job := s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: "in/pkg.zip"})
+	if job.Status != services.JobCompleted || job.ResultKey != "in/pkg/" {
+		t.Fatalf("job = %+v", job)
+	}
+	if job.Progress.ProcessedFiles != 2 || job.Progress.ProcessedBytes != 6 || !strings.Contains(job.Message, "跳过: 1") {
+		t.Errorf("progress = %+v, message = %q", job.Progress, job.Message)
+	}
+	if got := s.content("bkp-alice", "in/pkg/a.txt"); got != "aaa" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if got := s.content("bkp-alice", "in/pkg/dir/b.txt"); got != "bbb" {
+		t.Errorf("dir/b.txt = %q", got)
+	}
+	if got := s.content("bkp-alice", "in/pkg/link"); got != "<404>" {
+		t.Errorf("符号链接不应被解压: %q", got)
+	}
+	if _, err := s.store.HeadObject("users/bkp-alice/in/pkg/empty/"); err != nil {
+		t.Errorf("空文件夹未创建: %v", err)
+	}
+
+	// 默认目标文件夹已存在时另选名称
+	job = s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: "in/pkg.zip"})
+	if job.Status != services.JobCompleted || job.ResultKey != "in/pkg (1)/" {
+		t.Fatalf("再次解压 job = %+v", job)
+	}
+
+	// 解压到已有文件夹：按 onConflict 处理同名文件
+	s.upload("bkp-alice", "out", "a.txt", "old")
+	job = s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: "in/pkg.zip", OutputPath: "out", OnConflict: "fail"})
+	if job.Status != services.JobFailed || s.content("bkp-alice", "out/dir/b.txt") != "<404>" {
+		t.Errorf("fail 策略应在写入前失败: %+v", job)
+	}
+	job = s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: "in/pkg.zip", OutputPath: "out"})
+	if job.Status != services.JobCompleted || s.content("bkp-alice", "out/a.txt") != "old" || s.content("bkp-alice", "out/a (1).txt") != "aaa" {
+		t.Errorf("rename 策略 job = %+v", job)
+	}
+	job = s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: "in/pkg.zip", OutputPath: "out", OnConflict: "overwrite"})
+	if job.Status != services.JobCompleted || s.content("bkp-alice", "out/a.txt") != "aaa" {
+		t.Errorf("overwrite 策略 job = %+v", job)
+	}
+	if versions := s.listVersions("bkp-alice", "out/a.txt"); len(versions) != 2 {
+		t.Errorf("覆盖后应保留历史版本: %+v", versions)
+	}
+
+	// tar.zst
+	var buf bytes.Buffer
+	zw, _ := zstd.NewWriter(&buf)
+	makeTar(t, zw, []archiveFile{{name: "x/"}, {name: "x/y.txt", content: "yyy"}, {name: "link", symlink: true}})
+	zw.Close()
+	s.upload("bkp-alice", "", "z.tar.zst", buf.String())
+	job = s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: "z.tar.zst", OutputPath: "/"})
+	if job.Status != services.JobCompleted || job.ResultKey != "" || s.content("bkp-alice", "x/y.txt") != "yyy" || s.content("bkp-alice", "link") != "<404>" {
+		t.Errorf("tar.zst job = %+v", job)
+	}
+
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/archives/extract", models.ExtractRequest{ArchiveKey: "in/pkg.rar"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("不支持的格式 status = %d, want 400", w.Code)
+	}
+	w = s.doJSON("bkp-bob", http.MethodPost, "/api/v1/archives/extract", models.ExtractRequest{ArchiveKey: "in/pkg.zip"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("解压其他用户的压缩包 status = %d, want 404", w.Code)
+	}
+}
+
+func TestExtractRejectsUnsafeArchives(t *testing.T) {
+	s := newTestServer(t)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	makeTar(t, gz, []archiveFile{{name: "ok.txt", content: "ok"}, {name: "../../bkp-bob/evil.txt", content: "evil"}})
+	gz.Close()
+	s.upload("bkp-alice", "", "slip.tar.gz", buf.String())
+	s.upload("bkp-alice", "", "abs.zip", makeZip(t, []archiveFile{{name: "/etc/evil.txt", content: "evil"}}))
+	s.upload("bkp-alice", "", "bomb.zip", makeZip(t, []archiveFile{{name: "zeros.bin", content: strings.Repeat("\x00", 4<<20)}}))
+
+	for archive, want := range map[string]error{
+		"slip.tar.gz": services.ErrUnsafeArchivePath,
+		"abs.zip":     services.ErrUnsafeArchivePath,
+		"bomb.zip":    services.ErrArchiveTooLarge,
+	} {
+		job := s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: archive, OutputPath: "out"})
+		if job.Status != services.JobFailed || !strings.Contains(job.Error, want.Error()) {
+			t.Errorf("%s job = %+v, want %v", archive, job, want)
+		}
+	}
+	if objects, _ := tos.ListAllObjects(s.store, "users/"); len(objects) != 3 {
+		t.Errorf("被拒绝的压缩包不应写入任何文件: %+v", objects)
+	}
+}
+
+func TestDownloadZip(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "文档", "报告.txt", "report")
+	s.upload("bkp-alice", "文档/sub", "x.txt", "xx")
+	s.upload("bkp-alice", "", "a.txt", "aaa")
+
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/download/zip", models.DownloadZipRequest{Items: []string{"文档/", "a.txt"}})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("打包下载 = %d %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != "attachment; filename=download.zip" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("读取 zip 失败: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.NonUTF8 {
+			t.Errorf("%s 未使用 UTF-8 文件名", f.Name)
+		}
+	}
+	if strings.Join(names, ",") != "文档/,文档/sub/x.txt,文档/报告.txt,a.txt" {
+		t.Errorf("zip 条目 = %v", names)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/download/zip", models.DownloadZipRequest{Items: []string{"文档"}})
+	_, params, _ := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	if w.Code != http.StatusOK || params["filename"] != "文档.zip" {
+		t.Errorf("单个文件夹 = %d, filename = %q", w.Code, params["filename"])
+	}
+
+	w = s.doJSON("bkp-bob", http.MethodPost, "/api/v1/download/zip", models.DownloadZipRequest{Items: []string{"a.txt"}})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("下载其他用户的文件 status = %d, want 404", w.Code)
+	}
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/download/zip", models.DownloadZipRequest{Items: []string{"../bkp-bob/a.txt"}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("路径穿越 status = %d, want 400", w.Code)
+	}
+}
+
+func TestBatchOperations(t *testing.T) {
+	s := newTestServer(t)
+	for _, name := range []string{"1.txt", "2.txt", "3.txt"} {
+		s.upload("bkp-alice", "", name, name)
+	}
+
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/copy", models.BatchCopyRequest{Items: []string{"1.txt", "2.txt"}, Destination: "backup"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("批量复制失败: %d %s", w.Code, w.Body.String())
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/move", models.BatchMoveRequest{Items: []string{"3.txt", "missing.txt"}, Destination: "moved/"})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("批量移动 status = %d, want 206 (%s)", w.Code, w.Body.String())
+	}
+	var moved models.BatchOperationResponse
+	decode(t, w, &moved)
+	if moved.Processed != 1 || moved.Failed != 1 || len(moved.FailedItems) != 1 || moved.FailedItems[0] != "missing.txt" {
+		t.Errorf("批量移动结果 = %+v", moved)
+	}
+
+	// 不以 / 结尾的文件夹（没有文件夹标记对象）同样按文件夹递归处理
+	s.upload("bkp-alice", "docs/sub", "a.txt", "a")
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/copy", models.BatchCopyRequest{Items: []string{"docs"}, Destination: "backup"}); w.Code != http.StatusOK {
+		t.Fatalf("批量复制文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := s.content("bkp-alice", "backup/docs/sub/a.txt"); got != "a" {
+		t.Errorf("批量复制文件夹后的文件 = %q", got)
+	}
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/move", models.BatchMoveRequest{Items: []string{"docs"}, Destination: "moved"}); w.Code != http.StatusOK {
+		t.Fatalf("批量移动文件夹失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := s.content("bkp-alice", "moved/docs/sub/a.txt"); got != "a" {
+		t.Errorf("批量移动文件夹后的文件 = %q", got)
+	}
+	if got := s.content("bkp-alice", "docs/sub/a.txt"); got != "<404>" {
+		t.Errorf("批量移动文件夹后源文件应不存在: %q", got)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/delete", models.BatchOperationRequest{Items: []string{"1.txt", "2.txt"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("批量删除失败: %d %s", w.Code, w.Body.String())
+	}
+
+	if got := fileKeys(s.list("bkp-alice", "").Files); len(got) != 0 {
+		t.Errorf("root files = %v, want none", got)
+	}
+	if got := fileKeys(s.list("bkp-alice", "backup/").Files); len(got) != 2 {
+		t.Errorf("backup files = %v", got)
+	}
+	if got := fileKeys(s.list("bkp-alice", "moved/").Files); len(got) != 1 || got[0] != "moved/3.txt" {
+		t.Errorf("moved files = %v", got)
+	}
+}
+
+func (s *testServer) storageStats(userID string) models.StorageStats {
+	s.t.Helper()
+	w := s.do(userID, http.MethodGet, "/api/v1/stats/storage", nil, "")
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("获取存储统计失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Stats models.StorageStats `json:"stats"`
+	}
+	decode(s.t, w, &resp)
+	return resp.Stats
+}
+
+func TestQuota(t *testing.T) {
+	s := newTestServer(t)
+	s.quotas["bkp-alice"] = 100
+	s.upload("bkp-bob", "", "big.bin", strings.Repeat("b", 500))
+
+	if w := s.upload("bkp-alice", "docs", "a.txt", strings.Repeat("a", 40)); w.Code != http.StatusOK {
+		t.Fatalf("配额内上传失败: %d %s", w.Code, w.Body.String())
+	}
+	w := s.upload("bkp-alice", "docs", "b.txt", strings.Repeat("b", 70))
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), services.ErrQuotaExceeded.Error()) {
+		t.Errorf("超过配额的上传 status = %d, want 413 (%s)", w.Code, w.Body.String())
+	}
+
+	// 复制按源文件或文件夹的总大小检查
+	if w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/copy", models.CopyRequest{Source: "docs/a.txt", Destination: "docs/c.txt"}); w.Code != http.StatusOK {
+		t.Fatalf("配额内复制失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/copy", models.CopyRequest{Source: "docs", Destination: "backup"}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超过配额的文件夹复制 status = %d, want 413", w.Code)
+	}
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/copy", models.BatchCopyRequest{Items: []string{"docs/a.txt"}, Destination: "backup"}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超过配额的批量复制 status = %d, want 413", w.Code)
+	}
+
+	// 回收站中的文件仍然占用配额
+	s.do("bkp-alice", http.MethodDelete, "/api/v1/files/docs/c.txt", nil, "")
+	stats := s.storageStats("bkp-alice")
+	if stats.TotalSpace != 100 || stats.UsedSpace != 80 || stats.TrashSize != 40 || stats.FreeSpace != 20 || stats.FileCount != 1 {
+		t.Errorf("alice stats = %+v", stats)
+	}
+	if stats := s.storageStats("bkp-bob"); stats.TotalSpace != 0 || stats.UsedSpace != 500 || stats.FileCount != 1 {
+		t.Errorf("bob stats = %+v", stats)
+	}
+
+	// 解压前按条目声明的大小检查，超过配额时不写入任何文件
+	s.quotas["bkp-alice"] = 1000
+	s.upload("bkp-alice", "", "zeros.zip", makeZip(t, []archiveFile{{name: "zeros.bin", content: strings.Repeat("\x00", 2000)}}))
+	job := s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: "zeros.zip", OutputPath: "out"})
+	if job.Status != services.JobFailed || !strings.Contains(job.Error, services.ErrQuotaExceeded.Error()) {
+		t.Errorf("超过配额的解压 job = %+v", job)
+	}
+	if got := s.content("bkp-alice", "out/zeros.bin"); got != "<404>" {
+		t.Errorf("超过配额的解压不应写入文件: %q", got)
+	}
+
+	delete(s.quotas, "bkp-alice")
+	if job := s.extract("bkp-alice", models.ExtractRequest{ArchiveKey: "zeros.zip", OutputPath: "out"}); job.Status != services.JobCompleted {
+		t.Errorf("不限制配额时解压 job = %+v", job)
+	}
+}
+
+func TestQuotaOtherWritePaths(t *testing.T) {
+	s := newTestServer(t)
+	s.quotas["bkp-alice"] = 100
+
+	// 源文件不存在时返回404，而不是配额检查的错误
+	if w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/files/copy", models.CopyRequest{Source: "nope.txt", Destination: "copy.txt"}); w.Code != http.StatusNotFound {
+		t.Errorf("复制不存在的文件 status = %d, want 404 (%s)", w.Code, w.Body.String())
+	}
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/batch/copy", models.BatchCopyRequest{Items: []string{"nope.txt"}, Destination: "backup"}); w.Code != http.StatusPartialContent {
+		t.Errorf("批量复制不存在的文件 status = %d, want 206 (%s)", w.Code, w.Body.String())
+	}
+
+	// 分片上传：创建时按声明的大小检查，完成时按实际大小检查
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/uploads", models.InitiateUploadRequest{FileName: "big.bin", Size: 200}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超过配额的上传会话 status = %d, want 413", w.Code)
+	}
+	var created models.UploadSessionResponse
+	decode(t, s.doJSON("bkp-alice", http.MethodPost, "/api/v1/uploads", models.InitiateUploadRequest{FileName: "big.bin"}), &created)
+	base := "/api/v1/uploads/" + created.Session.SessionId
+	if w := s.do("bkp-alice", http.MethodPut, base+"/parts/1", strings.NewReader(strings.Repeat("x", 150)), "application/octet-stream"); w.Code != http.StatusOK {
+		t.Fatalf("上传分片失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.do("bkp-alice", http.MethodPost, base+"/complete", nil, ""); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("完成超过配额的上传 status = %d, want 413", w.Code)
+	}
+
+	// tus 和预签名直传在创建时检查
+	if w := s.tus("bkp-alice", http.MethodPost, "/api/v1/tus/", nil, map[string]string{
+		"Upload-Length":   "200",
+		"Upload-Metadata": tusMetadata("filename", "big.bin"),
+	}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超过配额的 tus 上传 status = %d, want 413", w.Code)
+	}
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/presign/upload", models.PresignUploadRequest{FileName: "big.bin", Size: 200}); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超过配额的预签名上传 status = %d, want 413", w.Code)
+	}
+
+	// 压缩按打包的文件总大小检查
+	s.upload("bkp-alice", "", "a.txt", strings.Repeat("a", 60))
+	job := s.waitJob("bkp-alice", s.doJSON("bkp-alice", http.MethodPost, "/api/v1/archives/compress", models.CompressRequest{Items: []string{"a.txt"}, OutputName: "a"}))
+	if job.Status != services.JobFailed || !strings.Contains(job.Error, services.ErrQuotaExceeded.Error()) {
+		t.Errorf("超过配额的压缩 job = %+v", job)
+	}
+
+	// 创建之后写入了其他文件，完成时超过配额
+	w := s.tus("bkp-alice", http.MethodPost, "/api/v1/tus/", nil, map[string]string{
+		"Upload-Length":   "30",
+		"Upload-Metadata": tusMetadata("filename", "tus.bin"),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建 tus 上传失败: %d %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	s.upload("bkp-alice", "", "b.txt", strings.Repeat("b", 20))
+	w = s.tus("bkp-alice", http.MethodPatch, location, strings.NewReader(strings.Repeat("t", 30)), map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("完成超过配额的 tus 上传 status = %d, want 413", w.Code)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/presign/upload", models.PresignUploadRequest{FileName: "direct.bin", Size: 15})
+	var presigned models.PresignResponse
+	decode(t, w, &presigned)
+	s.upload("bkp-alice", "", "c.txt", strings.Repeat("c", 10))
+	s.store.PutObject("users/bkp-alice/direct.bin", strings.NewReader(strings.Repeat("d", 15)), 15, "application/octet-stream", nil)
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/presign/complete", models.PresignCompleteRequest{UploadId: presigned.Presign.UploadId})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("完成超过配额的直传 status = %d, want 413", w.Code)
+	}
+	if got := s.content("bkp-alice", "direct.bin"); got != "<404>" {
+		t.Errorf("超过配额的直传应被删除: %q", got)
+	}
+	if stats := s.storageStats("bkp-alice"); stats.UsedSpace != 90 {
+		t.Errorf("alice stats = %+v", stats)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "projects", "report-2026.pdf", strings.Repeat("x", 2048))
+	s.upload("bkp-alice", "projects", "notes.txt", "small")
+	s.upload("bkp-alice", "", "report-old.txt", "old")
+	s.upload("bkp-bob", "", "report-bob.txt", "bob")
+
+	search := func(query string) []string {
+		t.Helper()
+		w := s.do("bkp-alice", http.MethodGet, "/api/v1/search?"+query, nil, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("搜索失败: %d %s", w.Code, w.Body.String())
+		}
+		var resp models.SearchResponse
+		decode(t, w, &resp)
+		keys := []string{}
+		for _, r := range resp.Results {
+			if r.Path != r.Key {
+				t.Errorf("path = %q, key = %q", r.Path, r.Key)
+			}
+			keys = append(keys, r.Key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	if got := search("q=report"); len(got) != 2 || got[0] != "projects/report-2026.pdf" || got[1] != "report-old.txt" {
+		t.Errorf("q=report => %v", got)
+	}
+	if got := search("q=report&folder=projects/"); len(got) != 1 || got[0] != "projects/report-2026.pdf" {
+		t.Errorf("q=report&folder=projects/ => %v", got)
+	}
+	if got := search("q=users"); len(got) != 0 {
+		t.Errorf("用户前缀不应参与匹配: %v", got)
+	}
+	if got := search("minSize=1024"); len(got) != 1 || got[0] != "projects/report-2026.pdf" {
+		t.Errorf("minSize=1024 => %v", got)
+	}
+}
+
+func TestStructuredSearch(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "projects", "report-2026.pdf", "%PDF-1.4\n"+strings.Repeat("x", 4096))
+	s.upload("bkp-alice", "projects", "draft-report.pdf", "%PDF-1.4\n"+strings.Repeat("x", 1024))
+	s.upload("bkp-alice", "projects", "report.md", "# report")
+	s.upload("bkp-alice", "", "report.txt", strings.Repeat("y", 2048))
+	s.upload("bkp-alice", "", "photo.png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+	search := func(q string) []string {
+		t.Helper()
+		w := s.do("bkp-alice", http.MethodGet, "/api/v1/search?q="+url.QueryEscape(q), nil, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("搜索 %q 失败: %d %s", q, w.Code, w.Body.String())
+		}
+		var resp models.SearchResponse
+		decode(t, w, &resp)
+		if resp.Query != q {
+			t.Errorf("query = %q, want %q", resp.Query, q)
+		}
+		keys := []string{}
+		for _, r := range resp.Results {
+			keys = append(keys, r.Key)
+		}
+		return keys
+	}
+
+	cases := []struct {
+		q    string
+		want string
+	}{
+		{"report type:pdf size:>2KB in:projects/ -name:draft", "projects/report-2026.pdf"},
+		{"report -in:projects sort:name", "report.txt"},
+		{"type:image OR (ext:md in:projects)", "photo.png,projects/report.md"},
+		{"report sort:size", "projects/report-2026.pdf,report.txt,projects/draft-report.pdf,projects/report.md"},
+		{"report sort:size-asc", "projects/report.md,projects/draft-report.pdf,report.txt,projects/report-2026.pdf"},
+		{"modified:>2000-01-01 NOT report sort:name", "photo.png"},
+	}
+	for _, tc := range cases {
+		if got := strings.Join(search(tc.q), ","); got != tc.want {
+			t.Errorf("%s => %s, want %s", tc.q, got, tc.want)
+		}
+	}
+
+	w := s.do("bkp-alice", http.MethodGet, "/api/v1/search?q="+url.QueryEscape("report size:>10XB"), nil, "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "第 8 个字符") {
+		t.Errorf("语法错误应返回400和出错位置: %d %s", w.Code, w.Body.String())
+	}
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/search?content=true&q="+url.QueryEscape("a OR b"), nil, "")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("全文检索的关键词不支持 OR，应返回400: %d", w.Code)
+	}
+}
+
+func TestContentSearch(t *testing.T) {
+	s := newTestServer(t)
+	var docx bytes.Buffer
+	zw := zip.NewWriter(&docx)
+	w, _ := zw.Create("word/document.xml")
+	w.Write([]byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		`<w:p><w:r><w:t>Budget review: the quarterly budget is approved</w:t></w:r></w:p></w:body></w:document>`))
+	zw.Close()
+	pdf := "%PDF-1.4\n1 0 obj\n<< /Length 44 >>\nstream\nBT (Quarterly budget & <forecast>) Tj ET\nendstream\nendobj\n%%EOF\n"
+
+	s.upload("bkp-alice", "docs", "plan.docx", docx.String())
+	s.upload("bkp-alice", "docs", "forecast.pdf", pdf)
+	s.upload("bkp-alice", "", "notes.md", "# Notes\n\nNothing about money here.")
+	s.upload("bkp-alice", "", "budget.txt", "file name matches, content does not")
+	s.upload("bkp-bob", "", "bob.txt", "bob's quarterly budget")
+
+	search := func(query string) models.SearchResponse {
+		t.Helper()
+		w := s.do("bkp-alice", http.MethodGet, "/api/v1/search?content=true&"+query, nil, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("全文检索失败: %d %s", w.Code, w.Body.String())
+		}
+		var resp models.SearchResponse
+		decode(t, w, &resp)
+		return resp
+	}
+
+	// 按相关度排序，只返回当前用户的文件
+	resp := search("q=quarterly+budget")
+	if len(resp.Results) != 2 || resp.Results[0].Key != "docs/plan.docx" || resp.Results[1].Key != "docs/forecast.pdf" {
+		t.Fatalf("q=quarterly budget => %+v", resp.Results)
+	}
+	if resp.Results[0].Score <= resp.Results[1].Score {
+		t.Errorf("相关度 = %v, %v", resp.Results[0].Score, resp.Results[1].Score)
+	}
+	if got := resp.Results[1].Snippet; got != "<mark>Quarterly</mark> <mark>budget</mark> &amp; &lt;forecast&gt;" {
+		t.Errorf("摘要 = %q", got)
+	}
+	if got := search("q=budget&types=pdf"); len(got.Results) != 1 || got.Results[0].Key != "docs/forecast.pdf" {
+		t.Errorf("q=budget&types=pdf => %+v", got.Results)
+	}
+
+	// 覆盖上传后按新内容检索
+	s.upload("bkp-alice", "", "notes.md", "# Notes\n\nBudget moved to docs.")
+	if got := search("q=budget+moved"); len(got.Results) != 1 || got.Results[0].Key != "notes.md" {
+		t.Errorf("覆盖后 => %+v", got.Results)
+	}
+	if got := search("q=money"); len(got.Results) != 0 {
+		t.Errorf("旧内容不应再匹配: %+v", got.Results)
+	}
+
+	if w := s.do("bkp-alice", http.MethodGet, "/api/v1/search?content=true", nil, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("没有关键词应返回400, got %d", w.Code)
+	}
+}
+
+func TestSavedSearches(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "contracts", "lease.pdf", "%PDF-1.4\nlease")
+	s.upload("bkp-alice", "contracts", "notes.txt", "notes")
+	s.upload("bkp-alice", "", "invoice.pdf", "%PDF-1.4\ninvoice")
+	s.upload("bkp-bob", "contracts", "bob.pdf", "%PDF-1.4\nbob")
+
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/saved-searches", models.SavedSearchRequest{Name: "合同 PDF", Query: "type:pdf sort:name", Folder: "contracts"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("保存搜索失败: %d %s", w.Code, w.Body.String())
+	}
+	var created models.SavedSearchResponse
+	decode(t, w, &created)
+	search := created.Search
+	if search.Folder != "contracts/" || search.Path != "@search/"+search.ID+"/" {
+		t.Errorf("保存的搜索 = %+v", search)
+	}
+
+	// 根目录列出智能文件夹，以 path 作为 prefix 列出实时结果
+	root := s.list("bkp-alice", "")
+	if len(root.SmartFolders) != 1 || root.SmartFolders[0].ID != search.ID {
+		t.Fatalf("smartFolders = %+v", root.SmartFolders)
+	}
+	if got := s.list("bkp-alice", "contracts/").SmartFolders; len(got) != 0 {
+		t.Errorf("子文件夹不应返回智能文件夹: %+v", got)
+	}
+	s.upload("bkp-alice", "contracts/2026", "renewal.pdf", "%PDF-1.4\nrenewal")
+	if got := strings.Join(fileKeys(s.list("bkp-alice", search.Path).Files), ","); got != "contracts/2026/renewal.pdf,contracts/lease.pdf" {
+		t.Errorf("智能文件夹 = %s", got)
+	}
+
+	// 修改条件后立即生效
+	w = s.doJSON("bkp-alice", http.MethodPut, "/api/v1/saved-searches/"+search.ID, models.SavedSearchRequest{Name: "所有 PDF", Query: "ext:pdf -renewal"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("修改搜索失败: %d %s", w.Code, w.Body.String())
+	}
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/saved-searches/"+search.ID+"/results", nil, "")
+	var results models.SearchResponse
+	decode(t, w, &results)
+	if keys := len(results.Results); w.Code != http.StatusOK || keys != 2 || results.Query != "ext:pdf -renewal" {
+		t.Errorf("执行搜索 = %d %s", w.Code, w.Body.String())
+	}
+
+	// 共享后接收者在自己的文件中搜索，不能修改
+	if w := s.doJSON("bkp-bob", http.MethodGet, "/api/v1/saved-searches/"+search.ID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("未共享时其他用户应返回404: %d", w.Code)
+	}
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/saved-searches/"+search.ID+"/share", models.ShareSavedSearchRequest{Username: "bkp-bob"})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"sharedWith":["bkp-bob"]`) {
+		t.Fatalf("共享失败: %d %s", w.Code, w.Body.String())
+	}
+	bobRoot := s.list("bkp-bob", "")
+	if len(bobRoot.SmartFolders) != 1 || bobRoot.SmartFolders[0].Owner != "bkp-alice" || bobRoot.SmartFolders[0].SharedWith != nil {
+		t.Fatalf("接收者的 smartFolders = %+v", bobRoot.SmartFolders)
+	}
+	if got := strings.Join(fileKeys(s.list("bkp-bob", search.Path).Files), ","); got != "contracts/bob.pdf" {
+		t.Errorf("接收者的智能文件夹 = %s", got)
+	}
+	if w := s.doJSON("bkp-bob", http.MethodPut, "/api/v1/saved-searches/"+search.ID, models.SavedSearchRequest{Name: "x"}); w.Code != http.StatusForbidden {
+		t.Errorf("接收者修改应返回403: %d", w.Code)
+	}
+	if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/saved-searches/"+search.ID+"/share", models.ShareSavedSearchRequest{Username: "nobody"}); w.Code != http.StatusNotFound {
+		t.Errorf("共享给不存在的用户应返回404: %d", w.Code)
+	}
+
+	// 接收者删除只移除自己的共享，创建者删除后智能文件夹消失
+	if w := s.do("bkp-bob", http.MethodDelete, "/api/v1/saved-searches/"+search.ID, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("接收者删除失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := s.list("bkp-bob", "").SmartFolders; len(got) != 0 {
+		t.Errorf("接收者删除后仍可见: %+v", got)
+	}
+	if w := s.do("bkp-alice", http.MethodGet, "/api/v1/saved-searches/"+search.ID, nil, ""); !strings.Contains(w.Body.String(), search.ID) || strings.Contains(w.Body.String(), "sharedWith") {
+		t.Errorf("接收者删除后创建者的搜索 = %s", w.Body.String())
+	}
+	if w := s.do("bkp-alice", http.MethodDelete, "/api/v1/saved-searches/"+search.ID, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("删除失败: %d", w.Code)
+	}
+	if got := s.list("bkp-alice", "").SmartFolders; len(got) != 0 {
+		t.Errorf("删除后 smartFolders = %+v", got)
+	}
+	if got := s.list("bkp-alice", search.Path); len(got.Files) != 0 {
+		t.Errorf("删除后应按普通文件夹列出: %+v", got.Files)
+	}
+
+	for _, req := range []models.SavedSearchRequest{
+		{Name: " ", Query: "type:pdf"},
+		{Name: "坏查询", Query: "size:>10XB"},
+		{Name: "全文", Query: "type:pdf", Content: true},
+		{Name: "路径", Folder: "../bkp-bob"},
+	} {
+		if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/saved-searches", req); w.Code != http.StatusBadRequest {
+			t.Errorf("%+v 应返回400: %d %s", req, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRecentFilesWithoutIndex(t *testing.T) {
+	s := newUnindexedTestServer(t)
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	s.store.SetClock(func() time.Time { return now })
+
+	// 最新的文件的键排在最后，超过默认数量的两倍
+	for i := 0; i < 45; i++ {
+		now = start.Add(time.Duration(i) * time.Minute)
+		s.upload("bkp-alice", "photos", fmt.Sprintf("%02d.jpg", i), "x")
+	}
+	now = start.Add(24 * time.Hour)
+	s.upload("bkp-alice", "photos", "zz.jpg", "x")
+
+	w := s.do("bkp-alice", http.MethodGet, "/api/v1/files/recent?limit=3", nil, "")
+	var resp struct {
+		Files []models.ExtendedFileInfo `json:"files"`
+	}
+	decode(t, w, &resp)
+	if w.Code != http.StatusOK || len(resp.Files) != 3 || resp.Files[0].Key != "photos/zz.jpg" || resp.Files[1].Key != "photos/44.jpg" {
+		t.Errorf("最近文件 = %d %+v", w.Code, resp.Files)
+	}
+
+	s.prefs.SetClock(func() time.Time { return now })
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/files/filter?time=today", nil, "")
+	var filtered models.SearchResponse
+	decode(t, w, &filtered)
+	if len(filtered.Results) != 1 || filtered.Results[0].Key != "photos/zz.jpg" {
+		t.Errorf("time=today => %+v", filtered.Results)
+	}
+}
+
+func TestTimeRangeFilters(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "docs", "a.txt", "a")
+	s.upload("bkp-alice", "docs", "b.txt", "b")
+
+	type recentResponse struct {
+		Files []models.ExtendedFileInfo `json:"files"`
+	}
+	recent := func(query string) []models.ExtendedFileInfo {
+		t.Helper()
+		w := s.do("bkp-alice", http.MethodGet, "/api/v1/files/recent?"+query, nil, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("最近文件失败: %d %s", w.Code, w.Body.String())
+		}
+		var resp recentResponse
+		decode(t, w, &resp)
+		return resp.Files
+	}
+	files := recent("")
+	if len(files) != 2 || files[0].LastModified.Before(files[1].LastModified) {
+		t.Fatalf("最近文件应按修改时间倒序: %+v", files)
+	}
+	modified := files[1].LastModified
+
+	filter := func(timeRange string) int {
+		t.Helper()
+		w := s.do("bkp-alice", http.MethodGet, "/api/v1/files/filter?time="+url.QueryEscape(timeRange), nil, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("time=%s 过滤失败: %d %s", timeRange, w.Code, w.Body.String())
+		}
+		var resp models.SearchResponse
+		decode(t, w, &resp)
+		return len(resp.Results)
+	}
+	day := modified.UTC().Format("2006-01-02")
+	for timeRange, want := range map[string]int{
+		"today":       2,
+		"this-week":   2,
+		"last-7-days": 2,
+		day:           2,
+		day + "..":    2,
+		".." + day:    2,
+		modified.UTC().AddDate(0, 0, 1).Format("2006-01-02") + "..": 0,
+	} {
+		if got := filter(timeRange); got != want {
+			t.Errorf("time=%s => %d, want %d", timeRange, got, want)
+		}
+	}
+	for _, bad := range []string{"bogus", "last-0-days", "2026-02-30", "2026-02-01..2026-01-01"} {
+		if w := s.do("bkp-alice", http.MethodGet, "/api/v1/files/filter?time="+url.QueryEscape(bad), nil, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("time=%s 应返回400: %d %s", bad, w.Code, w.Body.String())
+		}
+	}
+
+	// 两天之后：昨天和最近两天都不包括上传的日期
+	s.prefs.SetClock(func() time.Time { return modified.Add(48 * time.Hour) })
+	for timeRange, want := range map[string]int{"today": 0, "yesterday": 0, "last-2-days": 0, "last-3-days": 2} {
+		if got := filter(timeRange); got != want {
+			t.Errorf("两天后 time=%s => %d, want %d", timeRange, got, want)
+		}
+	}
+	if got := recent("time=last-3-days&limit=1"); len(got) != 1 || got[0].Key != files[0].Key {
+		t.Errorf("recent time=last-3-days = %+v", got)
+	}
+	if got := recent("time=yesterday"); len(got) != 0 {
+		t.Errorf("recent time=yesterday = %+v", got)
+	}
+	w := s.do("bkp-alice", http.MethodGet, "/api/v1/search?startDate=yesterday", nil, "")
+	var results models.SearchResponse
+	decode(t, w, &results)
+	if w.Code != http.StatusOK || len(results.Results) != 0 {
+		t.Errorf("startDate=yesterday => %d %s", w.Code, w.Body.String())
+	}
+	s.prefs.SetClock(time.Now)
+
+	// 默认时区为 UTC，设置后按用户的时区计算日期
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/preferences", nil, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"timezone":"UTC"`) {
+		t.Errorf("默认偏好设置 = %d %s", w.Code, w.Body.String())
+	}
+	if w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/preferences", models.UserPreferences{Timezone: "Mars/Olympus"}); w.Code != http.StatusBadRequest {
+		t.Errorf("无效时区应返回400: %d %s", w.Code, w.Body.String())
+	}
+
+	// 两个时区相差 25 小时，同一时刻一定是不同的日期
+	kiritimati, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Skipf("没有时区数据: %v", err)
+	}
+	query := "/api/v1/search?q=" + url.QueryEscape("modified:"+modified.In(kiritimati).Format("2006-01-02"))
+	for tz, want := range map[string]int{"Pacific/Kiritimati": 2, "Pacific/Pago_Pago": 0} {
+		w := s.doJSON("bkp-alice", http.MethodPut, "/api/v1/preferences", models.UserPreferences{Timezone: tz})
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), tz) {
+			t.Fatalf("设置时区失败: %d %s", w.Code, w.Body.String())
+		}
+		w = s.do("bkp-alice", http.MethodGet, query, nil, "")
+		var results models.SearchResponse
+		decode(t, w, &results)
+		if len(results.Results) != want {
+			t.Errorf("%s 时区 => %d, want %d", tz, len(results.Results), want)
+		}
+	}
+	// 其他用户不受影响
+	w = s.do("bkp-bob", http.MethodGet, "/api/v1/preferences", nil, "")
+	if !strings.Contains(w.Body.String(), `"timezone":"UTC"`) {
+		t.Errorf("其他用户的偏好设置 = %s", w.Body.String())
+	}
+}
+
+func TestUploadDetectsContentType(t *testing.T) {
+	s := newTestServer(t)
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00"
+	s.upload("bkp-alice", "", "scan.txt", png)
+	s.upload("bkp-alice", "", "main.go", "package main\n")
+	s.upload("bkp-alice", "", "notes.txt", "hello")
+
+	// 浏览器提供的 Content-Type 不可信，以文件内容为准
+	info, err := s.store.HeadObject("users/bkp-alice/scan.txt")
+	if err != nil {
+		t.Fatalf("HeadObject 失败: %v", err)
+	}
+	if info.ContentType != "image/png" {
+		t.Errorf("scan.txt ContentType = %q, want image/png", info.ContentType)
+	}
+	types := map[string]string{}
+	for _, f := range s.list("bkp-alice", "").Files {
+		types[f.Name] = f.ContentType
+	}
+	if types["scan.txt"] != "image/png" || types["main.go"] != "text/x-go" || types["notes.txt"] != "text/plain" {
+		t.Errorf("列表中的类型 = %v", types)
+	}
+
+	filter := func(fileType string) []string {
+		t.Helper()
+		w := s.do("bkp-alice", http.MethodGet, "/api/v1/files/filter?type="+fileType, nil, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("过滤失败: %d %s", w.Code, w.Body.String())
+		}
+		var resp models.SearchResponse
+		decode(t, w, &resp)
+		keys := []string{}
+		for _, r := range resp.Results {
+			keys = append(keys, r.Key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	if got := filter("image"); len(got) != 1 || got[0] != "scan.txt" {
+		t.Errorf("type=image => %v", got)
+	}
+	if got := filter("code"); len(got) != 1 || got[0] != "main.go" {
+		t.Errorf("type=code => %v", got)
+	}
+	if got := filter("document"); len(got) != 1 || got[0] != "notes.txt" {
+		t.Errorf("type=document => %v", got)
+	}
+	if w := s.do("bkp-alice", http.MethodGet, "/api/v1/files/filter?type=spreadsheet", nil, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("未知类型应返回400, got %d", w.Code)
+	}
+}
+
+func TestShareScopedToOwner(t *testing.T) {
+	s := newTestServer(t)
+	s.upload("bkp-alice", "", "shared.txt", "shared content")
+
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/share/create", models.ShareRequest{
+		FileKey:       "shared.txt",
+		ExpiresAt:     time.Now().Add(time.Hour),
+		AllowDownload: true,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("创建分享失败: %d %s", w.Code, w.Body.String())
+	}
+	var created models.ShareResponse
+	decode(t, w, &created)
+	if created.ShareInfo.FileKey != "shared.txt" || created.ShareInfo.FileSize != int64(len("shared content")) {
+		t.Errorf("share info = %+v", created.ShareInfo)
+	}
+
+	w = s.do("bkp-bob", http.MethodGet, "/api/v1/share/"+created.ShareInfo.ShareId+"/download", nil, "")
+	if w.Code != http.StatusOK || w.Body.String() != "shared content" {
+		t.Errorf("通过分享下载: %d %q", w.Code, w.Body.String())
+	}
+	w = s.doWithHeaders("bkp-bob", http.MethodGet, "/api/v1/share/"+created.ShareInfo.ShareId+"/download", nil, map[string]string{"Range": "bytes=7-"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "content" {
+		t.Errorf("分享下载 Range: %d %q", w.Code, w.Body.String())
+	}
+
+	var listed struct {
+		Shares []models.ShareInfo `json:"shares"`
+	}
+	decode(t, s.do("bkp-bob", http.MethodGet, "/api/v1/share/", nil, ""), &listed)
+	if len(listed.Shares) != 0 {
+		t.Errorf("bob 不应看到 alice 的分享列表: %+v", listed.Shares)
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/uploads", models.InitiateUploadRequest{
+		FileName:    "big.bin",
+		Folder:      "videos/",
+		Size:        11,
+		ContentType: "video/mp4",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("创建上传会话失败: %d %s", w.Code, w.Body.String())
+	}
+	var created models.UploadSessionResponse
+	decode(t, w, &created)
+	session := created.Session
+	if session.SessionId == "" || session.Key != "videos/big.bin" || session.PartSize <= 0 {
+		t.Fatalf("session = %+v", session)
+	}
+	base := "/api/v1/uploads/" + session.SessionId
+
+	if w := s.do("bkp-alice", http.MethodPut, base+"/parts/1", strings.NewReader("hello "), "application/octet-stream"); w.Code != http.StatusOK {
+		t.Fatalf("上传分片1失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.do("bkp-alice", http.MethodPost, base+"/complete", nil, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("分片不完整时完成上传: %d, want 400", w.Code)
+	}
+
+	// 其他用户看不到该会话
+	if w := s.do("bkp-bob", http.MethodGet, base, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("bob 获取 alice 的会话: %d, want 404", w.Code)
+	}
+	if w := s.do("bkp-bob", http.MethodPut, base+"/parts/2", strings.NewReader("x"), ""); w.Code != http.StatusNotFound {
+		t.Errorf("bob 上传到 alice 的会话: %d, want 404", w.Code)
+	}
+
+	// 服务重启后从存储中恢复会话
+	s = newTestServerWithStore(t, s.store)
+	var listed models.UploadSessionListResponse
+	decode(t, s.do("bkp-alice", http.MethodGet, "/api/v1/uploads", nil, ""), &listed)
+	if listed.Total != 1 || listed.Sessions[0].UploadedSize != 6 || len(listed.Sessions[0].Parts) != 1 {
+		t.Fatalf("重启后的会话列表 = %+v", listed)
+	}
+
+	if w := s.do("bkp-alice", http.MethodPut, base+"/parts/2", strings.NewReader("world"), ""); w.Code != http.StatusOK {
+		t.Fatalf("上传分片2失败: %d %s", w.Code, w.Body.String())
+	}
+	w = s.do("bkp-alice", http.MethodPost, base+"/complete", nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("完成上传失败: %d %s", w.Code, w.Body.String())
+	}
+	var completed models.UploadResponse
+	decode(t, w, &completed)
+	if completed.Key != "videos/big.bin" {
+		t.Errorf("完成后的 key = %q", completed.Key)
+	}
+
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/download/videos/big.bin", nil, "")
+	if w.Code != http.StatusOK || w.Body.String() != "hello world" {
+		t.Errorf("下载合并后的文件: %d %q", w.Code, w.Body.String())
+	}
+	// 创建会话时声明的 Content-Type 不可信，以合并后的内容为准
+	if info, _ := s.store.HeadObject("users/bkp-alice/videos/big.bin"); info == nil || !strings.HasPrefix(info.ContentType, "text/plain") {
+		t.Errorf("合并后的对象信息 = %+v", info)
+	}
+	if w := s.do("bkp-alice", http.MethodGet, base, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("完成后会话应被删除: %d", w.Code)
+	}
+}
+
+func TestAbortUpload(t *testing.T) {
+	s := newTestServer(t)
+
+	var created models.UploadSessionResponse
+	decode(t, s.doJSON("bkp-alice", http.MethodPost, "/api/v1/uploads", models.InitiateUploadRequest{FileName: "tmp.bin"}), &created)
+	base := "/api/v1/uploads/" + created.Session.SessionId
+	s.do("bkp-alice", http.MethodPut, base+"/parts/1", strings.NewReader("abc"), "")
+
+	if w := s.do("bkp-bob", http.MethodDelete, base, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("bob 取消 alice 的会话: %d, want 404", w.Code)
+	}
+	if w := s.do("bkp-alice", http.MethodDelete, base, nil, ""); w.Code != http.StatusOK {
+		t.Fatalf("取消上传失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.do("bkp-alice", http.MethodPut, base+"/parts/2", strings.NewReader("abc"), ""); w.Code != http.StatusNotFound {
+		t.Errorf("取消后上传分片: %d, want 404", w.Code)
+	}
+	if _, err := s.store.HeadObject("users/bkp-alice/tmp.bin"); err == nil {
+		t.Error("取消后对象不应存在")
+	}
+
+	for _, name := range []string{"../x.bin", "a/b.bin", "."} {
+		if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/uploads", models.InitiateUploadRequest{FileName: name}); w.Code != http.StatusBadRequest {
+			t.Errorf("非法文件名 %q: %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func (s *testServer) tus(userID, method, target string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	withVersion := map[string]string{"Tus-Resumable": "1.0.0"}
+	for k, v := range headers {
+		withVersion[k] = v
+	}
+	return s.doWithHeaders(userID, method, target, body, withVersion)
+}
+
+func tusMetadata(pairs ...string) string {
+	var encoded []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		encoded = append(encoded, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+	}
+	return strings.Join(encoded, ",")
+}
+
+func TestTusUpload(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.tus("bkp-alice", http.MethodOptions, "/api/v1/tus/", nil, nil)
+	if w.Code != http.StatusNoContent || !strings.Contains(w.Header().Get("Tus-Extension"), "checksum") {
+		t.Fatalf("OPTIONS: %d %v", w.Code, w.Header())
+	}
+
+	// 超过一个分片，覆盖暂存数据跨请求拼接的路径；Content-Type 按内容（MP4 文件头）判断，不采信 filetype
+	content := "\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2" + strings.Repeat("0123456789abcdef", (9<<20)/16)
+	w = s.tus("bkp-alice", http.MethodPost, "/api/v1/tus/", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(len(content)),
+		"Upload-Metadata": tusMetadata("filename", "movie.mp4", "folder", "videos", "filetype", "text/plain"),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建上传失败: %d %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/api/v1/tus/") {
+		t.Fatalf("Location = %q", location)
+	}
+
+	patch := func(userID string, offset int, chunk string, extra map[string]string) *httptest.ResponseRecorder {
+		headers := map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": strconv.Itoa(offset),
+		}
+		for k, v := range extra {
+			headers[k] = v
+		}
+		return s.tus(userID, http.MethodPatch, location, strings.NewReader(chunk), headers)
+	}
+
+	chunks := []int{0, 3 << 20, 6 << 20, len(content)}
+	if w := patch("bkp-alice", 0, content[:chunks[1]], nil); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != strconv.Itoa(chunks[1]) {
+		t.Fatalf("PATCH 1: %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+
+	if w := patch("bkp-alice", 0, "again", nil); w.Code != http.StatusConflict {
+		t.Errorf("错误偏移量: %d, want 409", w.Code)
+	}
+	if w := patch("bkp-bob", chunks[1], "x", nil); w.Code != http.StatusNotFound {
+		t.Errorf("bob 写入 alice 的上传: %d, want 404", w.Code)
+	}
+	if w := patch("bkp-alice", chunks[1], content[chunks[1]:chunks[2]], map[string]string{"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(make([]byte, 20))}); w.Code != 460 {
+		t.Errorf("校验和不匹配: %d, want 460", w.Code)
+	}
+
+	// 服务重启后通过 HEAD 续传
+	s = newTestServerWithStore(t, s.store)
+	w = s.tus("bkp-alice", http.MethodHead, location, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(chunks[1]) || w.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Fatalf("HEAD: %d %v", w.Code, w.Header())
+	}
+
+	for i := 1; i < len(chunks)-1; i++ {
+		chunk := content[chunks[i]:chunks[i+1]]
+		sum := sha256.Sum256([]byte(chunk))
+		w := patch("bkp-alice", chunks[i], chunk, map[string]string{"Upload-Checksum": "sha256 " + base64.StdEncoding.EncodeToString(sum[:])})
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("PATCH %d: %d %s", i+1, w.Code, w.Body.String())
+		}
+	}
+
+	w = s.do("bkp-alice", http.MethodGet, "/api/v1/download/videos/movie.mp4", nil, "")
+	if w.Code != http.StatusOK || w.Body.String() != content {
+		t.Fatalf("下载 tus 上传的文件: %d, %d 字节", w.Code, w.Body.Len())
+	}
+	if info, _ := s.store.HeadObject("users/bkp-alice/videos/movie.mp4"); info == nil || info.ContentType != "video/mp4" {
+		t.Errorf("对象信息 = %+v", info)
+	}
+
+	w = s.tus("bkp-alice", http.MethodHead, location, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(len(content)) {
+		t.Errorf("完成后 HEAD: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestTusTerminateAndValidation(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.tus("bkp-alice", http.MethodPost, "/api/v1/tus/", nil, map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": tusMetadata("filename", "a.txt"),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建上传失败: %d %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+
+	w = s.tus("bkp-alice", http.MethodPatch, location, strings.NewReader("0123456789extra"), map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超过 Upload-Length: %d, want 413", w.Code)
+	}
+	w = s.tus("bkp-alice", http.MethodPatch, location, strings.NewReader("01234"), map[string]string{
+		"Content-Type":  "application/octet-stream",
+		"Upload-Offset": "0",
+	})
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("错误的 Content-Type: %d, want 415", w.Code)
+	}
+
+	if w := s.tus("bkp-bob", http.MethodDelete, location, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("bob 终止 alice 的上传: %d, want 404", w.Code)
+	}
+	if w := s.tus("bkp-alice", http.MethodDelete, location, nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("终止上传: %d %s", w.Code, w.Body.String())
+	}
+	if w := s.tus("bkp-alice", http.MethodHead, location, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("终止后 HEAD: %d, want 404", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodHead, location, nil)
+	req.Header.Set("Authorization", "Bearer "+tokenFor(t, "bkp-alice"))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("缺少 Tus-Resumable: %d, want 412", rec.Code)
+	}
+
+	for _, metadata := range []string{"", tusMetadata("filename", "../x"), tusMetadata("filename", "a/b"), "filename !!!"} {
+		w := s.tus("bkp-alice", http.MethodPost, "/api/v1/tus/", nil, map[string]string{"Upload-Length": "1", "Upload-Metadata": metadata})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Upload-Metadata %q: %d, want 400", metadata, w.Code)
+		}
+	}
+
+	// 空文件创建时直接落盘
+	w = s.tus("bkp-alice", http.MethodPost, "/api/v1/tus/", nil, map[string]string{
+		"Upload-Length":   "0",
+		"Upload-Metadata": tusMetadata("filename", "empty.txt", "folder", "docs/"),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建空文件: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := s.store.HeadObject("users/bkp-alice/docs/empty.txt"); err != nil {
+		t.Errorf("空文件应已写入: %v", err)
+	}
+}
+
+func TestPresignedUpload(t *testing.T) {
+	s := newTestServer(t)
+
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/presign/upload", models.PresignUploadRequest{
+		FileName:    "movie.mp4",
+		Folder:      "videos",
+		Size:        5,
+		ContentType: "video/mp4",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("获取上传URL失败: %d %s", w.Code, w.Body.String())
+	}
+	var presigned models.PresignResponse
+	decode(t, w, &presigned)
+	p := presigned.Presign
+	if p.Key != "videos/movie.mp4" || p.Method != http.MethodPut || p.UploadId == "" || p.Headers["Content-Length"] != "5" {
+		t.Fatalf("presign = %+v", p)
+	}
+	if !strings.Contains(p.URL, "users/bkp-alice/videos/movie.mp4") {
+		t.Errorf("URL 应指向用户空间: %s", p.URL)
+	}
+
+	complete := func(userID string) *httptest.ResponseRecorder {
+		return s.doJSON(userID, http.MethodPost, "/api/v1/presign/complete", models.PresignCompleteRequest{UploadId: p.UploadId})
+	}
+
+	if w := complete("bkp-alice"); w.Code != http.StatusConflict {
+		t.Errorf("上传前回调: %d, want 409", w.Code)
+	}
+
+	// 模拟客户端直传到存储，完成回调前元数据索引中还没有该文件
+	s.store.PutObject("users/bkp-alice/videos/movie.mp4", strings.NewReader("hello"), 5, "video/mp4", nil)
+	if got := fileKeys(s.list("bkp-alice", "videos/").Files); len(got) != 0 {
+		t.Errorf("完成回调前的文件列表 = %v", got)
+	}
+
+	if w := complete("bkp-bob"); w.Code != http.StatusNotFound {
+		t.Errorf("bob 回调 alice 的上传: %d, want 404", w.Code)
+	}
+	w = complete("bkp-alice")
+	if w.Code != http.StatusOK {
+		t.Fatalf("完成回调失败: %d %s", w.Code, w.Body.String())
+	}
+	var done models.UploadResponse
+	decode(t, w, &done)
+	if done.Key != "videos/movie.mp4" {
+		t.Errorf("完成后的 key = %q", done.Key)
+	}
+	files := s.list("bkp-alice", "videos/").Files
+	if got := fileKeys(files); len(got) != 1 || got[0] != "videos/movie.mp4" {
+		t.Errorf("完成回调后的文件列表 = %v", got)
+	}
+	// 直传时签发的 Content-Type 不可信，回调时按内容修正，索引中也随之更新
+	if len(files) == 1 && !strings.HasPrefix(files[0].ContentType, "text/plain") {
+		t.Errorf("直传文件的 ContentType = %q, want text/plain", files[0].ContentType)
+	}
+	if w := complete("bkp-alice"); w.Code != http.StatusNotFound {
+		t.Errorf("重复回调: %d, want 404", w.Code)
+	}
+
+	w = s.doJSON("bkp-alice", http.MethodPost, "/api/v1/presign/download", models.PresignDownloadRequest{Key: "videos/movie.mp4"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("获取下载URL失败: %d %s", w.Code, w.Body.String())
+	}
+	decode(t, w, &presigned)
+	if presigned.Presign.Method != http.MethodGet || !strings.Contains(presigned.Presign.URL, "filename=movie.mp4") {
+		t.Errorf("下载 presign = %+v", presigned.Presign)
+	}
+	if w := s.doJSON("bkp-bob", http.MethodPost, "/api/v1/presign/download", models.PresignDownloadRequest{Key: "videos/movie.mp4"}); w.Code != http.StatusNotFound {
+		t.Errorf("bob 获取 alice 文件的下载URL: %d, want 404", w.Code)
+	}
+}
+
+func TestPresignedUploadValidation(t *testing.T) {
+	s := newTestServer(t)
+
+	for name, req := range map[string]models.PresignUploadRequest{
+		"路径穿越":  {FileName: "../x", Size: 1},
+		"负大小":   {FileName: "a.bin", Size: -1},
+		"超大文件":  {FileName: "a.bin", Size: 6 << 30},
+		"有效期过长": {FileName: "a.bin", Size: 1, ExpiresIn: 7200},
+	} {
+		if w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/presign/upload", req); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", name, w.Code)
+		}
+	}
+
+	var presigned models.PresignResponse
+	decode(t, s.doJSON("bkp-alice", http.MethodPost, "/api/v1/presign/upload", models.PresignUploadRequest{FileName: "a.bin", Size: 10}), &presigned)
+
+	// 实际上传的大小与声明不一致时删除文件
+	s.store.PutObject("users/bkp-alice/a.bin", strings.NewReader("short"), 5, "", nil)
+	w := s.doJSON("bkp-alice", http.MethodPost, "/api/v1/presign/complete", models.PresignCompleteRequest{UploadId: presigned.Presign.UploadId})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("大小不一致: %d, want 400", w.Code)
+	}
+	if _, err := s.store.HeadObject("users/bkp-alice/a.bin"); err == nil {
+		t.Error("大小不一致的文件应被删除")
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+)
+
+// JobHandler 查询后台任务（压缩、解压）的状态和进度
+type JobHandler struct {
+	jobs *services.JobService
+}
+
+func NewJobHandler(jobs *services.JobService) *JobHandler {
+	return &JobHandler{
+		jobs: jobs,
+	}
+}
+
+// GetJob 查询任务
+// @Summary      查询后台任务
+// @Description  返回任务状态（pending、running、completed、failed）、进度，完成后返回结果路径
+// @Tags         后台任务
+// @Produce      json
+// @Param        id   path      string  true  "任务ID"
+// @Success      200  {object}  models.JobResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Router       /jobs/{id} [get]
+func (h *JobHandler) GetJob(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.jobs.Get(scope.userID, c.Param("id"))
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.JobResponse{
+		Success: true,
+		Job:     scope.stripJob(*job),
+	})
+}
+
+// ListJobs 列出任务
+// @Summary      列出后台任务
+// @Description  列出当前用户24小时内的任务，最新的在前
+// @Tags         后台任务
+// @Produce      json
+// @Success      200  {object}  models.JobListResponse
+// @Router       /jobs [get]
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	jobs := h.jobs.List(scope.userID)
+	for i := range jobs {
+		jobs[i] = scope.stripJob(jobs[i])
+	}
+	c.JSON(http.StatusOK, models.JobListResponse{
+		Success: true,
+		Jobs:    jobs,
+		Total:   len(jobs),
+	})
+}
+
+// jobAccepted 写入任务已创建的202响应
+func jobAccepted(c *gin.Context, scope *userScope, job *models.Job) {
+	c.Header("Location", "/api/v1/jobs/"+job.JobId)
+	c.JSON(http.StatusAccepted, models.JobResponse{
+		Success: true,
+		Job:     scope.stripJob(*job),
+	})
+}
+
+func jobError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrJobNotFound) {
+		status = http.StatusNotFound
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+)
+
+// PreferenceHandler 用户偏好设置
+type PreferenceHandler struct {
+	preferences *services.PreferenceService
+}
+
+func NewPreferenceHandler(preferences *services.PreferenceService) *PreferenceHandler {
+	return &PreferenceHandler{preferences: preferences}
+}
+
+// GetPreferences 获取偏好设置
+// @Summary      获取偏好设置
+// @Description  timezone 为计算今天、本周等时间范围使用的时区，未设置时为服务器的默认时区
+// @Tags         用户设置
+// @Produce      json
+// @Success      200  {object}  models.PreferencesResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /preferences [get]
+func (h *PreferenceHandler) GetPreferences(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	prefs, err := h.preferences.Get(scope.userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.PreferencesResponse{
+		Success:     true,
+		Preferences: prefs,
+	})
+}
+
+// SetPreferences 设置偏好设置
+// @Summary      设置偏好设置
+// @Description  timezone 为 IANA 时区名（如 Asia/Shanghai、America/New_York），为空表示使用默认时区
+// @Tags         用户设置
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.UserPreferences  true  "偏好设置"
+// @Success      200      {object}  models.PreferencesResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Router       /preferences [put]
+func (h *PreferenceHandler) SetPreferences(c *gin.Context) {
+	var req models.UserPreferences
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	prefs, err := h.preferences.Set(scope.userID, req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidTimezone) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.PreferencesResponse{
+		Success:     true,
+		Preferences: prefs,
+	})
+}
+
+// userNow 返回用户时区的当前时间，用于解析相对日期，失败时直接写入500响应
+func userNow(c *gin.Context, preferences *services.PreferenceService, scope *userScope) (time.Time, bool) {
+	now, err := preferences.Now(scope.userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return time.Time{}, false
+	}
+	return now, true
+}
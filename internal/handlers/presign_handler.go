@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+	"bkp-drive/pkg/tos"
+)
+
+// PresignHandler 预签名直传，大文件的上传和下载直接与对象存储交互
+type PresignHandler struct {
+	presign *services.PresignService
+}
+
+func NewPresignHandler(presign *services.PresignService) *PresignHandler {
+	return &PresignHandler{
+		presign: presign,
+	}
+}
+
+// PresignUpload 获取预签名上传URL
+// @Summary      获取上传URL
+// @Description  返回短期有效的PUT URL，客户端须携带 headers 中的 Content-Type 和 Content-Length 直接上传到存储，完成后调用 /presign/complete
+// @Tags         预签名直传
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.PresignUploadRequest  true  "上传请求"
+// @Success      200      {object}  models.PresignResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Router       /presign/upload [post]
+func (h *PresignHandler) PresignUpload(c *gin.Context) {
+	var req models.PresignUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if _, err := cleanUserPath(req.FileName); err != nil || strings.Contains(req.FileName, "/") {
+		if err == nil {
+			err = errors.New("文件名不能包含 /")
+		}
+		badPath(c, err)
+		return
+	}
+	folder, err := scope.folder(req.Folder)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+	key := strings.TrimSuffix(folder, "/") + "/" + req.FileName
+
+	expires, err := services.PresignExpiry(req.ExpiresIn)
+	if err != nil {
+		presignError(c, err)
+		return
+	}
+
+	presigned, err := h.presign.PresignUpload(scope.userID, key, req.Size, req.ContentType, expires)
+	if err != nil {
+		presignError(c, err)
+		return
+	}
+
+	presigned.Key = scope.strip(presigned.Key)
+	c.JSON(http.StatusOK, models.PresignResponse{
+		Success: true,
+		Message: "上传URL已生成",
+		Presign: *presigned,
+	})
+}
+
+// PresignDownload 获取预签名下载URL
+// @Summary      获取下载URL
+// @Description  返回短期有效的GET URL，客户端直接从存储下载
+// @Tags         预签名直传
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.PresignDownloadRequest  true  "下载请求"
+// @Success      200      {object}  models.PresignResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Router       /presign/download [post]
+func (h *PresignHandler) PresignDownload(c *gin.Context) {
+	var req models.PresignDownloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	key, err := scope.key(req.Key)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	expires, err := services.PresignExpiry(req.ExpiresIn)
+	if err != nil {
+		presignError(c, err)
+		return
+	}
+
+	presigned, err := h.presign.PresignDownload(key, path.Base(key), expires)
+	if err != nil {
+		presignError(c, err)
+		return
+	}
+
+	presigned.Key = scope.strip(presigned.Key)
+	c.JSON(http.StatusOK, models.PresignResponse{
+		Success: true,
+		Message: "下载URL已生成",
+		Presign: *presigned,
+	})
+}
+
+// CompletePresignedUpload 直传完成回调
+// @Summary      完成直传
+// @Description  客户端直传成功后调用，服务端确认文件已写入且大小与声明一致；大小不一致的文件会被删除
+// @Tags         预签名直传
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.PresignCompleteRequest  true  "完成请求"
+// @Success      200      {object}  models.UploadResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Failure      409      {object}  models.ErrorResponse
+// @Router       /presign/complete [post]
+func (h *PresignHandler) CompletePresignedUpload(c *gin.Context) {
+	var req models.PresignCompleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	info, err := h.presign.Complete(scope.userID, req.UploadId)
+	if err != nil {
+		presignError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Message: "文件上传成功",
+		Key:     scope.strip(info.Key),
+	})
+}
+
+// presignError 将预签名错误映射为HTTP状态码
+func presignError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPresignedUploadNotFound), errors.Is(err, tos.ErrObjectNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrPresignedObjectMissing):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrPresignUnsupported), errors.Is(err, services.ErrPresignedUploadMismatch),
+		errors.Is(err, services.ErrPresignTooLarge), errors.Is(err, services.ErrInvalidPresignExpiry):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrQuotaExceeded):
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+)
+
+// checkQuota 处理配额检查的结果，超过配额时写入413响应，其他错误写入500响应
+func checkQuota(c *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+	return false
+}
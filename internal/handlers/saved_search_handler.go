@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+)
+
+// SavedSearchHandler 保存的搜索（智能文件夹）
+type SavedSearchHandler struct {
+	searches    *services.SavedSearchService
+	preferences *services.PreferenceService
+}
+
+func NewSavedSearchHandler(searches *services.SavedSearchService, preferences *services.PreferenceService) *SavedSearchHandler {
+	return &SavedSearchHandler{
+		searches:    searches,
+		preferences: preferences,
+	}
+}
+
+// ListSavedSearches 列出保存的搜索
+// @Summary      列出保存的搜索
+// @Description  列出自己保存的和其他用户共享的搜索，按名称排序
+// @Tags         搜索功能
+// @Produce      json
+// @Success      200  {object}  models.SavedSearchListResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /saved-searches [get]
+func (h *SavedSearchHandler) ListSavedSearches(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	searches, err := h.searches.List(scope.userID)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SavedSearchListResponse{
+		Success:  true,
+		Searches: searches,
+		Total:    len(searches),
+	})
+}
+
+// CreateSavedSearch 保存搜索
+// @Summary      保存搜索
+// @Description  保存搜索条件，之后在文件列表根目录中作为智能文件夹出现；query 的语法与 /search 的 q 参数相同
+// @Tags         搜索功能
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.SavedSearchRequest  true  "名称和搜索条件"
+// @Success      201      {object}  models.SavedSearchResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Router       /saved-searches [post]
+func (h *SavedSearchHandler) CreateSavedSearch(c *gin.Context) {
+	scope, req, ok := bindSavedSearch(c)
+	if !ok {
+		return
+	}
+
+	search, err := h.searches.Create(scope.userID, req)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, models.SavedSearchResponse{
+		Success: true,
+		Message: "搜索已保存",
+		Search:  *search,
+	})
+}
+
+// GetSavedSearch 获取保存的搜索
+// @Summary      获取保存的搜索
+// @Tags         搜索功能
+// @Produce      json
+// @Param        id   path      string  true  "搜索ID"
+// @Success      200  {object}  models.SavedSearchResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Router       /saved-searches/{id} [get]
+func (h *SavedSearchHandler) GetSavedSearch(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	search, err := h.searches.Get(scope.userID, c.Param("id"))
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SavedSearchResponse{
+		Success: true,
+		Search:  *search,
+	})
+}
+
+// UpdateSavedSearch 修改保存的搜索
+// @Summary      修改保存的搜索
+// @Description  只有创建者可以修改
+// @Tags         搜索功能
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                     true  "搜索ID"
+// @Param        request  body      models.SavedSearchRequest  true  "名称和搜索条件"
+// @Success      200      {object}  models.SavedSearchResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      403      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Router       /saved-searches/{id} [put]
+func (h *SavedSearchHandler) UpdateSavedSearch(c *gin.Context) {
+	scope, req, ok := bindSavedSearch(c)
+	if !ok {
+		return
+	}
+
+	search, err := h.searches.Update(scope.userID, c.Param("id"), req)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SavedSearchResponse{
+		Success: true,
+		Message: "搜索已更新",
+		Search:  *search,
+	})
+}
+
+// DeleteSavedSearch 删除保存的搜索
+// @Summary      删除保存的搜索
+// @Description  创建者删除时同时取消所有共享；共享的接收者删除时只从自己的列表中移除
+// @Tags         搜索功能
+// @Produce      json
+// @Param        id   path      string  true  "搜索ID"
+// @Success      200  {object}  models.DeleteResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Router       /saved-searches/{id} [delete]
+func (h *SavedSearchHandler) DeleteSavedSearch(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.searches.Delete(scope.userID, c.Param("id")); err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.DeleteResponse{
+		Success: true,
+		Message: "搜索已删除",
+	})
+}
+
+// ShareSavedSearch 共享保存的搜索
+// @Summary      共享保存的搜索
+// @Description  共享的是搜索条件，接收者看到的是在自己文件中的搜索结果；只有创建者可以共享
+// @Tags         搜索功能
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                          true  "搜索ID"
+// @Param        request  body      models.ShareSavedSearchRequest  true  "接收者的用户名"
+// @Success      200      {object}  models.SavedSearchResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      403      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Router       /saved-searches/{id}/share [post]
+func (h *SavedSearchHandler) ShareSavedSearch(c *gin.Context) {
+	h.share(c, h.searches.Share, "搜索已共享")
+}
+
+// UnshareSavedSearch 取消共享保存的搜索
+// @Summary      取消共享保存的搜索
+// @Tags         搜索功能
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                          true  "搜索ID"
+// @Param        request  body      models.ShareSavedSearchRequest  true  "接收者的用户名"
+// @Success      200      {object}  models.SavedSearchResponse
+// @Failure      403      {object}  models.ErrorResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Router       /saved-searches/{id}/share [delete]
+func (h *SavedSearchHandler) UnshareSavedSearch(c *gin.Context) {
+	h.share(c, h.searches.Unshare, "已取消共享")
+}
+
+func (h *SavedSearchHandler) share(c *gin.Context, action func(userID, id, username string) (*models.SavedSearch, error), message string) {
+	var req models.ShareSavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	search, err := action(scope.userID, c.Param("id"), req.Username)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.SavedSearchResponse{
+		Success: true,
+		Message: message,
+		Search:  *search,
+	})
+}
+
+// GetSavedSearchResults 执行保存的搜索
+// @Summary      执行保存的搜索
+// @Description  按当前文件实时搜索，共享的搜索在自己的文件中执行；today 等相对日期按查看者的时区计算
+// @Tags         搜索功能
+// @Produce      json
+// @Param        id   path      string  true  "搜索ID"
+// @Success      200  {object}  models.SearchResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /saved-searches/{id}/results [get]
+func (h *SavedSearchHandler) GetSavedSearchResults(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	search, err := h.searches.Get(scope.userID, c.Param("id"))
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+	now, ok := userNow(c, h.preferences, scope)
+	if !ok {
+		return
+	}
+	result, err := h.searches.Run(search, scope.prefix, now)
+	if err != nil {
+		savedSearchError(c, err)
+		return
+	}
+
+	scope.stripResults(result.Results)
+	c.JSON(http.StatusOK, result)
+}
+
+// bindSavedSearch 解析创建和修改请求并校验文件夹路径
+func bindSavedSearch(c *gin.Context) (*userScope, models.SavedSearchRequest, bool) {
+	var req models.SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return nil, req, false
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return nil, req, false
+	}
+	if _, err := scope.folder(req.Folder); err != nil {
+		badPath(c, err)
+		return nil, req, false
+	}
+	return scope, req, true
+}
+
+func savedSearchError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrSavedSearchNotFound), errors.Is(err, services.ErrUserNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrNotSavedSearchOwner):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrInvalidSavedSearch):
+		status = http.StatusBadRequest
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
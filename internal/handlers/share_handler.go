@@ -4,7 +4,6 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"sync"
@@ -18,14 +17,14 @@ import (
 
 // ShareHandler 分享功能处理器
 type ShareHandler struct {
-	tosClient *tos.TOSClient
+	store     tos.ObjectStore
 	shares    map[string]*models.ShareInfo // 内存存储分享信息（生产环境应使用数据库）
 	mu        sync.RWMutex
 }
 
-func NewShareHandler(tosClient *tos.TOSClient) *ShareHandler {
+func NewShareHandler(store tos.ObjectStore) *ShareHandler {
 	return &ShareHandler{
-		tosClient: tosClient,
+		store:     store,
 		shares:    make(map[string]*models.ShareInfo),
 	}
 }
@@ -41,8 +40,19 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 		return
 	}
 
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	fileKey, err := scope.key(req.FileKey)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
 	// 验证文件是否存在
-	_, _, _, err := h.tosClient.GetObject(req.FileKey)
+	reader, fileSize, _, err := h.store.GetObject(fileKey)
 	if err != nil {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Success: false,
@@ -50,6 +60,7 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 		})
 		return
 	}
+	reader.Close()
 
 	// 生成分享ID
 	shareId, err := generateShareId()
@@ -64,14 +75,16 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 	// 创建分享信息
 	shareInfo := &models.ShareInfo{
 		ShareId:       shareId,
-		FileKey:       req.FileKey,
-		FileName:      getFileName(req.FileKey),
+		FileKey:       fileKey,
+		FileName:      getFileName(fileKey),
+		FileSize:      fileSize,
 		ShareUrl:      fmt.Sprintf("/api/v1/share/%s", shareId),
 		ExpiresAt:     req.ExpiresAt,
 		Password:      req.Password,
 		AllowDownload: req.AllowDownload,
 		AccessCount:   0,
 		CreatedAt:     time.Now(),
+		OwnerID:       scope.userID,
 	}
 
 	// 存储分享信息
@@ -82,7 +95,7 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 	c.JSON(http.StatusOK, models.ShareResponse{
 		Success:   true,
 		Message:   "分享创建成功",
-		ShareInfo: *shareInfo,
+		ShareInfo: scope.stripShare(*shareInfo),
 	})
 }
 
@@ -192,39 +205,25 @@ func (h *ShareHandler) DownloadSharedFile(c *gin.Context) {
 		return
 	}
 
-	// 下载文件
-	reader, contentLength, contentType, err := h.tosClient.GetObject(shareInfo.FileKey)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Success: false,
-			Error:   "下载文件失败: " + err.Error(),
-		})
-		return
-	}
-	defer reader.Close()
-
-	c.Header("Content-Disposition", "attachment; filename="+shareInfo.FileName)
-	c.Header("Content-Type", contentType)
-	c.Header("Content-Length", fmt.Sprintf("%d", contentLength))
-
-	_, err = io.Copy(c.Writer, reader)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Success: false,
-			Error:   "下载文件失败: " + err.Error(),
-		})
-		return
-	}
+	serveObject(c, h.store, shareInfo.FileKey, shareInfo.FileName)
 }
 
 // DeleteShare 删除分享链接
 func (h *ShareHandler) DeleteShare(c *gin.Context) {
 	shareId := c.Param("shareId")
 
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	// 只允许分享的创建者删除
 	h.mu.Lock()
-	_, exists := h.shares[shareId]
-	if exists {
+	shareInfo, exists := h.shares[shareId]
+	if exists && shareInfo.OwnerID == scope.userID {
 		delete(h.shares, shareId)
+	} else {
+		exists = false
 	}
 	h.mu.Unlock()
 
@@ -244,14 +243,23 @@ func (h *ShareHandler) DeleteShare(c *gin.Context) {
 
 // ListShares 列出用户的分享
 func (h *ShareHandler) ListShares(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
 	h.mu.RLock()
 	var shares []models.ShareInfo
 	for _, share := range h.shares {
+		// 只返回当前用户创建的分享
+		if share.OwnerID != scope.userID {
+			continue
+		}
 		// 清理过期分享
 		if time.Now().After(share.ExpiresAt) {
 			continue
 		}
-		shares = append(shares, *share)
+		shares = append(shares, scope.stripShare(*share))
 	}
 	h.mu.RUnlock()
 
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+)
+
+// TrashHandler 回收站：列出、恢复和永久删除
+type TrashHandler struct {
+	trash *services.TrashService
+}
+
+func NewTrashHandler(trash *services.TrashService) *TrashHandler {
+	return &TrashHandler{
+		trash: trash,
+	}
+}
+
+// ListTrash 列出回收站
+// @Summary      列出回收站
+// @Description  列出当前用户回收站中的条目，最近删除的在前；条目的 key 用于恢复和永久删除
+// @Tags         回收站
+// @Produce      json
+// @Success      200  {object}  models.TrashListResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /trash [get]
+func (h *TrashHandler) ListTrash(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	items, err := h.trash.List(scope.userID)
+	if err != nil {
+		trashError(c, err)
+		return
+	}
+
+	for i := range items {
+		items[i].OriginalPath = scope.strip(items[i].OriginalPath)
+	}
+	c.JSON(http.StatusOK, models.TrashListResponse{
+		Success: true,
+		Items:   items,
+		Total:   len(items),
+	})
+}
+
+// RestoreTrash 恢复回收站条目
+// @Summary      恢复回收站条目
+// @Description  恢复到原路径；原路径已被占用时按 onConflict 处理：rename（默认，恢复为 "name (1).ext"）、overwrite 或 fail
+// @Tags         回收站
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.RestoreRequest  true  "恢复请求"
+// @Success      200      {object}  models.RestoreResponse
+// @Success      206      {object}  models.RestoreResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Router       /trash/restore [post]
+func (h *TrashHandler) RestoreTrash(c *gin.Context) {
+	var req models.RestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if _, err := services.ParseConflictPolicy(req.OnConflict); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result := models.RestoreResponse{Restored: map[string]string{}}
+	for _, id := range req.Items {
+		dest, err := h.trash.Restore(scope.userID, id, req.OnConflict)
+		if err != nil {
+			result.Failed++
+			result.FailedItems = append(result.FailedItems, id)
+			continue
+		}
+		result.Processed++
+		result.Restored[id] = scope.strip(dest)
+	}
+	result.Success = result.Failed == 0
+	result.Message = fmt.Sprintf("恢复完成，成功: %d, 失败: %d", result.Processed, result.Failed)
+
+	if result.Success {
+		c.JSON(http.StatusOK, result)
+	} else {
+		c.JSON(http.StatusPartialContent, result)
+	}
+}
+
+// DeleteTrashItem 永久删除回收站条目
+// @Summary      永久删除回收站条目
+// @Tags         回收站
+// @Produce      json
+// @Param        id   path      string  true  "回收站条目的 key"
+// @Success      200  {object}  models.DeleteResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Router       /trash/{id} [delete]
+func (h *TrashHandler) DeleteTrashItem(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.trash.Delete(scope.userID, c.Param("id")); err != nil {
+		trashError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeleteResponse{
+		Success: true,
+		Message: "已永久删除",
+	})
+}
+
+// EmptyTrash 清空回收站
+// @Summary      清空回收站
+// @Description  永久删除回收站中的所有条目，部分失败时返回206和失败的条目
+// @Tags         回收站
+// @Produce      json
+// @Success      200  {object}  models.BatchOperationResponse
+// @Success      206  {object}  models.BatchOperationResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /trash [delete]
+func (h *TrashHandler) EmptyTrash(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.trash.Empty(scope.userID)
+	if err != nil {
+		trashError(c, err)
+		return
+	}
+
+	if result.Success {
+		c.JSON(http.StatusOK, result)
+	} else {
+		c.JSON(http.StatusPartialContent, result)
+	}
+}
+
+func trashError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrTrashItemNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrRestoreConflict):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidConflictPolicy):
+		status = http.StatusBadRequest
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum"
+	// tusOffsetContentType PATCH 请求体必须使用的 Content-Type
+	tusOffsetContentType = "application/offset+octet-stream"
+	// statusChecksumMismatch tus checksum 扩展定义的校验失败状态码
+	statusChecksumMismatch = 460
+)
+
+// TusHandler tus 1.0 可续传上传协议（creation、termination、checksum 扩展）
+type TusHandler struct {
+	tus *services.TusService
+}
+
+func NewTusHandler(tus *services.TusService) *TusHandler {
+	return &TusHandler{
+		tus: tus,
+	}
+}
+
+// Options 返回服务端支持的 tus 版本和扩展
+// @Summary      tus 能力发现
+// @Tags         tus上传
+// @Success      204
+// @Router       /tus/ [options]
+func (h *TusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Checksum-Algorithm", strings.Join(services.TusChecksumAlgorithms, ","))
+	c.Status(http.StatusNoContent)
+}
+
+// Create 创建上传
+// @Summary      创建 tus 上传
+// @Description  Upload-Metadata 中 filename 为文件名（必填），folder 为目标文件夹，filetype 为文件类型
+// @Tags         tus上传
+// @Param        Tus-Resumable    header  string  true   "1.0.0"
+// @Param        Upload-Length    header  int     true   "文件大小"
+// @Param        Upload-Metadata  header  string  false  "Base64编码的元数据"
+// @Success      201
+// @Failure      400  {object}  models.ErrorResponse
+// @Router       /tus/ [post]
+func (h *TusHandler) Create(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		tusError(c, http.StatusBadRequest, "缺少或无效的 Upload-Length")
+		return
+	}
+
+	rawMetadata := c.GetHeader("Upload-Metadata")
+	metadata, err := parseTusMetadata(rawMetadata)
+	if err != nil {
+		tusError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fileName := metadata["filename"]
+	if _, err := cleanUserPath(fileName); err != nil || fileName == "" || strings.Contains(fileName, "/") {
+		tusError(c, http.StatusBadRequest, "Upload-Metadata 中的 filename 无效")
+		return
+	}
+	folder, err := scope.folder(metadata["folder"])
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+	key := strings.TrimSuffix(folder, "/") + "/" + fileName
+
+	contentType := metadata["filetype"]
+	if contentType == "" {
+		contentType = metadata["contentType"]
+	}
+
+	upload, err := h.tus.Create(scope.userID, key, length, contentType, rawMetadata)
+	if err != nil {
+		tusServiceError(c, err)
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.FullPath(), "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// Head 查询上传偏移量
+// @Summary      查询 tus 上传偏移量
+// @Tags         tus上传
+// @Param        id             path    string  true  "上传ID"
+// @Param        Tus-Resumable  header  string  true  "1.0.0"
+// @Success      200
+// @Failure      404
+// @Router       /tus/{id} [head]
+func (h *TusHandler) Head(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	upload, err := h.tus.Get(scope.userID, c.Param("id"))
+	if err != nil {
+		tusServiceError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+// Patch 从指定偏移量追加数据
+// @Summary      上传 tus 数据
+// @Description  请求体为从 Upload-Offset 开始的数据，可选 Upload-Checksum 校验
+// @Tags         tus上传
+// @Accept       application/offset+octet-stream
+// @Param        id               path    string  true   "上传ID"
+// @Param        Tus-Resumable    header  string  true   "1.0.0"
+// @Param        Upload-Offset    header  int     true   "当前偏移量"
+// @Param        Upload-Checksum  header  string  false  "校验算法和Base64摘要"
+// @Success      204
+// @Failure      404
+// @Failure      409
+// @Failure      460
+// @Router       /tus/{id} [patch]
+func (h *TusHandler) Patch(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if c.ContentType() != tusOffsetContentType {
+		tusError(c, http.StatusUnsupportedMediaType, "Content-Type 必须为 "+tusOffsetContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		tusError(c, http.StatusBadRequest, "缺少或无效的 Upload-Offset")
+		return
+	}
+
+	var checksum *services.TusChecksum
+	if header := c.GetHeader("Upload-Checksum"); header != "" {
+		checksum, err = services.ParseTusChecksum(header)
+		if err != nil {
+			tusError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	upload, err := h.tus.Write(scope.userID, c.Param("id"), offset, c.Request.Body, checksum)
+	if err != nil {
+		tusServiceError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+// Delete 终止上传
+// @Summary      终止 tus 上传
+// @Tags         tus上传
+// @Param        id             path    string  true  "上传ID"
+// @Param        Tus-Resumable  header  string  true  "1.0.0"
+// @Success      204
+// @Failure      404
+// @Router       /tus/{id} [delete]
+func (h *TusHandler) Delete(c *gin.Context) {
+	if !tusResumable(c) {
+		return
+	}
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.tus.Terminate(scope.userID, c.Param("id")); err != nil {
+		tusServiceError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// tusResumable 设置 Tus-Resumable 响应头，并拒绝不支持的协议版本
+func tusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		tusError(c, http.StatusPreconditionFailed, "不支持的 tus 协议版本")
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata 解析 Upload-Metadata 头（"key base64value,key2"）
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("Upload-Metadata 格式错误")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Upload-Metadata 中 %s 的值不是有效的Base64", key)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
+
+func tusServiceError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrTusUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrTusOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrTusSizeExceeded), errors.Is(err, services.ErrQuotaExceeded):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrTusChecksumMismatch):
+		status = statusChecksumMismatch
+	case errors.Is(err, services.ErrMultipartUnsupported):
+		status = http.StatusBadRequest
+	}
+	tusError(c, status, err.Error())
+}
+
+func tusError(c *gin.Context, status int, message string) {
+	c.Header("Cache-Control", "no-store")
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   message,
+	})
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+	"bkp-drive/pkg/tos"
+)
+
+// UploadHandler 可续传的分片上传会话
+type UploadHandler struct {
+	uploads *services.UploadService
+}
+
+func NewUploadHandler(uploads *services.UploadService) *UploadHandler {
+	return &UploadHandler{
+		uploads: uploads,
+	}
+}
+
+// InitiateUpload 创建分片上传会话
+// @Summary      创建上传会话
+// @Description  创建可续传的分片上传会话，返回会话ID和建议的分片大小
+// @Tags         分片上传
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.InitiateUploadRequest  true  "上传请求"
+// @Success      200      {object}  models.UploadSessionResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Failure      500      {object}  models.ErrorResponse
+// @Router       /uploads [post]
+func (h *UploadHandler) InitiateUpload(c *gin.Context) {
+	var req models.InitiateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if _, err := cleanUserPath(req.FileName); err != nil || strings.Contains(req.FileName, "/") {
+		if err == nil {
+			err = errors.New("文件名不能包含 /")
+		}
+		badPath(c, err)
+		return
+	}
+	folder, err := scope.folder(req.Folder)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+	key := strings.TrimSuffix(folder, "/") + "/" + req.FileName
+
+	session, err := h.uploads.Initiate(scope.userID, key, req.Size, req.ContentType)
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+
+	session.Key = scope.strip(session.Key)
+	c.JSON(http.StatusOK, models.UploadSessionResponse{
+		Success: true,
+		Message: "上传会话已创建",
+		Session: *session,
+	})
+}
+
+// ListUploads 列出未完成的上传会话
+// @Summary      列出上传会话
+// @Description  列出当前用户所有未完成的上传会话，用于断点续传
+// @Tags         分片上传
+// @Produce      json
+// @Success      200  {object}  models.UploadSessionListResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /uploads [get]
+func (h *UploadHandler) ListUploads(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.uploads.List(scope.userID)
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Key = scope.strip(sessions[i].Key)
+	}
+	c.JSON(http.StatusOK, models.UploadSessionListResponse{
+		Success:  true,
+		Message:  "获取上传会话成功",
+		Sessions: sessions,
+		Total:    len(sessions),
+	})
+}
+
+// GetUpload 获取上传会话及已上传的分片
+// @Summary      获取上传会话
+// @Description  获取上传会话信息和已上传的分片列表，客户端据此跳过已上传的分片
+// @Tags         分片上传
+// @Produce      json
+// @Param        sessionId  path      string  true  "会话ID"
+// @Success      200        {object}  models.UploadSessionResponse
+// @Failure      404        {object}  models.ErrorResponse
+// @Router       /uploads/{sessionId} [get]
+func (h *UploadHandler) GetUpload(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	session, err := h.uploads.Get(scope.userID, c.Param("sessionId"))
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+
+	session.Key = scope.strip(session.Key)
+	c.JSON(http.StatusOK, models.UploadSessionResponse{
+		Success: true,
+		Message: "获取上传会话成功",
+		Session: *session,
+	})
+}
+
+// UploadPart 上传一个分片
+// @Summary      上传分片
+// @Description  请求体为分片的原始内容，必须带 Content-Length；重复上传同一编号会覆盖
+// @Tags         分片上传
+// @Accept       application/octet-stream
+// @Produce      json
+// @Param        sessionId   path      string  true  "会话ID"
+// @Param        partNumber  path      int     true  "分片编号（1-10000）"
+// @Success      200         {object}  models.UploadPartResponse
+// @Failure      400         {object}  models.ErrorResponse
+// @Failure      404         {object}  models.ErrorResponse
+// @Failure      411         {object}  models.ErrorResponse
+// @Router       /uploads/{sessionId}/parts/{partNumber} [put]
+func (h *UploadHandler) UploadPart(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	partNumber, err := strconv.Atoi(c.Param("partNumber"))
+	if err != nil || partNumber < tos.MinPartNumber || partNumber > tos.MaxPartNumber {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "分片编号必须在 1 到 10000 之间",
+		})
+		return
+	}
+	if c.Request.ContentLength < 0 {
+		c.JSON(http.StatusLengthRequired, models.ErrorResponse{
+			Success: false,
+			Error:   "上传分片需要 Content-Length",
+		})
+		return
+	}
+
+	part, err := h.uploads.UploadPart(scope.userID, c.Param("sessionId"), partNumber, c.Request.Body, c.Request.ContentLength)
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadPartResponse{
+		Success: true,
+		Message: "分片上传成功",
+		Part:    *part,
+	})
+}
+
+// CompleteUpload 合并分片完成上传
+// @Summary      完成上传
+// @Description  按编号顺序合并所有已上传的分片，分片必须从1开始连续
+// @Tags         分片上传
+// @Produce      json
+// @Param        sessionId  path      string  true  "会话ID"
+// @Success      200        {object}  models.UploadResponse
+// @Failure      400        {object}  models.ErrorResponse
+// @Failure      404        {object}  models.ErrorResponse
+// @Router       /uploads/{sessionId}/complete [post]
+func (h *UploadHandler) CompleteUpload(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	key, err := h.uploads.Complete(scope.userID, c.Param("sessionId"))
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Message: "文件上传成功",
+		Key:     scope.strip(key),
+	})
+}
+
+// AbortUpload 取消上传会话
+// @Summary      取消上传
+// @Description  取消上传会话并删除已上传的分片
+// @Tags         分片上传
+// @Produce      json
+// @Param        sessionId  path      string  true  "会话ID"
+// @Success      200        {object}  models.DeleteResponse
+// @Failure      404        {object}  models.ErrorResponse
+// @Router       /uploads/{sessionId} [delete]
+func (h *UploadHandler) AbortUpload(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.uploads.Abort(scope.userID, c.Param("sessionId")); err != nil {
+		uploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeleteResponse{
+		Success: true,
+		Message: "上传已取消",
+	})
+}
+
+// uploadError 将上传会话错误映射为HTTP状态码
+func uploadError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrUploadSessionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrMultipartUnsupported), errors.Is(err, services.ErrIncompleteUpload):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrQuotaExceeded):
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
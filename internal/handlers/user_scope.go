@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+)
+
+// userRootPrefix 所有用户空间的根前缀，每个用户的对象都位于 users/<user_id>/ 下
+const userRootPrefix = "users/"
+
+// userScope 当前登录用户的命名空间，负责用户相对路径与存储对象键之间的转换
+type userScope struct {
+	userID string
+	prefix string
+}
+
+// requireUserScope 从认证中间件设置的 user_id 构建用户命名空间，失败时直接写入401响应
+func requireUserScope(c *gin.Context) (*userScope, bool) {
+	userID := c.GetString("user_id")
+	if userID == "" || userID == "." || userID == ".." || strings.ContainsAny(userID, "/\\") {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Success: false,
+			Error:   "用户未登录",
+		})
+		return nil, false
+	}
+
+	return &userScope{
+		userID: userID,
+		prefix: userRootPrefix + userID + "/",
+	}, true
+}
+
+// cleanUserPath 校验用户传入的相对路径，拒绝路径穿越和绝对路径
+func cleanUserPath(p string) (string, error) {
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, "\\") {
+		return "", fmt.Errorf("路径不能以 / 开头: %s", p)
+	}
+	if strings.ContainsAny(p, "\\\x00") {
+		return "", fmt.Errorf("路径包含非法字符: %s", p)
+	}
+
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("路径不能包含 . 或 ..: %s", p)
+		}
+		// 只允许末尾的空段（表示文件夹）
+		if segment == "" && i != len(segments)-1 {
+			return "", fmt.Errorf("路径包含空的层级: %s", p)
+		}
+	}
+
+	return p, nil
+}
+
+// key 将用户相对路径转换为存储中的完整对象键，路径不能为空
+func (s *userScope) key(p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("路径不能为空")
+	}
+	cleaned, err := cleanUserPath(p)
+	if err != nil {
+		return "", err
+	}
+	return s.prefix + cleaned, nil
+}
+
+// folder 将用户相对文件夹路径转换为完整前缀，空路径表示用户根目录
+func (s *userScope) folder(p string) (string, error) {
+	if p == "" || p == "/" {
+		return s.prefix, nil
+	}
+	cleaned, err := cleanUserPath(p)
+	if err != nil {
+		return "", err
+	}
+	return s.prefix + cleaned, nil
+}
+
+// keys 批量转换用户相对路径
+func (s *userScope) keys(paths []string) ([]string, error) {
+	keys := make([]string, 0, len(paths))
+	for _, p := range paths {
+		key, err := s.key(p)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// strip 将完整对象键还原为用户相对路径
+func (s *userScope) strip(key string) string {
+	return strings.TrimPrefix(key, s.prefix)
+}
+
+// stripAll 批量还原用户相对路径
+func (s *userScope) stripAll(keys []string) []string {
+	if keys == nil {
+		return nil
+	}
+	stripped := make([]string, 0, len(keys))
+	for _, key := range keys {
+		stripped = append(stripped, s.strip(key))
+	}
+	return stripped
+}
+
+// stripResults 将搜索结果中的对象键还原为用户相对路径
+func (s *userScope) stripResults(results []models.ExtendedFileInfo) {
+	for i := range results {
+		results[i].Key = s.strip(results[i].Key)
+		results[i].Path = s.strip(results[i].Path)
+	}
+}
+
+// stripShare 返回对象键已还原为用户相对路径的分享信息副本
+func (s *userScope) stripShare(share models.ShareInfo) models.ShareInfo {
+	share.FileKey = s.strip(share.FileKey)
+	return share
+}
+
+// stripJob 返回结果路径已还原为用户相对路径的任务副本
+func (s *userScope) stripJob(job models.Job) models.Job {
+	job.ResultKey = s.strip(job.ResultKey)
+	return job
+}
+
+// badPath 写入路径非法的400响应
+func badPath(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Success: false,
+		Error:   "路径不合法: " + err.Error(),
+	})
+}
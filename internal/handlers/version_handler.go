@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/internal/services"
+	"bkp-drive/pkg/tos"
+)
+
+// VersionHandler 文件的历史版本
+type VersionHandler struct {
+	store    tos.ObjectStore
+	versions *services.VersionService
+}
+
+func NewVersionHandler(store tos.ObjectStore, versions *services.VersionService) *VersionHandler {
+	return &VersionHandler{
+		store:    store,
+		versions: versions,
+	}
+}
+
+// ListVersions 列出文件的版本
+// @Summary      列出文件版本
+// @Description  列出文件的当前版本（versionId 为 current）和历史版本，最新的在前
+// @Tags         历史版本
+// @Produce      json
+// @Param        key  query     string  true  "文件路径"
+// @Success      200  {object}  models.VersionListResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Router       /versions [get]
+func (h *VersionHandler) ListVersions(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+	key, err := scope.key(c.Query("key"))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	versions, err := h.versions.List(key)
+	if err != nil {
+		versionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.VersionListResponse{
+		Success:  true,
+		Key:      scope.strip(key),
+		Versions: versions,
+	})
+}
+
+// DownloadVersion 下载指定版本
+// @Summary      下载文件版本
+// @Description  支持 Range 和条件请求
+// @Tags         历史版本
+// @Produce      octet-stream
+// @Param        key        query  string  true  "文件路径"
+// @Param        versionId  query  string  true  "版本ID"
+// @Success      200
+// @Failure      404  {object}  models.ErrorResponse
+// @Router       /versions/download [get]
+func (h *VersionHandler) DownloadVersion(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+	key, err := scope.key(c.Query("key"))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	versioned, err := h.versions.ObjectKey(key, c.Query("versionId"))
+	if err != nil {
+		versionError(c, err)
+		return
+	}
+
+	serveObject(c, h.store, versioned, path.Base(key))
+}
+
+// RestoreVersion 将历史版本恢复为当前版本
+// @Summary      恢复文件版本
+// @Description  被替换的当前内容保存为新的历史版本
+// @Tags         历史版本
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.RestoreVersionRequest  true  "恢复请求"
+// @Success      200      {object}  models.VersionListResponse
+// @Failure      404      {object}  models.ErrorResponse
+// @Router       /versions/restore [post]
+func (h *VersionHandler) RestoreVersion(c *gin.Context) {
+	var req models.RestoreVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+	key, err := scope.key(req.Key)
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	if err := h.versions.Restore(scope.userID, key, req.VersionId); err != nil {
+		versionError(c, err)
+		return
+	}
+
+	versions, err := h.versions.List(key)
+	if err != nil {
+		versionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.VersionListResponse{
+		Success:  true,
+		Key:      req.Key,
+		Versions: versions,
+	})
+}
+
+// DeleteVersion 删除历史版本
+// @Summary      删除历史版本
+// @Tags         历史版本
+// @Produce      json
+// @Param        key        query     string  true  "文件路径"
+// @Param        versionId  query     string  true  "版本ID"
+// @Success      200        {object}  models.DeleteResponse
+// @Failure      400        {object}  models.ErrorResponse
+// @Failure      404        {object}  models.ErrorResponse
+// @Router       /versions [delete]
+func (h *VersionHandler) DeleteVersion(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+	key, err := scope.key(c.Query("key"))
+	if err != nil {
+		badPath(c, err)
+		return
+	}
+
+	if err := h.versions.Delete(key, c.Query("versionId")); err != nil {
+		versionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DeleteResponse{
+		Success: true,
+		Message: "历史版本已删除",
+	})
+}
+
+// GetVersionPolicy 获取历史版本保留策略
+// @Summary      获取版本保留策略
+// @Tags         历史版本
+// @Produce      json
+// @Success      200  {object}  models.VersionPolicyResponse
+// @Router       /versions/policy [get]
+func (h *VersionHandler) GetVersionPolicy(c *gin.Context) {
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	policy, err := h.versions.Policy(scope.userID)
+	if err != nil {
+		versionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.VersionPolicyResponse{
+		Success: true,
+		Policy:  policy,
+	})
+}
+
+// SetVersionPolicy 设置历史版本保留策略
+// @Summary      设置版本保留策略
+// @Description  keepLast 为每个文件保留的历史版本数，keepDays 为保留天数，0 表示不限制；保存后立即按新策略清理
+// @Tags         历史版本
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.VersionPolicy  true  "保留策略"
+// @Success      200      {object}  models.VersionPolicyResponse
+// @Failure      400      {object}  models.ErrorResponse
+// @Router       /versions/policy [put]
+func (h *VersionHandler) SetVersionPolicy(c *gin.Context) {
+	var policy models.VersionPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	scope, ok := requireUserScope(c)
+	if !ok {
+		return
+	}
+
+	if err := h.versions.SetPolicy(scope.userID, policy); err != nil {
+		versionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.VersionPolicyResponse{
+		Success: true,
+		Policy:  policy,
+	})
+}
+
+func versionError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrVersionNotFound), errors.Is(err, tos.ErrObjectNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrDeleteCurrentVersion), errors.Is(err, services.ErrInvalidVersionPolicy):
+		status = http.StatusBadRequest
+	}
+
+	c.JSON(status, models.ErrorResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
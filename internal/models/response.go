@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"bkp-drive/pkg/daterange"
+	"bkp-drive/pkg/searchquery"
+)
 
 // 基础文件信息
 type FileInfo struct {
@@ -21,6 +26,8 @@ type ExtendedFileInfo struct {
 	Thumbnail   string `json:"thumbnail,omitempty"`
 	ShareCount  int    `json:"shareCount"`
 	VersionCount int   `json:"versionCount"`
+	Snippet     string  `json:"snippet,omitempty"` // 全文检索时匹配内容的摘要（HTML），匹配词以 <mark> 标记
+	Score       float64 `json:"score,omitempty"`   // 全文检索的相关度
 }
 
 // 批量操作请求
@@ -60,10 +67,49 @@ type SearchRequest struct {
 	FileTypes  []string `json:"fileTypes,omitempty"`
 	MinSize    int64    `json:"minSize,omitempty"`
 	MaxSize    int64    `json:"maxSize,omitempty"`
-	StartDate  string   `json:"startDate,omitempty"`
-	EndDate    string   `json:"endDate,omitempty"`
 	Folder     string   `json:"folder,omitempty"`
 	Limit      int      `json:"limit,omitempty"`
+	Content    bool     `json:"content,omitempty"` // 在文件内容中搜索 Query，结果按相关度排序
+	// 修改时间范围，由 startDate、endDate 或 FilterFiles 的 time 参数按用户时区解析得到
+	Modified   daterange.Range `json:"-"`
+	// 结构化查询（见 pkg/searchquery）解析得到的条件和排序，与上面的条件同时生效
+	Filter     *searchquery.Node  `json:"-"`
+	Sort       []searchquery.Sort `json:"-"`
+}
+
+// 用户偏好设置
+type UserPreferences struct {
+	Timezone string `json:"timezone"` // IANA 时区名，如 Asia/Shanghai，决定今天、本周等时间范围的起止
+}
+
+type PreferencesResponse struct {
+	Success     bool            `json:"success"`
+	Preferences UserPreferences `json:"preferences"`
+}
+
+// 保存的搜索（智能文件夹），每次查看时按当前文件重新搜索
+type SavedSearch struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner"` // 创建者的用户ID
+	Name       string    `json:"name"`
+	Query      string    `json:"query"`            // 结构化查询，语法与 /search 的 q 参数相同
+	Folder     string    `json:"folder,omitempty"` // 搜索的文件夹，空表示全部文件
+	Content    bool      `json:"content,omitempty"`
+	SharedWith []string  `json:"sharedWith,omitempty"` // 共享给的用户ID，只有创建者可见
+	Path       string    `json:"path"`                 // 在文件列表中的虚拟文件夹路径
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type SavedSearchRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Query   string `json:"query"`
+	Folder  string `json:"folder"`
+	Content bool   `json:"content"`
+}
+
+type ShareSavedSearchRequest struct {
+	Username string `json:"username" binding:"required"`
 }
 
 // 分享相关
@@ -85,17 +131,38 @@ type ShareInfo struct {
 	AllowDownload bool      `json:"allowDownload"`
 	AccessCount   int       `json:"accessCount"`
 	CreatedAt     time.Time `json:"createdAt"`
+	OwnerID       string    `json:"-"` // 分享创建者的用户ID
 }
 
 // 存储统计
 type StorageStats struct {
-	TotalSpace    int64             `json:"totalSpace"`
-	UsedSpace     int64             `json:"usedSpace"`
-	FreeSpace     int64             `json:"freeSpace"`
-	FileCount     int64             `json:"fileCount"`
-	FolderCount   int64             `json:"folderCount"`
-	FileTypeStats map[string]int64  `json:"fileTypeStats"`
-	RecentUsage   []DayUsage        `json:"recentUsage"`
+	TotalSpace    int64                   `json:"totalSpace"`
+	UsedSpace     int64                   `json:"usedSpace"`
+	LogicalSize   int64                   `json:"logicalSize"`  // 所有文件大小之和
+	PhysicalSize  int64                   `json:"physicalSize"` // 去重后实际占用的存储空间
+	FreeSpace     int64                   `json:"freeSpace"`
+	TrashSize     int64                   `json:"trashSize"`   // 回收站占用的空间
+	VersionSize   int64                   `json:"versionSize"` // 历史版本占用的空间
+	FileCount     int64                   `json:"fileCount"`
+	FolderCount   int64                   `json:"folderCount"`
+	FileTypeStats map[string]int64        `json:"fileTypeStats"`
+	CategoryStats map[string]CategoryStat `json:"categoryStats"`
+	RecentUsage   []DayUsage              `json:"recentUsage"`
+}
+
+// CategoryStat 某一分类（image、video、document 等）的文件数和占用空间
+type CategoryStat struct {
+	FileCount int64 `json:"fileCount"`
+	Size      int64 `json:"size"`
+}
+
+// QuotaUsage 用户的配额和占用空间，Quota 为 0 表示不限制
+type QuotaUsage struct {
+	Quota       int64 `json:"quota"`
+	UsedSize    int64 `json:"usedSize"`
+	FileSize    int64 `json:"fileSize"`
+	TrashSize   int64 `json:"trashSize"`
+	VersionSize int64 `json:"versionSize"`
 }
 
 type DayUsage struct {
@@ -107,13 +174,31 @@ type DayUsage struct {
 // 回收站相关
 type TrashItem struct {
 	FileInfo
-	DeletedAt    time.Time `json:"deletedAt"`
-	OriginalPath string    `json:"originalPath"`
-	DeletedBy    string    `json:"deletedBy,omitempty"`
+	DeletedAt    time.Time  `json:"deletedAt"`
+	OriginalPath string     `json:"originalPath"`
+	DeletedBy    string     `json:"deletedBy,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"` // 自动清理的时间，未开启自动清理时为空
 }
 
 type RestoreRequest struct {
-	Items []string `json:"items" binding:"required"`
+	Items      []string `json:"items" binding:"required"`
+	OnConflict string   `json:"onConflict,omitempty"` // 原路径已被占用时：rename（默认）、overwrite 或 fail
+}
+
+// RestoreResponse 恢复结果，Restored 为条目ID到恢复后路径的映射
+type RestoreResponse struct {
+	Success     bool              `json:"success"`
+	Message     string            `json:"message"`
+	Processed   int               `json:"processed"`
+	Failed      int               `json:"failed"`
+	FailedItems []string          `json:"failedItems,omitempty"`
+	Restored    map[string]string `json:"restored,omitempty"`
+}
+
+type TrashListResponse struct {
+	Success bool        `json:"success"`
+	Items   []TrashItem `json:"items"`
+	Total   int         `json:"total"`
 }
 
 // 版本管理
@@ -126,6 +211,28 @@ type FileVersion struct {
 	Comment      string    `json:"comment,omitempty"`
 }
 
+type VersionListResponse struct {
+	Success  bool          `json:"success"`
+	Key      string        `json:"key"`
+	Versions []FileVersion `json:"versions"`
+}
+
+type RestoreVersionRequest struct {
+	Key       string `json:"key" binding:"required"`
+	VersionId string `json:"versionId" binding:"required"`
+}
+
+// VersionPolicy 历史版本保留策略，超过任一限制的历史版本会被删除，0 表示不限制
+type VersionPolicy struct {
+	KeepLast int `json:"keepLast"` // 每个文件最多保留的历史版本数
+	KeepDays int `json:"keepDays"` // 历史版本的保留天数
+}
+
+type VersionPolicyResponse struct {
+	Success bool          `json:"success"`
+	Policy  VersionPolicy `json:"policy"`
+}
+
 // 压缩相关
 type CompressRequest struct {
 	Items      []string `json:"items" binding:"required"`
@@ -136,6 +243,99 @@ type CompressRequest struct {
 type ExtractRequest struct {
 	ArchiveKey string `json:"archiveKey" binding:"required"`
 	OutputPath string `json:"outputPath"`
+	OnConflict string `json:"onConflict"` // rename（默认）、overwrite、fail
+}
+
+type DownloadZipRequest struct {
+	Items []string `json:"items" binding:"required"`
+	Name  string   `json:"name"` // 下载的文件名，默认为单个条目的名称或 download.zip
+}
+
+// 后台任务相关
+type JobProgress struct {
+	TotalFiles     int     `json:"totalFiles"`
+	ProcessedFiles int     `json:"processedFiles"`
+	TotalBytes     int64   `json:"totalBytes"`
+	ProcessedBytes int64   `json:"processedBytes"`
+	Percent        float64 `json:"percent"`
+}
+
+type Job struct {
+	JobId       string      `json:"jobId"`
+	Type        string      `json:"type"`   // compress, extract
+	Status      string      `json:"status"` // pending, running, completed, failed
+	Progress    JobProgress `json:"progress"`
+	ResultKey   string      `json:"resultKey,omitempty"` // 完成后生成的文件或文件夹
+	Message     string      `json:"message,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	CompletedAt *time.Time  `json:"completedAt,omitempty"`
+}
+
+type JobResponse struct {
+	Success bool `json:"success"`
+	Job     Job  `json:"job"`
+}
+
+type JobListResponse struct {
+	Success bool  `json:"success"`
+	Jobs    []Job `json:"jobs"`
+	Total   int   `json:"total"`
+}
+
+// 分片上传相关
+type InitiateUploadRequest struct {
+	FileName    string `json:"fileName" binding:"required"`
+	Folder      string `json:"folder"`
+	Size        int64  `json:"size"` // 文件总大小，可选，完成时校验
+	ContentType string `json:"contentType"` // 完成时按文件内容重新判断
+}
+
+type UploadPartInfo struct {
+	PartNumber   int       `json:"partNumber"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+type UploadSession struct {
+	SessionId    string           `json:"sessionId"`
+	Key          string           `json:"key"`
+	FileName     string           `json:"fileName"`
+	Size         int64            `json:"size"`
+	PartSize     int64            `json:"partSize"` // 建议的分片大小
+	ContentType  string           `json:"contentType"`
+	UploadedSize int64            `json:"uploadedSize"`
+	Parts        []UploadPartInfo `json:"parts"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	ExpiresAt    time.Time        `json:"expiresAt"`
+}
+
+// 预签名直传相关
+type PresignUploadRequest struct {
+	FileName    string `json:"fileName" binding:"required"`
+	Folder      string `json:"folder"`
+	Size        int64  `json:"size" binding:"min=0"` // 客户端上传时 Content-Length 必须与之相同
+	ContentType string `json:"contentType"` // 仅用于签名，完成回调时按文件内容重新判断
+	ExpiresIn   int    `json:"expiresIn"` // 有效期（秒），默认900，最大3600
+}
+
+type PresignDownloadRequest struct {
+	Key       string `json:"key" binding:"required"`
+	ExpiresIn int    `json:"expiresIn"`
+}
+
+type PresignCompleteRequest struct {
+	UploadId string `json:"uploadId" binding:"required"`
+}
+
+type PresignedURL struct {
+	UploadId  string            `json:"uploadId,omitempty"` // 仅上传返回，完成后回调时使用
+	Key       string            `json:"key"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"` // 请求时必须携带的请求头
+	ExpiresAt time.Time         `json:"expiresAt"`
 }
 
 // 通用响应结构
@@ -147,11 +347,15 @@ type UploadResponse struct {
 }
 
 type ListResponse struct {
-	Success bool       `json:"success"`
-	Message string     `json:"message"`
-	Files   []FileInfo `json:"files,omitempty"`
-	Folders []string   `json:"folders,omitempty"`
-	Total   int        `json:"total"`
+	Success   bool       `json:"success"`
+	Message   string     `json:"message"`
+	Files     []FileInfo `json:"files,omitempty"`
+	Folders   []string   `json:"folders,omitempty"`
+	Total     int        `json:"total"` // 本页的条目数
+	HasMore   bool       `json:"hasMore"`
+	NextToken string     `json:"nextToken,omitempty"` // 传给下一次请求的 token 参数
+	// SmartFolders 保存的搜索，只在根目录的第一页返回，以 path 作为 prefix 列出搜索结果
+	SmartFolders []SavedSearch `json:"smartFolders,omitempty"`
 }
 
 type SearchResponse struct {
@@ -162,6 +366,18 @@ type SearchResponse struct {
 	Query   string             `json:"query"`
 }
 
+type SavedSearchResponse struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message"`
+	Search  SavedSearch `json:"search"`
+}
+
+type SavedSearchListResponse struct {
+	Success  bool          `json:"success"`
+	Searches []SavedSearch `json:"searches"`
+	Total    int           `json:"total"`
+}
+
 type BatchOperationResponse struct {
 	Success     bool     `json:"success"`
 	Message     string   `json:"message"`
@@ -181,6 +397,31 @@ type ShareResponse struct {
 	ShareInfo ShareInfo `json:"shareInfo,omitempty"`
 }
 
+type UploadSessionResponse struct {
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Session UploadSession `json:"session"`
+}
+
+type UploadSessionListResponse struct {
+	Success  bool            `json:"success"`
+	Message  string          `json:"message"`
+	Sessions []UploadSession `json:"sessions"`
+	Total    int             `json:"total"`
+}
+
+type UploadPartResponse struct {
+	Success bool           `json:"success"`
+	Message string         `json:"message"`
+	Part    UploadPartInfo `json:"part"`
+}
+
+type PresignResponse struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Presign PresignedURL `json:"presign"`
+}
+
 type ErrorResponse struct {
 	Success bool   `json:"success"`
 	Error   string `json:"error"`
@@ -0,0 +1,427 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/mimetypes"
+	"bkp-drive/pkg/tos"
+)
+
+// 解压相关错误
+var (
+	ErrUnsafeArchivePath = errors.New("压缩包包含不安全的路径")
+	ErrArchiveTooLarge   = errors.New("压缩包解压后超过限制")
+	ErrExtractConflict   = errors.New("目标位置已存在同名文件")
+)
+
+// ExtractLimits 解压限制，防止压缩炸弹，0 表示不限制
+type ExtractLimits struct {
+	MaxBytes int64 // 解压后的总字节数
+	MaxFiles int   // 文件数
+	MaxRatio int   // 解压后的总字节数与压缩包大小之比
+}
+
+// DefaultExtractLimits 默认的解压限制
+var DefaultExtractLimits = ExtractLimits{
+	MaxBytes: 10 << 30,
+	MaxFiles: 10000,
+	MaxRatio: 100,
+}
+
+// ratioCheckMinBytes 解压后的内容小于该值时不检查压缩比，小文件的压缩比本来就可能很高
+const ratioCheckMinBytes = 1 << 20
+
+// ArchiveFormatFromKey 根据扩展名判断压缩包格式
+func ArchiveFormatFromKey(key string) (string, error) {
+	name := strings.ToLower(key)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveTar, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz, nil
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return ArchiveTarZst, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedArchiveFormat, path.Base(key))
+}
+
+// Extract 在后台将压缩包解压到 outputFolder，任务结果为解压的目标文件夹
+// outputFolder 为空时解压到压缩包旁边与其同名的文件夹，该文件夹已存在时按 rename 策略另选名称；
+// 已存在的同名文件按 onConflict 处理：rename（默认）、overwrite（保留历史版本）或 fail（不解压任何文件）
+// 包含绝对路径或 .. 的压缩包、超过 ExtractLimits 或用户剩余配额的压缩包整体拒绝；符号链接等特殊条目被跳过
+func (s *ArchiveService) Extract(userID, archiveKey, outputFolder, onConflict string) (*models.Job, error) {
+	format, err := ArchiveFormatFromKey(archiveKey)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ParseConflictPolicy(onConflict)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.store.HeadObject(archiveKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.jobs.Start(userID, JobExtract, func(progress *JobProgress) (string, error) {
+		folder, err := s.extractFolder(archiveKey, outputFolder, policy)
+		if err != nil {
+			return "", err
+		}
+
+		quota, err := s.quotas.Remaining(userID)
+		if err != nil {
+			return "", err
+		}
+
+		// 第一遍只读取条目信息：校验路径、限制、配额和冲突，任何问题都不写入文件
+		scan := &extractBudget{limits: s.limits, archiveSize: info.Size, quota: quota}
+		files := 0
+		err = s.walkArchive(archiveKey, info.Size, format, func(m archiveMember) error {
+			if m.skip || m.dir {
+				return nil
+			}
+			files++
+			if err := scan.addFile(); err != nil {
+				return err
+			}
+			if err := scan.add(m.size); err != nil {
+				return err
+			}
+			if policy == RestoreFail {
+				if exists, err := s.objectExists(folder + m.name); err != nil || exists {
+					if err == nil {
+						err = fmt.Errorf("%w: %s", ErrExtractConflict, m.name)
+					}
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		progress.SetTotal(files, scan.bytes)
+
+		// 第二遍解压，按实际读取的字节数限制，防止条目声明的大小与实际不符
+		budget := &extractBudget{limits: s.limits, archiveSize: info.Size, quota: quota}
+		renamed, skipped := 0, 0
+		if outputFolder == "" {
+			if err := s.store.PutObject(folder, strings.NewReader(""), 0, "", nil); err != nil {
+				return "", fmt.Errorf("创建文件夹失败: %w", err)
+			}
+		}
+		err = s.walkArchive(archiveKey, info.Size, format, func(m archiveMember) error {
+			switch {
+			case m.skip:
+				skipped++
+				return nil
+			case m.dir:
+				return s.store.PutObject(folder+m.name+"/", strings.NewReader(""), 0, "", nil)
+			}
+
+			key, err := s.extractTarget(userID, folder+m.name, policy)
+			if err != nil {
+				return err
+			}
+			if key != folder+m.name {
+				renamed++
+			}
+
+			content, err := m.open()
+			if err != nil {
+				return fmt.Errorf("读取 %s 失败: %w", m.name, err)
+			}
+			defer content.Close()
+
+			contentType, reader, err := mimetypes.Detect(&progressReader{reader: budget.reader(content), progress: progress.Add}, key)
+			if err != nil {
+				if budget.err != nil {
+					return budget.err
+				}
+				return fmt.Errorf("读取 %s 失败: %w", m.name, err)
+			}
+			if err := s.store.PutObject(key, reader, m.size, contentType, nil); err != nil {
+				if budget.err != nil {
+					return budget.err
+				}
+				return fmt.Errorf("解压 %s 失败: %w", m.name, err)
+			}
+			progress.Add(1, 0)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+
+		progress.SetMessage(fmt.Sprintf("解压完成，文件: %d, 重命名: %d, 跳过: %d", files, renamed, skipped))
+		return folder, nil
+	})
+}
+
+// extractFolder 解压的目标文件夹，outputFolder 为空时使用压缩包旁边与其同名（去掉扩展名）的文件夹
+func (s *ArchiveService) extractFolder(archiveKey, outputFolder, policy string) (string, error) {
+	if outputFolder != "" {
+		return tos.FolderPrefix(outputFolder), nil
+	}
+
+	dir, name := path.Split(archiveKey)
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tar.zst", ".tgz", ".tzst", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	if name == "" {
+		name = "extracted"
+	}
+
+	folder := dir + name + "/"
+	if policy != RestoreRename {
+		return folder, nil
+	}
+	for i := 0; i <= maxRestoreRenames; i++ {
+		candidate := folder
+		if i > 0 {
+			candidate = renamedKey(folder, true, i)
+		}
+		objects, err := tos.ListAllObjects(s.store, candidate)
+		if err != nil {
+			return "", err
+		}
+		if len(objects) == 0 {
+			return candidate, nil
+		}
+	}
+	return "", ErrExtractConflict
+}
+
+// extractTarget 按冲突策略选择文件的写入位置
+func (s *ArchiveService) extractTarget(userID, key, policy string) (string, error) {
+	exists, err := s.objectExists(key)
+	if err != nil || !exists {
+		return key, err
+	}
+
+	switch policy {
+	case RestoreOverwrite:
+		return key, s.versions.Snapshot(userID, key)
+	case RestoreFail:
+		return "", fmt.Errorf("%w: %s", ErrExtractConflict, path.Base(key))
+	}
+
+	for i := 1; i <= maxRestoreRenames; i++ {
+		candidate := renamedKey(key, false, i)
+		exists, err := s.objectExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrExtractConflict, path.Base(key))
+}
+
+func (s *ArchiveService) objectExists(key string) (bool, error) {
+	_, err := s.store.HeadObject(key)
+	if errors.Is(err, tos.ErrObjectNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// archiveMember 压缩包中的一个条目，name 为校验过的相对路径（文件夹不带末尾的 /）
+type archiveMember struct {
+	name string
+	dir  bool
+	skip bool // 符号链接、设备文件等不解压的条目
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+// walkArchive 依次读取压缩包中的条目，遇到不安全的路径时返回 ErrUnsafeArchivePath
+func (s *ArchiveService) walkArchive(key string, size int64, format string, fn func(m archiveMember) error) error {
+	if format == ArchiveZip {
+		return s.walkZip(key, size, fn)
+	}
+
+	reader, _, _, err := s.store.GetObject(key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var stream io.Reader = reader
+	switch format {
+	case ArchiveTarGz:
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("读取压缩包失败: %w", err)
+		}
+		defer gz.Close()
+		stream = gz
+	case ArchiveTarZst:
+		zr, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("读取压缩包失败: %w", err)
+		}
+		defer zr.Close()
+		stream = zr
+	}
+
+	tr := tar.NewReader(stream)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取压缩包失败: %w", err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		name, ok := safeArchiveName(header.Name)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnsafeArchivePath, header.Name)
+		}
+		if name == "" {
+			continue
+		}
+
+		member := archiveMember{name: name, size: header.Size}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			member.dir = true
+		case tar.TypeReg:
+			member.open = func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		default:
+			member.skip = true
+		}
+		if err := fn(member); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ArchiveService) walkZip(key string, size int64, fn func(m archiveMember) error) error {
+	rs := tos.NewObjectReadSeeker(s.store, key, size)
+	defer rs.Close()
+
+	zr, err := zip.NewReader(rs, size)
+	if err != nil {
+		return fmt.Errorf("读取压缩包失败: %w", err)
+	}
+	for _, f := range zr.File {
+		name, ok := safeArchiveName(f.Name)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnsafeArchivePath, f.Name)
+		}
+		if name == "" {
+			continue
+		}
+
+		member := archiveMember{name: name, size: int64(f.UncompressedSize64)}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			member.dir = true
+		case mode&fs.ModeType == 0:
+			member.open = f.Open
+		default:
+			member.skip = true
+		}
+		if err := fn(member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeArchiveName 将条目名称转换为相对路径，拒绝绝对路径和 ..（zip-slip），
+// 返回空字符串表示压缩包根目录
+func safeArchiveName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) {
+		return "", false
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." {
+		return "", true
+	}
+	return cleaned, true
+}
+
+// extractBudget 累计解压的文件数和字节数，超过 ExtractLimits 时返回 ErrArchiveTooLarge，
+// 超过用户剩余配额 quota（-1 表示不限制）时返回 ErrQuotaExceeded
+type extractBudget struct {
+	limits      ExtractLimits
+	archiveSize int64
+	quota       int64
+	files       int
+	bytes       int64
+	err         error
+}
+
+func (b *extractBudget) addFile() error {
+	b.files++
+	if b.limits.MaxFiles > 0 && b.files > b.limits.MaxFiles {
+		b.err = fmt.Errorf("%w: 文件数超过 %d", ErrArchiveTooLarge, b.limits.MaxFiles)
+	}
+	return b.err
+}
+
+func (b *extractBudget) add(n int64) error {
+	b.bytes += n
+	switch {
+	case b.limits.MaxBytes > 0 && b.bytes > b.limits.MaxBytes:
+		b.err = fmt.Errorf("%w: 解压后超过 %d 字节", ErrArchiveTooLarge, b.limits.MaxBytes)
+	case b.limits.MaxRatio > 0 && b.bytes > ratioCheckMinBytes && b.bytes > b.archiveSize*int64(b.limits.MaxRatio):
+		b.err = fmt.Errorf("%w: 压缩比超过 %d", ErrArchiveTooLarge, b.limits.MaxRatio)
+	case b.quota >= 0 && b.bytes > b.quota:
+		b.err = fmt.Errorf("%w: 解压后超过剩余的 %s", ErrQuotaExceeded, formatBytes(b.quota))
+	}
+	return b.err
+}
+
+// reader 读取时累计字节数，超过限制后返回错误
+func (b *extractBudget) reader(r io.Reader) io.Reader {
+	return &budgetReader{reader: r, budget: b}
+}
+
+type budgetReader struct {
+	reader io.Reader
+	budget *extractBudget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if budgetErr := r.budget.add(int64(n)); budgetErr != nil {
+			return 0, budgetErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/tos"
+)
+
+// 压缩格式，tar.zst 只支持解压
+const (
+	ArchiveZip    = "zip"
+	ArchiveTar    = "tar"
+	ArchiveTarGz  = "tar.gz"
+	ArchiveTarZst = "tar.zst"
+)
+
+// 任务类型
+const (
+	JobCompress = "compress"
+	JobExtract  = "extract"
+)
+
+// 压缩相关错误
+var (
+	ErrUnsupportedArchiveFormat = errors.New("不支持的压缩格式")
+	ErrEmptyArchive             = errors.New("没有要压缩的文件")
+)
+
+// ArchiveEntry 压缩包中的一个条目
+type ArchiveEntry struct {
+	Key      string // 对象键，文件夹条目为空
+	Name     string // 压缩包内的相对路径，文件夹以 / 结尾
+	Size     int64
+	Modified time.Time
+}
+
+// IsDir 条目是否为文件夹
+func (e ArchiveEntry) IsDir() bool {
+	return strings.HasSuffix(e.Name, "/")
+}
+
+// ParseArchiveFormat 校验压缩格式，空字符串表示 zip
+func ParseArchiveFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", ArchiveZip:
+		return ArchiveZip, nil
+	case ArchiveTar:
+		return ArchiveTar, nil
+	case ArchiveTarGz, "tgz":
+		return ArchiveTarGz, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedArchiveFormat, format)
+}
+
+// archiveExt 压缩格式对应的扩展名和 Content-Type
+func archiveExt(format string) (string, string) {
+	switch format {
+	case ArchiveTar:
+		return ".tar", "application/x-tar"
+	case ArchiveTarGz:
+		return ".tar.gz", "application/gzip"
+	}
+	return ".zip", "application/zip"
+}
+
+// ArchiveService 将文件和文件夹打包成压缩包，以及解压存储中的压缩包
+type ArchiveService struct {
+	store    tos.ObjectStore
+	jobs     *JobService
+	versions *VersionService
+	quotas   *QuotaService
+	limits   ExtractLimits
+}
+
+func NewArchiveService(store tos.ObjectStore, jobs *JobService, versions *VersionService, quotas *QuotaService, limits ExtractLimits) *ArchiveService {
+	return &ArchiveService{
+		store:    store,
+		jobs:     jobs,
+		versions: versions,
+		quotas:   quotas,
+		limits:   limits,
+	}
+}
+
+// Compress 在后台将 keys 打包写入 outputKey，outputKey 缺少扩展名时自动补上，任务结果为压缩包的对象键
+// keys 中的文件夹（以 / 结尾或存在子对象）连同所有子对象一起打包，压缩包内以文件夹名为根
+func (s *ArchiveService) Compress(userID string, keys []string, outputKey, format string) (*models.Job, error) {
+	format, err := ParseArchiveFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrEmptyArchive
+	}
+	ext, contentType := archiveExt(format)
+	if !strings.HasSuffix(strings.ToLower(outputKey), ext) {
+		outputKey += ext
+	}
+
+	return s.jobs.Start(userID, JobCompress, func(progress *JobProgress) (string, error) {
+		entries, err := s.CollectEntries(keys)
+		if err != nil {
+			return "", err
+		}
+
+		// 覆盖已有的同名压缩包时，不把它自己打包进去
+		files := 0
+		var total int64
+		kept := entries[:0]
+		for _, entry := range entries {
+			if entry.Key == outputKey {
+				continue
+			}
+			if !entry.IsDir() {
+				files++
+				total += entry.Size
+			}
+			kept = append(kept, entry)
+		}
+		progress.SetTotal(files, total)
+
+		// 压缩包的大小按打包的文件总大小估计
+		quota, err := s.quotas.Remaining(userID)
+		if err != nil {
+			return "", err
+		}
+		if quota >= 0 && total > quota {
+			return "", fmt.Errorf("%w: 压缩的文件共 %s，剩余 %s", ErrQuotaExceeded, formatBytes(total), formatBytes(quota))
+		}
+
+		if err := s.versions.Snapshot(userID, outputKey); err != nil {
+			return "", err
+		}
+
+		reader, writer := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			err := s.WriteArchive(writer, format, kept, progress.Add)
+			writer.CloseWithError(err)
+			done <- err
+		}()
+
+		err = s.store.PutObject(outputKey, reader, -1, contentType, nil)
+		reader.CloseWithError(err)
+		if writeErr := <-done; writeErr != nil {
+			return "", writeErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("保存压缩包失败: %w", err)
+		}
+		return outputKey, nil
+	})
+}
+
+// CollectEntries 列出 keys 对应的所有条目，顶层重名时按 "name (1).ext" 重命名
+func (s *ArchiveService) CollectEntries(keys []string) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+	used := map[string]bool{}
+
+	for _, key := range keys {
+		folder := strings.HasSuffix(key, "/")
+		var info *tos.ObjectInfo
+		if !folder {
+			var err error
+			info, err = s.store.HeadObject(key)
+			if errors.Is(err, tos.ErrObjectNotFound) {
+				folder, err = tos.IsFolder(s.store, key)
+				if err == nil && !folder {
+					err = fmt.Errorf("%w: %s", tos.ErrObjectNotFound, path.Base(key))
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		base := path.Base(strings.TrimSuffix(key, "/"))
+		name := base
+		for i := 1; used[name]; i++ {
+			name = strings.TrimSuffix(renamedKey(base, folder, i), "/")
+		}
+		used[name] = true
+
+		if !folder {
+			entries = append(entries, ArchiveEntry{Key: key, Name: name, Size: info.Size, Modified: info.LastModified})
+			continue
+		}
+
+		prefix := tos.FolderPrefix(key)
+		objects, err := tos.ListAllObjects(s.store, prefix)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ArchiveEntry{Name: name + "/"})
+		for _, obj := range objects {
+			rel := strings.TrimPrefix(obj.Key, prefix)
+			if rel == "" {
+				continue
+			}
+			entry := ArchiveEntry{Name: name + "/" + rel, Modified: obj.LastModified}
+			if !entry.IsDir() {
+				entry.Key = obj.Key
+				entry.Size = obj.Size
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrEmptyArchive
+	}
+	return entries, nil
+}
+
+// WriteArchive 将条目按 format 写入 w，每写完一部分内容调用 progress 上报文件数和字节数
+// zip 在内容超过4GB时自动使用 ZIP64，非 ASCII 文件名以 UTF-8 标记写入
+func (s *ArchiveService) WriteArchive(w io.Writer, format string, entries []ArchiveEntry, progress func(files int, bytes int64)) error {
+	if progress == nil {
+		progress = func(int, int64) {}
+	}
+
+	switch format {
+	case ArchiveZip:
+		return s.writeZip(w, entries, progress)
+	case ArchiveTar:
+		return s.writeTar(w, entries, progress)
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		if err := s.writeTar(gz, entries, progress); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedArchiveFormat, format)
+}
+
+func (s *ArchiveService) writeZip(w io.Writer, entries []ArchiveEntry, progress func(int, int64)) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.Name, Modified: entry.Modified}
+		if entry.IsDir() {
+			if _, err := zw.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		header.Method = zip.Deflate
+		err := s.copyEntry(entry, progress, func(size int64) (io.Writer, error) {
+			return zw.CreateHeader(header)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (s *ArchiveService) writeTar(w io.Writer, entries []ArchiveEntry, progress func(int, int64)) error {
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.Name, ModTime: entry.Modified, Format: tar.FormatPAX}
+		if entry.IsDir() {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0o755
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		header.Typeflag = tar.TypeReg
+		header.Mode = 0o644
+		err := s.copyEntry(entry, progress, func(size int64) (io.Writer, error) {
+			header.Size = size
+			return tw, tw.WriteHeader(header)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// copyEntry 读取条目内容写入 create 返回的 writer，create 的参数为对象的实际大小
+func (s *ArchiveService) copyEntry(entry ArchiveEntry, progress func(int, int64), create func(size int64) (io.Writer, error)) error {
+	reader, size, _, err := s.store.GetObject(entry.Key)
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", entry.Name, err)
+	}
+	defer reader.Close()
+
+	dst, err := create(size)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, &progressReader{reader: reader, progress: progress}); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", entry.Name, err)
+	}
+	progress(1, 0)
+	return nil
+}
+
+// progressReader 读取时上报已处理的字节数
+type progressReader struct {
+	reader   io.Reader
+	progress func(int, int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.progress(0, int64(n))
+	}
+	return n, err
+}
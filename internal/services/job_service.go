@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"bkp-drive/internal/models"
+)
+
+// ErrJobNotFound 任务不存在、属于其他用户或已过期
+var ErrJobNotFound = errors.New("任务不存在或已过期")
+
+// 任务状态
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// JobTTL 已结束的任务保留的时间
+const JobTTL = 24 * time.Hour
+
+// JobFunc 任务的执行函数，返回结果对象键
+type JobFunc func(progress *JobProgress) (string, error)
+
+// JobService 在后台执行耗时的操作（压缩、解压），客户端轮询任务状态和进度
+// 任务只保存在内存中，服务重启后未完成的任务会丢失
+type JobService struct {
+	mu   sync.Mutex
+	jobs map[string]*jobRecord
+	now  func() time.Time
+}
+
+type jobRecord struct {
+	userID string
+	job    models.Job
+}
+
+func NewJobService() *JobService {
+	return &JobService{
+		jobs: map[string]*jobRecord{},
+		now:  time.Now,
+	}
+}
+
+// SetClock 替换任务过期判断使用的时钟，便于测试
+func (s *JobService) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Start 创建任务并在后台执行
+func (s *JobService) Start(userID, jobType string, run JobFunc) (*models.Job, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.expire()
+	record := &jobRecord{
+		userID: userID,
+		job: models.Job{
+			JobId:     id,
+			Type:      jobType,
+			Status:    JobPending,
+			CreatedAt: s.now(),
+		},
+	}
+	s.jobs[id] = record
+	job := record.job
+	s.mu.Unlock()
+
+	go s.run(id, run)
+	return &job, nil
+}
+
+// Get 获取用户的任务
+func (s *JobService) Get(userID, id string) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	record, ok := s.jobs[id]
+	if !ok || record.userID != userID {
+		return nil, ErrJobNotFound
+	}
+	job := record.job
+	return &job, nil
+}
+
+// List 列出用户的任务，最新的在前
+func (s *JobService) List(userID string) []models.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	jobs := []models.Job{}
+	for _, record := range s.jobs {
+		if record.userID == userID {
+			jobs = append(jobs, record.job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+func (s *JobService) run(id string, run JobFunc) {
+	s.update(id, func(job *models.Job) {
+		job.Status = JobRunning
+	})
+
+	resultKey, err := func() (resultKey string, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("任务 %s 异常: %v", id, r)
+				err = fmt.Errorf("任务异常: %v", r)
+			}
+		}()
+		return run(&JobProgress{service: s, id: id})
+	}()
+
+	s.update(id, func(job *models.Job) {
+		completedAt := s.now()
+		job.CompletedAt = &completedAt
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = JobCompleted
+		job.ResultKey = resultKey
+		job.Progress.Percent = 100
+	})
+}
+
+func (s *JobService) update(id string, fn func(job *models.Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.jobs[id]; ok {
+		fn(&record.job)
+	}
+}
+
+// expire 删除结束超过 JobTTL 的任务，调用方须持有锁
+func (s *JobService) expire() {
+	cutoff := s.now().Add(-JobTTL)
+	for id, record := range s.jobs {
+		if record.job.CompletedAt != nil && record.job.CompletedAt.Before(cutoff) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// JobProgress 任务执行过程中上报进度
+type JobProgress struct {
+	service *JobService
+	id      string
+}
+
+// SetTotal 设置需要处理的文件数和字节数
+func (p *JobProgress) SetTotal(files int, bytes int64) {
+	p.service.update(p.id, func(job *models.Job) {
+		job.Progress.TotalFiles = files
+		job.Progress.TotalBytes = bytes
+		job.Progress.Percent = percent(job.Progress)
+	})
+}
+
+// Add 累加已处理的文件数和字节数
+func (p *JobProgress) Add(files int, bytes int64) {
+	p.service.update(p.id, func(job *models.Job) {
+		job.Progress.ProcessedFiles += files
+		job.Progress.ProcessedBytes += bytes
+		job.Progress.Percent = percent(job.Progress)
+	})
+}
+
+// SetMessage 设置任务完成时的说明
+func (p *JobProgress) SetMessage(message string) {
+	p.service.update(p.id, func(job *models.Job) {
+		job.Message = message
+	})
+}
+
+// percent 按字节计算完成百分比，没有字节时按文件数计算，结束前最多为99
+func percent(progress models.JobProgress) float64 {
+	var done float64
+	switch {
+	case progress.TotalBytes > 0:
+		done = float64(progress.ProcessedBytes) / float64(progress.TotalBytes)
+	case progress.TotalFiles > 0:
+		done = float64(progress.ProcessedFiles) / float64(progress.TotalFiles)
+	}
+	return min(float64(int(done*1000))/10, 99)
+}
@@ -0,0 +1,40 @@
+package services
+
+import "sync"
+
+// keyedLocks 按ID串行执行操作，没有请求持有或等待时删除该ID的锁，避免已结束的ID一直占用内存
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int // 持有和等待该锁的请求数
+}
+
+// lock 锁定 id 直到返回的函数被调用
+func (k *keyedLocks) lock(id string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyedLock{}
+	}
+	l := k.locks[id]
+	if l == nil {
+		l = &keyedLock{}
+		k.locks[id] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, id)
+		}
+		k.mu.Unlock()
+	}
+}
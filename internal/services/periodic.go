@@ -0,0 +1,29 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// startPeriodic 立即执行一次 task，之后每隔 interval 执行一次，返回停止函数
+func startPeriodic(interval time.Duration, task func()) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			task()
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
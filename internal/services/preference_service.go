@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/tos"
+)
+
+// ErrInvalidTimezone 不是有效的 IANA 时区名
+var ErrInvalidTimezone = errors.New("无效的时区")
+
+// preferencePrefix 用户偏好设置的前缀
+const preferencePrefix = "system/preferences/"
+
+// PreferenceService 保存用户的偏好设置，目前只有计算今天、本周等时间范围使用的时区
+type PreferenceService struct {
+	store    tos.ObjectStore
+	location *time.Location
+	now      func() time.Time
+}
+
+// NewPreferenceService location 为没有设置时区的用户使用的时区
+func NewPreferenceService(store tos.ObjectStore, location *time.Location) *PreferenceService {
+	return &PreferenceService{
+		store:    store,
+		location: location,
+		now:      time.Now,
+	}
+}
+
+// SetClock 替换相对日期使用的时钟，便于测试
+func (s *PreferenceService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Get 返回用户的偏好设置，未设置的项使用默认值
+func (s *PreferenceService) Get(userID string) (models.UserPreferences, error) {
+	prefs := models.UserPreferences{Timezone: s.location.String()}
+	reader, _, _, err := s.store.GetObject(preferenceKey(userID))
+	if errors.Is(err, tos.ErrObjectNotFound) {
+		return prefs, nil
+	}
+	if err != nil {
+		return prefs, err
+	}
+	defer reader.Close()
+
+	var saved models.UserPreferences
+	if err := json.NewDecoder(reader).Decode(&saved); err != nil {
+		return prefs, nil
+	}
+	if _, err := time.LoadLocation(saved.Timezone); err == nil && saved.Timezone != "" {
+		prefs.Timezone = saved.Timezone
+	}
+	return prefs, nil
+}
+
+// Set 保存用户的偏好设置，时区为空表示使用默认时区
+func (s *PreferenceService) Set(userID string, prefs models.UserPreferences) (models.UserPreferences, error) {
+	prefs.Timezone = strings.TrimSpace(prefs.Timezone)
+	if prefs.Timezone != "" {
+		// Local 取决于服务器的配置，不作为用户的时区
+		if _, err := time.LoadLocation(prefs.Timezone); err != nil || prefs.Timezone == "Local" {
+			return prefs, fmt.Errorf("%w: %s", ErrInvalidTimezone, prefs.Timezone)
+		}
+	}
+
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return prefs, err
+	}
+	if err := s.store.PutObject(preferenceKey(userID), bytes.NewReader(data), int64(len(data)), "application/json", nil); err != nil {
+		return prefs, fmt.Errorf("保存偏好设置失败: %w", err)
+	}
+	return s.Get(userID)
+}
+
+// Now 返回用户时区的当前时间，用于解析 today、this-week 等相对日期
+func (s *PreferenceService) Now(userID string) (time.Time, error) {
+	prefs, err := s.Get(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(prefs.Timezone)
+	if err != nil {
+		loc = s.location
+	}
+	return s.now().In(loc), nil
+}
+
+func preferenceKey(userID string) string {
+	return preferencePrefix + userID + ".json"
+}
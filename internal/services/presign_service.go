@@ -0,0 +1,264 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/tos"
+)
+
+// 预签名直传相关错误
+var (
+	ErrPresignUnsupported      = errors.New("当前存储后端不支持预签名URL")
+	ErrPresignedUploadNotFound = errors.New("预签名上传不存在或已过期")
+	ErrPresignedObjectMissing  = errors.New("文件尚未上传到存储")
+	ErrPresignedUploadMismatch = errors.New("上传的文件与预签名时声明的大小不一致")
+	ErrPresignTooLarge         = errors.New("文件超过单次上传的大小上限，请使用分片上传")
+	ErrInvalidPresignExpiry    = errors.New("有效期必须在1秒到1小时之间")
+)
+
+const (
+	// presignedUploadPrefix 预签名上传记录的前缀，完成回调时据此校验
+	presignedUploadPrefix = "system/presigned-uploads/"
+	// DefaultPresignExpiry 预签名URL的默认有效期
+	DefaultPresignExpiry = 15 * time.Minute
+	// MaxPresignExpiry 预签名URL的最长有效期
+	MaxPresignExpiry = time.Hour
+	// MaxPresignedPutSize 单次PUT上传的大小上限
+	MaxPresignedPutSize = 5 << 30
+	// presignCompleteGrace URL过期后仍可完成回调的时间，覆盖过期前开始的慢速上传
+	presignCompleteGrace = time.Hour
+	// presignClockSkew 允许的存储服务与本服务之间的时钟偏差
+	presignClockSkew = time.Minute
+)
+
+// presignedUploadRecord 已签发的上传URL，完成回调时校验对象与声明一致
+type presignedUploadRecord struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"userId"`
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	StagingKey  string    `json:"stagingKey,omitempty"` // 上传写入的暂存对象，完成时转为 Key 上的对象
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// PresignService 签发直连存储的上传/下载URL，文件内容不经过本服务
+type PresignService struct {
+	store     tos.ObjectStore
+	presigner tos.Presigner
+	versions  *VersionService
+	quotas    *QuotaService
+	now       func() time.Time
+}
+
+func NewPresignService(store tos.ObjectStore, versions *VersionService, quotas *QuotaService) *PresignService {
+	presigner, _ := store.(tos.Presigner)
+	return &PresignService{
+		store:     store,
+		presigner: presigner,
+		versions:  versions,
+		quotas:    quotas,
+		now:       time.Now,
+	}
+}
+
+// SetClock 替换过期判断使用的时钟，便于测试
+func (s *PresignService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// PresignExpiry 将请求中的有效期（秒）转换为时长，0 表示使用默认值
+func PresignExpiry(seconds int) (time.Duration, error) {
+	if seconds == 0 {
+		return DefaultPresignExpiry, nil
+	}
+	expires := time.Duration(seconds) * time.Second
+	if seconds < 0 || expires > MaxPresignExpiry {
+		return 0, ErrInvalidPresignExpiry
+	}
+	return expires, nil
+}
+
+// PresignUpload 签发上传URL，key 为完整对象键
+func (s *PresignService) PresignUpload(userID, key string, size int64, contentType string, expires time.Duration) (*models.PresignedURL, error) {
+	if s.presigner == nil {
+		return nil, ErrPresignUnsupported
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("文件大小不能为负数")
+	}
+	if size > MaxPresignedPutSize {
+		return nil, ErrPresignTooLarge
+	}
+	if err := s.quotas.Check(userID, size); err != nil {
+		return nil, err
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := s.presigner.PresignPutObject(key, expires, contentType, size)
+	if err != nil {
+		return nil, err
+	}
+	// 客户端直接覆盖存储中的对象，只能在签发时保存当前内容
+	if err := s.versions.Snapshot(userID, key); err != nil {
+		return nil, err
+	}
+
+	record := &presignedUploadRecord{
+		ID:          id,
+		UserID:      userID,
+		Key:         key,
+		Size:        size,
+		ContentType: contentType,
+		StagingKey:  request.StagingKey,
+		CreatedAt:   s.now(),
+		ExpiresAt:   s.now().Add(expires),
+	}
+	if err := s.saveRecord(record); err != nil {
+		return nil, err
+	}
+
+	presigned := presignedURL(key, request)
+	presigned.UploadId = id
+	return presigned, nil
+}
+
+// PresignDownload 签发下载URL，对象不存在时返回 tos.ErrObjectNotFound
+func (s *PresignService) PresignDownload(key, filename string, expires time.Duration) (*models.PresignedURL, error) {
+	if s.presigner == nil {
+		return nil, ErrPresignUnsupported
+	}
+	if _, err := s.store.HeadObject(key); err != nil {
+		return nil, err
+	}
+
+	request, err := s.presigner.PresignGetObject(key, expires, filename)
+	if err != nil {
+		return nil, err
+	}
+	return presignedURL(key, request), nil
+}
+
+// Complete 客户端直传完成后的回调，确认对象已写入且大小与签发时一致，然后更新元数据索引
+// 大小不一致的对象会被删除
+func (s *PresignService) Complete(userID, uploadID string) (*tos.ObjectInfo, error) {
+	record, err := s.loadRecord(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 上传到暂存对象时先转为 Key 上的对象（去重存储据此释放原来引用的内容），
+	// 暂存对象不存在时由下面按修改时间判断是尚未上传还是已经转换过
+	if err := tos.AdoptStagedObject(s.store, record.Key, record.StagingKey); err != nil && !errors.Is(err, tos.ErrObjectNotFound) {
+		return nil, err
+	}
+
+	info, err := s.store.HeadObject(record.Key)
+	if err != nil {
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return nil, ErrPresignedObjectMissing
+		}
+		return nil, err
+	}
+	// 签发之前就存在的同名对象不算本次上传
+	if info.LastModified.Before(record.CreatedAt.Add(-presignClockSkew)) {
+		return nil, ErrPresignedObjectMissing
+	}
+
+	if info.Size != record.Size {
+		s.store.DeleteObject(record.Key)
+		s.store.DeleteObject(presignedRecordKey(userID, uploadID))
+		return nil, fmt.Errorf("%w: 已上传 %d 字节，声明 %d 字节", ErrPresignedUploadMismatch, info.Size, record.Size)
+	}
+
+	// 直传的对象没有经过本服务写入，需要补充元数据索引
+	if err := tos.IndexObject(s.store, record.Key); err != nil {
+		return nil, err
+	}
+	if err := detectContentType(s.store, record.Key); err != nil {
+		return nil, err
+	}
+	if info, err = s.store.HeadObject(record.Key); err != nil {
+		return nil, err
+	}
+
+	// 占用空间中已包括该对象，超过配额（签发后写入了其他文件）时删除
+	if err := s.quotas.Check(userID, 0); err != nil {
+		if errors.Is(err, ErrQuotaExceeded) {
+			s.store.DeleteObject(record.Key)
+			s.store.DeleteObject(presignedRecordKey(userID, uploadID))
+		}
+		return nil, err
+	}
+
+	s.store.DeleteObject(presignedRecordKey(userID, uploadID))
+	return info, nil
+}
+
+// loadRecord 读取上传记录，属于其他用户或已超过回调期限时返回 ErrPresignedUploadNotFound
+func (s *PresignService) loadRecord(userID, id string) (*presignedUploadRecord, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, ErrPresignedUploadNotFound
+	}
+
+	reader, _, _, err := s.store.GetObject(presignedRecordKey(userID, id))
+	if err != nil {
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return nil, ErrPresignedUploadNotFound
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	var record presignedUploadRecord
+	if err := json.NewDecoder(reader).Decode(&record); err != nil || record.UserID != userID {
+		return nil, ErrPresignedUploadNotFound
+	}
+
+	if s.now().After(record.ExpiresAt.Add(presignCompleteGrace)) {
+		s.store.DeleteObject(presignedRecordKey(userID, id))
+		return nil, ErrPresignedUploadNotFound
+	}
+
+	return &record, nil
+}
+
+func (s *PresignService) saveRecord(record *presignedUploadRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := s.store.PutObject(presignedRecordKey(record.UserID, record.ID), bytes.NewReader(data), int64(len(data)), "application/json", nil); err != nil {
+		return fmt.Errorf("保存上传记录失败: %w", err)
+	}
+	return nil
+}
+
+func presignedURL(key string, request *tos.PresignedRequest) *models.PresignedURL {
+	headers := request.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return &models.PresignedURL{
+		Key:       key,
+		Method:    request.Method,
+		URL:       request.URL,
+		Headers:   headers,
+		ExpiresAt: request.ExpiresAt,
+	}
+}
+
+func presignedRecordKey(userID, id string) string {
+	return presignedUploadPrefix + userID + "/" + id + ".json"
+}
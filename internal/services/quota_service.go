@@ -0,0 +1,179 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/tos"
+)
+
+// ErrQuotaExceeded 写入后超过用户的存储配额
+var ErrQuotaExceeded = errors.New("存储空间不足")
+
+// QuotaStore 保存单独设置的用户配额
+type QuotaStore interface {
+	// UserQuota 返回用户的配额（字节），没有单独设置时 ok 为 false
+	UserQuota(userID string) (quota int64, ok bool, err error)
+}
+
+// dbQuotaStore 从 users 表的 quota_bytes 字段读取配额，NULL 表示使用默认配额
+type dbQuotaStore struct {
+	db *sql.DB
+}
+
+func NewDBQuotaStore(db *sql.DB) QuotaStore {
+	return &dbQuotaStore{db: db}
+}
+
+func (s *dbQuotaStore) UserQuota(userID string) (int64, bool, error) {
+	var quota sql.NullInt64
+	err := s.db.QueryRow("SELECT quota_bytes FROM users WHERE user_id = $1", userID).Scan(&quota)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("查询用户配额失败: %w", err)
+	}
+	return quota.Int64, quota.Valid, nil
+}
+
+// UsagePrefixes 用户文件之外计入占用空间的回收站和历史版本前缀，
+// 开启元数据索引时应一并索引（见 tos.NewIndexedStore 的 metadataPrefixes），否则每次检查配额都要列举其中的全部对象
+var UsagePrefixes = []string{trashDataPrefix, versionDataPrefix + userKeyPrefix}
+
+// QuotaService 计算用户占用的存储空间并在写入前检查配额
+// 占用空间包括用户的文件、回收站和历史版本，按文件大小计算（不考虑去重）。
+// 检查和写入之间不加锁：同一用户并发写入时可能都通过检查，合计超出配额最多为同时进行的写入大小之和，
+// 之后的写入会因超出配额而失败
+type QuotaService struct {
+	store        tos.ObjectStore
+	quotas       QuotaStore
+	defaultQuota int64
+}
+
+// NewQuotaService defaultQuota 为没有单独设置配额的用户的配额，0 表示不限制；quotas 为 nil 时所有用户使用默认配额
+func NewQuotaService(store tos.ObjectStore, quotas QuotaStore, defaultQuota int64) *QuotaService {
+	return &QuotaService{
+		store:        store,
+		quotas:       quotas,
+		defaultQuota: defaultQuota,
+	}
+}
+
+// Quota 返回用户的配额，0 表示不限制
+func (s *QuotaService) Quota(userID string) (int64, error) {
+	if s.quotas == nil {
+		return s.defaultQuota, nil
+	}
+	quota, ok, err := s.quotas.UserQuota(userID)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return s.defaultQuota, nil
+	}
+	return quota, nil
+}
+
+// Usage 返回用户的配额和占用空间
+func (s *QuotaService) Usage(userID string) (*models.QuotaUsage, error) {
+	quota, err := s.Quota(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &models.QuotaUsage{Quota: quota}
+	for _, part := range []struct {
+		prefix string
+		size   *int64
+	}{
+		{userKeyPrefix + userID + "/", &usage.FileSize},
+		{trashDataPrefix + userID + "/", &usage.TrashSize},
+		{versionDataPrefix + userKeyPrefix + userID + "/", &usage.VersionSize},
+	} {
+		stats, err := tos.GetStorageStats(s.store, part.prefix)
+		if err != nil {
+			return nil, err
+		}
+		*part.size = stats.LogicalSize
+	}
+	usage.UsedSize = usage.FileSize + usage.TrashSize + usage.VersionSize
+	return usage, nil
+}
+
+// Remaining 返回用户剩余的配额，不限制时返回 -1
+func (s *QuotaService) Remaining(userID string) (int64, error) {
+	usage, err := s.Usage(userID)
+	if err != nil {
+		return 0, err
+	}
+	if usage.Quota == 0 {
+		return -1, nil
+	}
+	return max(usage.Quota-usage.UsedSize, 0), nil
+}
+
+// Check 检查用户还能写入 size 字节，超过配额时返回 ErrQuotaExceeded
+func (s *QuotaService) Check(userID string, size int64) error {
+	usage, err := s.Usage(userID)
+	if err != nil {
+		return err
+	}
+	if usage.Quota == 0 || usage.UsedSize+size <= usage.Quota {
+		return nil
+	}
+	return quotaExceeded(usage.UsedSize, usage.Quota, size)
+}
+
+// CheckCopy 检查用户还能复制 keys（以 / 结尾或没有同名对象的按文件夹递归计算）
+// 不存在的项目不计入，由复制操作逐项报告失败
+func (s *QuotaService) CheckCopy(userID string, keys []string) error {
+	var size int64
+	for _, key := range keys {
+		folder, err := tos.IsFolder(s.store, key)
+		if err != nil {
+			return err
+		}
+		if !folder {
+			info, err := s.store.HeadObject(key)
+			if errors.Is(err, tos.ErrObjectNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			size += info.Size
+			continue
+		}
+
+		objects, err := tos.ListAllObjects(s.store, tos.FolderPrefix(key))
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			size += obj.Size
+		}
+	}
+	return s.Check(userID, size)
+}
+
+func quotaExceeded(used, quota, size int64) error {
+	return fmt.Errorf("%w: 已用 %s / %s，还需要 %s", ErrQuotaExceeded, formatBytes(used), formatBytes(quota), formatBytes(size))
+}
+
+// formatBytes 将字节数格式化为便于阅读的形式
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", value), "0"), ".") + " " + "KMGTP"[exp:exp+1] + "B"
+}
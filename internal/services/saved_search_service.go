@@ -0,0 +1,478 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/searchquery"
+	"bkp-drive/pkg/tos"
+)
+
+// 保存的搜索相关错误
+var (
+	ErrSavedSearchNotFound = errors.New("保存的搜索不存在")
+	ErrNotSavedSearchOwner = errors.New("只有创建者可以修改或共享保存的搜索")
+	ErrInvalidSavedSearch  = errors.New("保存的搜索无效")
+	ErrUserNotFound        = errors.New("用户不存在")
+)
+
+const (
+	// savedSearchPrefix 保存的搜索的前缀，用户的搜索位于 system/saved-searches/<user_id>/<id>.json
+	savedSearchPrefix = "system/saved-searches/"
+	// savedSearchSharePrefix 共享标记的前缀，system/saved-search-shares/<接收者>/<id> 的内容为创建者的用户ID
+	savedSearchSharePrefix = "system/saved-search-shares/"
+	// SmartFolderPrefix 保存的搜索在文件列表中的虚拟文件夹前缀，虚拟路径为 @search/<id>/
+	SmartFolderPrefix = "@search/"
+	// SavedSearchResultLimit 每次查看保存的搜索最多返回的结果数
+	SavedSearchResultLimit = 1000
+	// MaxSavedSearches 每个用户最多保存的搜索数（不含共享给他的）
+	MaxSavedSearches = 100
+	// maxSavedSearchName 名称的最大字符数
+	maxSavedSearchName = 100
+)
+
+// UserDirectory 按用户名查找用户
+type UserDirectory interface {
+	// UserID 返回用户名对应的用户ID，用户不存在时 ok 为 false
+	UserID(username string) (userID string, ok bool, err error)
+}
+
+// dbUserDirectory 从 users 表查找用户
+type dbUserDirectory struct {
+	db *sql.DB
+}
+
+func NewDBUserDirectory(db *sql.DB) UserDirectory {
+	return &dbUserDirectory{db: db}
+}
+
+func (d *dbUserDirectory) UserID(username string) (string, bool, error) {
+	var userID string
+	err := d.db.QueryRow("SELECT user_id FROM users WHERE username = $1", username).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("查询用户失败: %w", err)
+	}
+	return userID, true, nil
+}
+
+// SavedSearchService 保存用户的搜索条件，在文件列表中作为智能文件夹出现，查看时实时搜索
+// 共享给其他用户的只是搜索条件，接收者看到的是在自己文件中的搜索结果
+type SavedSearchService struct {
+	store tos.ObjectStore
+	users UserDirectory
+	now   func() time.Time
+}
+
+func NewSavedSearchService(store tos.ObjectStore, users UserDirectory) *SavedSearchService {
+	return &SavedSearchService{
+		store: store,
+		users: users,
+		now:   time.Now,
+	}
+}
+
+// ApplySearchQuery 解析结构化查询 q 设置 req 的条件和排序，相对日期按用户时区的当前时间 now 计算；
+// 全文检索时顶层没有字段的条件作为在内容中搜索的关键词，否则匹配相对路径
+func ApplySearchQuery(req *models.SearchRequest, q string, content bool, now time.Time) error {
+	parsed, err := searchquery.ParseAt(q, now)
+	if err != nil {
+		return err
+	}
+	req.Filter, req.Sort = parsed.Expr, parsed.Sort
+	if !content {
+		return nil
+	}
+
+	keywords, rest, err := parsed.Keywords()
+	if err != nil {
+		return err
+	}
+	req.Query, req.Filter = strings.Join(keywords, " "), rest
+	return nil
+}
+
+// SmartFolderID 从虚拟文件夹路径中取出保存的搜索ID，不是虚拟文件夹路径时 ok 为 false
+func SmartFolderID(prefix string) (string, bool) {
+	id, ok := strings.CutPrefix(prefix, SmartFolderPrefix)
+	if !ok {
+		return "", false
+	}
+	id = strings.TrimSuffix(id, "/")
+	return id, validSavedSearchID(id)
+}
+
+// Create 保存新的搜索，folder 为相对用户根目录的文件夹
+func (s *SavedSearchService) Create(userID string, req models.SavedSearchRequest) (*models.SavedSearch, error) {
+	if err := s.validate(&req); err != nil {
+		return nil, err
+	}
+	own, err := s.listOwn(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(own) >= MaxSavedSearches {
+		return nil, fmt.Errorf("%w: 最多保存 %d 个搜索", ErrInvalidSavedSearch, MaxSavedSearches)
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	search := &models.SavedSearch{
+		ID:        id,
+		Owner:     userID,
+		Name:      req.Name,
+		Query:     req.Query,
+		Folder:    req.Folder,
+		Content:   req.Content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.save(search); err != nil {
+		return nil, err
+	}
+	return s.view(userID, search), nil
+}
+
+// List 列出用户自己的和共享给他的搜索，按名称排序
+func (s *SavedSearchService) List(userID string) ([]models.SavedSearch, error) {
+	searches, err := s.listOwn(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	markers, err := tos.ListAllObjects(s.store, savedSearchSharePrefix+userID+"/")
+	if err != nil {
+		return nil, err
+	}
+	for _, marker := range markers {
+		search, err := s.shared(userID, path.Base(marker.Key))
+		if errors.Is(err, ErrSavedSearchNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, *search)
+	}
+
+	for i := range searches {
+		searches[i] = *s.view(userID, &searches[i])
+	}
+	sort.SliceStable(searches, func(i, j int) bool {
+		return strings.ToLower(searches[i].Name) < strings.ToLower(searches[j].Name)
+	})
+	return searches, nil
+}
+
+// Get 返回用户自己的或共享给他的搜索
+func (s *SavedSearchService) Get(userID, id string) (*models.SavedSearch, error) {
+	search, err := s.load(userID, id)
+	if errors.Is(err, ErrSavedSearchNotFound) {
+		search, err = s.shared(userID, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.view(userID, search), nil
+}
+
+// Update 修改搜索的名称和条件，只有创建者可以修改
+func (s *SavedSearchService) Update(userID, id string, req models.SavedSearchRequest) (*models.SavedSearch, error) {
+	search, err := s.owned(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(&req); err != nil {
+		return nil, err
+	}
+
+	search.Name, search.Query, search.Folder, search.Content = req.Name, req.Query, req.Folder, req.Content
+	search.UpdatedAt = s.now()
+	if err := s.save(search); err != nil {
+		return nil, err
+	}
+	return s.view(userID, search), nil
+}
+
+// Delete 创建者删除搜索及其共享；接收者删除时只取消共享给自己的部分
+func (s *SavedSearchService) Delete(userID, id string) error {
+	search, err := s.load(userID, id)
+	if errors.Is(err, ErrSavedSearchNotFound) {
+		if search, err = s.shared(userID, id); err != nil {
+			return err
+		}
+		return s.unshare(search, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range search.SharedWith {
+		s.store.DeleteObject(savedSearchShareKey(recipient, id))
+	}
+	return s.store.DeleteObject(savedSearchKey(userID, id))
+}
+
+// Share 将搜索共享给用户名为 username 的用户，只有创建者可以共享
+func (s *SavedSearchService) Share(userID, id, username string) (*models.SavedSearch, error) {
+	search, err := s.owned(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := s.lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	if recipient == userID {
+		return nil, fmt.Errorf("%w: 不能共享给自己", ErrInvalidSavedSearch)
+	}
+
+	marker := []byte(userID)
+	if err := s.store.PutObject(savedSearchShareKey(recipient, id), bytes.NewReader(marker), int64(len(marker)), "text/plain", nil); err != nil {
+		return nil, fmt.Errorf("保存共享记录失败: %w", err)
+	}
+	if !contains(search.SharedWith, recipient) {
+		search.SharedWith = append(search.SharedWith, recipient)
+		if err := s.save(search); err != nil {
+			return nil, err
+		}
+	}
+	return s.view(userID, search), nil
+}
+
+// Unshare 取消共享给用户名为 username 的用户，只有创建者可以取消
+func (s *SavedSearchService) Unshare(userID, id, username string) (*models.SavedSearch, error) {
+	search, err := s.owned(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := s.lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unshare(search, recipient); err != nil {
+		return nil, err
+	}
+	return s.view(userID, search), nil
+}
+
+// Run 在 folder（查看者的用户根目录）下执行搜索，结果中的对象键为完整对象键
+// now 为查看者时区的当前时间，today 等相对日期每次查看时重新计算
+func (s *SavedSearchService) Run(search *models.SavedSearch, folder string, now time.Time) (*models.SearchResponse, error) {
+	req := &models.SearchRequest{
+		Folder:  folder + search.Folder,
+		Limit:   SavedSearchResultLimit,
+		Content: search.Content,
+	}
+	if err := ApplySearchQuery(req, search.Query, search.Content, now); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSavedSearch, err)
+	}
+
+	result, err := tos.SearchObjects(s.store, req)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, errors.New(result.Message)
+	}
+	result.Query = search.Query
+	return result, nil
+}
+
+// validate 校验并规范化请求，文件夹路径应已由调用方校验
+func (s *SavedSearchService) validate(req *models.SavedSearchRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || utf8.RuneCountInString(req.Name) > maxSavedSearchName || strings.Contains(req.Name, "/") {
+		return fmt.Errorf("%w: 名称不能为空、不能包含 /，且不超过 %d 个字符", ErrInvalidSavedSearch, maxSavedSearchName)
+	}
+	if req.Folder = strings.Trim(req.Folder, "/"); req.Folder != "" {
+		req.Folder += "/"
+	}
+
+	parsed := &models.SearchRequest{}
+	if err := ApplySearchQuery(parsed, req.Query, req.Content, s.now()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSavedSearch, err)
+	}
+	if req.Content {
+		if parsed.Query == "" {
+			return fmt.Errorf("%w: 全文检索需要提供搜索关键词", ErrInvalidSavedSearch)
+		}
+		if !tos.SupportsContentSearch(s.store, userKeyPrefix) {
+			return fmt.Errorf("%w: 全文检索需要开启元数据索引", ErrInvalidSavedSearch)
+		}
+	}
+	return nil
+}
+
+// view 返回给 userID 看的副本，共享列表只有创建者可见
+func (s *SavedSearchService) view(userID string, search *models.SavedSearch) *models.SavedSearch {
+	view := *search
+	view.Path = SmartFolderPrefix + search.ID + "/"
+	if search.Owner != userID {
+		view.SharedWith = nil
+	}
+	return &view
+}
+
+// owned 读取用户自己的搜索，共享给他的搜索返回 ErrNotSavedSearchOwner
+func (s *SavedSearchService) owned(userID, id string) (*models.SavedSearch, error) {
+	search, err := s.load(userID, id)
+	if errors.Is(err, ErrSavedSearchNotFound) {
+		if _, err := s.shared(userID, id); err == nil {
+			return nil, ErrNotSavedSearchOwner
+		}
+	}
+	return search, err
+}
+
+// shared 通过共享标记读取共享给 userID 的搜索，创建者已取消共享时返回 ErrSavedSearchNotFound
+func (s *SavedSearchService) shared(userID, id string) (*models.SavedSearch, error) {
+	if !validSavedSearchID(id) {
+		return nil, ErrSavedSearchNotFound
+	}
+	reader, _, _, err := s.store.GetObject(savedSearchShareKey(userID, id))
+	if err != nil {
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return nil, ErrSavedSearchNotFound
+		}
+		return nil, err
+	}
+	owner, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	search, err := s.load(string(owner), id)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(search.SharedWith, userID) {
+		return nil, ErrSavedSearchNotFound
+	}
+	return search, nil
+}
+
+// unshare 从共享列表中移除 recipient 并删除其共享标记
+func (s *SavedSearchService) unshare(search *models.SavedSearch, recipient string) error {
+	if err := s.store.DeleteObject(savedSearchShareKey(recipient, search.ID)); err != nil {
+		return fmt.Errorf("删除共享记录失败: %w", err)
+	}
+	sharedWith := search.SharedWith[:0]
+	for _, id := range search.SharedWith {
+		if id != recipient {
+			sharedWith = append(sharedWith, id)
+		}
+	}
+	if len(sharedWith) == len(search.SharedWith) {
+		return nil
+	}
+	search.SharedWith = sharedWith
+	return s.save(search)
+}
+
+func (s *SavedSearchService) lookup(username string) (string, error) {
+	if s.users == nil {
+		return "", ErrUserNotFound
+	}
+	userID, ok, err := s.users.UserID(username)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	return userID, nil
+}
+
+func (s *SavedSearchService) listOwn(userID string) ([]models.SavedSearch, error) {
+	objects, err := tos.ListAllObjects(s.store, savedSearchPrefix+userID+"/")
+	if err != nil {
+		return nil, err
+	}
+	searches := []models.SavedSearch{}
+	for _, obj := range objects {
+		search, err := s.load(userID, strings.TrimSuffix(path.Base(obj.Key), ".json"))
+		if errors.Is(err, ErrSavedSearchNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, *search)
+	}
+	return searches, nil
+}
+
+// load 读取 userID 创建的搜索
+func (s *SavedSearchService) load(userID, id string) (*models.SavedSearch, error) {
+	if !validSavedSearchID(id) {
+		return nil, ErrSavedSearchNotFound
+	}
+
+	reader, _, _, err := s.store.GetObject(savedSearchKey(userID, id))
+	if err != nil {
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return nil, ErrSavedSearchNotFound
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	var search models.SavedSearch
+	if err := json.NewDecoder(reader).Decode(&search); err != nil || search.Owner != userID {
+		return nil, ErrSavedSearchNotFound
+	}
+	return &search, nil
+}
+
+func (s *SavedSearchService) save(search *models.SavedSearch) error {
+	record := *search
+	record.Path = ""
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	if err := s.store.PutObject(savedSearchKey(search.Owner, search.ID), bytes.NewReader(data), int64(len(data)), "application/json", nil); err != nil {
+		return fmt.Errorf("保存搜索失败: %w", err)
+	}
+	return nil
+}
+
+func validSavedSearchID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && id != ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func savedSearchKey(userID, id string) string {
+	return savedSearchPrefix + userID + "/" + id + ".json"
+}
+
+func savedSearchShareKey(userID, id string) string {
+	return savedSearchSharePrefix + userID + "/" + id
+}
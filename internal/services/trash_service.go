@@ -0,0 +1,523 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/tos"
+)
+
+// 回收站相关错误
+var (
+	ErrTrashItemNotFound     = errors.New("回收站条目不存在")
+	ErrRestoreConflict       = errors.New("原路径已存在同名文件或文件夹")
+	ErrInvalidConflictPolicy = errors.New("不支持的冲突处理方式")
+)
+
+// 恢复时原路径已被占用的处理方式
+const (
+	RestoreRename    = "rename"    // 恢复为 "name (1).ext"
+	RestoreOverwrite = "overwrite" // 覆盖已有文件，文件夹合并
+	RestoreFail      = "fail"      // 不恢复，记为失败
+)
+
+const (
+	// trashRecordPrefix 回收站条目记录的前缀
+	trashRecordPrefix = "system/trash-records/"
+	// trashDataPrefix 回收站中文件内容的前缀
+	trashDataPrefix = "system/trash/"
+	// DefaultTrashRetention 回收站条目的默认保留时间
+	DefaultTrashRetention = 30 * 24 * time.Hour
+	// maxRestoreRenames 生成不冲突名称的最大尝试次数
+	maxRestoreRenames = 1000
+)
+
+// trashRecord 回收站条目，Key 为条目在回收站中的对象键（文件夹以 / 结尾）
+type trashRecord struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"userId"`
+	OriginalKey  string    `json:"originalKey"`
+	Key          string    `json:"key"`
+	IsFolder     bool      `json:"isFolder"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"lastModified"`
+	DeletedAt    time.Time `json:"deletedAt"`
+	// RestoringTo 正在恢复的目标路径，恢复部分失败后重试时继续使用该路径
+	RestoringTo string `json:"restoringTo,omitempty"`
+}
+
+// ParseConflictPolicy 校验恢复时的冲突处理方式，空值表示 rename
+func ParseConflictPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return RestoreRename, nil
+	case RestoreRename, RestoreOverwrite, RestoreFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidConflictPolicy, policy)
+	}
+}
+
+// TrashService 删除的文件和文件夹先移到用户的回收站，可恢复或永久删除，超过保留时间后自动清理
+type TrashService struct {
+	store     tos.ObjectStore
+	versions  *VersionService
+	retention time.Duration
+	now       func() time.Time
+	locks     keyedLocks
+}
+
+// NewTrashService retention 为回收站条目的保留时间，0 表示不自动清理；
+// 覆盖恢复时原路径上的文件由 versions 保存为历史版本
+func NewTrashService(store tos.ObjectStore, versions *VersionService, retention time.Duration) *TrashService {
+	return &TrashService{
+		store:     store,
+		versions:  versions,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// SetClock 替换删除时间和过期判断使用的时钟，便于测试
+func (s *TrashService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Trash 将文件或文件夹移到回收站，key 为完整对象键
+// 文件夹部分对象移动失败时返回失败的对象，已移动的部分作为一个回收站条目保留
+func (s *TrashService) Trash(userID, key string, folder bool) (*models.BatchOperationResponse, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	record := &trashRecord{
+		ID:          id,
+		UserID:      userID,
+		OriginalKey: key,
+		IsFolder:    folder,
+		DeletedAt:   s.now(),
+	}
+
+	if !folder {
+		info, err := s.store.HeadObject(key)
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			// 与 DeleteObject 一致，删除不存在的文件不报错，重试删除也不会失败
+			return &models.BatchOperationResponse{Success: true, Message: "文件不存在"}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		record.Key = trashItemPrefix(userID, id) + path.Base(key)
+		record.Size = info.Size
+		record.ContentType = info.ContentType
+		record.ETag = info.ETag
+		record.LastModified = info.LastModified
+
+		// 先保存记录，移动失败时记录指向的对象不存在，清理时一并删除
+		if err := s.saveRecord(record); err != nil {
+			return nil, err
+		}
+		if err := tos.MoveObject(s.store, key, record.Key); err != nil {
+			s.store.DeleteObject(trashRecordKey(userID, id))
+			return nil, err
+		}
+		return &models.BatchOperationResponse{
+			Success:   true,
+			Message:   "已移到回收站",
+			Processed: 1,
+		}, nil
+	}
+
+	prefix := tos.FolderPrefix(key)
+	objects, err := tos.ListAllObjects(s.store, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return &models.BatchOperationResponse{Success: true, Message: "文件夹为空"}, nil
+	}
+	record.OriginalKey = prefix
+	record.Key = trashItemPrefix(userID, id) + path.Base(strings.TrimSuffix(prefix, "/")) + "/"
+	for _, obj := range objects {
+		record.Size += obj.Size
+		if obj.LastModified.After(record.LastModified) {
+			record.LastModified = obj.LastModified
+		}
+	}
+
+	if err := s.saveRecord(record); err != nil {
+		return nil, err
+	}
+	result, err := tos.MoveFolder(s.store, prefix, record.Key, nil)
+	if err != nil {
+		s.store.DeleteObject(trashRecordKey(userID, id))
+		return nil, err
+	}
+	if !result.Success {
+		// 只统计实际移到回收站的大小
+		record.Size = 0
+		moved, _ := tos.ListAllObjects(s.store, record.Key)
+		for _, obj := range moved {
+			record.Size += obj.Size
+		}
+		s.saveRecord(record)
+	}
+	return result, nil
+}
+
+// TrashBatch 将多个文件或文件夹移到回收站，汇总每个对象的结果
+func (s *TrashService) TrashBatch(userID string, keys []string) *models.BatchOperationResponse {
+	processed, failed := 0, 0
+	var failedItems []string
+	for _, key := range keys {
+		folder, err := tos.IsFolder(s.store, key)
+		var result *models.BatchOperationResponse
+		if err == nil {
+			result, err = s.Trash(userID, key, folder)
+		}
+		if err != nil {
+			failed++
+			failedItems = append(failedItems, key)
+			continue
+		}
+		processed += result.Processed
+		failed += result.Failed
+		failedItems = append(failedItems, result.FailedItems...)
+	}
+
+	return &models.BatchOperationResponse{
+		Success:     failed == 0,
+		Message:     fmt.Sprintf("已移到回收站，成功: %d, 失败: %d", processed, failed),
+		Processed:   processed,
+		Failed:      failed,
+		FailedItems: failedItems,
+	}
+}
+
+// List 列出用户回收站中的条目，最近删除的在前
+func (s *TrashService) List(userID string) ([]models.TrashItem, error) {
+	records, err := s.listRecords(trashRecordPrefix + userID + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.TrashItem, 0, len(records))
+	for _, record := range records {
+		items = append(items, s.trashItem(record))
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// Restore 将回收站条目恢复到原路径，原路径被占用时按 onConflict 处理
+// 返回恢复后的完整对象键
+func (s *TrashService) Restore(userID, id, onConflict string) (string, error) {
+	onConflict, err := ParseConflictPolicy(onConflict)
+	if err != nil {
+		return "", err
+	}
+
+	unlock := s.lock(id)
+	defer unlock()
+
+	record, err := s.loadRecord(userID, id)
+	if err != nil {
+		return "", err
+	}
+
+	dest := record.RestoringTo
+	if dest == "" {
+		dest, err = s.restoreTarget(record, onConflict)
+		if err != nil {
+			return "", err
+		}
+		// 记录目标路径，部分失败后重试时不会把已恢复的部分当作冲突
+		record.RestoringTo = dest
+		if err := s.saveRecord(record); err != nil {
+			return "", err
+		}
+	}
+
+	// 覆盖恢复时先保存原路径上文件的历史版本
+	snapshot := func(key string) error {
+		return s.versions.Snapshot(userID, key)
+	}
+	if !record.IsFolder {
+		if err := snapshot(dest); err != nil {
+			return "", err
+		}
+		if err := tos.MoveObject(s.store, record.Key, dest); err != nil {
+			return "", fmt.Errorf("恢复失败: %w", err)
+		}
+	} else {
+		result, err := tos.MoveFolder(s.store, record.Key, dest, snapshot)
+		if err != nil {
+			return "", fmt.Errorf("恢复失败: %w", err)
+		}
+		if !result.Success {
+			return "", fmt.Errorf("恢复失败: %s", result.Message)
+		}
+	}
+
+	s.store.DeleteObject(trashRecordKey(userID, id))
+	return dest, nil
+}
+
+// Delete 永久删除回收站条目
+func (s *TrashService) Delete(userID, id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	record, err := s.loadRecord(userID, id)
+	if err != nil {
+		return err
+	}
+	return s.purge(record)
+}
+
+// Empty 清空用户的回收站，FailedItems 为未能删除的条目ID
+func (s *TrashService) Empty(userID string) (*models.BatchOperationResponse, error) {
+	records, err := s.listRecords(trashRecordPrefix + userID + "/")
+	if err != nil {
+		return nil, err
+	}
+	return s.purgeAll(records, "清空回收站"), nil
+}
+
+// PurgeExpired 永久删除所有用户回收站中超过保留时间的条目
+func (s *TrashService) PurgeExpired() (*models.BatchOperationResponse, error) {
+	if s.retention <= 0 {
+		return &models.BatchOperationResponse{Success: true, Message: "未开启自动清理"}, nil
+	}
+
+	records, err := s.listRecords(trashRecordPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := s.now().Add(-s.retention)
+	var expired []*trashRecord
+	for _, record := range records {
+		if record.DeletedAt.Before(cutoff) {
+			expired = append(expired, record)
+		}
+	}
+	return s.purgeAll(expired, "清理过期条目"), nil
+}
+
+// StartPurge 在后台定期清理过期条目，返回停止函数
+func (s *TrashService) StartPurge(interval time.Duration) (stop func()) {
+	return startPeriodic(interval, func() {
+		result, err := s.PurgeExpired()
+		if err != nil {
+			log.Printf("回收站自动清理失败: %v", err)
+		} else if result.Processed > 0 || result.Failed > 0 {
+			log.Printf("回收站自动清理: %s", result.Message)
+		}
+	})
+}
+
+func (s *TrashService) purgeAll(records []*trashRecord, operation string) *models.BatchOperationResponse {
+	processed, failed := 0, 0
+	var failedItems []string
+	for _, record := range records {
+		unlock := s.lock(record.ID)
+		err := s.purge(record)
+		unlock()
+		if err != nil {
+			failed++
+			failedItems = append(failedItems, record.ID)
+		} else {
+			processed++
+		}
+	}
+
+	return &models.BatchOperationResponse{
+		Success:     failed == 0,
+		Message:     fmt.Sprintf("%s完成，成功: %d, 失败: %d", operation, processed, failed),
+		Processed:   processed,
+		Failed:      failed,
+		FailedItems: failedItems,
+	}
+}
+
+// purge 删除条目的内容，全部删除成功后才删除记录，失败后可以重试
+func (s *TrashService) purge(record *trashRecord) error {
+	result, err := tos.DeleteFolder(s.store, trashItemPrefix(record.UserID, record.ID))
+	if err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("永久删除失败: %s", result.Message)
+	}
+	return s.store.DeleteObject(trashRecordKey(record.UserID, record.ID))
+}
+
+// restoreTarget 选择恢复的目标路径
+func (s *TrashService) restoreTarget(record *trashRecord, onConflict string) (string, error) {
+	dest := record.OriginalKey
+	occupied, err := s.occupied(dest, record.IsFolder)
+	if err != nil || !occupied {
+		return dest, err
+	}
+
+	switch onConflict {
+	case RestoreOverwrite:
+		return dest, nil
+	case RestoreFail:
+		return "", ErrRestoreConflict
+	}
+
+	for i := 1; i <= maxRestoreRenames; i++ {
+		candidate := renamedKey(dest, record.IsFolder, i)
+		occupied, err := s.occupied(candidate, record.IsFolder)
+		if err != nil {
+			return "", err
+		}
+		if !occupied {
+			return candidate, nil
+		}
+	}
+	return "", ErrRestoreConflict
+}
+
+// occupied 判断路径上是否已有文件或非空文件夹
+func (s *TrashService) occupied(key string, folder bool) (bool, error) {
+	if !folder {
+		_, err := s.store.HeadObject(key)
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	output, err := s.store.ListObjects(&tos.ListObjectsInput{Prefix: key, MaxKeys: 1})
+	if err != nil {
+		return false, err
+	}
+	return len(output.Objects) > 0, nil
+}
+
+// renamedKey 生成带序号的名称：a/b.txt -> a/b (1).txt，a/dir/ -> a/dir (1)/
+func renamedKey(key string, folder bool, n int) string {
+	if folder {
+		return fmt.Sprintf("%s (%d)/", strings.TrimSuffix(key, "/"), n)
+	}
+	dir, name := path.Split(key)
+	ext := path.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	return fmt.Sprintf("%s%s (%d)%s", dir, strings.TrimSuffix(name, ext), n, ext)
+}
+
+func (s *TrashService) trashItem(record *trashRecord) models.TrashItem {
+	name := path.Base(strings.TrimSuffix(record.OriginalKey, "/"))
+	item := models.TrashItem{
+		FileInfo: models.FileInfo{
+			Key:          record.ID,
+			Name:         name,
+			Size:         record.Size,
+			LastModified: record.LastModified,
+			ContentType:  record.ContentType,
+			IsFolder:     record.IsFolder,
+			ETag:         record.ETag,
+		},
+		DeletedAt:    record.DeletedAt,
+		OriginalPath: record.OriginalKey,
+		DeletedBy:    record.UserID,
+	}
+	if s.retention > 0 {
+		expiresAt := record.DeletedAt.Add(s.retention)
+		item.ExpiresAt = &expiresAt
+	}
+	return item
+}
+
+// listRecords 读取前缀下的所有条目记录，损坏的记录被跳过
+func (s *TrashService) listRecords(prefix string) ([]*trashRecord, error) {
+	objects, err := tos.ListAllObjects(s.store, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*trashRecord
+	for _, obj := range objects {
+		record, err := s.readRecord(obj.Key)
+		if err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// loadRecord 读取条目记录，属于其他用户时返回 ErrTrashItemNotFound
+func (s *TrashService) loadRecord(userID, id string) (*trashRecord, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, ErrTrashItemNotFound
+	}
+
+	record, err := s.readRecord(trashRecordKey(userID, id))
+	if err != nil {
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return nil, ErrTrashItemNotFound
+		}
+		return nil, err
+	}
+	if record.UserID != userID || record.ID != id {
+		return nil, ErrTrashItemNotFound
+	}
+	return record, nil
+}
+
+func (s *TrashService) readRecord(key string) (*trashRecord, error) {
+	reader, _, _, err := s.store.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var record trashRecord
+	if err := json.NewDecoder(reader).Decode(&record); err != nil {
+		return nil, fmt.Errorf("回收站记录损坏: %w", err)
+	}
+	return &record, nil
+}
+
+func (s *TrashService) saveRecord(record *trashRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := s.store.PutObject(trashRecordKey(record.UserID, record.ID), bytes.NewReader(data), int64(len(data)), "application/json", nil); err != nil {
+		return fmt.Errorf("保存回收站记录失败: %w", err)
+	}
+	return nil
+}
+
+// lock 同一条目的恢复和删除串行执行
+func (s *TrashService) lock(id string) func() {
+	return s.locks.lock(id)
+}
+
+func trashRecordKey(userID, id string) string {
+	return trashRecordPrefix + userID + "/" + id + ".json"
+}
+
+func trashItemPrefix(userID, id string) string {
+	return trashDataPrefix + userID + "/" + id + "/"
+}
@@ -0,0 +1,420 @@
+package services
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"bkp-drive/pkg/mimetypes"
+	"bkp-drive/pkg/tos"
+)
+
+// tus 上传相关错误
+var (
+	ErrTusUploadNotFound    = errors.New("上传不存在或已过期")
+	ErrTusOffsetMismatch    = errors.New("Upload-Offset 与服务端偏移量不一致")
+	ErrTusSizeExceeded      = errors.New("上传内容超过 Upload-Length")
+	ErrTusChecksumMismatch  = errors.New("校验和不匹配")
+	ErrTusChecksumAlgorithm = errors.New("不支持的校验算法")
+)
+
+const (
+	// tusUploadPrefix tus 上传记录和未满一个分片的缓冲数据在存储中的前缀
+	tusUploadPrefix = "system/tus-uploads/"
+	// TusUploadTTL tus 上传的有效期
+	TusUploadTTL = UploadSessionTTL
+)
+
+// TusChecksumAlgorithms 支持的 Upload-Checksum 算法
+var TusChecksumAlgorithms = []string{"sha1", "sha256", "md5"}
+
+// TusUpload 一次 tus 上传的状态
+type TusUpload struct {
+	ID        string
+	Key       string // 完整对象键
+	Length    int64
+	Offset    int64
+	Metadata  string // 原始 Upload-Metadata 头
+	ExpiresAt time.Time
+}
+
+// TusChecksum 单次 PATCH 请求体的校验和
+type TusChecksum struct {
+	hash     hash.Hash
+	expected []byte
+}
+
+// ParseTusChecksum 解析 Upload-Checksum 头（"<算法> <Base64摘要>"）
+func ParseTusChecksum(header string) (*TusChecksum, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, fmt.Errorf("Upload-Checksum 格式错误: %s", header)
+	}
+
+	var h hash.Hash
+	switch algorithm {
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "md5":
+		h = md5.New()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrTusChecksumAlgorithm, algorithm)
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Upload-Checksum 不是有效的Base64: %w", err)
+	}
+
+	return &TusChecksum{hash: h, expected: expected}, nil
+}
+
+// tusUploadRecord 持久化的 tus 上传状态
+// 收到的数据按分片大小写入存储后端的分片上传，不足一个分片的部分暂存为 tail 对象
+type tusUploadRecord struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"userId"`
+	UploadID    string    `json:"uploadId"`
+	Key         string    `json:"key"`
+	ContentType string    `json:"contentType"`
+	Metadata    string    `json:"metadata"`
+	Length      int64     `json:"length"`
+	Offset      int64     `json:"offset"`
+	Flushed     int64     `json:"flushed"` // 已写入分片上传的字节数
+	Parts       int       `json:"parts"`
+	PartSize    int64     `json:"partSize"`
+	Completed   bool      `json:"completed"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// TusService 实现 tus 1.0 协议的存储部分，与普通上传写入同一个对象存储
+type TusService struct {
+	store    tos.ObjectStore
+	uploader tos.MultipartUploader
+	versions *VersionService
+	quotas   *QuotaService
+	now      func() time.Time
+	locks    keyedLocks // 同一上传的请求串行处理
+}
+
+func NewTusService(store tos.ObjectStore, versions *VersionService, quotas *QuotaService) *TusService {
+	uploader, _ := store.(tos.MultipartUploader)
+	return &TusService{
+		store:    store,
+		uploader: uploader,
+		versions: versions,
+		quotas:   quotas,
+		now:      time.Now,
+	}
+}
+
+// SetClock 替换过期判断使用的时钟，便于测试
+func (s *TusService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Create 创建上传，key 为最终的完整对象键，长度为0的文件直接写入
+func (s *TusService) Create(userID, key string, length int64, contentType, metadata string) (*TusUpload, error) {
+	if s.uploader == nil {
+		return nil, ErrMultipartUnsupported
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("Upload-Length 不能为负数")
+	}
+	if err := s.quotas.Check(userID, length); err != nil {
+		return nil, err
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	record := &tusUploadRecord{
+		ID:          id,
+		UserID:      userID,
+		Key:         key,
+		ContentType: contentType,
+		Metadata:    metadata,
+		Length:      length,
+		PartSize:    suggestPartSize(length),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(TusUploadTTL),
+	}
+
+	if length == 0 {
+		if err := s.versions.Snapshot(userID, key); err != nil {
+			return nil, err
+		}
+		if err := s.store.PutObject(key, bytes.NewReader(nil), 0, mimetypes.TypeByKey(key), nil); err != nil {
+			return nil, err
+		}
+		record.Completed = true
+	} else {
+		record.UploadID, err = s.uploader.CreateMultipartUpload(key, contentType, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.saveRecord(record); err != nil {
+		if record.UploadID != "" {
+			s.uploader.AbortMultipartUpload(key, record.UploadID)
+		}
+		return nil, err
+	}
+
+	return record.upload(), nil
+}
+
+// Get 获取上传的当前偏移量
+func (s *TusService) Get(userID, id string) (*TusUpload, error) {
+	record, err := s.loadRecord(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return record.upload(), nil
+}
+
+// Write 从 offset 处追加数据；未携带校验和时，连接中断前已收到的数据仍会保存
+// 写满 Upload-Length 后合并为最终文件
+func (s *TusService) Write(userID, id string, offset int64, content io.Reader, checksum *TusChecksum) (*TusUpload, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	record, err := s.loadRecord(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != record.Offset {
+		return nil, ErrTusOffsetMismatch
+	}
+
+	// 先落到临时文件：校验和需要读完整个请求体才能验证
+	spool, err := os.CreateTemp("", "bkp-tus-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	remaining := record.Length - record.Offset
+	var w io.Writer = spool
+	if checksum != nil {
+		w = io.MultiWriter(spool, checksum.hash)
+	}
+	n, readErr := io.Copy(w, io.LimitReader(content, remaining+1))
+	if n > remaining {
+		return nil, ErrTusSizeExceeded
+	}
+	if readErr != nil && checksum != nil {
+		return nil, fmt.Errorf("读取上传数据失败: %w", readErr)
+	}
+	if checksum != nil && !bytes.Equal(checksum.hash.Sum(nil), checksum.expected) {
+		return nil, ErrTusChecksumMismatch
+	}
+	if n == 0 {
+		return record.upload(), nil
+	}
+	// 上传期间可能写入了其他文件，合并为最终文件之前再检查一次配额
+	if record.Offset+n == record.Length {
+		if err := s.quotas.Check(userID, record.Length); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if err := s.appendData(record, spool, n); err != nil {
+		return nil, err
+	}
+
+	return record.upload(), nil
+}
+
+// Terminate 终止上传并清理已上传的数据；已完成的上传只删除记录，不影响文件
+func (s *TusService) Terminate(userID, id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	record, err := s.loadRecord(userID, id)
+	if err != nil {
+		return err
+	}
+
+	s.discard(record)
+	return nil
+}
+
+// appendData 将新数据与暂存的 tail 拼接，按分片大小写入分片上传，剩余部分重新暂存
+func (s *TusService) appendData(record *tusUploadRecord, data io.Reader, size int64) error {
+	buffered := record.Offset - record.Flushed
+	pending := buffered + size
+	final := record.Offset+size == record.Length
+
+	reader := data
+	if buffered > 0 {
+		tail, _, _, err := s.store.GetObject(tailKey(record.UserID, record.ID))
+		if err != nil {
+			return fmt.Errorf("读取暂存数据失败: %w", err)
+		}
+		defer tail.Close()
+		reader = io.MultiReader(io.LimitReader(tail, buffered), data)
+	}
+
+	for pending >= record.PartSize || (final && pending > 0) {
+		partSize := min(pending, record.PartSize)
+		if _, err := s.uploader.UploadPart(record.Key, record.UploadID, record.Parts+1, io.LimitReader(reader, partSize), partSize); err != nil {
+			return s.wrapUploadError(record, err)
+		}
+		record.Parts++
+		record.Flushed += partSize
+		pending -= partSize
+	}
+
+	if pending > 0 {
+		// tail 对象可能正被读取，先复制到临时文件再覆盖
+		rest, err := os.CreateTemp("", "bkp-tus-tail-*")
+		if err != nil {
+			return fmt.Errorf("创建临时文件失败: %w", err)
+		}
+		defer func() {
+			rest.Close()
+			os.Remove(rest.Name())
+		}()
+		if _, err := io.CopyN(rest, reader, pending); err != nil {
+			return fmt.Errorf("暂存数据失败: %w", err)
+		}
+		if _, err := rest.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := s.store.PutObject(tailKey(record.UserID, record.ID), rest, pending, "application/octet-stream", nil); err != nil {
+			return fmt.Errorf("暂存数据失败: %w", err)
+		}
+	}
+
+	record.Offset += size
+
+	if final {
+		parts, err := s.uploader.ListParts(record.Key, record.UploadID)
+		if err != nil {
+			return s.wrapUploadError(record, err)
+		}
+		if err := s.versions.Snapshot(record.UserID, record.Key); err != nil {
+			return err
+		}
+		if err := s.uploader.CompleteMultipartUpload(record.Key, record.UploadID, parts); err != nil {
+			return s.wrapUploadError(record, err)
+		}
+		record.Completed = true
+		s.store.DeleteObject(tailKey(record.UserID, record.ID))
+		if err := detectContentType(s.store, record.Key); err != nil {
+			return err
+		}
+	}
+
+	// 完成的上传保留记录直到过期，客户端续传时 HEAD 仍能得到最终偏移量
+	return s.saveRecord(record)
+}
+
+// discard 删除上传记录、暂存数据以及未完成的分片上传
+func (s *TusService) discard(record *tusUploadRecord) {
+	if !record.Completed && record.UploadID != "" {
+		s.uploader.AbortMultipartUpload(record.Key, record.UploadID)
+	}
+	s.store.DeleteObject(tailKey(record.UserID, record.ID))
+	s.store.DeleteObject(tusRecordKey(record.UserID, record.ID))
+}
+
+// wrapUploadError 存储后端的分片上传已不存在时，上传随之失效
+func (s *TusService) wrapUploadError(record *tusUploadRecord, err error) error {
+	if errors.Is(err, tos.ErrUploadNotFound) {
+		s.discard(record)
+		return ErrTusUploadNotFound
+	}
+	return err
+}
+
+// loadRecord 读取上传记录，属于其他用户或已过期时返回 ErrTusUploadNotFound
+func (s *TusService) loadRecord(userID, id string) (*tusUploadRecord, error) {
+	if s.uploader == nil {
+		return nil, ErrMultipartUnsupported
+	}
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, ErrTusUploadNotFound
+	}
+
+	reader, _, _, err := s.store.GetObject(tusRecordKey(userID, id))
+	if err != nil {
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return nil, ErrTusUploadNotFound
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	var record tusUploadRecord
+	if err := json.NewDecoder(reader).Decode(&record); err != nil || record.UserID != userID {
+		return nil, ErrTusUploadNotFound
+	}
+
+	if s.now().After(record.ExpiresAt) {
+		s.discard(&record)
+		return nil, ErrTusUploadNotFound
+	}
+
+	return &record, nil
+}
+
+func (s *TusService) saveRecord(record *tusUploadRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := s.store.PutObject(tusRecordKey(record.UserID, record.ID), bytes.NewReader(data), int64(len(data)), "application/json", nil); err != nil {
+		return fmt.Errorf("保存上传记录失败: %w", err)
+	}
+	return nil
+}
+
+func (s *TusService) lock(id string) func() {
+	return s.locks.lock(id)
+}
+
+func (r *tusUploadRecord) upload() *TusUpload {
+	return &TusUpload{
+		ID:        r.ID,
+		Key:       r.Key,
+		Length:    r.Length,
+		Offset:    r.Offset,
+		Metadata:  r.Metadata,
+		ExpiresAt: r.ExpiresAt,
+	}
+}
+
+func tusRecordKey(userID, id string) string {
+	return path.Join(tusUploadPrefix, userID, id+".json")
+}
+
+func tailKey(userID, id string) string {
+	return path.Join(tusUploadPrefix, userID, id+".tail")
+}
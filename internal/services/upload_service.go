@@ -0,0 +1,376 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/mimetypes"
+	"bkp-drive/pkg/tos"
+)
+
+// 上传会话相关错误
+var (
+	ErrUploadSessionNotFound = errors.New("上传会话不存在或已过期")
+	ErrMultipartUnsupported  = errors.New("当前存储后端不支持分片上传")
+	ErrIncompleteUpload      = errors.New("上传未完成")
+)
+
+const (
+	// uploadSessionPrefix 上传会话记录在存储中的前缀，位于用户空间之外，用户不可见
+	uploadSessionPrefix = "system/upload-sessions/"
+	// UploadSessionTTL 上传会话的有效期
+	UploadSessionTTL = 7 * 24 * time.Hour
+	// DefaultUploadPartSize 建议的分片大小
+	DefaultUploadPartSize = 8 << 20
+)
+
+// uploadSessionRecord 持久化的上传会话，服务重启后客户端可以继续上传
+type uploadSessionRecord struct {
+	SessionID   string    `json:"sessionId"`
+	UserID      string    `json:"userId"`
+	UploadID    string    `json:"uploadId"` // 存储后端的分片上传ID
+	Key         string    `json:"key"`
+	FileName    string    `json:"fileName"`
+	Size        int64     `json:"size"`
+	PartSize    int64     `json:"partSize"`
+	ContentType string    `json:"contentType"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// UploadService 管理基于分片上传的可续传上传会话
+type UploadService struct {
+	store    tos.ObjectStore
+	uploader tos.MultipartUploader
+	versions *VersionService
+	quotas   *QuotaService
+	now      func() time.Time
+}
+
+func NewUploadService(store tos.ObjectStore, versions *VersionService, quotas *QuotaService) *UploadService {
+	uploader, _ := store.(tos.MultipartUploader)
+	return &UploadService{
+		store:    store,
+		uploader: uploader,
+		versions: versions,
+		quotas:   quotas,
+		now:      time.Now,
+	}
+}
+
+// SetClock 替换会话过期判断使用的时钟，便于测试
+func (s *UploadService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Initiate 创建上传会话，key 为完整对象键
+func (s *UploadService) Initiate(userID, key string, size int64, contentType string) (*models.UploadSession, error) {
+	if s.uploader == nil {
+		return nil, ErrMultipartUnsupported
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("文件大小不能为负数")
+	}
+	if err := s.quotas.Check(userID, size); err != nil {
+		return nil, err
+	}
+
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	uploadID, err := s.uploader.CreateMultipartUpload(key, contentType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	record := &uploadSessionRecord{
+		SessionID:   sessionID,
+		UserID:      userID,
+		UploadID:    uploadID,
+		Key:         key,
+		FileName:    path.Base(key),
+		Size:        size,
+		PartSize:    suggestPartSize(size),
+		ContentType: contentType,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(UploadSessionTTL),
+	}
+	if err := s.saveRecord(record); err != nil {
+		s.uploader.AbortMultipartUpload(key, uploadID)
+		return nil, err
+	}
+
+	return record.session(nil), nil
+}
+
+// Get 获取上传会话及已上传的分片
+func (s *UploadService) Get(userID, sessionID string) (*models.UploadSession, error) {
+	record, err := s.loadRecord(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := s.listParts(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record.session(parts), nil
+}
+
+// List 列出用户所有未完成的上传会话
+func (s *UploadService) List(userID string) ([]models.UploadSession, error) {
+	sessions := []models.UploadSession{}
+
+	input := &tos.ListObjectsInput{Prefix: uploadSessionPrefix + userID + "/"}
+	for {
+		output, err := s.store.ListObjects(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range output.Objects {
+			sessionID := strings.TrimSuffix(path.Base(obj.Key), ".json")
+			session, err := s.Get(userID, sessionID)
+			if err != nil {
+				// 过期或损坏的会话在 loadRecord 中已被清理
+				continue
+			}
+			sessions = append(sessions, *session)
+		}
+
+		if !output.IsTruncated {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+// UploadPart 上传一个分片，重复上传同一编号会覆盖之前的内容
+func (s *UploadService) UploadPart(userID, sessionID string, partNumber int, content io.Reader, size int64) (*models.UploadPartInfo, error) {
+	record, err := s.loadRecord(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	part, err := s.uploader.UploadPart(record.Key, record.UploadID, partNumber, content, size)
+	if err != nil {
+		return nil, s.wrapUploadError(record, err)
+	}
+
+	info := partInfo(*part)
+	return &info, nil
+}
+
+// Complete 合并所有已上传的分片，分片编号必须从1开始连续，返回最终的对象键
+func (s *UploadService) Complete(userID, sessionID string) (string, error) {
+	record, err := s.loadRecord(userID, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	parts, err := s.uploader.ListParts(record.Key, record.UploadID)
+	if err != nil {
+		return "", s.wrapUploadError(record, err)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%w: 尚未上传任何分片", ErrIncompleteUpload)
+	}
+
+	var total int64
+	for i, part := range parts {
+		if part.PartNumber != i+1 {
+			return "", fmt.Errorf("%w: 缺少第 %d 个分片", ErrIncompleteUpload, i+1)
+		}
+		total += part.Size
+	}
+	if record.Size > 0 && total != record.Size {
+		return "", fmt.Errorf("%w: 已上传 %d 字节，文件大小为 %d 字节", ErrIncompleteUpload, total, record.Size)
+	}
+	// 创建会话时可能未声明大小，期间也可能写入了其他文件，按实际大小再检查一次
+	if err := s.quotas.Check(userID, total); err != nil {
+		return "", err
+	}
+
+	if err := s.versions.Snapshot(userID, record.Key); err != nil {
+		return "", err
+	}
+	if err := s.uploader.CompleteMultipartUpload(record.Key, record.UploadID, parts); err != nil {
+		return "", s.wrapUploadError(record, err)
+	}
+	s.store.DeleteObject(recordKey(userID, sessionID))
+	if err := detectContentType(s.store, record.Key); err != nil {
+		return "", err
+	}
+
+	return record.Key, nil
+}
+
+// Abort 取消上传会话并清理已上传的分片
+func (s *UploadService) Abort(userID, sessionID string) error {
+	record, err := s.loadRecord(userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.uploader.AbortMultipartUpload(record.Key, record.UploadID); err != nil && !errors.Is(err, tos.ErrUploadNotFound) {
+		return err
+	}
+	return s.store.DeleteObject(recordKey(userID, sessionID))
+}
+
+func (s *UploadService) listParts(record *uploadSessionRecord) ([]tos.UploadedPart, error) {
+	parts, err := s.uploader.ListParts(record.Key, record.UploadID)
+	if err != nil {
+		return nil, s.wrapUploadError(record, err)
+	}
+	return parts, nil
+}
+
+// wrapUploadError 存储后端的分片上传已不存在时，会话记录也随之失效
+func (s *UploadService) wrapUploadError(record *uploadSessionRecord, err error) error {
+	if errors.Is(err, tos.ErrUploadNotFound) {
+		s.store.DeleteObject(recordKey(record.UserID, record.SessionID))
+		return ErrUploadSessionNotFound
+	}
+	return err
+}
+
+// loadRecord 读取会话记录，会话属于其他用户或已过期时返回 ErrUploadSessionNotFound
+func (s *UploadService) loadRecord(userID, sessionID string) (*uploadSessionRecord, error) {
+	if s.uploader == nil {
+		return nil, ErrMultipartUnsupported
+	}
+	if _, err := hex.DecodeString(sessionID); err != nil || sessionID == "" {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	reader, _, _, err := s.store.GetObject(recordKey(userID, sessionID))
+	if err != nil {
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, err
+	}
+	defer reader.Close()
+
+	var record uploadSessionRecord
+	if err := json.NewDecoder(reader).Decode(&record); err != nil || record.UserID != userID {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	if s.now().After(record.ExpiresAt) {
+		s.uploader.AbortMultipartUpload(record.Key, record.UploadID)
+		s.store.DeleteObject(recordKey(userID, sessionID))
+		return nil, ErrUploadSessionNotFound
+	}
+
+	return &record, nil
+}
+
+func (s *UploadService) saveRecord(record *uploadSessionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := s.store.PutObject(recordKey(record.UserID, record.SessionID), bytes.NewReader(data), int64(len(data)), "application/json", nil); err != nil {
+		return fmt.Errorf("保存上传会话失败: %w", err)
+	}
+	return nil
+}
+
+func (r *uploadSessionRecord) session(parts []tos.UploadedPart) *models.UploadSession {
+	session := &models.UploadSession{
+		SessionId:   r.SessionID,
+		Key:         r.Key,
+		FileName:    r.FileName,
+		Size:        r.Size,
+		PartSize:    r.PartSize,
+		ContentType: r.ContentType,
+		Parts:       []models.UploadPartInfo{},
+		CreatedAt:   r.CreatedAt,
+		ExpiresAt:   r.ExpiresAt,
+	}
+	for _, part := range parts {
+		session.Parts = append(session.Parts, partInfo(part))
+		session.UploadedSize += part.Size
+	}
+	return session
+}
+
+func partInfo(part tos.UploadedPart) models.UploadPartInfo {
+	return models.UploadPartInfo{
+		PartNumber:   part.PartNumber,
+		Size:         part.Size,
+		ETag:         part.ETag,
+		LastModified: part.LastModified,
+	}
+}
+
+// detectContentType 按已写入对象的前几个字节判断 Content-Type，空文件按扩展名判断，
+// 与存储中的不一致时修改；分片上传和直传时客户端声明的 Content-Type 不可信
+func detectContentType(store tos.ObjectStore, key string) error {
+	info, err := store.HeadObject(key)
+	if err != nil {
+		return err
+	}
+
+	contentType := mimetypes.TypeByKey(key)
+	if info.Size > 0 {
+		reader, err := tos.GetObjectRange(store, key, 0, min(info.Size, mimetypes.SniffLen))
+		if err != nil {
+			return err
+		}
+		head, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("读取文件内容失败: %w", err)
+		}
+		contentType = mimetypes.DetectBytes(head, path.Base(key))
+	}
+
+	if contentType == info.ContentType {
+		return nil
+	}
+	return tos.SetContentType(store, key, contentType)
+}
+
+func recordKey(userID, sessionID string) string {
+	return uploadSessionPrefix + userID + "/" + sessionID + ".json"
+}
+
+// suggestPartSize 建议的分片大小，保证分片数量不超过上限
+func suggestPartSize(size int64) int64 {
+	partSize := int64(DefaultUploadPartSize)
+	for size > partSize*tos.MaxPartNumber {
+		partSize *= 2
+	}
+	return partSize
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成会话ID失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/tos"
+)
+
+// 历史版本相关错误
+var (
+	ErrVersionNotFound      = errors.New("历史版本不存在")
+	ErrDeleteCurrentVersion = errors.New("不能删除当前版本，请直接删除文件")
+	ErrInvalidVersionPolicy = errors.New("保留策略不能为负数")
+)
+
+const (
+	// versionDataPrefix 历史版本的前缀，文件 key 的版本位于 system/versions/<key>/<versionId>
+	versionDataPrefix = "system/versions/"
+	// versionPolicyPrefix 用户保留策略的前缀
+	versionPolicyPrefix = "system/version-policies/"
+	// userKeyPrefix 用户文件的前缀，与处理器中的用户命名空间一致
+	userKeyPrefix = "users/"
+	// CurrentVersionID 表示文件的当前版本
+	CurrentVersionID = "current"
+)
+
+// versionEntry 一个历史版本，id 为16位十六进制的原修改时间加8位 ETag 校验值，按 id 排序即按时间排序
+type versionEntry struct {
+	id     string
+	object tos.ObjectInfo
+}
+
+// VersionService 覆盖文件前保留原内容作为历史版本，并按用户的保留策略清理
+// 版本按路径记录：文件移动或删除后，原路径的历史版本仍然保留
+type VersionService struct {
+	store    tos.ObjectStore
+	defaults models.VersionPolicy
+	now      func() time.Time
+}
+
+// NewVersionService defaults 为用户未设置保留策略时使用的策略
+func NewVersionService(store tos.ObjectStore, defaults models.VersionPolicy) *VersionService {
+	return &VersionService{
+		store:    store,
+		defaults: defaults,
+		now:      time.Now,
+	}
+}
+
+// SetClock 替换保留期限判断使用的时钟，便于测试
+func (s *VersionService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Snapshot 在覆盖 key 之前将当前内容保存为历史版本，对象不存在时不做任何事
+// 版本ID由原修改时间和 ETag 决定，重复调用不会产生重复的版本
+func (s *VersionService) Snapshot(userID, key string) error {
+	if err := s.snapshot(key); err != nil {
+		return err
+	}
+	s.prune(userID, key)
+	return nil
+}
+
+func (s *VersionService) snapshot(key string) error {
+	if strings.HasSuffix(key, "/") {
+		return nil
+	}
+	info, err := s.store.HeadObject(key)
+	if errors.Is(err, tos.ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.CopyObject(key, versionKey(key, versionID(info))); err != nil {
+		return fmt.Errorf("保存历史版本失败: %w", err)
+	}
+	return nil
+}
+
+// List 列出文件的当前版本和历史版本，最新的在前
+// 文件和历史版本都不存在时返回 tos.ErrObjectNotFound
+func (s *VersionService) List(key string) ([]models.FileVersion, error) {
+	versions := []models.FileVersion{}
+
+	info, err := s.store.HeadObject(key)
+	if err != nil && !errors.Is(err, tos.ErrObjectNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		versions = append(versions, models.FileVersion{
+			VersionId:    CurrentVersionID,
+			Size:         info.Size,
+			LastModified: info.LastModified,
+			ETag:         info.ETag,
+			IsLatest:     true,
+		})
+	}
+
+	entries, err := s.listVersions(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		versions = append(versions, models.FileVersion{
+			VersionId:    entry.id,
+			Size:         entry.object.Size,
+			LastModified: versionTime(entry.id),
+			ETag:         entry.object.ETag,
+		})
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("获取版本失败: %w", tos.ErrObjectNotFound)
+	}
+	return versions, nil
+}
+
+// ObjectKey 返回指定版本内容所在的对象键，current 表示文件本身
+func (s *VersionService) ObjectKey(key, id string) (string, error) {
+	if id == CurrentVersionID {
+		return key, nil
+	}
+	if !validVersionID(id) {
+		return "", ErrVersionNotFound
+	}
+
+	versioned := versionKey(key, id)
+	if _, err := s.store.HeadObject(versioned); err != nil {
+		if errors.Is(err, tos.ErrObjectNotFound) {
+			return "", ErrVersionNotFound
+		}
+		return "", err
+	}
+	return versioned, nil
+}
+
+// Restore 将历史版本恢复为当前版本，被替换的当前内容保存为新的历史版本
+func (s *VersionService) Restore(userID, key, id string) error {
+	if id == CurrentVersionID {
+		return nil
+	}
+	versioned, err := s.ObjectKey(key, id)
+	if err != nil {
+		return err
+	}
+
+	// 先恢复再清理，避免要恢复的版本因超出保留数量被删除
+	if err := s.snapshot(key); err != nil {
+		return err
+	}
+	if err := s.store.CopyObject(versioned, key); err != nil {
+		return fmt.Errorf("恢复版本失败: %w", err)
+	}
+	s.prune(userID, key)
+	return nil
+}
+
+// Delete 删除一个历史版本
+func (s *VersionService) Delete(key, id string) error {
+	if id == CurrentVersionID {
+		return ErrDeleteCurrentVersion
+	}
+	versioned, err := s.ObjectKey(key, id)
+	if err != nil {
+		return err
+	}
+	return s.store.DeleteObject(versioned)
+}
+
+// Policy 返回用户的保留策略，未设置时返回默认策略
+func (s *VersionService) Policy(userID string) (models.VersionPolicy, error) {
+	reader, _, _, err := s.store.GetObject(versionPolicyKey(userID))
+	if errors.Is(err, tos.ErrObjectNotFound) {
+		return s.defaults, nil
+	}
+	if err != nil {
+		return models.VersionPolicy{}, err
+	}
+	defer reader.Close()
+
+	var policy models.VersionPolicy
+	if err := json.NewDecoder(reader).Decode(&policy); err != nil {
+		return s.defaults, nil
+	}
+	return policy, nil
+}
+
+// SetPolicy 保存用户的保留策略，并立即按新策略清理该用户的历史版本
+func (s *VersionService) SetPolicy(userID string, policy models.VersionPolicy) error {
+	if policy.KeepLast < 0 || policy.KeepDays < 0 {
+		return ErrInvalidVersionPolicy
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if err := s.store.PutObject(versionPolicyKey(userID), bytes.NewReader(data), int64(len(data)), "application/json", nil); err != nil {
+		return fmt.Errorf("保存保留策略失败: %w", err)
+	}
+
+	_, err = s.pruneAll(versionDataPrefix + userKeyPrefix + userID + "/")
+	return err
+}
+
+// PruneExpired 按各用户的保留策略清理所有历史版本，返回删除的版本数
+func (s *VersionService) PruneExpired() (int, error) {
+	return s.pruneAll(versionDataPrefix)
+}
+
+// StartPrune 在后台定期清理超过保留期限的历史版本，返回停止函数
+func (s *VersionService) StartPrune(interval time.Duration) (stop func()) {
+	return startPeriodic(interval, func() {
+		deleted, err := s.PruneExpired()
+		if err != nil {
+			log.Printf("历史版本清理失败: %v", err)
+		} else if deleted > 0 {
+			log.Printf("历史版本清理: 删除 %d 个版本", deleted)
+		}
+	})
+}
+
+// prune 按用户的保留策略清理一个文件的历史版本，失败只记录日志
+func (s *VersionService) prune(userID, key string) {
+	policy, err := s.Policy(userID)
+	if err == nil {
+		var entries []versionEntry
+		entries, err = s.listVersions(key)
+		if err == nil {
+			s.pruneEntries(policy, entries)
+		}
+	}
+	if err != nil {
+		log.Printf("清理 %s 的历史版本失败: %v", key, err)
+	}
+}
+
+// pruneAll 清理前缀下所有文件的历史版本
+func (s *VersionService) pruneAll(prefix string) (int, error) {
+	objects, err := tos.ListAllObjects(s.store, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	byKey := map[string][]versionEntry{}
+	for _, obj := range objects {
+		key, id := path.Split(strings.TrimPrefix(obj.Key, versionDataPrefix))
+		if !validVersionID(id) {
+			continue
+		}
+		key = strings.TrimSuffix(key, "/")
+		byKey[key] = append(byKey[key], versionEntry{id: id, object: obj})
+	}
+
+	policies := map[string]models.VersionPolicy{}
+	deleted := 0
+	for key, entries := range byKey {
+		userID := versionOwner(key)
+		policy, ok := policies[userID]
+		if !ok {
+			if policy, err = s.Policy(userID); err != nil {
+				return deleted, err
+			}
+			policies[userID] = policy
+		}
+
+		sortVersions(entries)
+		deleted += s.pruneEntries(policy, entries)
+	}
+	return deleted, nil
+}
+
+// pruneEntries 删除超出保留数量或保留天数的版本，entries 须按时间从新到旧排序
+// 保留天数从版本被替换（保存为历史版本）的时间开始计算
+func (s *VersionService) pruneEntries(policy models.VersionPolicy, entries []versionEntry) int {
+	cutoff := s.now().Add(-time.Duration(policy.KeepDays) * 24 * time.Hour)
+	deleted := 0
+	for i, entry := range entries {
+		tooMany := policy.KeepLast > 0 && i >= policy.KeepLast
+		tooOld := policy.KeepDays > 0 && entry.object.LastModified.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := s.store.DeleteObject(entry.object.Key); err == nil {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// listVersions 列出文件的历史版本，从新到旧排序
+func (s *VersionService) listVersions(key string) ([]versionEntry, error) {
+	var entries []versionEntry
+
+	input := &tos.ListObjectsInput{Prefix: versionDataPrefix + key + "/", Delimiter: "/"}
+	for {
+		output, err := s.store.ListObjects(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range output.Objects {
+			id := path.Base(obj.Key)
+			if validVersionID(id) {
+				entries = append(entries, versionEntry{id: id, object: obj})
+			}
+		}
+		if !output.IsTruncated {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	sortVersions(entries)
+	return entries, nil
+}
+
+func sortVersions(entries []versionEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id > entries[j].id
+	})
+}
+
+func versionID(info *tos.ObjectInfo) string {
+	return fmt.Sprintf("%016x%08x", info.LastModified.UnixNano(), crc32.ChecksumIEEE([]byte(info.ETag)))
+}
+
+func validVersionID(id string) bool {
+	if len(id) != 24 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// versionTime 版本ID中记录的原修改时间
+func versionTime(id string) time.Time {
+	nanos, _ := strconv.ParseInt(id[:16], 16, 64)
+	return time.Unix(0, nanos)
+}
+
+// versionOwner 从 users/<user_id>/... 形式的对象键中取出用户ID
+func versionOwner(key string) string {
+	owner, _, _ := strings.Cut(strings.TrimPrefix(key, userKeyPrefix), "/")
+	return owner
+}
+
+func versionKey(key, id string) string {
+	return versionDataPrefix + key + "/" + id
+}
+
+func versionPolicyKey(userID string) string {
+	return versionPolicyPrefix + userID + ".json"
+}
@@ -2,9 +2,17 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
+	// 存储后端配置
+	StorageBackend   string // tos（默认）、s3、local 或 memory（仅用于调试，重启后数据丢失）
+	LocalStoragePath string // local 后端的根目录
+	StorageDedup     bool   // 按内容去重，相同内容只保存一份
+	MetadataIndex    bool   // 在数据库的 files 表中维护用户文件的元数据索引
+
 	// TOS配置
 	TOSEndpoint string
 	TOSRegion   string
@@ -12,6 +20,14 @@ type Config struct {
 	SecretKey   string
 	BucketName  string
 
+	// S3兼容存储配置（MinIO等）
+	S3Endpoint     string // 如 http://localhost:9000，http:// 前缀表示不使用TLS
+	S3Region       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3BucketName   string
+	S3UsePathStyle bool // 使用路径风格寻址（MinIO通常需要开启）
+
 	// Supabase/PostgreSQL配置 (支持两种方式)
 	DatabaseURL string // 完整的连接URL (优先使用)
 	DBHost      string // 或者使用单独的参数
@@ -22,10 +38,34 @@ type Config struct {
 
 	// JWT密钥
 	JWTSecret string
+
+	// 回收站条目的保留时间，超过后自动永久删除，0 表示不自动清理
+	TrashRetention time.Duration
+
+	// 历史版本的默认保留策略，用户可以单独设置，0 表示不限制
+	VersionKeepLast int
+	VersionKeepDays int
+
+	// 解压限制，防止压缩炸弹，0 表示不限制
+	ExtractMaxBytes int64
+	ExtractMaxFiles int
+	ExtractMaxRatio int
+
+	// 没有单独设置配额的用户的存储配额（字节），0 表示不限制
+	UserQuota int64
+
+	// 没有设置时区的用户使用的时区（IANA 时区名），用于计算今天、本周等时间范围
+	DefaultTimezone string
 }
 
 func LoadConfig() *Config {
 	return &Config{
+		// 存储后端配置
+		StorageBackend:   getEnvOrDefault("STORAGE_BACKEND", "tos"),
+		LocalStoragePath: getEnvOrDefault("LOCAL_STORAGE_PATH", "./data"),
+		StorageDedup:     getEnvBool("STORAGE_DEDUP", false),
+		MetadataIndex:    getEnvBool("METADATA_INDEX", false),
+
 		// TOS配置
 		AccessKey:   os.Getenv("TOS_ACCESS_KEY"),
 		SecretKey:   os.Getenv("TOS_SECRET_KEY"),
@@ -33,6 +73,14 @@ func LoadConfig() *Config {
 		TOSRegion:   os.Getenv("TOS_REGION"),
 		BucketName:  os.Getenv("TOS_BUCKET_NAME"),
 
+		// S3兼容存储配置
+		S3Endpoint:     os.Getenv("S3_ENDPOINT"),
+		S3Region:       getEnvOrDefault("S3_REGION", "us-east-1"),
+		S3AccessKey:    os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:    os.Getenv("S3_SECRET_KEY"),
+		S3BucketName:   os.Getenv("S3_BUCKET_NAME"),
+		S3UsePathStyle: getEnvBool("S3_USE_PATH_STYLE", true),
+
 		// Supabase/PostgreSQL配置
 		DatabaseURL: os.Getenv("DATABASE_URL"),          // 优先使用完整URL
 		DBHost:      os.Getenv("SUPABASE_DB_HOST"),      // 或者使用单独参数
@@ -43,6 +91,24 @@ func LoadConfig() *Config {
 
 		// JWT密钥
 		JWTSecret: os.Getenv("JWT_SECRET"),
+
+		// 回收站
+		TrashRetention: time.Duration(getEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+
+		// 历史版本
+		VersionKeepLast: getEnvInt("VERSION_KEEP_LAST", 10),
+		VersionKeepDays: getEnvInt("VERSION_KEEP_DAYS", 0),
+
+		// 解压限制
+		ExtractMaxBytes: int64(getEnvInt("EXTRACT_MAX_SIZE_MB", 10240)) << 20,
+		ExtractMaxFiles: getEnvInt("EXTRACT_MAX_FILES", 10000),
+		ExtractMaxRatio: getEnvInt("EXTRACT_MAX_RATIO", 100),
+
+		// 用户配额
+		UserQuota: int64(getEnvInt("USER_QUOTA_MB", 102400)) << 20,
+
+		// 默认时区
+		DefaultTimezone: getEnvOrDefault("DEFAULT_TIMEZONE", "Asia/Shanghai"),
 	}
 }
 
@@ -52,3 +118,21 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			return parsed
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,502 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/fulltext"
+	"bkp-drive/pkg/mimetypes"
+	"bkp-drive/pkg/searchquery"
+	"bkp-drive/pkg/tos"
+)
+
+// userKeyPrefix 用户文件的对象键前缀，其后的第一段为用户ID
+const userKeyPrefix = "users/"
+
+// defaultListMaxKeys 列举记录的默认单页数量，与存储后端一致
+const defaultListMaxKeys = 1000
+
+// snippetWindow 按内容搜索时为生成摘要读取的原文字符数
+const snippetWindow = 400
+
+const fileColumns = "key, size, content_type, etag, content_hash, last_modified, tags"
+
+// FileIndex 基于 files 表的对象元数据索引（表结构见 scripts/init_supabase.sql）
+// key 使用 "C" 排序规则，按前缀查询可以使用主键索引，排序与对象存储的列举顺序一致
+type FileIndex struct {
+	db *sql.DB
+}
+
+func NewFileIndex(db *sql.DB) *FileIndex {
+	return &FileIndex{db: db}
+}
+
+// PutObject 新增或更新对象的记录
+func (f *FileIndex) PutObject(info tos.ObjectInfo) error {
+	contentType := tos.ObjectContentType(info)
+	tags := tos.ObjectTags(info)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	_, err := f.db.Exec(`
+		INSERT INTO files (key, owner, size, content_type, category, etag, content_hash, is_folder, tags, last_modified)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (key) DO UPDATE SET
+			owner = EXCLUDED.owner,
+			size = EXCLUDED.size,
+			content_type = EXCLUDED.content_type,
+			category = EXCLUDED.category,
+			etag = EXCLUDED.etag,
+			content_hash = EXCLUDED.content_hash,
+			is_folder = EXCLUDED.is_folder,
+			tags = EXCLUDED.tags,
+			last_modified = EXCLUDED.last_modified`,
+		info.Key,
+		ownerOf(info.Key),
+		info.Size,
+		contentType,
+		mimetypes.Category(contentType, info.Key),
+		info.ETag,
+		info.ContentHash,
+		strings.HasSuffix(info.Key, "/") && info.Size == 0,
+		pq.Array(tags),
+		info.LastModified,
+	)
+	if err != nil {
+		return fmt.Errorf("保存文件记录失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteObject 删除对象的记录
+func (f *FileIndex) DeleteObject(key string) error {
+	if _, err := f.db.Exec("DELETE FROM files WHERE key = $1", key); err != nil {
+		return fmt.Errorf("删除文件记录失败: %w", err)
+	}
+	return nil
+}
+
+// ListObjects 按前缀列举记录，有分隔符时按分隔符之前的部分分组得到公共前缀
+func (f *FileIndex) ListObjects(input *tos.ListObjectsInput) (*tos.ListObjectsOutput, error) {
+	maxKeys := input.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultListMaxKeys
+	}
+
+	after := ""
+	if input.ContinuationToken != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(input.ContinuationToken)
+		if err != nil {
+			return nil, fmt.Errorf("无效的分页令牌: %w", err)
+		}
+		after = string(decoded)
+	}
+
+	// 多取一条判断是否还有下一页
+	var rows *sql.Rows
+	var err error
+	if input.Delimiter == "" {
+		rows, err = f.db.Query(`
+			SELECT `+fileColumns+`, FALSE FROM files
+			WHERE key LIKE $1 AND key > $2
+			ORDER BY key LIMIT $3`,
+			likePrefix(input.Prefix), after, maxKeys+1)
+	} else {
+		// 逐条跳跃扫描主键索引：每一步取 next_from 之后的第一个键，键位于子文件夹中时返回公共前缀，
+		// 下一步直接跳到该公共前缀之后，最多读取 maxKeys+1 条记录，与子文件夹中的对象数量无关
+		rows, err = f.db.Query(`
+			WITH RECURSIVE listed AS (
+				SELECT *, 1 AS n FROM (`+delimitedEntry("$2")+`) head
+				UNION ALL
+				SELECT step.*, listed.n + 1 FROM listed CROSS JOIN LATERAL (`+delimitedEntry("listed.next_from")+`) step
+				WHERE listed.n <= $3
+			)
+			SELECT entry, size, content_type, etag, content_hash, last_modified, tags, is_prefix
+			FROM listed ORDER BY n`,
+			likePrefix(input.Prefix), listFrom(input.Prefix, input.Delimiter, after), maxKeys,
+			utf8.RuneCountInString(input.Prefix), utf8.RuneCountInString(input.Delimiter), input.Delimiter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("列举文件记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	output := &tos.ListObjectsOutput{}
+	last := ""
+	for count := 0; rows.Next(); count++ {
+		var isPrefix bool
+		obj, err := scanFile(rows, &isPrefix)
+		if err != nil {
+			return nil, err
+		}
+		if count >= maxKeys {
+			output.IsTruncated = true
+			output.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		if isPrefix {
+			output.CommonPrefixes = append(output.CommonPrefixes, obj.Key)
+		} else {
+			output.Objects = append(output.Objects, *obj)
+		}
+		last = obj.Key
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("列举文件记录失败: %w", err)
+	}
+	return output, nil
+}
+
+// delimitedEntry 按键排序不小于 from 的第一条记录，以及它在分隔符列举中对应的条目：
+// entry 为对象键，或键在前缀之后第一个分隔符及之前的部分（公共前缀）；
+// next_from 为下一条目的起点，公共前缀跳过其下的所有键（最后一个字符加一），对象为紧随其后的键
+func delimitedEntry(from string) string {
+	return `
+		SELECT key, size, content_type, etag, content_hash, last_modified, tags, is_prefix, entry,
+			CASE WHEN is_prefix THEN substr(entry, 1, length(entry) - 1) || chr(ascii(right(entry, 1)) + 1)
+				ELSE key || chr(1) END AS next_from
+		FROM (
+			SELECT *, CASE WHEN pos > 0 THEN substr(key, 1, $4 + pos - 1 + $5) ELSE key END AS entry, pos > 0 AS is_prefix
+			FROM (
+				SELECT ` + fileColumns + `, strpos(substr(key, $4 + 1), $6) AS pos FROM files
+				WHERE key LIKE $1 AND key >= ` + from + `
+				ORDER BY key LIMIT 1
+			) matched
+		) entries`
+}
+
+// listFrom 分隔符列举的起点：after 为上一页最后返回的条目，公共前缀从其下所有键之后开始，对象从紧随其后的键开始
+func listFrom(prefix, delimiter, after string) string {
+	if after == "" {
+		return prefix
+	}
+	if rest, ok := strings.CutPrefix(after, prefix); ok && strings.Contains(rest, delimiter) {
+		last, size := utf8.DecodeLastRuneInString(after)
+		return after[:len(after)-size] + string(last+1)
+	}
+	// 键中不会出现 NUL，紧随 after 之后的键不小于 after + "\x01"
+	return after + "\x01"
+}
+
+// SearchObjects 在 req.Folder 下搜索文件，条件与逐个过滤对象时一致
+func (f *FileIndex) SearchObjects(req *models.SearchRequest, limit int) ([]tos.ObjectInfo, error) {
+	query := searchQuery(req)
+	if req.Query != "" {
+		// 只匹配搜索文件夹以下的相对路径
+		query.where("substr(key, %s) ILIKE %s", utf8.RuneCountInString(req.Folder)+1, "%"+escapeLike(req.Query)+"%")
+	}
+
+	rows, err := f.db.Query("SELECT "+fileColumns+" FROM files WHERE "+query.condition()+
+		fmt.Sprintf(" ORDER BY %s LIMIT %d", orderBy(req.Sort, "key"), limit), query.args...)
+	if err != nil {
+		return nil, fmt.Errorf("搜索文件记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var results []tos.ObjectInfo
+	for rows.Next() {
+		obj, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *obj)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("搜索文件记录失败: %w", err)
+	}
+	return results, nil
+}
+
+// PutContent 保存对象的文本及其分词结果（中文按相邻两字切分），content_tsv 列由数据库根据分词结果生成
+func (f *FileIndex) PutContent(key, text string) error {
+	if _, err := f.db.Exec("UPDATE files SET content = $2, content_terms = $3 WHERE key = $1", key, text, fulltext.Segment(text)); err != nil {
+		return fmt.Errorf("保存文件内容失败: %w", err)
+	}
+	return nil
+}
+
+// SearchContent 按内容搜索文件，按 ts_rank 排序，摘要由 ts_headline 生成；
+// 搜索关键词与保存的文本一样先用 fulltext.Segment 分词，中文关键词匹配文本中连续出现的每两个字
+func (f *FileIndex) SearchContent(req *models.SearchRequest, limit int) ([]tos.ContentMatch, error) {
+	terms := fulltext.Terms(req.Query)
+	first := ""
+	if len(terms) > 0 {
+		first = terms[0]
+	}
+
+	query := searchQuery(req)
+	tsQuery := fmt.Sprintf("plainto_tsquery('simple', %s)", query.arg(fulltext.Segment(req.Query)))
+	query.where("content_tsv @@ " + tsQuery)
+	headlineOptions := query.arg(fmt.Sprintf(`StartSel="%s", StopSel="%s", MinWords=10, MaxWords=30, MaxFragments=2, FragmentDelimiter=" … "`,
+		fulltext.MarkStart, fulltext.MarkEnd))
+	// ts_headline 按 simple 配置切分原文，无法标记中文关键词，另取第一个关键词附近的原文由 fulltext.Snippet 生成摘要
+	window := fmt.Sprintf("substr(content, greatest(strpos(lower(content), %s) - %d, 1), %d)",
+		query.arg(first), snippetWindow/2, snippetWindow)
+	order := orderBy(req.Sort, "rank DESC, key")
+
+	// 先排序取前 limit 条再生成摘要，避免为所有匹配的文件生成摘要
+	rows, err := f.db.Query(`
+		SELECT `+fileColumns+`, rank, ts_headline('simple', content, `+tsQuery+`, `+headlineOptions+`), `+window+`
+		FROM (
+			SELECT *, ts_rank(content_tsv, `+tsQuery+`) AS rank FROM files
+			WHERE `+query.condition()+`
+			ORDER BY `+order+`
+			LIMIT `+query.arg(limit)+`
+		) ranked
+		ORDER BY `+order, query.args...)
+	if err != nil {
+		return nil, fmt.Errorf("搜索文件内容失败: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []tos.ContentMatch
+	for rows.Next() {
+		var match tos.ContentMatch
+		var text string
+		obj, err := scanFile(rows, &match.Score, &match.Snippet, &text)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(match.Snippet, fulltext.MarkStart) {
+			if snippet := fulltext.Snippet(text, terms); snippet != "" {
+				match.Snippet = snippet
+			}
+		}
+		match.ObjectInfo = *obj
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("搜索文件内容失败: %w", err)
+	}
+	return matches, nil
+}
+
+// StorageStats 统计 prefix 下的文件和文件夹，去重存储中相同内容只计算一次实际占用
+func (f *FileIndex) StorageStats(prefix string) (*models.StorageStats, error) {
+	stats := &models.StorageStats{
+		FileTypeStats: make(map[string]int64),
+		CategoryStats: make(map[string]models.CategoryStat),
+		RecentUsage:   []models.DayUsage{},
+	}
+	query := newFileQuery(prefix)
+
+	rows, err := f.db.Query(`
+		SELECT content_type, category, count(*), COALESCE(sum(size), 0) FROM files
+		WHERE NOT is_folder AND `+query.condition()+`
+		GROUP BY content_type, category`, query.args...)
+	if err != nil {
+		return nil, fmt.Errorf("统计文件记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contentType, category string
+		var count, size int64
+		if err := rows.Scan(&contentType, &category, &count, &size); err != nil {
+			return nil, fmt.Errorf("读取文件统计失败: %w", err)
+		}
+		stats.FileTypeStats[contentType] += count
+		categoryStat := stats.CategoryStats[category]
+		categoryStat.FileCount += count
+		categoryStat.Size += size
+		stats.CategoryStats[category] = categoryStat
+		stats.FileCount += count
+		stats.LogicalSize += size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("统计文件记录失败: %w", err)
+	}
+
+	err = f.db.QueryRow(`
+		SELECT
+			(SELECT count(*) FROM files WHERE is_folder AND `+query.condition()+`),
+			(SELECT COALESCE(sum(size), 0) FROM (
+				SELECT DISTINCT ON (CASE WHEN content_hash = '' THEN key ELSE content_hash END) size
+				FROM files WHERE NOT is_folder AND `+query.condition()+`
+			) contents)`, query.args...).Scan(&stats.FolderCount, &stats.PhysicalSize)
+	if err != nil {
+		return nil, fmt.Errorf("统计文件记录失败: %w", err)
+	}
+
+	stats.UsedSpace = stats.LogicalSize
+	return stats, nil
+}
+
+// searchQuery 按 req 中除 Query 外的条件搜索 req.Folder 下的文件
+func searchQuery(req *models.SearchRequest) *fileQuery {
+	query := newFileQuery(req.Folder)
+	query.where("NOT is_folder")
+
+	if req.MinSize > 0 {
+		query.where("size >= %s", req.MinSize)
+	}
+	if req.MaxSize > 0 {
+		query.where("size <= %s", req.MaxSize)
+	}
+	if !req.Modified.Start.IsZero() {
+		query.where("last_modified >= %s", req.Modified.Start)
+	}
+	if !req.Modified.End.IsZero() {
+		query.where("last_modified < %s", req.Modified.End)
+	}
+	if len(req.FileTypes) > 0 {
+		// 分类名或 Content-Type 片段
+		var types []string
+		for _, ft := range req.FileTypes {
+			types = append(types, "%"+escapeLike(ft)+"%")
+		}
+		query.where("(category = ANY(%s) OR content_type LIKE ANY(%s))", pq.Array(req.FileTypes), pq.Array(types))
+	}
+	if req.Filter != nil {
+		query.conditions = append(query.conditions, filterCondition(req.Filter, query, req.Folder))
+	}
+	return query
+}
+
+// baseName 对象键的最后一段，即文件名
+const baseName = "substring(key from '[^/]*$')"
+
+// filterCondition 将结构化查询的条件转换为 SQL，与 searchquery.Node.Match 一致，参数加入 query
+func filterCondition(node *searchquery.Node, query *fileQuery, folder string) string {
+	switch node.Op {
+	case searchquery.And, searchquery.Or:
+		separator := " AND "
+		if node.Op == searchquery.Or {
+			separator = " OR "
+		}
+		var parts []string
+		for _, child := range node.Children {
+			parts = append(parts, filterCondition(child, query, folder))
+		}
+		return "(" + strings.Join(parts, separator) + ")"
+	case searchquery.Not:
+		return "NOT " + filterCondition(node.Children[0], query, folder)
+	}
+
+	term := node.Term
+	switch term.Field {
+	case searchquery.FieldPath:
+		return fmt.Sprintf("(substr(key, %s) ILIKE %s)", query.arg(utf8.RuneCountInString(folder)+1), query.arg("%"+escapeLike(term.Value)+"%"))
+	case searchquery.FieldName:
+		return fmt.Sprintf("(%s ILIKE %s)", baseName, query.arg("%"+escapeLike(term.Value)+"%"))
+	case searchquery.FieldExt:
+		return fmt.Sprintf("(lower(key) LIKE %s)", query.arg("%."+escapeLike(term.Value)))
+	case searchquery.FieldType:
+		return fmt.Sprintf("(category = %s OR content_type LIKE %s)", query.arg(term.Value), query.arg("%"+escapeLike(term.Value)+"%"))
+	case searchquery.FieldSize:
+		return fmt.Sprintf("(size BETWEEN %s AND %s)", query.arg(term.MinSize), query.arg(term.MaxSize))
+	case searchquery.FieldModified:
+		conditions := []string{"TRUE"}
+		if !term.After.IsZero() {
+			conditions = append(conditions, "last_modified >= "+query.arg(term.After))
+		}
+		if !term.Before.IsZero() {
+			conditions = append(conditions, "last_modified < "+query.arg(term.Before))
+		}
+		return "(" + strings.Join(conditions, " AND ") + ")"
+	case searchquery.FieldIn:
+		return fmt.Sprintf("(key LIKE %s)", query.arg(likePrefix(folder+term.Value)))
+	case searchquery.FieldTag:
+		return fmt.Sprintf("(%s = ANY(tags))", query.arg(term.Value))
+	}
+	return "FALSE"
+}
+
+// orderBy 排序条件对应的 ORDER BY 子句，没有排序条件时返回 fallback，否则以键作为最后的排序依据
+func orderBy(sorts []searchquery.Sort, fallback string) string {
+	if len(sorts) == 0 {
+		return fallback
+	}
+	var parts []string
+	for _, s := range sorts {
+		column := map[string]string{
+			searchquery.SortName:     "lower(" + baseName + ")",
+			searchquery.SortSize:     "size",
+			searchquery.SortModified: "last_modified",
+		}[s.Field]
+		if s.Desc {
+			column += " DESC"
+		}
+		parts = append(parts, column)
+	}
+	return strings.Join(append(parts, "key"), ", ")
+}
+
+// fileQuery 按前缀查询 files 表的条件，参数按出现顺序编号
+type fileQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+// newFileQuery 前缀在某个用户空间内时同时按 owner 过滤，可以使用 owner 开头的索引
+func newFileQuery(prefix string) *fileQuery {
+	query := &fileQuery{}
+	query.where("key LIKE %s", likePrefix(prefix))
+	if owner := ownerOf(prefix); owner != "" {
+		query.where("owner = %s", owner)
+	}
+	return query
+}
+
+// where 增加一个条件，format 中的每个 %s 替换为一个参数占位符
+func (q *fileQuery) where(format string, args ...interface{}) {
+	placeholders := make([]interface{}, len(args))
+	for i, arg := range args {
+		placeholders[i] = q.arg(arg)
+	}
+	q.conditions = append(q.conditions, fmt.Sprintf(format, placeholders...))
+}
+
+// arg 增加一个参数，返回其占位符
+func (q *fileQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *fileQuery) condition() string {
+	return strings.Join(q.conditions, " AND ")
+}
+
+// scanFile 读取 fileColumns 对应的一行，extra 为之后的其他列
+func scanFile(rows *sql.Rows, extra ...interface{}) (*tos.ObjectInfo, error) {
+	var obj tos.ObjectInfo
+	var tags []string
+	dest := append([]interface{}{&obj.Key, &obj.Size, &obj.ContentType, &obj.ETag, &obj.ContentHash, &obj.LastModified, pq.Array(&tags)}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("读取文件记录失败: %w", err)
+	}
+	if len(tags) > 0 {
+		obj.Metadata = map[string]string{tos.MetaTags: strings.Join(tags, ",")}
+	}
+	return &obj, nil
+}
+
+// ownerOf 返回对象键所属的用户ID，不在用户空间内时返回空字符串
+func ownerOf(key string) string {
+	rest, ok := strings.CutPrefix(key, userKeyPrefix)
+	if !ok {
+		return ""
+	}
+	owner, _, found := strings.Cut(rest, "/")
+	if !found {
+		return ""
+	}
+	return owner
+}
+
+// likePrefix 匹配以 prefix 开头的 LIKE 模式
+func likePrefix(prefix string) string {
+	return escapeLike(prefix) + "%"
+}
+
+// escapeLike 转义 LIKE 模式中的通配符（PostgreSQL 默认的转义字符为 \）
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
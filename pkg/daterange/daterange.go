@@ -0,0 +1,177 @@
+// Package daterange 将 today、this-week、last-7-days、2026-01-01..2026-01-31 等时间表达式解析为时间范围，
+// 相对日期和日期都按调用方传入的当前时间所在的时区计算，搜索、过滤和最近文件共用同一套规则
+package daterange
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的相对日期，一周从周一开始
+const (
+	Today     = "today"
+	Yesterday = "yesterday"
+	ThisWeek  = "this-week"
+	LastWeek  = "last-week"
+	ThisMonth = "this-month"
+	LastMonth = "last-month"
+	ThisYear  = "this-year"
+	LastYear  = "last-year"
+)
+
+// MaxDays last-N-days 中 N 的上限
+const MaxDays = 3660
+
+// aliases 简写，与 FilterFiles 原有的 time 参数一致
+var aliases = map[string]string{
+	"week":  ThisWeek,
+	"month": ThisMonth,
+	"year":  ThisYear,
+}
+
+// Range 左闭右开的时间范围 [Start, End)，零值的一端表示不限制
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// IsZero 两端都不限制
+func (r Range) IsZero() bool {
+	return r.Start.IsZero() && r.End.IsZero()
+}
+
+// Contains 判断 t 是否在范围内
+func (r Range) Contains(t time.Time) bool {
+	return (r.Start.IsZero() || !t.Before(r.Start)) && (r.End.IsZero() || t.Before(r.End))
+}
+
+// Parse 解析时间表达式，now 为当前时间，其时区决定一天的起止：
+//   - today、yesterday、this-week、last-week、this-month、last-month、this-year、last-year
+//     （week、month、year 分别是 this-week、this-month、this-year 的简写）
+//   - last-N-days：包括今天在内的最近 N 天
+//   - 2026-01-01、2026-01、2026：当天、当月、当年
+//   - a..b：从 a 的开始到 b 的结束，a、b 为以上任意表达式，省略一端表示不限制
+func Parse(expr string, now time.Time) (Range, error) {
+	expr = strings.TrimSpace(expr)
+	if from, to, ok := strings.Cut(expr, ".."); ok {
+		return parseInterval(from, to, now)
+	}
+	return parseSingle(expr, now)
+}
+
+func parseInterval(from, to string, now time.Time) (Range, error) {
+	var r Range
+	if from = strings.TrimSpace(from); from != "" {
+		start, err := parseSingle(from, now)
+		if err != nil {
+			return Range{}, err
+		}
+		r.Start = start.Start
+	}
+	if to = strings.TrimSpace(to); to != "" {
+		end, err := parseSingle(to, now)
+		if err != nil {
+			return Range{}, err
+		}
+		r.End = end.End
+	}
+	if r.IsZero() {
+		return Range{}, fmt.Errorf("范围两端不能都为空")
+	}
+	if !r.Start.IsZero() && !r.End.IsZero() && !r.Start.Before(r.End) {
+		return Range{}, fmt.Errorf("开始时间不能晚于结束时间")
+	}
+	return r, nil
+}
+
+// parseSingle 解析不含 .. 的表达式
+func parseSingle(expr string, now time.Time) (Range, error) {
+	name := strings.ToLower(expr)
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+
+	y, m, d := now.Date()
+	loc := now.Location()
+	day := func(offset int) time.Time { return time.Date(y, m, d+offset, 0, 0, 0, 0, loc) }
+	// 周一为 0
+	weekday := (int(now.Weekday()) + 6) % 7
+
+	switch name {
+	case Today:
+		return Range{day(0), day(1)}, nil
+	case Yesterday:
+		return Range{day(-1), day(0)}, nil
+	case ThisWeek:
+		return Range{day(-weekday), day(7 - weekday)}, nil
+	case LastWeek:
+		return Range{day(-weekday - 7), day(-weekday)}, nil
+	case ThisMonth:
+		return Range{time.Date(y, m, 1, 0, 0, 0, 0, loc), time.Date(y, m+1, 1, 0, 0, 0, 0, loc)}, nil
+	case LastMonth:
+		return Range{time.Date(y, m-1, 1, 0, 0, 0, 0, loc), time.Date(y, m, 1, 0, 0, 0, 0, loc)}, nil
+	case ThisYear:
+		return Range{time.Date(y, 1, 1, 0, 0, 0, 0, loc), time.Date(y+1, 1, 1, 0, 0, 0, 0, loc)}, nil
+	case LastYear:
+		return Range{time.Date(y-1, 1, 1, 0, 0, 0, 0, loc), time.Date(y, 1, 1, 0, 0, 0, 0, loc)}, nil
+	}
+
+	if n, ok := lastDays(name); ok {
+		if n < 1 || n > MaxDays {
+			return Range{}, fmt.Errorf("last-N-days 的天数应在 1 到 %d 之间", MaxDays)
+		}
+		return Range{day(1 - n), day(1)}, nil
+	}
+
+	return parseDate(expr, loc)
+}
+
+// lastDays 解析 last-N-days
+func lastDays(name string) (int, bool) {
+	rest, ok := strings.CutPrefix(name, "last-")
+	if !ok {
+		return 0, false
+	}
+	rest, ok = strings.CutSuffix(rest, "-days")
+	if !ok {
+		rest, ok = strings.CutSuffix(rest, "-day")
+	}
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseDate 解析 YYYY-MM-DD、YYYY-MM、YYYY，返回对应的一天、一个月或一年
+func parseDate(value string, loc *time.Location) (Range, error) {
+	for _, layout := range []struct {
+		layout string
+		years  int
+		months int
+		days   int
+	}{
+		{"2006-01-02", 0, 0, 1},
+		{"2006-01", 0, 1, 0},
+		{"2006", 1, 0, 0},
+	} {
+		if len(value) != len(layout.layout) {
+			continue
+		}
+		t, err := time.ParseInLocation(layout.layout, value, loc)
+		if err != nil {
+			continue
+		}
+		y, m, d := t.Date()
+		return Range{
+			time.Date(y, m, d, 0, 0, 0, 0, loc),
+			time.Date(y+layout.years, m+time.Month(layout.months), d+layout.days, 0, 0, 0, 0, loc),
+		}, nil
+	}
+	return Range{}, fmt.Errorf("日期格式应为 YYYY-MM-DD、YYYY-MM 或 YYYY，或 today、yesterday、this-week、last-week、this-month、last-month、this-year、last-year、last-N-days")
+}
@@ -0,0 +1,179 @@
+package daterange
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // 测试不依赖系统的时区数据库
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("加载时区 %s 失败: %v", name, err)
+	}
+	return loc
+}
+
+func TestParse(t *testing.T) {
+	shanghai := mustLoad(t, "Asia/Shanghai")
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", s, shanghai)
+		if err != nil {
+			t.Fatalf("解析时间 %s 失败: %v", s, err)
+		}
+		return v
+	}
+	day := func(s string) time.Time { return at(s + " 00:00:00") }
+
+	cases := []struct {
+		now   string
+		expr  string
+		start string
+		end   string
+	}{
+		// 一天的第一刻和最后一刻
+		{"2026-03-01 00:00:00", "today", "2026-03-01", "2026-03-02"},
+		{"2026-03-01 23:59:59.999999999", "today", "2026-03-01", "2026-03-02"},
+		// 跨月、跨年、闰年
+		{"2026-03-01 00:00:00", "yesterday", "2026-02-28", "2026-03-01"},
+		{"2024-03-01 08:00:00", "yesterday", "2024-02-29", "2024-03-01"},
+		{"2026-01-01 00:00:00", "yesterday", "2025-12-31", "2026-01-01"},
+		// 一周从周一开始：2026-03-01 是周日，2026-03-02 是周一
+		{"2026-03-01 12:00:00", "this-week", "2026-02-23", "2026-03-02"},
+		{"2026-03-02 00:00:00", "this-week", "2026-03-02", "2026-03-09"},
+		{"2026-03-01 12:00:00", "week", "2026-02-23", "2026-03-02"},
+		{"2026-03-02 00:00:00", "last-week", "2026-02-23", "2026-03-02"},
+		{"2026-01-01 10:00:00", "last-week", "2025-12-22", "2025-12-29"},
+		{"2026-03-31 23:59:59", "this-month", "2026-03-01", "2026-04-01"},
+		{"2026-01-15 10:00:00", "last-month", "2025-12-01", "2026-01-01"},
+		{"2026-01-15 10:00:00", "Month", "2026-01-01", "2026-02-01"},
+		{"2026-01-01 00:00:00", "this-year", "2026-01-01", "2027-01-01"},
+		{"2026-06-30 10:00:00", "last-year", "2025-01-01", "2026-01-01"},
+		// 最近 N 天包括今天
+		{"2026-03-01 10:00:00", "last-1-days", "2026-03-01", "2026-03-02"},
+		{"2026-03-01 10:00:00", "last-7-days", "2026-02-23", "2026-03-02"},
+		{"2026-03-01 10:00:00", "last-1-day", "2026-03-01", "2026-03-02"},
+		{"2024-03-01 10:00:00", "last-30-days", "2024-02-01", "2024-03-02"},
+		// 日期、月份、年份
+		{"2026-03-01 10:00:00", "2025-12-31", "2025-12-31", "2026-01-01"},
+		{"2026-03-01 10:00:00", "2024-02", "2024-02-01", "2024-03-01"},
+		{"2026-03-01 10:00:00", "2025", "2025-01-01", "2026-01-01"},
+		// 范围包括两端
+		{"2026-03-01 10:00:00", "2026-01-01..2026-01-31", "2026-01-01", "2026-02-01"},
+		{"2026-03-01 10:00:00", "2026-01..2026-02", "2026-01-01", "2026-03-01"},
+		{"2026-03-01 10:00:00", "last-month..today", "2026-02-01", "2026-03-02"},
+		{"2026-03-01 10:00:00", "2026-02-28..", "2026-02-28", ""},
+		{"2026-03-01 10:00:00", "..yesterday", "", "2026-03-01"},
+		{"2026-03-01 10:00:00", "2026-03-01..2026-03-01", "2026-03-01", "2026-03-02"},
+	}
+
+	for _, tc := range cases {
+		r, err := Parse(tc.expr, at(tc.now))
+		if err != nil {
+			t.Errorf("Parse(%q, %s) 失败: %v", tc.expr, tc.now, err)
+			continue
+		}
+		var want Range
+		if tc.start != "" {
+			want.Start = day(tc.start)
+		}
+		if tc.end != "" {
+			want.End = day(tc.end)
+		}
+		if !r.Start.Equal(want.Start) || !r.End.Equal(want.End) {
+			t.Errorf("Parse(%q, %s) = [%s, %s), want [%s, %s)", tc.expr, tc.now, r.Start, r.End, want.Start, want.End)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		expr string
+		msg  string
+	}{
+		{"", "日期格式应为"},
+		{"tomorrow", "日期格式应为"},
+		{"2026/01/01", "日期格式应为"},
+		{"2026-02-30", "日期格式应为"},
+		{"2026-1-5", "日期格式应为"},
+		{"last-x-days", "日期格式应为"},
+		{"last-0-days", "天数应在"},
+		{"last-3661-days", "天数应在"},
+		{"..", "两端不能都为空"},
+		{"2026-02-01..2026-01-31", "开始时间不能晚于结束时间"},
+		{"today..nope", "日期格式应为"},
+	}
+	for _, tc := range cases {
+		if _, err := Parse(tc.expr, now); err == nil || !strings.Contains(err.Error(), tc.msg) {
+			t.Errorf("Parse(%q) = %v, want %s", tc.expr, err, tc.msg)
+		}
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	shanghai := mustLoad(t, "Asia/Shanghai")
+	newYork := mustLoad(t, "America/New_York")
+
+	// 同一时刻在不同时区是不同的日期
+	instant := time.Date(2026, 1, 5, 16, 30, 0, 0, time.UTC)
+	inShanghai, _ := Parse("today", instant.In(shanghai))
+	inNewYork, _ := Parse("today", instant.In(newYork))
+	if got := inShanghai.Start.In(shanghai).Format("2006-01-02"); got != "2026-01-06" {
+		t.Errorf("上海的今天 = %s", got)
+	}
+	if got := inNewYork.Start.In(newYork).Format("2006-01-02"); got != "2026-01-05" {
+		t.Errorf("纽约的今天 = %s", got)
+	}
+	if !inShanghai.Start.Equal(time.Date(2026, 1, 5, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("上海的今天从 %s 开始", inShanghai.Start.UTC())
+	}
+
+	// 夏令时切换的当天为 23 或 25 小时
+	for _, tc := range []struct {
+		now   time.Time
+		hours float64
+	}{
+		{time.Date(2026, 3, 8, 12, 0, 0, 0, newYork), 23},
+		{time.Date(2026, 11, 1, 12, 0, 0, 0, newYork), 25},
+		{time.Date(2026, 11, 2, 12, 0, 0, 0, newYork), 24},
+	} {
+		r, _ := Parse("today", tc.now)
+		if got := r.End.Sub(r.Start).Hours(); got != tc.hours {
+			t.Errorf("%s 当天有 %v 小时, want %v", tc.now.Format("2006-01-02"), got, tc.hours)
+		}
+	}
+	week, _ := Parse("2026-03-08..2026-03-14", time.Now().In(newYork))
+	if got := week.End.Sub(week.Start).Hours(); got != 7*24-1 {
+		t.Errorf("包含夏令时切换的一周有 %v 小时", got)
+	}
+}
+
+func TestContains(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	today, _ := Parse("today", now)
+	cases := []struct {
+		t    time.Time
+		want bool
+	}{
+		{today.Start.Add(-time.Nanosecond), false},
+		{today.Start, true},
+		{today.End.Add(-time.Nanosecond), true},
+		{today.End, false},
+	}
+	for _, tc := range cases {
+		if got := today.Contains(tc.t); got != tc.want {
+			t.Errorf("Contains(%s) = %v", tc.t, got)
+		}
+	}
+
+	open, _ := Parse("2026-02-28..", now)
+	if !open.Contains(now.AddDate(100, 0, 0)) || open.Contains(open.Start.Add(-time.Nanosecond)) {
+		t.Error("不限制结束时间的范围判断错误")
+	}
+	if !(Range{}).Contains(now) || !(Range{}).IsZero() {
+		t.Error("零值应不限制")
+	}
+}
@@ -0,0 +1,290 @@
+// Package fulltext 从文本、Markdown、代码、PDF 和 docx 文件中提取可检索的文本，以及检索结果的相关度和摘要
+package fulltext
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"io"
+	"math"
+	"mime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"bkp-drive/pkg/mimetypes"
+)
+
+// MaxFileSize 超过该大小的文件不提取文本
+const MaxFileSize = 20 << 20
+
+// MaxTextLength 提取文本的最大字节数，超出部分截断（PostgreSQL 的 tsvector 不能超过 1MB）
+const MaxTextLength = 256 << 10
+
+// 摘要中匹配词的标记，提取的文本中不会出现这两个字符
+const (
+	MarkStart = "\x02"
+	MarkEnd   = "\x03"
+)
+
+// 摘要在第一个匹配词前后保留的字符数
+const (
+	snippetBefore = 40
+	snippetAfter  = 120
+)
+
+const (
+	docxType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	pdfType  = "application/pdf"
+)
+
+// errBinary 内容不是文本
+var errBinary = errors.New("不是文本内容")
+
+// Extractable 判断是否可以从文件中提取文本
+func Extractable(contentType, key string, size int64) bool {
+	return size <= MaxFileSize && kind(contentType, key) != ""
+}
+
+// Extract 提取文件中的文本，contentType 为空或通用类型时按扩展名判断格式
+func Extract(r io.Reader, contentType, key string) (string, error) {
+	var text string
+	var err error
+	switch kind(contentType, key) {
+	case "text":
+		text, err = extractText(r)
+	case "pdf":
+		text, err = extractPDF(r)
+	case "docx":
+		text, err = extractDocx(r)
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return clean(text), nil
+}
+
+// kind 返回文件的文本格式，不支持提取时返回空字符串
+func kind(contentType, key string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == mimetypes.DefaultType {
+		mediaType = mimetypes.TypeByKey(key)
+	}
+
+	switch {
+	case mediaType == pdfType:
+		return "pdf"
+	case mediaType == docxType:
+		return "docx"
+	case strings.HasPrefix(mediaType, "text/"), mimetypes.Category(mediaType, key) == mimetypes.Code:
+		return "text"
+	}
+	return ""
+}
+
+// extractText 读取纯文本，包含 NUL 字符的内容视为二进制文件
+func extractText(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxTextLength))
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", errBinary
+	}
+	return string(data), nil
+}
+
+// clean 截断到 MaxTextLength，去掉无效的 UTF-8 和除换行、制表符外的控制字符
+func clean(text string) string {
+	if len(text) > MaxTextLength {
+		text = text[:MaxTextLength]
+	}
+	text = strings.ToValidUTF8(text, "")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// token 文本中的一个词及其字节位置
+type token struct {
+	word       string
+	start, end int
+}
+
+// tokenize 按字母和数字的连续序列分词并转为小写，与 PostgreSQL 的 simple 分词配置接近；
+// 中日韩文字之间没有空格，连续的一段按相邻两字切分为互相重叠的词（只有一个字时为单字）
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	var run []int // 当前一段中日韩文字每个字的起始位置
+	flushRun := func(end int) {
+		if len(run) == 1 {
+			tokens = append(tokens, token{text[run[0]:end], run[0], end})
+		}
+		for i := 0; i+1 < len(run); i++ {
+			next := end
+			if i+2 < len(run) {
+				next = run[i+2]
+			}
+			tokens = append(tokens, token{text[run[i]:next], run[i], next})
+		}
+		run = run[:0]
+	}
+
+	for i, r := range text {
+		isCJK := cjk(r)
+		isWord := !isCJK && (unicode.IsLetter(r) || unicode.IsDigit(r))
+		if !isWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+		if !isCJK && len(run) > 0 {
+			flushRun(i)
+		}
+		switch {
+		case isCJK:
+			run = append(run, i)
+		case isWord && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	if len(run) > 0 {
+		flushRun(len(text))
+	}
+	return tokens
+}
+
+// cjk 是否为中日韩文字
+func cjk(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Segment 返回分词后以空格连接的文本，与 Terms、Score 的分词一致。
+// PostgreSQL 的 simple 配置不能切分中文，把一整段中文当作一个词，
+// 对保存的文本和搜索关键词都先用 Segment 切分，再由 simple 配置生成 tsvector 和 tsquery
+func Segment(text string) string {
+	tokens := tokenize(text)
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = t.word
+	}
+	return strings.Join(words, " ")
+}
+
+// Terms 搜索关键词中的词，重复的词只保留一个
+func Terms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, t := range tokenize(query) {
+		if !seen[t.word] {
+			seen[t.word] = true
+			terms = append(terms, t.word)
+		}
+	}
+	return terms
+}
+
+// Score 文本与搜索词的相关度：所有词都出现时按出现次数计算，并按文本长度适当降低，有词未出现时为 0
+func Score(text string, terms []string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	tokens := tokenize(text)
+	counts := map[string]int{}
+	for _, t := range tokens {
+		counts[t.word]++
+	}
+
+	total := 0
+	for _, term := range terms {
+		if counts[term] == 0 {
+			return 0
+		}
+		total += counts[term]
+	}
+	return float64(total) / (1 + math.Log(float64(len(tokens))))
+}
+
+// Snippet 截取第一个匹配词附近的文本作为摘要，匹配词以 MarkStart 和 MarkEnd 标记
+func Snippet(text string, terms []string) string {
+	matched := map[string]bool{}
+	for _, term := range terms {
+		matched[term] = true
+	}
+	tokens := tokenize(text)
+	first := -1
+	for i, t := range tokens {
+		if matched[t.word] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	start := moveRunes(text, tokens[first].start, -snippetBefore)
+	end := moveRunes(text, tokens[first].start, snippetAfter)
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	markStart, markEnd := -1, -1
+	mark := func() {
+		if markStart >= 0 {
+			b.WriteString(text[pos:markStart])
+			b.WriteString(MarkStart + text[markStart:markEnd] + MarkEnd)
+			pos = markEnd
+		}
+	}
+	for _, t := range tokens[first:] {
+		if t.end > end {
+			break
+		}
+		if !matched[t.word] {
+			continue
+		}
+		// 中日韩文字相邻两字的词互相重叠，重叠的匹配合并为一处标记
+		if markStart >= 0 && t.start < markEnd {
+			markEnd = t.end
+			continue
+		}
+		mark()
+		markStart, markEnd = t.start, t.end
+	}
+	mark()
+	b.WriteString(text[pos:end])
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// moveRunes 从字节位置 pos 向前（n 为负数）或向后移动 n 个字符，不超出文本范围
+func moveRunes(text string, pos, n int) int {
+	for ; n < 0 && pos > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:pos])
+		pos -= size
+	}
+	for ; n > 0 && pos < len(text); n-- {
+		_, size := utf8.DecodeRuneInString(text[pos:])
+		pos += size
+	}
+	return pos
+}
+
+// Highlight 将摘要转为 HTML：合并空白、转义内容，匹配词使用 <mark> 标记
+func Highlight(snippet string) string {
+	snippet = html.EscapeString(strings.Join(strings.Fields(snippet), " "))
+	return strings.NewReplacer(MarkStart, "<mark>", MarkEnd, "</mark>").Replace(snippet)
+}
@@ -0,0 +1,142 @@
+package fulltext
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func docxBytes(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatalf("创建 zip 条目失败: %v", err)
+	}
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>%s</w:body></w:document>`, body)
+	if err := zw.Close(); err != nil {
+		t.Fatalf("关闭 zip 失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func pdfBytes(content string, compress bool) []byte {
+	stream := []byte(content)
+	dict := fmt.Sprintf("<< /Length %d >>", len(stream))
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(stream)
+		zw.Close()
+		stream = buf.Bytes()
+		dict = fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>", len(stream))
+	}
+	return []byte("%PDF-1.4\n1 0 obj\n<< /Type /Page >>\nendobj\n2 0 obj\n" + dict + "\nstream\n" +
+		string(stream) + "\nendstream\nendobj\n3 0 obj\n<< /Length 4 /Filter /DCTDecode >>\nstream\n\xff\xd8\xff\xe0\nendstream\nendobj\n%%EOF\n")
+}
+
+func TestExtract(t *testing.T) {
+	pageContent := "BT /F1 12 Tf 72 712 Td (Quarterly \\(Q3\\) report) Tj 0 -14 Td [(Reve) -20 (nue gr) 10 (owth)] TJ T* (caf\\351) ' ET"
+	cases := []struct {
+		name        string
+		content     []byte
+		contentType string
+		key         string
+		want        string
+	}{
+		{"纯文本", []byte("hello\x00world"), "text/plain", "a.txt", ""},
+		{"Markdown", []byte("# 标题\n\n正文\x02"), "text/markdown; charset=utf-8", "README.md", "# 标题\n\n正文 "},
+		{"代码按扩展名", []byte("package main"), "application/octet-stream", "main.go", "package main"},
+		{"JSON", []byte(`{"a": 1}`), "application/json", "a.json", `{"a": 1}`},
+		{"PDF", pdfBytes(pageContent, false), "application/pdf", "a.pdf", "\nQuarterly (Q3) report\nRevenue growth\n\ncafé\n"},
+		{"压缩的 PDF", pdfBytes(pageContent, true), "", "a.pdf", "\nQuarterly (Q3) report\nRevenue growth\n\ncafé\n"},
+		{"docx", docxBytes(t, `<w:p><w:r><w:t>第一段</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">tab </w:t></w:r></w:p><w:p><w:r><w:t>second &amp; last</w:t></w:r></w:p>`),
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "a.docx", "第一段\ttab \nsecond & last\n"},
+		{"不支持的类型", []byte("\x89PNG"), "image/png", "a.png", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Extract(bytes.NewReader(tc.content), tc.contentType, tc.key)
+			if tc.name == "纯文本" {
+				if err == nil {
+					t.Error("包含 NUL 的内容应视为二进制文件")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract 失败: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Extract = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := Extract(strings.NewReader("not a zip"), "", "a.docx"); err == nil {
+		t.Error("损坏的 docx 应返回错误")
+	}
+	if Extractable("text/plain", "a.txt", MaxFileSize+1) || !Extractable("", "notes.md", 10) || Extractable("", "a.bin", 10) {
+		t.Error("Extractable 结果错误")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 10) + "the Quarterly report shows revenue growth; quarterly numbers <b>up</b>" + strings.Repeat(" dolor", 30)
+	terms := Terms("quarterly REPORT quarterly")
+	if strings.Join(terms, ",") != "quarterly,report" {
+		t.Fatalf("Terms = %v", terms)
+	}
+
+	snippet := Snippet(text, terms)
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Errorf("截断的摘要应有省略号: %q", snippet)
+	}
+	got := Highlight(snippet)
+	want := "the <mark>Quarterly</mark> <mark>report</mark> shows revenue growth; <mark>quarterly</mark> numbers &lt;b&gt;up&lt;/b&gt; dolor"
+	if !strings.Contains(got, want) {
+		t.Errorf("Highlight = %q", got)
+	}
+
+	if Snippet(text, Terms("missing")) != "" || Snippet("短文本 报告", Terms("报告")) != "短文本 "+MarkStart+"报告"+MarkEnd {
+		t.Error("Snippet 结果错误")
+	}
+
+	short := Score("quarterly report", terms)
+	long := Score(text, terms)
+	if short <= 0 || long <= 0 || Score(text, Terms("report missing")) != 0 {
+		t.Errorf("Score = %v %v", short, long)
+	}
+}
+
+func TestChineseQuery(t *testing.T) {
+	if got := Segment("全文检索：PDF文件管理系统"); got != "全文 文检 检索 pdf 文件 件管 管理 理系 系统" {
+		t.Errorf("Segment = %q", got)
+	}
+	terms := Terms("文件管理")
+	if strings.Join(terms, ",") != "文件,件管,管理" {
+		t.Fatalf("Terms = %v", terms)
+	}
+
+	text := "这是一个文件管理系统"
+	if Score(text, terms) <= 0 {
+		t.Error("包含关键词的中文文本应匹配")
+	}
+	// 按两字切分只要求每两个字都出现，不保证它们在原文中相邻
+	if Score("文件和管理", terms) != 0 || Score("文件件管管理", terms) <= 0 {
+		t.Error("Score 结果错误")
+	}
+	// 单字关键词只匹配单独出现的字
+	if Score(text, Terms("文")) != 0 || Score("文 件", Terms("文")) <= 0 {
+		t.Error("单字关键词匹配结果错误")
+	}
+
+	if got := Snippet(text, terms); got != "这是一个"+MarkStart+"文件管理"+MarkEnd+"系统" {
+		t.Errorf("Snippet = %q", got)
+	}
+}
@@ -0,0 +1,167 @@
+package fulltext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// streamPattern PDF 中的流对象：字典和流数据
+var streamPattern = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+
+// extractPDF 从页面内容流的文本操作符（Tj、TJ、'、"）中提取文本。
+// 只支持未压缩或 FlateDecode 压缩的流，以及使用标准编码的字体；
+// 使用 CID 字体的文本（常见于中文 PDF）和扫描件无法提取
+func extractPDF(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxFileSize))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, loc := range streamPattern.FindAllSubmatchIndex(data, -1) {
+		dict := data[loc[2]:loc[3]]
+		rest := data[loc[1]:]
+		end := bytes.Index(rest, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := rest[:end]
+
+		// 字体、图片等其他流经过其他过滤器编码，无法按内容流解析
+		if bytes.Contains(dict, []byte("/Filter")) {
+			if !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Contains(dict, []byte("/DCTDecode")) {
+				continue
+			}
+			if content, err = inflate(content); err != nil {
+				continue
+			}
+		}
+		pdfText(&b, content)
+		if b.Len() >= MaxTextLength {
+			break
+		}
+	}
+	return b.String(), nil
+}
+
+// inflate 解压 FlateDecode 流，流末尾可能有多余的换行
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	out, err := io.ReadAll(io.LimitReader(reader, MaxFileSize))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pdfText 解析内容流，将文本操作符的字符串参数写入 b，换行操作符写入换行
+func pdfText(b *strings.Builder, content []byte) {
+	var operands []string
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, next := pdfString(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '[':
+			// TJ 的数组参数中字符串之间的数字是字距调整，不影响文本
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFDelimiter(c):
+			i++
+		default:
+			start := i
+			for i < len(content) && !isPDFDelimiter(content[i]) && content[i] != '(' && content[i] != '[' {
+				i++
+			}
+			switch string(content[start:i]) {
+			case "Tj", "TJ":
+				b.WriteString(strings.Join(operands, ""))
+			case "'", `"`:
+				b.WriteString("\n" + strings.Join(operands, ""))
+			case "T*", "Td", "TD", "ET":
+				b.WriteString("\n")
+			default:
+				// 数字、名称等其他操作数
+				continue
+			}
+			operands = operands[:0]
+		}
+	}
+}
+
+// isPDFDelimiter 空白和不属于字符串的分隔符
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, ']', '<', '>', '/', '{', '}', ')':
+		return true
+	}
+	return false
+}
+
+// pdfString 解析从 start 处的 ( 开始的字符串，返回内容和结束后的位置
+func pdfString(content []byte, start int) (string, int) {
+	var b strings.Builder
+	depth := 0
+	for i := start; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\\' && i+1 < len(content):
+			i++
+			switch e := content[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// 行尾的反斜杠表示续行
+			default:
+				if e >= '0' && e <= '7' {
+					// 最多三位的八进制字符码
+					code := 0
+					for j := 0; j < 3 && i < len(content) && content[i] >= '0' && content[i] <= '7'; j++ {
+						code = code*8 + int(content[i]-'0')
+						i++
+					}
+					i--
+					b.WriteRune(rune(code & 0xff))
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		case c == '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i + 1
+			}
+			b.WriteByte(c)
+		default:
+			if c < 0x80 {
+				b.WriteByte(c)
+			} else {
+				// 标准编码的高位字符按 Latin-1 处理
+				b.WriteRune(rune(c))
+			}
+		}
+	}
+	return b.String(), len(content)
+}
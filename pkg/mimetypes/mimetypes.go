@@ -0,0 +1,279 @@
+// Package mimetypes 文件类型注册表：扩展名与 Content-Type 的对应关系、内容嗅探和文件分类
+package mimetypes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// 文件分类
+const (
+	Image    = "image"
+	Video    = "video"
+	Audio    = "audio"
+	Document = "document"
+	Archive  = "archive"
+	Code     = "code"
+	Other    = "other"
+)
+
+// Categories 所有分类
+var Categories = []string{Image, Video, Audio, Document, Archive, Code, Other}
+
+// DefaultType 无法判断类型时使用的 Content-Type
+const DefaultType = "application/octet-stream"
+
+// SniffLen 内容嗅探读取的字节数
+const SniffLen = 3072
+
+type fileType struct {
+	contentType string
+	category    string
+}
+
+// byExtension 扩展名对应的 Content-Type 和分类
+var byExtension = map[string]fileType{
+	// 图片
+	".jpg":  {"image/jpeg", Image},
+	".jpeg": {"image/jpeg", Image},
+	".png":  {"image/png", Image},
+	".gif":  {"image/gif", Image},
+	".webp": {"image/webp", Image},
+	".bmp":  {"image/bmp", Image},
+	".svg":  {"image/svg+xml", Image},
+	".ico":  {"image/x-icon", Image},
+	".tif":  {"image/tiff", Image},
+	".tiff": {"image/tiff", Image},
+	".heic": {"image/heic", Image},
+	".heif": {"image/heif", Image},
+	".avif": {"image/avif", Image},
+
+	// 视频
+	".mp4":  {"video/mp4", Video},
+	".m4v":  {"video/x-m4v", Video},
+	".mov":  {"video/quicktime", Video},
+	".avi":  {"video/x-msvideo", Video},
+	".wmv":  {"video/x-ms-wmv", Video},
+	".flv":  {"video/x-flv", Video},
+	".f4v":  {"video/mp4", Video},
+	".webm": {"video/webm", Video},
+	".mkv":  {"video/x-matroska", Video},
+	".3gp":  {"video/3gpp", Video},
+	".mpeg": {"video/mpeg", Video},
+	".mpg":  {"video/mpeg", Video},
+	".rmvb": {"application/vnd.rn-realmedia-vbr", Video},
+
+	// 音频
+	".mp3":  {"audio/mpeg", Audio},
+	".wav":  {"audio/wav", Audio},
+	".flac": {"audio/flac", Audio},
+	".aac":  {"audio/aac", Audio},
+	".ogg":  {"audio/ogg", Audio},
+	".oga":  {"audio/ogg", Audio},
+	".opus": {"audio/opus", Audio},
+	".m4a":  {"audio/x-m4a", Audio},
+	".wma":  {"audio/x-ms-wma", Audio},
+	".mid":  {"audio/midi", Audio},
+	".midi": {"audio/midi", Audio},
+	".amr":  {"audio/amr", Audio},
+
+	// 文档
+	".pdf":  {"application/pdf", Document},
+	".txt":  {"text/plain", Document},
+	".md":   {"text/markdown", Document},
+	".rtf":  {"text/rtf", Document},
+	".csv":  {"text/csv", Document},
+	".doc":  {"application/msword", Document},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", Document},
+	".xls":  {"application/vnd.ms-excel", Document},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Document},
+	".ppt":  {"application/vnd.ms-powerpoint", Document},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", Document},
+	".odt":  {"application/vnd.oasis.opendocument.text", Document},
+	".ods":  {"application/vnd.oasis.opendocument.spreadsheet", Document},
+	".odp":  {"application/vnd.oasis.opendocument.presentation", Document},
+	".epub": {"application/epub+zip", Document},
+
+	// 压缩包
+	".zip": {"application/zip", Archive},
+	".rar": {"application/x-rar-compressed", Archive},
+	".7z":  {"application/x-7z-compressed", Archive},
+	".tar": {"application/x-tar", Archive},
+	".gz":  {"application/gzip", Archive},
+	".tgz": {"application/gzip", Archive},
+	".bz2": {"application/x-bzip2", Archive},
+	".xz":  {"application/x-xz", Archive},
+	".zst": {"application/zstd", Archive},
+	".iso": {"application/x-iso9660-image", Archive},
+
+	// 代码
+	".html":  {"text/html", Code},
+	".htm":   {"text/html", Code},
+	".css":   {"text/css", Code},
+	".js":    {"text/javascript", Code},
+	".mjs":   {"text/javascript", Code},
+	".jsx":   {"text/jsx", Code},
+	".ts":    {"text/x-typescript", Code},
+	".tsx":   {"text/tsx", Code},
+	".vue":   {"text/x-vue", Code},
+	".json":  {"application/json", Code},
+	".xml":   {"application/xml", Code},
+	".yaml":  {"application/yaml", Code},
+	".yml":   {"application/yaml", Code},
+	".toml":  {"application/toml", Code},
+	".go":    {"text/x-go", Code},
+	".py":    {"text/x-python", Code},
+	".java":  {"text/x-java", Code},
+	".kt":    {"text/x-kotlin", Code},
+	".swift": {"text/x-swift", Code},
+	".c":     {"text/x-c", Code},
+	".h":     {"text/x-c", Code},
+	".cpp":   {"text/x-c++", Code},
+	".cc":    {"text/x-c++", Code},
+	".hpp":   {"text/x-c++", Code},
+	".cs":    {"text/x-csharp", Code},
+	".rs":    {"text/x-rust", Code},
+	".rb":    {"text/x-ruby", Code},
+	".php":   {"text/x-php", Code},
+	".lua":   {"text/x-lua", Code},
+	".pl":    {"text/x-perl", Code},
+	".sh":    {"text/x-shellscript", Code},
+	".sql":   {"application/sql", Code},
+}
+
+// byContentType Content-Type 对应的分类，包含注册表中的类型和内容嗅探可能得到的别名
+var byContentType = map[string]string{
+	"application/javascript":       Code,
+	"application/x-javascript":     Code,
+	"application/x-sh":             Code,
+	"application/x-httpd-php":      Code,
+	"application/x-python":         Code,
+	"application/x-ole-storage":    Document,
+	"application/rtf":              Document,
+	"application/x-zip-compressed": Archive,
+	"application/vnd.rar":          Archive,
+	"application/x-gzip":           Archive,
+	"application/vnd.rn-realmedia": Video,
+}
+
+func init() {
+	for _, t := range byExtension {
+		byContentType[t.contentType] = t.category
+	}
+}
+
+// TypeByKey 根据扩展名推测 Content-Type，未知扩展名返回 DefaultType
+func TypeByKey(key string) string {
+	if t, ok := byExtension[strings.ToLower(path.Ext(key))]; ok {
+		return t.contentType
+	}
+	return DefaultType
+}
+
+// Category 返回文件的分类，优先按 Content-Type 判断，Content-Type 为通用类型时按扩展名判断
+func Category(contentType, key string) string {
+	contentType = baseType(contentType)
+	if category, ok := byContentType[contentType]; ok && !generic(contentType) {
+		return category
+	}
+	if t, ok := byExtension[strings.ToLower(path.Ext(key))]; ok {
+		return t.category
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return Image
+	case strings.HasPrefix(contentType, "video/"):
+		return Video
+	case strings.HasPrefix(contentType, "audio/"):
+		return Audio
+	case strings.HasPrefix(contentType, "text/"):
+		return Document
+	}
+	return Other
+}
+
+// IsCategory 判断是否为已知的分类
+func IsCategory(category string) bool {
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect 读取内容的前几个字节嗅探 Content-Type，返回的 reader 仍包含完整内容；
+// content 可以 Seek 时读取后回到原位置并原样返回，便于调用方再次读取
+func Detect(content io.Reader, filename string) (string, io.Reader, error) {
+	seeker, _ := content.(io.Seeker)
+	var start int64
+	if seeker != nil {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker = nil
+		}
+	}
+
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, err
+	}
+	head = head[:n]
+	contentType := DetectBytes(head, filename)
+
+	if seeker != nil {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		return contentType, content, nil
+	}
+	return contentType, io.MultiReader(bytes.NewReader(head), content), nil
+}
+
+// DetectBytes 根据内容的前几个字节判断 Content-Type，以内容为准；
+// 嗅探只能得到通用类型（二进制、纯文本、zip 等容器格式）时，使用扩展名对应的更具体的类型
+func DetectBytes(head []byte, filename string) string {
+	sniffed := mimetype.Detect(head)
+	byExt := TypeByKey(filename)
+	if byExt == DefaultType {
+		return sniffed.String()
+	}
+
+	if sniffed.Is(DefaultType) {
+		return byExt
+	}
+	// 纯文本内容的具体类型（代码、Markdown、CSV 等）只能由扩展名确定
+	if sniffed.Is("text/plain") && (strings.HasPrefix(byExt, "text/") || byContentType[byExt] == Code) {
+		return byExt
+	}
+	// 扩展名对应的类型是嗅探结果的子类型，如 zip 格式的 docx、epub
+	if node := mimetype.Lookup(byExt); node != nil {
+		for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+			if sniffed.Is(parent.String()) {
+				return byExt
+			}
+		}
+	}
+	return sniffed.String()
+}
+
+// baseType 去掉参数（如 charset）并转为小写
+func baseType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// generic 无法说明文件类型的通用 Content-Type
+func generic(contentType string) bool {
+	return contentType == "" || contentType == DefaultType || contentType == "text/plain"
+}
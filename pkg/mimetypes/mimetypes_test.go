@@ -0,0 +1,121 @@
+package mimetypes
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+func zipBytes(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("创建 zip 条目失败: %v", err)
+		}
+		w.Write([]byte("content"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("关闭 zip 失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectBytes(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  []byte
+		filename string
+		want     string
+	}{
+		{"内容优先于扩展名", pngHeader, "scan.txt", "image/png"},
+		{"无扩展名按内容", pngHeader, "scan", "image/png"},
+		{"代码按扩展名", []byte("package main\n\nfunc main() {}\n"), "main.go", "text/x-go"},
+		{"Markdown 按扩展名", []byte("# 标题\n\n正文\n"), "README.md", "text/markdown"},
+		{"纯文本", []byte("hello world\n"), "notes", "text/plain; charset=utf-8"},
+		{"zip 容器中的 docx", zipBytes(t, "word/document.xml"), "report.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"伪装成 docx 的 png", pngHeader, "report.docx", "image/png"},
+		{"未知二进制按扩展名", []byte{0x00, 0x01, 0x02, 0x03}, "movie.mp4", "video/mp4"},
+		{"未知二进制未知扩展名", []byte{0x00, 0x01, 0x02, 0x03}, "data.bin", DefaultType},
+	}
+
+	for _, tc := range cases {
+		if got := DetectBytes(tc.content, tc.filename); got != tc.want {
+			t.Errorf("%s: DetectBytes(%q) = %q, want %q", tc.name, tc.filename, got, tc.want)
+		}
+	}
+}
+
+func TestDetectPreservesContent(t *testing.T) {
+	content := strings.Repeat("a", SniffLen*2+7)
+	contentType, reader, err := Detect(strings.NewReader(content), "a.txt")
+	if err != nil {
+		t.Fatalf("Detect 失败: %v", err)
+	}
+	if contentType != "text/plain" {
+		t.Errorf("contentType = %q, want text/plain", contentType)
+	}
+	data, _ := io.ReadAll(reader)
+	if string(data) != content {
+		t.Errorf("读取到 %d 字节, want %d", len(data), len(content))
+	}
+
+	seekable := strings.NewReader(content)
+	seekable.Seek(3, io.SeekStart)
+	if _, reader, err = Detect(seekable, "a.txt"); err != nil || reader != io.Reader(seekable) {
+		t.Fatalf("可 Seek 的内容应原样返回: %v", err)
+	}
+	if data, _ := io.ReadAll(reader); string(data) != content[3:] {
+		t.Errorf("从原位置读取到 %d 字节, want %d", len(data), len(content)-3)
+	}
+
+	_, reader, err = Detect(strings.NewReader("hi"), "short.txt")
+	if err != nil {
+		t.Fatalf("短内容 Detect 失败: %v", err)
+	}
+	if data, _ := io.ReadAll(reader); string(data) != "hi" {
+		t.Errorf("短内容读取到 %q", data)
+	}
+}
+
+func TestCategory(t *testing.T) {
+	cases := []struct {
+		contentType string
+		key         string
+		want        string
+	}{
+		{"image/png", "scan.txt", Image},
+		{"image/x-unknown", "a", Image},
+		{"video/mp4", "a.mp4", Video},
+		{"audio/mpeg", "a.mp3", Audio},
+		{"application/pdf", "a.pdf", Document},
+		{"text/plain; charset=utf-8", "main.go", Code},
+		{"text/plain", "notes", Document},
+		{"application/zip", "a.zip", Archive},
+		{"application/x-tar", "", Archive},
+		{"", "App.TSX", Code},
+		{DefaultType, "a.xlsx", Document},
+		{DefaultType, "a.bin", Other},
+	}
+
+	for _, tc := range cases {
+		if got := Category(tc.contentType, tc.key); got != tc.want {
+			t.Errorf("Category(%q, %q) = %q, want %q", tc.contentType, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestTypeByKey(t *testing.T) {
+	if got := TypeByKey("photos/A.JPG"); got != "image/jpeg" {
+		t.Errorf("TypeByKey(A.JPG) = %q", got)
+	}
+	if got := TypeByKey("folder.v2/file"); got != DefaultType {
+		t.Errorf("TypeByKey(folder.v2/file) = %q", got)
+	}
+}
@@ -0,0 +1,106 @@
+package searchquery
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// Fields 用于匹配和排序的文件属性
+type Fields struct {
+	Path        string // 相对于搜索文件夹的路径
+	Size        int64
+	Modified    time.Time
+	ContentType string
+	Category    string
+	Tags        []string
+}
+
+// Match 判断文件是否满足条件，nil 表示不限制
+func (n *Node) Match(f Fields) bool {
+	if n == nil {
+		return true
+	}
+	switch n.Op {
+	case And:
+		for _, child := range n.Children {
+			if !child.Match(f) {
+				return false
+			}
+		}
+		return true
+	case Or:
+		for _, child := range n.Children {
+			if child.Match(f) {
+				return true
+			}
+		}
+		return false
+	case Not:
+		return !n.Children[0].Match(f)
+	}
+	return n.Term.Match(f)
+}
+
+// Match 判断文件是否满足单个条件，文字比较不区分大小写（标签除外）
+func (t Term) Match(f Fields) bool {
+	switch t.Field {
+	case FieldPath:
+		return containsFold(f.Path, t.Value)
+	case FieldName:
+		return containsFold(path.Base(f.Path), t.Value)
+	case FieldExt:
+		return strings.HasSuffix(strings.ToLower(f.Path), "."+t.Value)
+	case FieldType:
+		return f.Category == t.Value || strings.Contains(f.ContentType, t.Value)
+	case FieldSize:
+		return f.Size >= t.MinSize && f.Size <= t.MaxSize
+	case FieldModified:
+		return (t.After.IsZero() || !f.Modified.Before(t.After)) && (t.Before.IsZero() || f.Modified.Before(t.Before))
+	case FieldIn:
+		return strings.HasPrefix(f.Path, t.Value)
+	case FieldTag:
+		for _, tag := range f.Tags {
+			if tag == t.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Compare 按排序条件比较两个文件，依次比较每个条件，都相同时返回 0
+func Compare(sorts []Sort, a, b Fields) int {
+	for _, s := range sorts {
+		c := 0
+		switch s.Field {
+		case SortName:
+			c = strings.Compare(strings.ToLower(path.Base(a.Path)), strings.ToLower(path.Base(b.Path)))
+		case SortSize:
+			c = compareInt(a.Size, b.Size)
+		case SortModified:
+			c = a.Modified.Compare(b.Modified)
+		}
+		if s.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,562 @@
+// Package searchquery 结构化搜索语法，例如
+//
+//	report type:pdf size:>10MB modified:<2026-01-01 in:projects/ -tag:draft sort:size
+//
+// 空格分隔的条件同时满足，OR 连接的条件满足其一，- 或 NOT 表示取反，括号用于分组；
+// 含空格或特殊字符的值用双引号括起来，如 name:"年度 报告"
+package searchquery
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"bkp-drive/pkg/daterange"
+)
+
+// 支持的字段，没有字段的条件匹配相对路径
+const (
+	FieldPath     = ""
+	FieldName     = "name"     // 文件名包含
+	FieldExt      = "ext"      // 扩展名
+	FieldType     = "type"     // 分类（image、document 等）或 Content-Type 片段
+	FieldSize     = "size"     // 大小：10MB、>10MB、<=1GB、1MB..10MB
+	FieldModified = "modified" // 修改时间：2026-01-01、<2026-01-01、2025-01-01..2025-12-31、today、last-7-days（见 pkg/daterange）
+	FieldIn       = "in"       // 所在文件夹（相对于搜索文件夹）
+	FieldTag      = "tag"      // 标签
+	fieldSort     = "sort"     // 排序：sort:size、sort:name-asc、sort:modified-desc
+)
+
+// 可排序的字段
+const (
+	SortName     = "name"
+	SortSize     = "size"
+	SortModified = "modified"
+)
+
+// Op 节点的类型
+type Op int
+
+const (
+	And   Op = iota // 子条件同时满足
+	Or              // 子条件满足其一
+	Not             // 唯一的子条件不满足
+	Match           // 叶子节点，按 Term 匹配
+)
+
+// Node 查询条件的语法树
+type Node struct {
+	Op       Op
+	Children []*Node
+	Term     Term
+}
+
+// Term 单个条件，Size 和 Modified 的值在解析时转换为范围
+type Term struct {
+	Field string
+	Value string
+	// MinSize、MaxSize 为闭区间
+	MinSize, MaxSize int64
+	// After、Before 为左闭右开区间，零值表示不限制
+	After, Before time.Time
+}
+
+// Sort 排序条件
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query 解析后的查询
+type Query struct {
+	Expr *Node // 没有条件时为 nil
+	Sort []Sort
+}
+
+// SyntaxError 查询语法错误，Pos 为出错位置（从 1 开始的字符序号）
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("查询语法错误（第 %d 个字符）: %s", e.Pos, e.Msg)
+}
+
+// Parse 解析查询，日期按 UTC 解释
+func Parse(input string) (*Query, error) {
+	return ParseAt(input, time.Now().UTC())
+}
+
+// ParseAt 解析查询，today、last-7-days 等相对日期相对于 now 计算，日期的起止按 now 所在的时区解释
+func ParseAt(input string, now time.Time) (*Query, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, end: len([]rune(input)) + 1, now: now, query: &Query{}}
+	if len(tokens) == 0 {
+		return p.query, nil
+	}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != nil {
+		// parseOr 只会在右括号处提前结束
+		return nil, &SyntaxError{tok.pos, "多余的右括号"}
+	}
+	p.query.Expr = expr
+	return p.query, nil
+}
+
+// Keywords 取出顶层（不在 OR、NOT 中）没有字段的条件作为关键词，返回关键词和其余条件，
+// 用于全文检索：关键词在文件内容中搜索，其余条件过滤文件
+func (q *Query) Keywords() ([]string, *Node, error) {
+	var keywords []string
+	var rest []*Node
+	conditions := []*Node{q.Expr}
+	if q.Expr != nil && q.Expr.Op == And {
+		conditions = q.Expr.Children
+	}
+	for _, node := range conditions {
+		switch {
+		case node == nil:
+		case node.Op == Match && node.Term.Field == FieldPath:
+			keywords = append(keywords, node.Term.Value)
+		case containsKeyword(node):
+			return nil, nil, fmt.Errorf("全文检索的关键词不支持 OR 和 NOT，只能用于文件名、类型等条件")
+		default:
+			rest = append(rest, node)
+		}
+	}
+
+	switch len(rest) {
+	case 0:
+		return keywords, nil, nil
+	case 1:
+		return keywords, rest[0], nil
+	}
+	return keywords, &Node{Op: And, Children: rest}, nil
+}
+
+// containsKeyword 判断条件中是否有没有字段的条件
+func containsKeyword(node *Node) bool {
+	if node.Op == Match {
+		return node.Term.Field == FieldPath
+	}
+	for _, child := range node.Children {
+		if containsKeyword(child) {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenLParen
+	tokenRParen
+	tokenMinus
+	tokenOr
+	tokenNot
+)
+
+type token struct {
+	kind  tokenKind
+	pos   int
+	field string
+	value string
+}
+
+// lex 分词：括号、开头的 -、OR、NOT 和 [字段:]值，值中双引号括起的部分原样保留
+func lex(input string) ([]token, error) {
+	runes := []rune(input)
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: pos})
+			i++
+			continue
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: pos})
+			i++
+			continue
+		case r == '-':
+			if i+1 >= len(runes) || unicode.IsSpace(runes[i+1]) || runes[i+1] == ')' {
+				return nil, &SyntaxError{pos, "- 之后缺少条件"}
+			}
+			tokens = append(tokens, token{kind: tokenMinus, pos: pos})
+			i++
+			continue
+		}
+
+		var b strings.Builder
+		field := ""
+		quoted := false
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+			switch c := runes[i]; {
+			case c == '"':
+				quoted = true
+				end := i + 1
+				for ; end < len(runes) && runes[end] != '"'; end++ {
+					if runes[end] == '\\' && end+1 < len(runes) {
+						end++
+					}
+					b.WriteRune(runes[end])
+				}
+				if end >= len(runes) {
+					return nil, &SyntaxError{i + 1, "缺少右引号"}
+				}
+				i = end + 1
+			case c == ':' && field == "" && !quoted && b.Len() > 0:
+				field = strings.ToLower(b.String())
+				b.Reset()
+				i++
+			default:
+				b.WriteRune(c)
+				i++
+			}
+		}
+
+		value := b.String()
+		switch {
+		case field == "" && !quoted && value == "OR":
+			tokens = append(tokens, token{kind: tokenOr, pos: pos})
+		case field == "" && !quoted && value == "NOT":
+			tokens = append(tokens, token{kind: tokenNot, pos: pos})
+		case field != "" && value == "":
+			return nil, &SyntaxError{pos, fmt.Sprintf("%s: 之后缺少值", field)}
+		default:
+			tokens = append(tokens, token{kind: tokenWord, pos: pos, field: field, value: value})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens  []token
+	next    int
+	end     int // 输入结束的位置，用于报告缺少的内容
+	depth   int // 括号的层数
+	negated int // NOT 的层数
+	now     time.Time
+	query   *Query
+}
+
+func (p *parser) peek() *token {
+	if p.next >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.next]
+}
+
+// parseOr 解析 OR 连接的条件
+func (p *parser) parseOr() (*Node, error) {
+	var children []*Node
+	sorts := len(p.query.Sort)
+	orPos := 0
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+
+		tok := p.peek()
+		if tok == nil || tok.kind != tokenOr {
+			break
+		}
+		p.next++
+		if next := p.peek(); next == nil || next.kind == tokenRParen || next.kind == tokenOr {
+			return nil, &SyntaxError{tok.pos, "OR 之后缺少条件"}
+		}
+		if orPos == 0 {
+			orPos = tok.pos
+		}
+	}
+	if len(children) > 1 && len(p.query.Sort) > sorts {
+		return nil, &SyntaxError{orPos, "排序条件不能放在括号、OR 或 NOT 中"}
+	}
+	return group(Or, children), nil
+}
+
+// parseAnd 解析连续的条件，直到 OR、右括号或输入结束
+func (p *parser) parseAnd() (*Node, error) {
+	var children []*Node
+	for {
+		tok := p.peek()
+		if tok == nil || tok.kind == tokenOr || tok.kind == tokenRParen {
+			break
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			children = append(children, node)
+		}
+	}
+
+	if len(children) == 0 {
+		pos := p.end
+		if tok := p.peek(); tok != nil {
+			pos = tok.pos
+		}
+		// 只有排序条件时没有过滤条件
+		if p.depth == 0 && p.peek() == nil && len(p.query.Sort) > 0 {
+			return nil, nil
+		}
+		return nil, &SyntaxError{pos, "缺少条件"}
+	}
+	return group(And, children), nil
+}
+
+// parseUnary 解析取反、括号和单个条件，排序条件返回 nil
+func (p *parser) parseUnary() (*Node, error) {
+	tok := p.peek()
+	p.next++
+	switch tok.kind {
+	case tokenMinus, tokenNot:
+		if next := p.peek(); next == nil || next.kind == tokenRParen || next.kind == tokenOr {
+			return nil, &SyntaxError{tok.pos, "NOT 之后缺少条件"}
+		}
+		p.negated++
+		node, err := p.parseUnary()
+		p.negated--
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, &SyntaxError{tok.pos, "排序条件不能取反"}
+		}
+		return &Node{Op: Not, Children: []*Node{node}}, nil
+
+	case tokenLParen:
+		p.depth++
+		node, err := p.parseOr()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next == nil || next.kind != tokenRParen {
+			return nil, &SyntaxError{tok.pos, "括号没有闭合"}
+		}
+		p.next++
+		return node, nil
+
+	case tokenWord:
+		if tok.field == fieldSort {
+			if p.depth > 0 || p.negated > 0 {
+				return nil, &SyntaxError{tok.pos, "排序条件不能放在括号、OR 或 NOT 中"}
+			}
+			sort, err := parseSort(tok.value)
+			if err != nil {
+				return nil, &SyntaxError{tok.pos, err.Error()}
+			}
+			p.query.Sort = append(p.query.Sort, sort)
+			return nil, nil
+		}
+		term, err := parseTerm(tok.field, tok.value, p.now)
+		if err != nil {
+			return nil, &SyntaxError{tok.pos, err.Error()}
+		}
+		return &Node{Op: Match, Term: term}, nil
+	}
+	return nil, &SyntaxError{tok.pos, "多余的右括号"}
+}
+
+// group 只有一个子条件时直接返回该条件
+func group(op Op, children []*Node) *Node {
+	var flat []*Node
+	for _, child := range children {
+		if child != nil {
+			flat = append(flat, child)
+		}
+	}
+	switch len(flat) {
+	case 0:
+		return nil
+	case 1:
+		return flat[0]
+	}
+	return &Node{Op: op, Children: flat}
+}
+
+// parseTerm 校验字段，将大小和时间转换为范围
+func parseTerm(field, value string, now time.Time) (Term, error) {
+	term := Term{Field: field, Value: value}
+	switch field {
+	case FieldPath, FieldName, FieldType, FieldTag:
+	case FieldExt:
+		term.Value = strings.ToLower(strings.TrimPrefix(value, "."))
+	case FieldIn:
+		term.Value = strings.Trim(value, "/")
+		if term.Value != "" {
+			term.Value += "/"
+		}
+	case FieldSize:
+		min, max, err := parseRange(value, parseSize)
+		if err != nil {
+			return term, fmt.Errorf("size 的值无效 %q: %v", value, err)
+		}
+		term.MinSize, term.MaxSize = sizeBounds(min, max)
+	case FieldModified:
+		after, before, err := parseRange(value, func(v string) (daterange.Range, error) { return daterange.Parse(v, now) })
+		if err != nil {
+			return term, fmt.Errorf("modified 的值无效 %q: %v", value, err)
+		}
+		term.After, term.Before = dateBounds(after, before)
+	default:
+		return term, fmt.Errorf("未知的字段 %q，可用: name、ext、type、size、modified、in、tag、sort；搜索包含冒号的文字请加双引号", field)
+	}
+	return term, nil
+}
+
+// bound 比较条件中的一端
+type bound[T any] struct {
+	value     T
+	set       bool
+	inclusive bool
+}
+
+// parseRange 解析 >v、>=v、<v、<=v、v 和 a..b，v 表示等于
+func parseRange[T any](value string, parse func(string) (T, error)) (lower, upper bound[T], err error) {
+	if from, to, ok := strings.Cut(value, ".."); ok {
+		if from != "" {
+			if lower.value, err = parse(from); err != nil {
+				return
+			}
+			lower.set, lower.inclusive = true, true
+		}
+		if to != "" {
+			if upper.value, err = parse(to); err != nil {
+				return
+			}
+			upper.set, upper.inclusive = true, true
+		}
+		if !lower.set && !upper.set {
+			err = fmt.Errorf("范围两端不能都为空")
+		}
+		return
+	}
+
+	var op string
+	for _, prefix := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, prefix) {
+			op, value = prefix, value[len(prefix):]
+			break
+		}
+	}
+	v, err := parse(value)
+	if err != nil {
+		return
+	}
+	switch op {
+	case ">", ">=":
+		lower = bound[T]{v, true, op == ">="}
+	case "<", "<=":
+		upper = bound[T]{v, true, op == "<="}
+	default:
+		lower = bound[T]{v, true, true}
+		upper = bound[T]{v, true, true}
+	}
+	return
+}
+
+// sizeBounds 转换为闭区间
+func sizeBounds(lower, upper bound[int64]) (int64, int64) {
+	min, max := int64(0), int64(math.MaxInt64)
+	if lower.set {
+		min = lower.value
+		if !lower.inclusive {
+			min++
+		}
+	}
+	if upper.set {
+		max = upper.value
+		if !upper.inclusive {
+			max--
+		}
+	}
+	return min, max
+}
+
+// dateBounds 转换为左闭右开区间，日期包含当天的全部时间，>today 表示明天及以后
+func dateBounds(lower, upper bound[daterange.Range]) (time.Time, time.Time) {
+	var after, before time.Time
+	if lower.set {
+		after = lower.value.Start
+		if !lower.inclusive {
+			after = lower.value.End
+		}
+	}
+	if upper.set {
+		before = upper.value.End
+		if !upper.inclusive {
+			before = upper.value.Start
+		}
+	}
+	return after, before
+}
+
+// sizeUnits 大小单位，按 1024 进制
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// parseSize 解析带单位的大小，如 10MB、1.5G、512
+func parseSize(value string) (int64, error) {
+	upper := strings.ToUpper(value)
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper, factor = strings.TrimSuffix(upper, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(upper, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("应为数字加单位（B、KB、MB、GB、TB），如 10MB")
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// parseSort 解析 field、field-asc、field-desc，名称默认升序，大小和修改时间默认降序
+func parseSort(value string) (Sort, error) {
+	field, dir, _ := strings.Cut(strings.ToLower(value), "-")
+	sort := Sort{Field: field}
+	switch field {
+	case SortName:
+	case SortSize, SortModified:
+		sort.Desc = true
+	default:
+		return sort, fmt.Errorf("不支持按 %q 排序，可用: name、size、modified", value)
+	}
+	switch dir {
+	case "":
+	case "asc":
+		sort.Desc = false
+	case "desc":
+		sort.Desc = true
+	default:
+		return sort, fmt.Errorf("排序方向应为 asc 或 desc: %q", value)
+	}
+	return sort, nil
+}
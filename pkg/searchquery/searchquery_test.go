@@ -0,0 +1,235 @@
+package searchquery
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// format 以前缀形式输出语法树，便于比较
+func format(n *Node) string {
+	if n == nil {
+		return "<nil>"
+	}
+	switch n.Op {
+	case And, Or:
+		name := map[Op]string{And: "AND", Or: "OR"}[n.Op]
+		var parts []string
+		for _, child := range n.Children {
+			parts = append(parts, format(child))
+		}
+		return name + "(" + strings.Join(parts, " ") + ")"
+	case Not:
+		return "NOT(" + format(n.Children[0]) + ")"
+	}
+	return fmt.Sprintf("%s:%q", n.Term.Field, n.Term.Value)
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+		sort  string
+	}{
+		{"", "<nil>", ""},
+		{"report", `:"report"`, ""},
+		{"report type:pdf in:projects -tag:draft", `AND(:"report" type:"pdf" in:"projects/" NOT(tag:"draft"))`, ""},
+		{"a OR b c", `OR(:"a" AND(:"b" :"c"))`, ""},
+		{"(a OR b) NOT c", `AND(OR(:"a" :"b") NOT(:"c"))`, ""},
+		{`name:"年度 报告" "foo:bar" "OR" ext:.PDF`, `AND(name:"年度 报告" :"foo:bar" :"OR" ext:"pdf")`, ""},
+		{"Type:image sort:size sort:name", `type:"image"`, "size-desc,name-asc"},
+		{"sort:modified-asc", "<nil>", "modified-asc"},
+		{"report-2026 x-y", `AND(:"report-2026" :"x-y")`, ""},
+	}
+
+	for _, tc := range cases {
+		q, err := Parse(tc.input)
+		if err != nil {
+			t.Errorf("Parse(%q) 失败: %v", tc.input, err)
+			continue
+		}
+		if got := format(q.Expr); got != tc.want {
+			t.Errorf("Parse(%q) = %s, want %s", tc.input, got, tc.want)
+		}
+		var sorts []string
+		for _, s := range q.Sort {
+			dir := "asc"
+			if s.Desc {
+				dir = "desc"
+			}
+			sorts = append(sorts, s.Field+"-"+dir)
+		}
+		if got := strings.Join(sorts, ","); got != tc.sort {
+			t.Errorf("Parse(%q) 排序 = %s, want %s", tc.input, got, tc.sort)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		pos   int
+		msg   string
+	}{
+		{"a OR", 3, "OR 之后缺少条件"},
+		{"OR a", 1, "缺少条件"},
+		{"(a b", 1, "括号没有闭合"},
+		{"a)", 2, "多余的右括号"},
+		{"()", 2, "缺少条件"},
+		{"a -", 3, "- 之后缺少条件"},
+		{`name:"abc`, 6, "缺少右引号"},
+		{"size:", 1, "size: 之后缺少值"},
+		{"color:red", 1, "未知的字段"},
+		{"size:>10XB", 1, "size 的值无效"},
+		{"size:..", 1, "范围两端不能都为空"},
+		{"modified:2026/01/01", 1, "日期格式应为 YYYY-MM-DD"},
+		{"sort:owner", 1, "不支持按"},
+		{"sort:size-up", 1, "排序方向"},
+		{"-sort:size", 2, "排序条件不能"},
+		{"(a sort:size)", 4, "排序条件不能"},
+		{"a OR b sort:size", 3, "排序条件不能"},
+	}
+
+	for _, tc := range cases {
+		_, err := Parse(tc.input)
+		syntaxErr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("Parse(%q) 应返回语法错误, got %v", tc.input, err)
+			continue
+		}
+		if syntaxErr.Pos != tc.pos || !strings.Contains(syntaxErr.Msg, tc.msg) {
+			t.Errorf("Parse(%q) = %v, want 第 %d 个字符 %s", tc.input, err, tc.pos, tc.msg)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	files := []Fields{
+		{Path: "projects/Report.pdf", Size: 20 << 20, Modified: day("2025-12-31").Add(23 * time.Hour), ContentType: "application/pdf", Category: "document"},
+		{Path: "projects/draft-report.pdf", Size: 5 << 20, Modified: day("2025-06-01"), ContentType: "application/pdf", Category: "document", Tags: []string{"draft"}},
+		{Path: "report.txt", Size: 10 << 20, Modified: day("2026-01-01"), ContentType: "text/plain", Category: "document"},
+		{Path: "photos/report.png", Size: 1024, Modified: day("2026-02-01"), ContentType: "image/png", Category: "image"},
+	}
+
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"report type:pdf size:>10MB modified:<2026-01-01 in:projects/ -tag:draft", "projects/Report.pdf"},
+		{"size:10MB", "report.txt"},
+		{"size:<=10M", "projects/draft-report.pdf,report.txt,photos/report.png"},
+		{"size:1KB..5MB", "projects/draft-report.pdf,photos/report.png"},
+		{"modified:2025-12-31", "projects/Report.pdf"},
+		{"modified:>2025-12-31", "report.txt,photos/report.png"},
+		{"modified:>=2026-01-01 modified:<=2026-01-01", "report.txt"},
+		{"modified:2025-06-01..2025-12-31", "projects/Report.pdf,projects/draft-report.pdf"},
+		{"type:image OR ext:txt", "report.txt,photos/report.png"},
+		{"NOT (type:image OR ext:txt)", "projects/Report.pdf,projects/draft-report.pdf"},
+		{"name:draft", "projects/draft-report.pdf"},
+		{"projects", "projects/Report.pdf,projects/draft-report.pdf"},
+		{"name:projects", ""},
+		{"tag:Draft", ""},
+	}
+
+	for _, tc := range cases {
+		q, err := Parse(tc.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) 失败: %v", tc.query, err)
+		}
+		var matched []string
+		for _, f := range files {
+			if q.Expr.Match(f) {
+				matched = append(matched, f.Path)
+			}
+		}
+		if got := strings.Join(matched, ","); got != tc.want {
+			t.Errorf("%s => %s, want %s", tc.query, got, tc.want)
+		}
+	}
+
+	q, _ := Parse("sort:size sort:name")
+	if Compare(q.Sort, files[0], files[2]) >= 0 || Compare(q.Sort, files[3], files[1]) <= 0 {
+		t.Error("按大小降序排序错误")
+	}
+	q, _ = Parse("sort:name")
+	if Compare(q.Sort, files[1], files[0]) >= 0 || Compare(q.Sort, files[0], files[0]) != 0 {
+		t.Error("按名称升序排序错误")
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	q, _ := Parse(`quarterly "budget plan" type:pdf -tag:draft sort:modified`)
+	keywords, rest, err := q.Keywords()
+	if err != nil {
+		t.Fatalf("Keywords 失败: %v", err)
+	}
+	if strings.Join(keywords, "|") != "quarterly|budget plan" || format(rest) != `AND(type:"pdf" NOT(tag:"draft"))` {
+		t.Errorf("Keywords = %v, %s", keywords, format(rest))
+	}
+
+	for _, input := range []string{"a OR b", "type:pdf -draft", "NOT a"} {
+		q, _ := Parse(input)
+		if _, _, err := q.Keywords(); err == nil {
+			t.Errorf("%s: OR 或 NOT 中的关键词应报错", input)
+		}
+	}
+}
+
+func TestRelativeDates(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*3600)
+	// 2026-03-02 是周一
+	now := time.Date(2026, 3, 2, 0, 30, 0, 0, shanghai)
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, shanghai)
+		return d
+	}
+
+	cases := []struct {
+		query  string
+		after  string
+		before string
+	}{
+		{"modified:today", "2026-03-02", "2026-03-03"},
+		{"modified:yesterday", "2026-03-01", "2026-03-02"},
+		{"modified:>yesterday", "2026-03-02", ""},
+		{"modified:>=yesterday", "2026-03-01", ""},
+		{"modified:<this-week", "", "2026-03-02"},
+		{"modified:<=last-week", "", "2026-03-02"},
+		{"modified:last-7-days", "2026-02-24", "2026-03-03"},
+		{"modified:this-month", "2026-03-01", "2026-04-01"},
+		{"modified:2026-01-01", "2026-01-01", "2026-01-02"},
+		{"modified:2025-12..yesterday", "2025-12-01", "2026-03-02"},
+	}
+	for _, tc := range cases {
+		q, err := ParseAt(tc.query, now)
+		if err != nil {
+			t.Errorf("ParseAt(%q) 失败: %v", tc.query, err)
+			continue
+		}
+		term := q.Expr.Term
+		var after, before time.Time
+		if tc.after != "" {
+			after = day(tc.after)
+		}
+		if tc.before != "" {
+			before = day(tc.before)
+		}
+		if !term.After.Equal(after) || !term.Before.Equal(before) {
+			t.Errorf("%s => [%s, %s), want [%s, %s)", tc.query, term.After, term.Before, after, before)
+		}
+	}
+
+	// 按 UTC 刚过零点，在 UTC+8 已经是当天早上
+	q, _ := ParseAt("modified:today", now)
+	if !q.Expr.Match(Fields{Modified: time.Date(2026, 3, 1, 16, 0, 0, 0, time.UTC)}) || q.Expr.Match(Fields{Modified: time.Date(2026, 3, 1, 15, 59, 59, 0, time.UTC)}) {
+		t.Error("today 应按 now 所在的时区计算")
+	}
+	if _, err := ParseAt("modified:tomorrow", now); err == nil {
+		t.Error("未知的相对日期应报错")
+	}
+}
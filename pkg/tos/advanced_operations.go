@@ -1,56 +1,32 @@
 package tos
 
 import (
-	"context"
 	"fmt"
+	"sort"
 	"strings"
-	"time"
-
-	"github.com/volcengine/ve-tos-golang-sdk/v2/tos"
 
 	"bkp-drive/internal/models"
+	"bkp-drive/pkg/fulltext"
+	"bkp-drive/pkg/mimetypes"
+	"bkp-drive/pkg/searchquery"
 )
 
-// CopyObject 复制对象（简单实现，先下载再上传）
-func (tc *TOSClient) CopyObject(sourceKey, destKey string) error {
-	// 由于TOS SDK的CopyObject方法可能不同，我们使用下载-上传的方式
-	reader, contentLength, contentType, err := tc.GetObject(sourceKey)
-	if err != nil {
-		return fmt.Errorf("获取源对象失败: %w", err)
-	}
-	defer reader.Close()
-
-	ctx := context.Background()
-	
-	input := &tos.PutObjectV2Input{
-		PutObjectBasicInput: tos.PutObjectBasicInput{
-			Bucket:        tc.config.BucketName,
-			Key:           destKey,
-			ContentLength: contentLength,
-			ContentType:   contentType,
-		},
-		Content: reader,
-	}
-
-	_, err = tc.client.PutObjectV2(ctx, input)
-	if err != nil {
-		return fmt.Errorf("复制对象失败: %w", err)
+// MoveObject 移动对象（复制后删除源对象）
+func MoveObject(store ObjectStore, sourceKey, destKey string) error {
+	// 源和目标相同时复制后再删除会丢失对象
+	if sourceKey == destKey {
+		return nil
 	}
 
-	return nil
-}
-
-// MoveObject 移动对象（复制后删除源对象）
-func (tc *TOSClient) MoveObject(sourceKey, destKey string) error {
 	// 先复制
-	if err := tc.CopyObject(sourceKey, destKey); err != nil {
+	if err := store.CopyObject(sourceKey, destKey); err != nil {
 		return err
 	}
 
 	// 再删除源对象
-	if err := tc.DeleteObject(sourceKey); err != nil {
+	if err := store.DeleteObject(sourceKey); err != nil {
 		// 如果删除失败，尝试清理目标对象
-		tc.DeleteObject(destKey)
+		store.DeleteObject(destKey)
 		return fmt.Errorf("移动对象失败，删除源对象时出错: %w", err)
 	}
 
@@ -58,112 +34,96 @@ func (tc *TOSClient) MoveObject(sourceKey, destKey string) error {
 }
 
 // RenameObject 重命名对象
-func (tc *TOSClient) RenameObject(oldKey, newKey string) error {
-	return tc.MoveObject(oldKey, newKey)
+func RenameObject(store ObjectStore, oldKey, newKey string) error {
+	return MoveObject(store, oldKey, newKey)
 }
 
-// BatchDeleteObjects 批量删除对象
-func (tc *TOSClient) BatchDeleteObjects(keys []string) (*models.BatchOperationResponse, error) {
+// BatchDeleteObjects 批量删除对象，以 / 结尾的项目按文件夹递归删除
+func BatchDeleteObjects(store ObjectStore, keys []string) (*models.BatchOperationResponse, error) {
 	// 由于不确定批量删除的确切API，我们使用逐个删除的方式
-	processed := 0
-	failed := 0
-	var failedItems []string
+	result := &folderResult{}
 
 	for _, key := range keys {
-		if err := tc.DeleteObject(key); err != nil {
-			failed++
-			failedItems = append(failedItems, key)
-		} else {
-			processed++
+		if strings.HasSuffix(key, "/") {
+			folder, err := DeleteFolder(store, key)
+			result.merge(key, folder, err)
+			continue
 		}
+		result.record(key, store.DeleteObject(key))
 	}
 
-	return &models.BatchOperationResponse{
-		Success:     failed == 0,
-		Message:     fmt.Sprintf("批量删除完成，成功: %d, 失败: %d", processed, failed),
-		Processed:   processed,
-		Failed:      failed,
-		FailedItems: failedItems,
-	}, nil
+	return result.response("批量删除"), nil
 }
 
-// BatchCopyObjects 批量复制对象
-func (tc *TOSClient) BatchCopyObjects(items []string, destination string) (*models.BatchOperationResponse, error) {
-	processed := 0
-	failed := 0
-	var failedItems []string
+// BatchCopyObjects 批量复制对象，以 / 结尾或没有同名对象但存在子对象的项目按文件夹递归复制，
+// 覆盖目标中已存在的对象前调用 snapshot
+func BatchCopyObjects(store ObjectStore, items []string, destination string, snapshot SnapshotFunc) (*models.BatchOperationResponse, error) {
+	result := &folderResult{}
 
 	destination = strings.TrimSuffix(destination, "/") + "/"
 
 	for _, sourceKey := range items {
-		fileName := getFileName(sourceKey)
-		destKey := destination + fileName
-
-		if err := tc.CopyObject(sourceKey, destKey); err != nil {
-			failed++
-			failedItems = append(failedItems, sourceKey)
-		} else {
-			processed++
+		isFolder, err := IsFolder(store, sourceKey)
+		if err != nil {
+			result.record(sourceKey, err)
+			continue
+		}
+		if isFolder {
+			folder, err := CopyFolder(store, sourceKey, destination+getFileName(strings.TrimSuffix(sourceKey, "/")), snapshot)
+			result.merge(sourceKey, folder, err)
+			continue
 		}
+
+		destKey := destination + getFileName(sourceKey)
+		result.record(sourceKey, copyFolderObject(store, sourceKey, destKey, snapshot))
 	}
 
-	return &models.BatchOperationResponse{
-		Success:     failed == 0,
-		Message:     fmt.Sprintf("批量复制完成，成功: %d, 失败: %d", processed, failed),
-		Processed:   processed,
-		Failed:      failed,
-		FailedItems: failedItems,
-	}, nil
+	return result.response("批量复制"), nil
 }
 
-// BatchMoveObjects 批量移动对象
-func (tc *TOSClient) BatchMoveObjects(items []string, destination string) (*models.BatchOperationResponse, error) {
-	processed := 0
-	failed := 0
-	var failedItems []string
+// BatchMoveObjects 批量移动对象，以 / 结尾或没有同名对象但存在子对象的项目按文件夹递归移动，
+// 覆盖目标中已存在的对象前调用 snapshot
+func BatchMoveObjects(store ObjectStore, items []string, destination string, snapshot SnapshotFunc) (*models.BatchOperationResponse, error) {
+	result := &folderResult{}
 
 	destination = strings.TrimSuffix(destination, "/") + "/"
 
 	for _, sourceKey := range items {
-		fileName := getFileName(sourceKey)
-		destKey := destination + fileName
-
-		if err := tc.MoveObject(sourceKey, destKey); err != nil {
-			failed++
-			failedItems = append(failedItems, sourceKey)
-		} else {
-			processed++
+		isFolder, err := IsFolder(store, sourceKey)
+		if err != nil {
+			result.record(sourceKey, err)
+			continue
+		}
+		if isFolder {
+			folder, err := MoveFolder(store, sourceKey, destination+getFileName(strings.TrimSuffix(sourceKey, "/")), snapshot)
+			result.merge(sourceKey, folder, err)
+			continue
 		}
+
+		destKey := destination + getFileName(sourceKey)
+		if err := beforeOverwrite(snapshot, sourceKey, destKey); err != nil {
+			result.record(sourceKey, err)
+			continue
+		}
+		result.record(sourceKey, MoveObject(store, sourceKey, destKey))
 	}
 
-	return &models.BatchOperationResponse{
-		Success:     failed == 0,
-		Message:     fmt.Sprintf("批量移动完成，成功: %d, 失败: %d", processed, failed),
-		Processed:   processed,
-		Failed:      failed,
-		FailedItems: failedItems,
-	}, nil
+	return result.response("批量移动"), nil
 }
 
-// SearchObjects 搜索对象
-func (tc *TOSClient) SearchObjects(req *models.SearchRequest) (*models.SearchResponse, error) {
-	ctx := context.Background()
-
+// SearchObjects 搜索对象，存储带元数据索引时查询索引
+func SearchObjects(store ObjectStore, req *models.SearchRequest) (*models.SearchResponse, error) {
 	// 设置默认限制
 	limit := req.Limit
 	if limit <= 0 || limit > 1000 {
 		limit = 100
 	}
 
-	input := &tos.ListObjectsV2Input{
-		Bucket: tc.config.BucketName,
-		ListObjectsInput: tos.ListObjectsInput{
-			Prefix:  req.Folder,
-			MaxKeys: limit * 2, // 获取更多结果用于过滤
-		},
+	if req.Content {
+		return searchContent(store, req, limit)
 	}
 
-	output, err := tc.client.ListObjectsV2(ctx, input)
+	objects, err := searchObjects(store, req, limit)
 	if err != nil {
 		return &models.SearchResponse{
 			Success: false,
@@ -173,36 +133,65 @@ func (tc *TOSClient) SearchObjects(req *models.SearchRequest) (*models.SearchRes
 
 	var results []models.ExtendedFileInfo
 	
-	for _, obj := range output.Contents {
-		// 跳过文件夹标记
-		if strings.HasSuffix(obj.Key, "/") && obj.Size == 0 {
-			continue
-		}
-
-		// 应用搜索过滤条件
-		if !matchesSearchCriteria(obj, req) {
-			continue
-		}
-
+	for _, obj := range objects {
 		extInfo := models.ExtendedFileInfo{
 			FileInfo: models.FileInfo{
 				Key:          obj.Key,
 				Name:         getFileName(obj.Key),
 				Size:         obj.Size,
 				LastModified: obj.LastModified,
-				ContentType:  getContentTypeFromKey(obj.Key),
+				ContentType:  ObjectContentType(obj),
 				IsFolder:     false,
-				ETag:         strings.Trim(obj.ETag, "\""),
+				ETag:         obj.ETag,
 			},
 			Path: obj.Key,
 		}
 
 		results = append(results, extInfo)
+	}
 
-		// 限制结果数量
-		if len(results) >= limit {
-			break
-		}
+	return &models.SearchResponse{
+		Success: true,
+		Message: "搜索完成",
+		Results: results,
+		Total:   len(results),
+		Query:   req.Query,
+	}, nil
+}
+
+// searchContent 按内容搜索，需要支持全文检索的元数据索引
+func searchContent(store ObjectStore, req *models.SearchRequest, limit int) (*models.SearchResponse, error) {
+	index := contentIndex(store, req.Folder)
+	if index == nil {
+		return &models.SearchResponse{
+			Success: false,
+			Message: "搜索失败: 全文检索需要开启元数据索引",
+		}, nil
+	}
+
+	matches, err := index.SearchContent(req, limit)
+	if err != nil {
+		return &models.SearchResponse{
+			Success: false,
+			Message: fmt.Sprintf("搜索失败: %v", err),
+		}, nil
+	}
+
+	results := []models.ExtendedFileInfo{}
+	for _, match := range matches {
+		results = append(results, models.ExtendedFileInfo{
+			FileInfo: models.FileInfo{
+				Key:          match.Key,
+				Name:         getFileName(match.Key),
+				Size:         match.Size,
+				LastModified: match.LastModified,
+				ContentType:  ObjectContentType(match.ObjectInfo),
+				ETag:         match.ETag,
+			},
+			Path:    match.Key,
+			Snippet: fulltext.Highlight(match.Snippet),
+			Score:   match.Score,
+		})
 	}
 
 	return &models.SearchResponse{
@@ -214,54 +203,108 @@ func (tc *TOSClient) SearchObjects(req *models.SearchRequest) (*models.SearchRes
 	}, nil
 }
 
-// GetStorageStats 获取存储统计信息
-func (tc *TOSClient) GetStorageStats() (*models.StorageStats, error) {
-	ctx := context.Background()
+// searchObjects 返回符合条件的文件，没有元数据索引时分页列举 req.Folder 下的全部对象逐个过滤；
+// 不指定排序时按键的顺序返回，找到 limit 个即可停止，否则过滤并排序所有对象后再截取前 limit 个
+func searchObjects(store ObjectStore, req *models.SearchRequest, limit int) ([]ObjectInfo, error) {
+	if index := metadataIndex(store, req.Folder); index != nil {
+		return index.SearchObjects(req, limit)
+	}
+
+	var objects []ObjectInfo
+	input := &ListObjectsInput{Prefix: req.Folder}
+	for {
+		output, err := store.ListObjects(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range output.Objects {
+			// 跳过文件夹标记，应用搜索过滤条件
+			if isFolderMarker(obj) || !matchesSearchCriteria(obj, req) {
+				continue
+			}
+			objects = append(objects, obj)
+			if len(req.Sort) == 0 && len(objects) >= limit {
+				return objects, nil
+			}
+		}
+		if !output.IsTruncated {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	sortObjects(objects, req)
+	if len(objects) > limit {
+		objects = objects[:limit]
+	}
+	return objects, nil
+}
 
-	input := &tos.ListObjectsV2Input{
-		Bucket: tc.config.BucketName,
-		ListObjectsInput: tos.ListObjectsInput{
-			MaxKeys: 10000, // 获取大量对象用于统计
-		},
+// GetStorageStats 获取 prefix 下的存储统计信息，存储带元数据索引时查询索引
+func GetStorageStats(store ObjectStore, prefix string) (*models.StorageStats, error) {
+	if index := metadataIndex(store, prefix); index != nil {
+		stats, err := index.StorageStats(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("获取存储统计失败: %w", err)
+		}
+		return stats, nil
 	}
 
-	output, err := tc.client.ListObjectsV2(ctx, input)
+	objects, err := ListAllObjects(store, prefix)
 	if err != nil {
 		return nil, fmt.Errorf("获取存储统计失败: %w", err)
 	}
+	return objectStats(objects), nil
+}
 
+// objectStats 统计对象列表中的文件和文件夹
+func objectStats(objects []ObjectInfo) *models.StorageStats {
 	stats := &models.StorageStats{
 		FileTypeStats: make(map[string]int64),
+		CategoryStats: make(map[string]models.CategoryStat),
 		RecentUsage:   []models.DayUsage{},
 	}
 
 	var totalSize int64
+	var physicalSize int64
 	var fileCount int64
 	var folderCount int64
+	// 去重存储中相同内容只占用一份空间
+	hashes := map[string]bool{}
 
 	// 统计文件和文件夹
-	for _, obj := range output.Contents {
-		if strings.HasSuffix(obj.Key, "/") && obj.Size == 0 {
+	for _, obj := range objects {
+		if isFolderMarker(obj) {
 			folderCount++
 			continue
 		}
 
 		fileCount++
 		totalSize += obj.Size
+		if obj.ContentHash == "" {
+			physicalSize += obj.Size
+		} else if !hashes[obj.ContentHash] {
+			hashes[obj.ContentHash] = true
+			physicalSize += obj.Size
+		}
 
-		// 按文件类型统计
-		contentType := getContentTypeFromKey(obj.Key)
+		// 按文件类型和分类统计
+		contentType := ObjectContentType(obj)
 		stats.FileTypeStats[contentType]++
+		category := mimetypes.Category(contentType, obj.Key)
+		categoryStat := stats.CategoryStats[category]
+		categoryStat.FileCount++
+		categoryStat.Size += obj.Size
+		stats.CategoryStats[category] = categoryStat
 	}
 
 	stats.UsedSpace = totalSize
+	stats.LogicalSize = totalSize
+	stats.PhysicalSize = physicalSize
 	stats.FileCount = fileCount
 	stats.FolderCount = folderCount
-	// 假设总空间为100GB（实际应该从配置或TOS服务获取）
-	stats.TotalSpace = 100 * 1024 * 1024 * 1024
-	stats.FreeSpace = stats.TotalSpace - stats.UsedSpace
 
-	return stats, nil
+	return stats
 }
 
 // 辅助函数
@@ -270,9 +313,15 @@ func getFileName(key string) string {
 	return parts[len(parts)-1]
 }
 
-func matchesSearchCriteria(obj tos.ListedObjectV2, req *models.SearchRequest) bool {
-	// 文件名匹配
-	if req.Query != "" && !strings.Contains(strings.ToLower(obj.Key), strings.ToLower(req.Query)) {
+// isFolderMarker 判断对象是否为文件夹标记（以 / 结尾且大小为0）
+func isFolderMarker(obj ObjectInfo) bool {
+	return strings.HasSuffix(obj.Key, "/") && obj.Size == 0
+}
+
+func matchesSearchCriteria(obj ObjectInfo, req *models.SearchRequest) bool {
+	// 文件名匹配（只匹配搜索文件夹以下的相对路径）
+	relativeKey := strings.TrimPrefix(obj.Key, req.Folder)
+	if req.Query != "" && !strings.Contains(strings.ToLower(relativeKey), strings.ToLower(req.Query)) {
 		return false
 	}
 
@@ -285,27 +334,22 @@ func matchesSearchCriteria(obj tos.ListedObjectV2, req *models.SearchRequest) bo
 	}
 
 	// 时间范围过滤
-	if req.StartDate != "" {
-		if startTime, err := time.Parse("2006-01-02", req.StartDate); err == nil {
-			if obj.LastModified.Before(startTime) {
-				return false
-			}
-		}
+	if !req.Modified.Contains(obj.LastModified) {
+		return false
 	}
-	if req.EndDate != "" {
-		if endTime, err := time.Parse("2006-01-02", req.EndDate); err == nil {
-			if obj.LastModified.After(endTime.Add(24 * time.Hour)) {
-				return false
-			}
-		}
+
+	// 结构化查询中的条件
+	if req.Filter != nil && !req.Filter.Match(searchFields(obj, req.Folder)) {
+		return false
 	}
 
-	// 文件类型过滤
+	// 文件类型过滤：分类名（image、document 等）或 Content-Type 片段
 	if len(req.FileTypes) > 0 {
-		contentType := getContentTypeFromKey(obj.Key)
+		contentType := ObjectContentType(obj)
+		category := mimetypes.Category(contentType, obj.Key)
 		found := false
 		for _, ft := range req.FileTypes {
-			if strings.Contains(contentType, ft) {
+			if ft == category || strings.Contains(contentType, ft) {
 				found = true
 				break
 			}
@@ -316,4 +360,30 @@ func matchesSearchCriteria(obj tos.ListedObjectV2, req *models.SearchRequest) bo
 	}
 
 	return true
-}
\ No newline at end of file
+}
+
+// searchFields 结构化查询匹配和排序使用的文件属性
+func searchFields(obj ObjectInfo, folder string) searchquery.Fields {
+	contentType := ObjectContentType(obj)
+	return searchquery.Fields{
+		Path:        strings.TrimPrefix(obj.Key, folder),
+		Size:        obj.Size,
+		Modified:    obj.LastModified,
+		ContentType: contentType,
+		Category:    mimetypes.Category(contentType, obj.Key),
+		Tags:        ObjectTags(obj),
+	}
+}
+
+// sortObjects 按 req.Sort 排序，相同时按键排序
+func sortObjects(objects []ObjectInfo, req *models.SearchRequest) {
+	if len(req.Sort) == 0 {
+		return
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		if c := searchquery.Compare(req.Sort, searchFields(objects[i], req.Folder), searchFields(objects[j], req.Folder)); c != 0 {
+			return c < 0
+		}
+		return objects[i].Key < objects[j].Key
+	})
+}
@@ -0,0 +1,119 @@
+package tos
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/searchquery"
+)
+
+func TestStorageStatsByCategory(t *testing.T) {
+	store := NewMemoryStore()
+	if err := CreateFolder(store, "docs"); err != nil {
+		t.Fatalf("CreateFolder 失败: %v", err)
+	}
+	putTestObjects(t, store, "docs/a.pdf", "docs/b.md", "src/main.go", "photos/a.jpg", "data.bin")
+	// 扩展名与内容不符时以保存的 Content-Type 为准
+	if err := store.PutObject("scan.txt", strings.NewReader("png"), 3, "image/png", nil); err != nil {
+		t.Fatalf("PutObject 失败: %v", err)
+	}
+
+	stats, err := GetStorageStats(store, "")
+	if err != nil {
+		t.Fatalf("GetStorageStats 失败: %v", err)
+	}
+	if stats.FileCount != 6 || stats.FolderCount != 1 {
+		t.Errorf("fileCount = %d, folderCount = %d", stats.FileCount, stats.FolderCount)
+	}
+
+	want := map[string]models.CategoryStat{
+		"document": {FileCount: 2, Size: int64(len("docs/a.pdf") + len("docs/b.md"))},
+		"code":     {FileCount: 1, Size: int64(len("src/main.go"))},
+		"image":    {FileCount: 2, Size: int64(len("photos/a.jpg") + 3)},
+		"other":    {FileCount: 1, Size: int64(len("data.bin"))},
+	}
+	if len(stats.CategoryStats) != len(want) {
+		t.Errorf("categoryStats = %+v", stats.CategoryStats)
+	}
+	for category, stat := range want {
+		if stats.CategoryStats[category] != stat {
+			t.Errorf("categoryStats[%s] = %+v, want %+v", category, stats.CategoryStats[category], stat)
+		}
+	}
+	if stats.FileTypeStats["image/png"] != 1 || stats.FileTypeStats["image/jpeg"] != 1 {
+		t.Errorf("fileTypeStats = %+v", stats.FileTypeStats)
+	}
+}
+
+func TestSearchObjectsByCategory(t *testing.T) {
+	store := NewMemoryStore()
+	putTestObjects(t, store, "a.pdf", "b.go", "c.mp3", "d.zip")
+
+	search := func(fileTypes ...string) []string {
+		t.Helper()
+		resp, err := SearchObjects(store, &models.SearchRequest{FileTypes: fileTypes})
+		if err != nil || !resp.Success {
+			t.Fatalf("SearchObjects 失败: %v %s", err, resp.Message)
+		}
+		keys := []string{}
+		for _, r := range resp.Results {
+			keys = append(keys, r.Key)
+		}
+		return keys
+	}
+
+	if got := search("code", "audio"); strings.Join(got, ",") != "b.go,c.mp3" {
+		t.Errorf("code,audio => %v", got)
+	}
+	if got := search("application/zip"); strings.Join(got, ",") != "d.zip" {
+		t.Errorf("application/zip => %v", got)
+	}
+}
+
+func TestSearchObjectsScansWholeFolder(t *testing.T) {
+	store := NewMemoryStore()
+	// 超过一页（1000 个）的对象，排序后排在最前和满足条件的对象的键都排在最后
+	for i := 0; i < 1005; i++ {
+		key := fmt.Sprintf("photos/%04d.jpg", i)
+		if err := store.PutObject(key, strings.NewReader("x"), 1, "", nil); err != nil {
+			t.Fatalf("PutObject 失败: %v", err)
+		}
+	}
+	large := strings.Repeat("x", 100)
+	if err := store.PutObject("photos/zz-large.jpg", strings.NewReader(large), int64(len(large)), "", nil); err != nil {
+		t.Fatalf("PutObject 失败: %v", err)
+	}
+	putTestObjects(t, store, "photos/zz-notes.md")
+
+	search := func(q string) []string {
+		t.Helper()
+		query, err := searchquery.Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q) 失败: %v", q, err)
+		}
+		resp, err := SearchObjects(store, &models.SearchRequest{Folder: "photos/", Limit: 3, Filter: query.Expr, Sort: query.Sort})
+		if err != nil || !resp.Success {
+			t.Fatalf("SearchObjects 失败: %v %s", err, resp.Message)
+		}
+		keys := []string{}
+		for _, r := range resp.Results {
+			keys = append(keys, r.Key)
+		}
+		return keys
+	}
+
+	if got := search("sort:size-desc"); len(got) != 3 || got[0] != "photos/zz-large.jpg" {
+		t.Errorf("sort:size-desc => %v", got)
+	}
+	if got := search("ext:md OR name:zz-large"); strings.Join(got, ",") != "photos/zz-large.jpg,photos/zz-notes.md" {
+		t.Errorf("OR => %v", got)
+	}
+	if got := search("-ext:jpg"); strings.Join(got, ",") != "photos/zz-notes.md" {
+		t.Errorf("NOT => %v", got)
+	}
+	if got := search(""); strings.Join(got, ",") != "photos/0000.jpg,photos/0001.jpg,photos/0002.jpg" {
+		t.Errorf("不指定排序 => %v", got)
+	}
+}
@@ -3,11 +3,24 @@ package tos
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/volcengine/ve-tos-golang-sdk/v2/tos"
+	"github.com/volcengine/ve-tos-golang-sdk/v2/tos/enum"
 
 	"bkp-drive/pkg/config"
+	"bkp-drive/pkg/mimetypes"
+)
+
+const (
+	// tosCopyObjectMaxSize 单次 CopyObject 支持的最大对象大小
+	tosCopyObjectMaxSize = 5 << 30
+	// tosCopyPartSize 分片复制时每个分片的大小
+	tosCopyPartSize = 1 << 30
 )
 
 type TOSClient struct {
@@ -91,4 +104,477 @@ func (tc *TOSClient) GetEndpoint() string {
 		endpoint = strings.TrimPrefix(endpoint, "http://")
 	}
 	return endpoint
-}
\ No newline at end of file
+}
+
+// wrapTOSError 将TOS的404错误转换为 ErrObjectNotFound
+func wrapTOSError(action string, err error) error {
+	if tos.StatusCode(err) == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", action, ErrObjectNotFound)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// PutObject 上传对象到 TOS
+func (tc *TOSClient) PutObject(key string, content io.Reader, size int64, contentType string, metadata map[string]string) error {
+	ctx := context.Background()
+
+	input := &tos.PutObjectV2Input{
+		PutObjectBasicInput: tos.PutObjectBasicInput{
+			Bucket:      tc.config.BucketName,
+			Key:         key,
+			ContentType: contentType,
+			Meta:        metadata,
+		},
+		Content: content,
+	}
+	if size >= 0 {
+		input.ContentLength = size
+	}
+
+	_, err := tc.client.PutObjectV2(ctx, input)
+	if err != nil {
+		return fmt.Errorf("上传对象失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetObject 从 TOS 下载对象
+func (tc *TOSClient) GetObject(key string) (io.ReadCloser, int64, string, error) {
+	ctx := context.Background()
+	
+	input := &tos.GetObjectV2Input{
+		Bucket: tc.config.BucketName,
+		Key:    key,
+	}
+	
+	output, err := tc.client.GetObjectV2(ctx, input)
+	if err != nil {
+		return nil, 0, "", wrapTOSError("下载对象失败", err)
+	}
+	
+	return output.Content, output.ContentLength, output.ContentType, nil
+}
+
+// GetObjectRange 按字节范围下载对象
+func (tc *TOSClient) GetObjectRange(key string, offset, length int64) (io.ReadCloser, error) {
+	output, err := tc.client.GetObjectV2(context.Background(), &tos.GetObjectV2Input{
+		Bucket: tc.config.BucketName,
+		Key:    key,
+		Range:  fmt.Sprintf("bytes=%d-%d", offset, offset+length-1),
+	})
+	if err != nil {
+		return nil, wrapTOSError("下载对象失败", err)
+	}
+
+	return output.Content, nil
+}
+
+// GetProcessedObject 获取TOS处理后的对象（如缩略图、视频截图等）
+func (tc *TOSClient) GetProcessedObject(key string, process string) (io.ReadCloser, int64, string, error) {
+	ctx := context.Background()
+	
+	// 使用TOS SDK的GetObject方法，并通过Process参数指定处理操作
+	input := &tos.GetObjectV2Input{
+		Bucket:  tc.config.BucketName,
+		Key:     key,
+		Process: process, // TOS处理参数
+	}
+	
+	output, err := tc.client.GetObjectV2(ctx, input)
+	if err != nil {
+		return nil, 0, "", wrapTOSError("获取处理后对象失败", err)
+	}
+	
+	return output.Content, output.ContentLength, output.ContentType, nil
+}
+
+// HeadObject 获取 TOS 对象元信息
+func (tc *TOSClient) HeadObject(key string) (*ObjectInfo, error) {
+	ctx := context.Background()
+
+	output, err := tc.client.HeadObjectV2(ctx, &tos.HeadObjectV2Input{
+		Bucket: tc.config.BucketName,
+		Key:    key,
+	})
+	if err != nil {
+		return nil, wrapTOSError("获取对象信息失败", err)
+	}
+
+	metadata := make(map[string]string)
+	if output.Meta != nil {
+		output.Meta.Range(func(k, v string) bool {
+			metadata[k] = v
+			return true
+		})
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         output.ContentLength,
+		LastModified: output.LastModified,
+		ETag:         strings.Trim(output.ETag, "\""),
+		ContentType:  output.ContentType,
+		Metadata:     metadata,
+	}, nil
+}
+
+// ListObjects 列出存储桶中的对象（单页）
+func (tc *TOSClient) ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error) {
+	ctx := context.Background()
+
+	maxKeys := input.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultListMaxKeys
+	}
+
+	output, err := tc.client.ListObjectsType2(ctx, &tos.ListObjectsType2Input{
+		Bucket:            tc.config.BucketName,
+		Prefix:            input.Prefix,
+		Delimiter:         input.Delimiter,
+		MaxKeys:           maxKeys,
+		ContinuationToken: input.ContinuationToken,
+		ListOnlyOnce:      true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列出对象失败: %w", err)
+	}
+
+	result := &ListObjectsOutput{
+		IsTruncated:           output.IsTruncated,
+		NextContinuationToken: output.NextContinuationToken,
+	}
+	for _, obj := range output.Contents {
+		result.Objects = append(result.Objects, ObjectInfo{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			ETag:         strings.Trim(obj.ETag, "\""),
+		})
+	}
+	for _, commonPrefix := range output.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix.Prefix)
+	}
+
+	return result, nil
+}
+
+// DeleteObject 删除 TOS 中的对象
+func (tc *TOSClient) DeleteObject(key string) error {
+	ctx := context.Background()
+	
+	input := &tos.DeleteObjectV2Input{
+		Bucket: tc.config.BucketName,
+		Key:    key,
+	}
+	
+	_, err := tc.client.DeleteObjectV2(ctx, input)
+	if err != nil {
+		return fmt.Errorf("删除对象失败: %w", err)
+	}
+	
+	return nil
+}
+
+// CopyObject 服务端复制对象，Content-Type和自定义元数据随对象一起复制，数据不经过本服务
+func (tc *TOSClient) CopyObject(sourceKey, destKey string) error {
+	info, err := tc.HeadObject(sourceKey)
+	if err != nil {
+		return fmt.Errorf("获取源对象失败: %w", err)
+	}
+
+	// 单次 CopyObject 最多支持 5GB，更大的对象使用分片复制
+	if info.Size > tosCopyObjectMaxSize {
+		return tc.copyObjectMultipart(info, destKey)
+	}
+
+	_, err = tc.client.CopyObject(context.Background(), &tos.CopyObjectInput{
+		Bucket:            tc.config.BucketName,
+		Key:               destKey,
+		SrcBucket:         tc.config.BucketName,
+		SrcKey:            sourceKey,
+		MetadataDirective: enum.MetadataDirectiveCopy,
+	})
+	if err != nil {
+		return wrapTOSError("复制对象失败", err)
+	}
+
+	return nil
+}
+
+// SetContentType 将对象复制到自身并替换 Content-Type，自定义元数据保持不变
+func (tc *TOSClient) SetContentType(key, contentType string) error {
+	info, err := tc.HeadObject(key)
+	if err != nil {
+		return fmt.Errorf("获取对象失败: %w", err)
+	}
+
+	if info.Size > tosCopyObjectMaxSize {
+		replaced := *info
+		replaced.ContentType = contentType
+		return tc.copyObjectMultipart(&replaced, key)
+	}
+
+	_, err = tc.client.CopyObject(context.Background(), &tos.CopyObjectInput{
+		Bucket:            tc.config.BucketName,
+		Key:               key,
+		SrcBucket:         tc.config.BucketName,
+		SrcKey:            key,
+		ContentType:       contentType,
+		Meta:              info.Metadata,
+		MetadataDirective: enum.MetadataDirectiveReplace,
+		CopySourceIfMatch: info.ETag,
+	})
+	if err != nil {
+		return wrapTOSError("修改 Content-Type 失败", err)
+	}
+	return nil
+}
+
+// copyObjectMultipart 使用 UploadPartCopy 分片复制大对象，分片复制不会继承源对象的元数据，需要在创建分片上传时显式设置
+func (tc *TOSClient) copyObjectMultipart(source *ObjectInfo, destKey string) error {
+	ctx := context.Background()
+
+	upload, err := tc.client.CreateMultipartUploadV2(ctx, &tos.CreateMultipartUploadV2Input{
+		Bucket:      tc.config.BucketName,
+		Key:         destKey,
+		ContentType: source.ContentType,
+		Meta:        source.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("创建分片复制任务失败: %w", err)
+	}
+
+	parts := make([]tos.UploadedPartV2, 0)
+	for i, r := range copyPartRanges(source.Size, tosCopyPartSize) {
+		output, err := tc.client.UploadPartCopyV2(ctx, &tos.UploadPartCopyV2Input{
+			Bucket:          tc.config.BucketName,
+			Key:             destKey,
+			UploadID:        upload.UploadID,
+			PartNumber:      i + 1,
+			SrcBucket:       tc.config.BucketName,
+			SrcKey:          source.Key,
+			CopySourceRange: fmt.Sprintf("bytes=%d-%d", r[0], r[1]),
+			// 复制期间源对象被覆盖时中止，避免拼出新旧混合的内容
+			CopySourceIfMatch: source.ETag,
+		})
+		if err != nil {
+			tc.AbortMultipartUpload(destKey, upload.UploadID)
+			return wrapTOSError(fmt.Sprintf("复制第 %d 个分片失败", i+1), err)
+		}
+		parts = append(parts, tos.UploadedPartV2{PartNumber: i + 1, ETag: output.ETag})
+	}
+
+	_, err = tc.client.CompleteMultipartUploadV2(ctx, &tos.CompleteMultipartUploadV2Input{
+		Bucket:   tc.config.BucketName,
+		Key:      destKey,
+		UploadID: upload.UploadID,
+		Parts:    parts,
+	})
+	if err != nil {
+		tc.AbortMultipartUpload(destKey, upload.UploadID)
+		return fmt.Errorf("完成分片复制失败: %w", err)
+	}
+
+	return nil
+}
+
+// copyPartRanges 将 [0, size) 按 partSize 切分为闭区间字节范围
+func copyPartRanges(size, partSize int64) [][2]int64 {
+	var ranges [][2]int64
+	for start := int64(0); start < size; start += partSize {
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+	return ranges
+}
+
+// wrapTOSUploadError 将分片上传相关的404错误转换为 ErrUploadNotFound
+func wrapTOSUploadError(action string, err error) error {
+	if tos.StatusCode(err) == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", action, ErrUploadNotFound)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// CreateMultipartUpload 创建分片上传任务
+func (tc *TOSClient) CreateMultipartUpload(key, contentType string, metadata map[string]string) (string, error) {
+	if contentType == "" {
+		contentType = mimetypes.TypeByKey(key)
+	}
+
+	output, err := tc.client.CreateMultipartUploadV2(context.Background(), &tos.CreateMultipartUploadV2Input{
+		Bucket:      tc.config.BucketName,
+		Key:         key,
+		ContentType: contentType,
+		Meta:        metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("创建分片上传任务失败: %w", err)
+	}
+
+	return output.UploadID, nil
+}
+
+// UploadPart 上传分片
+func (tc *TOSClient) UploadPart(key, uploadID string, partNumber int, content io.Reader, size int64) (*UploadedPart, error) {
+	if err := validatePartNumber(partNumber); err != nil {
+		return nil, err
+	}
+
+	input := &tos.UploadPartV2Input{
+		UploadPartBasicInput: tos.UploadPartBasicInput{
+			Bucket:     tc.config.BucketName,
+			Key:        key,
+			UploadID:   uploadID,
+			PartNumber: partNumber,
+		},
+		Content: content,
+	}
+	if size >= 0 {
+		input.ContentLength = size
+	}
+
+	output, err := tc.client.UploadPartV2(context.Background(), input)
+	if err != nil {
+		return nil, wrapTOSUploadError("上传分片失败", err)
+	}
+
+	return &UploadedPart{
+		PartNumber:   partNumber,
+		ETag:         strings.Trim(output.ETag, "\""),
+		Size:         size,
+		LastModified: time.Now(),
+	}, nil
+}
+
+// ListParts 列出已上传的分片（自动翻页）
+func (tc *TOSClient) ListParts(key, uploadID string) ([]UploadedPart, error) {
+	ctx := context.Background()
+
+	parts := []UploadedPart{}
+	marker := 0
+	for {
+		output, err := tc.client.ListParts(ctx, &tos.ListPartsInput{
+			Bucket:           tc.config.BucketName,
+			Key:              key,
+			UploadID:         uploadID,
+			PartNumberMarker: marker,
+			MaxParts:         1000,
+		})
+		if err != nil {
+			return nil, wrapTOSUploadError("列出分片失败", err)
+		}
+
+		for _, part := range output.Parts {
+			parts = append(parts, UploadedPart{
+				PartNumber:   part.PartNumber,
+				ETag:         strings.Trim(part.ETag, "\""),
+				Size:         part.Size,
+				LastModified: part.LastModified,
+			})
+		}
+
+		if !output.IsTruncated {
+			break
+		}
+		marker = output.NextPartNumberMarker
+	}
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片
+func (tc *TOSClient) CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error {
+	if err := validateCompleteParts(parts); err != nil {
+		return err
+	}
+
+	uploaded := make([]tos.UploadedPartV2, 0, len(parts))
+	for _, part := range parts {
+		uploaded = append(uploaded, tos.UploadedPartV2{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+
+	_, err := tc.client.CompleteMultipartUploadV2(context.Background(), &tos.CompleteMultipartUploadV2Input{
+		Bucket:   tc.config.BucketName,
+		Key:      key,
+		UploadID: uploadID,
+		Parts:    uploaded,
+	})
+	if err != nil {
+		return wrapTOSUploadError("完成分片上传失败", err)
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload 取消分片上传
+func (tc *TOSClient) AbortMultipartUpload(key, uploadID string) error {
+	_, err := tc.client.AbortMultipartUpload(context.Background(), &tos.AbortMultipartUploadInput{
+		Bucket:   tc.config.BucketName,
+		Key:      key,
+		UploadID: uploadID,
+	})
+	if err != nil {
+		return wrapTOSUploadError("取消分片上传失败", err)
+	}
+
+	return nil
+}
+
+// PresignPutObject 生成预签名上传URL
+func (tc *TOSClient) PresignPutObject(key string, expires time.Duration, contentType string, contentLength int64) (*PresignedRequest, error) {
+	if contentType == "" {
+		contentType = mimetypes.TypeByKey(key)
+	}
+
+	output, err := tc.client.PreSignedURL(&tos.PreSignedURLInput{
+		HTTPMethod: enum.HttpMethodPut,
+		Bucket:     tc.config.BucketName,
+		Key:        key,
+		Expires:    int64(expires / time.Second),
+		Header: map[string]string{
+			"Content-Type":   contentType,
+			"Content-Length": strconv.FormatInt(contentLength, 10),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成上传URL失败: %w", err)
+	}
+
+	return &PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       output.SignedUrl,
+		Headers:   output.SignedHeader,
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+// PresignGetObject 生成预签名下载URL
+func (tc *TOSClient) PresignGetObject(key string, expires time.Duration, filename string) (*PresignedRequest, error) {
+	query := map[string]string{}
+	if filename != "" {
+		query["response-content-disposition"] = attachmentDisposition(filename)
+	}
+
+	output, err := tc.client.PreSignedURL(&tos.PreSignedURLInput{
+		HTTPMethod: enum.HttpMethodGet,
+		Bucket:     tc.config.BucketName,
+		Key:        key,
+		Expires:    int64(expires / time.Second),
+		Query:      query,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成下载URL失败: %w", err)
+	}
+
+	return &PresignedRequest{
+		Method:    http.MethodGet,
+		URL:       output.SignedUrl,
+		Headers:   map[string]string{},
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
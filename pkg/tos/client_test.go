@@ -0,0 +1,23 @@
+package tos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCopyPartRanges(t *testing.T) {
+	tests := []struct {
+		size, partSize int64
+		want           [][2]int64
+	}{
+		{0, 4, nil},
+		{4, 4, [][2]int64{{0, 3}}},
+		{10, 4, [][2]int64{{0, 3}, {4, 7}, {8, 9}}},
+	}
+
+	for _, tt := range tests {
+		if got := copyPartRanges(tt.size, tt.partSize); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("copyPartRanges(%d, %d) = %v, want %v", tt.size, tt.partSize, got, tt.want)
+		}
+	}
+}
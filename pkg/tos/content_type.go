@@ -0,0 +1,30 @@
+package tos
+
+import "fmt"
+
+// ContentTypeSetter 支持原地修改对象 Content-Type 的存储后端，内容和自定义元数据保持不变
+type ContentTypeSetter interface {
+	SetContentType(key, contentType string) error
+}
+
+// SetContentType 修改对象的 Content-Type，存储后端不支持时读出内容重新写入
+func SetContentType(store ObjectStore, key, contentType string) error {
+	if setter, ok := store.(ContentTypeSetter); ok {
+		return setter.SetContentType(key, contentType)
+	}
+
+	info, err := store.HeadObject(key)
+	if err != nil {
+		return err
+	}
+	reader, size, _, err := store.GetObject(key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := store.PutObject(key, reader, size, contentType, info.Metadata); err != nil {
+		return fmt.Errorf("修改 Content-Type 失败: %w", err)
+	}
+	return nil
+}
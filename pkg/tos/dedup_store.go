@@ -0,0 +1,680 @@
+package tos
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 去重存储使用的内部前缀
+const (
+	dedupBlobPrefix    = "system/blobs/"
+	dedupRefPrefix     = "system/blob-refs/"
+	dedupStagingPrefix = "system/dedup-staging/"
+)
+
+// 引用对象的自定义元数据
+const (
+	dedupMetaHash = "dedup-sha256"
+	dedupMetaSize = "dedup-size"
+	dedupMetaETag = "dedup-etag"
+)
+
+// dedupCacheLimit 列举时缓存的引用数量上限，超过后清空重建
+const dedupCacheLimit = 100000
+
+// DedupStore 按内容去重的存储：文件内容按 SHA-256 只保存一份（system/blobs/），
+// 用户可见的路径是记录哈希的引用对象，复制只需写入新的引用。
+// 每个引用在 system/blob-refs/<哈希>/ 下有一个标记对象作为引用计数，最后一个引用删除时删除内容。
+// 开启去重前已有的对象和 system/ 下的内部对象不做去重，按原样读写
+type DedupStore struct {
+	store    ObjectStore
+	locks    [256]sync.Mutex // 按哈希首字节分段，同一内容的引用计数变更串行处理
+	keyLocks [256]sync.Mutex // 按键的哈希分段，同一个键的写入和删除串行处理，避免并发覆盖时引用计数出错
+
+	cacheMu sync.Mutex
+	cache   map[string]*dedupRef // 键+ETag -> 引用，nil 表示普通对象
+}
+
+// dedupRef 引用对象指向的内容
+type dedupRef struct {
+	hash string
+	size int64
+	etag string // 内容的 MD5，与普通对象的 ETag 一致
+}
+
+// NewDedupStore 在存储后端之上开启去重，返回的存储保留后端的预签名和内容处理能力
+func NewDedupStore(store ObjectStore) ObjectStore {
+	d := &DedupStore{
+		store: store,
+		cache: map[string]*dedupRef{},
+	}
+
+	presigner, canPresign := store.(Presigner)
+	processor, canProcess := store.(ProcessedObjectGetter)
+	switch {
+	case canPresign && canProcess:
+		return struct {
+			*DedupStore
+			dedupPresigner
+			dedupProcessor
+		}{d, dedupPresigner{d, presigner}, dedupProcessor{d, processor}}
+	case canPresign:
+		return struct {
+			*DedupStore
+			dedupPresigner
+		}{d, dedupPresigner{d, presigner}}
+	case canProcess:
+		return struct {
+			*DedupStore
+			dedupProcessor
+		}{d, dedupProcessor{d, processor}}
+	}
+	return d
+}
+
+// EnsureBucketExists 确保存储空间可用
+func (d *DedupStore) EnsureBucketExists() error {
+	return d.store.EnsureBucketExists()
+}
+
+// PutObject 计算内容哈希，内容不存在时保存一份，然后在 key 写入引用
+func (d *DedupStore) PutObject(key string, content io.Reader, size int64, contentType string, metadata map[string]string) error {
+	unlock := d.lockKey(key)
+	defer unlock()
+
+	if !dedupable(key) || size == 0 {
+		return d.replace(key, "", func() error {
+			return d.store.PutObject(key, content, size, contentType, metadata)
+		})
+	}
+
+	ref, err := d.storeBlob(key, content, size, contentType)
+	if err != nil {
+		return err
+	}
+	return d.putRef(key, ref, contentType, metadata)
+}
+
+// GetObject 读取对象，引用对象返回其指向的内容
+func (d *DedupStore) GetObject(key string) (io.ReadCloser, int64, string, error) {
+	info, ref, err := d.head(key)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if ref == nil {
+		return d.store.GetObject(key)
+	}
+
+	reader, _, _, err := d.store.GetObject(blobKey(ref.hash))
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("读取 %s 的内容失败: %w", key, err)
+	}
+	return reader, ref.size, info.ContentType, nil
+}
+
+// GetObjectRange 按字节范围读取对象
+func (d *DedupStore) GetObjectRange(key string, offset, length int64) (io.ReadCloser, error) {
+	ref, err := d.refOf(key)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return GetObjectRange(d.store, key, offset, length)
+	}
+	return GetObjectRange(d.store, blobKey(ref.hash), offset, length)
+}
+
+// HeadObject 获取对象元信息，引用对象返回内容的大小和 ETag
+func (d *DedupStore) HeadObject(key string) (*ObjectInfo, error) {
+	info, _, err := d.head(key)
+	return info, err
+}
+
+// ListObjects 列举对象，隐藏去重的内部对象，引用对象返回内容的大小和 ETag
+func (d *DedupStore) ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error) {
+	output, err := d.store.ListObjects(input)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := output.Objects[:0]
+	for _, obj := range output.Objects {
+		if dedupInternal(obj.Key) {
+			continue
+		}
+		ref, err := d.listedRef(obj)
+		if err != nil {
+			return nil, err
+		}
+		if ref != nil {
+			obj = ref.apply(obj)
+		}
+		objects = append(objects, obj)
+	}
+	output.Objects = objects
+
+	prefixes := output.CommonPrefixes[:0]
+	for _, prefix := range output.CommonPrefixes {
+		if !dedupInternal(prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	output.CommonPrefixes = prefixes
+	return output, nil
+}
+
+// DeleteObject 删除对象，引用对象同时减少引用计数
+func (d *DedupStore) DeleteObject(key string) error {
+	unlock := d.lockKey(key)
+	defer unlock()
+
+	return d.replace(key, "", func() error {
+		return d.store.DeleteObject(key)
+	})
+}
+
+// CopyObject 复制对象，引用对象只复制引用，不复制内容
+func (d *DedupStore) CopyObject(sourceKey, destKey string) error {
+	unlock := d.lockKey(destKey)
+	defer unlock()
+
+	ref, err := d.refOf(sourceKey)
+	if err != nil {
+		return fmt.Errorf("获取源对象失败: %w", err)
+	}
+	hash := ""
+	if ref != nil {
+		hash = ref.hash
+		if err := d.claim(ref, destKey, nil); err != nil {
+			return err
+		}
+	}
+	return d.replace(destKey, hash, func() error {
+		return d.store.CopyObject(sourceKey, destKey)
+	})
+}
+
+// SetContentType 修改对象的 Content-Type，引用对象只需修改引用本身
+func (d *DedupStore) SetContentType(key, contentType string) error {
+	unlock := d.lockKey(key)
+	defer unlock()
+
+	return SetContentType(d.store, key, contentType)
+}
+
+// CreateMultipartUpload 分片先上传到暂存对象，完成时再计算哈希。
+// 每个上传使用独立的暂存对象，返回的上传ID为“暂存ID.后端上传ID”
+func (d *DedupStore) CreateMultipartUpload(key, contentType string, metadata map[string]string) (string, error) {
+	uploader, err := d.uploader()
+	if err != nil {
+		return "", err
+	}
+	id, err := newDedupID()
+	if err != nil {
+		return "", err
+	}
+	uploadID, err := uploader.CreateMultipartUpload(stagingKey(key, id), contentType, metadata)
+	if err != nil {
+		return "", err
+	}
+	return id + "." + uploadID, nil
+}
+
+// UploadPart 上传一个分片
+func (d *DedupStore) UploadPart(key, uploadID string, partNumber int, content io.Reader, size int64) (*UploadedPart, error) {
+	uploader, staged, uploadID, err := d.multipart(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return uploader.UploadPart(staged, uploadID, partNumber, content, size)
+}
+
+// ListParts 列出已上传的分片
+func (d *DedupStore) ListParts(key, uploadID string) ([]UploadedPart, error) {
+	uploader, staged, uploadID, err := d.multipart(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return uploader.ListParts(staged, uploadID)
+}
+
+// CompleteMultipartUpload 合并分片后将暂存对象转为去重的内容和引用
+func (d *DedupStore) CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error {
+	uploader, staged, uploadID, err := d.multipart(key, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := uploader.CompleteMultipartUpload(staged, uploadID, parts); err != nil {
+		return err
+	}
+
+	unlock := d.lockKey(key)
+	defer unlock()
+
+	if !dedupable(key) {
+		defer d.store.DeleteObject(staged)
+		return d.replace(key, "", func() error {
+			return d.store.CopyObject(staged, key)
+		})
+	}
+
+	info, err := d.store.HeadObject(staged)
+	if err != nil {
+		return err
+	}
+	ref, err := d.ingest(key, staged)
+	if err != nil {
+		return err
+	}
+	return d.putRef(key, ref, info.ContentType, info.Metadata)
+}
+
+// AbortMultipartUpload 取消分片上传
+func (d *DedupStore) AbortMultipartUpload(key, uploadID string) error {
+	uploader, staged, uploadID, err := d.multipart(key, uploadID)
+	if err != nil {
+		return err
+	}
+	return uploader.AbortMultipartUpload(staged, uploadID)
+}
+
+// multipart 从上传ID中解析暂存对象和后端的上传ID
+func (d *DedupStore) multipart(key, uploadID string) (MultipartUploader, string, string, error) {
+	uploader, err := d.uploader()
+	if err != nil {
+		return nil, "", "", err
+	}
+	id, backendID, ok := strings.Cut(uploadID, ".")
+	if !ok || len(id) != dedupIDLength || backendID == "" {
+		return nil, "", "", ErrUploadNotFound
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return nil, "", "", ErrUploadNotFound
+	}
+	return uploader, stagingKey(key, id), backendID, nil
+}
+
+// AdoptStagedObject 将预签名上传的暂存对象转为 key 上的引用，并释放 key 原来引用的内容
+func (d *DedupStore) AdoptStagedObject(key, stagingKey string) error {
+	if !strings.HasPrefix(stagingKey, dedupStagingPrefix+"presign/") || !strings.HasSuffix(stagingKey, "/"+key) {
+		return fmt.Errorf("无效的暂存对象: %s", stagingKey)
+	}
+
+	unlock := d.lockKey(key)
+	defer unlock()
+
+	info, err := d.store.HeadObject(stagingKey)
+	if err != nil {
+		return err
+	}
+	if info.Size == 0 {
+		defer d.store.DeleteObject(stagingKey)
+		return d.replace(key, "", func() error {
+			return d.store.CopyObject(stagingKey, key)
+		})
+	}
+	ref, err := d.ingest(key, stagingKey)
+	if err != nil {
+		return err
+	}
+	return d.putRef(key, ref, info.ContentType, info.Metadata)
+}
+
+func (d *DedupStore) uploader() (MultipartUploader, error) {
+	uploader, ok := d.store.(MultipartUploader)
+	if !ok {
+		return nil, errors.New("存储后端不支持分片上传")
+	}
+	return uploader, nil
+}
+
+// storeBlob 保存内容并为 key 增加引用；内容可以 Seek 时先计算哈希，已存在的内容不再上传
+func (d *DedupStore) storeBlob(key string, content io.Reader, size int64, contentType string) (*dedupRef, error) {
+	if seeker, ok := content.(io.ReadSeeker); ok && size > 0 {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			ref, err := hashContent(io.LimitReader(seeker, size+1))
+			if err != nil {
+				return nil, fmt.Errorf("读取内容失败: %w", err)
+			}
+			if ref.size != size {
+				return nil, fmt.Errorf("写入对象失败: 期望 %d 字节，实际 %d 字节", size, ref.size)
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("读取内容失败: %w", err)
+			}
+
+			err = d.claim(ref, key, func() error {
+				return d.store.PutObject(blobKey(ref.hash), seeker, size, contentType, nil)
+			})
+			return ref, err
+		}
+	}
+
+	// 无法预先计算哈希时先写入暂存对象
+	id, err := newDedupID()
+	if err != nil {
+		return nil, err
+	}
+	staged := dedupStagingPrefix + "put/" + id
+	if err := d.store.PutObject(staged, content, size, contentType, nil); err != nil {
+		return nil, err
+	}
+	return d.ingest(key, staged)
+}
+
+// ingest 计算暂存对象的哈希并为 key 增加引用，内容不存在时复制为内容对象，最后删除暂存对象
+func (d *DedupStore) ingest(key, staged string) (*dedupRef, error) {
+	defer d.store.DeleteObject(staged)
+
+	reader, _, _, err := d.store.GetObject(staged)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := hashContent(reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("读取内容失败: %w", err)
+	}
+
+	err = d.claim(ref, key, func() error {
+		return d.store.CopyObject(staged, blobKey(ref.hash))
+	})
+	return ref, err
+}
+
+// claim 为 key 增加内容的引用；内容不存在时调用 upload 保存，upload 为 nil 时返回 ErrObjectNotFound。
+// 检查内容和增加引用在同一把锁内完成，避免内容在此期间因最后一个引用被删除而删除
+func (d *DedupStore) claim(ref *dedupRef, key string, upload func() error) error {
+	lock := d.lock(ref.hash)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, err := d.store.HeadObject(blobKey(ref.hash)); errors.Is(err, ErrObjectNotFound) {
+		if upload == nil {
+			return fmt.Errorf("内容 %s: %w", ref.hash, ErrObjectNotFound)
+		}
+		if err := upload(); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := d.store.PutObject(refKey(ref.hash, key), strings.NewReader(""), 0, "application/octet-stream", nil); err != nil {
+		return fmt.Errorf("增加引用计数失败: %w", err)
+	}
+	return nil
+}
+
+// putRef 在 key 写入引用对象，调用前须已通过 claim 增加引用
+func (d *DedupStore) putRef(key string, ref *dedupRef, contentType string, metadata map[string]string) error {
+	refMetadata := map[string]string{}
+	for k, v := range metadata {
+		refMetadata[k] = v
+	}
+	refMetadata[dedupMetaHash] = ref.hash
+	refMetadata[dedupMetaSize] = strconv.FormatInt(ref.size, 10)
+	refMetadata[dedupMetaETag] = ref.etag
+
+	return d.replace(key, ref.hash, func() error {
+		return d.store.PutObject(key, strings.NewReader(ref.hash), int64(len(ref.hash)), contentType, refMetadata)
+	})
+}
+
+// replace 执行覆盖或删除 key 的操作，hash 为写入后 key 引用的内容（不是引用时为空），
+// 成功后释放 key 原来引用的其他内容。调用方须持有 key 的锁（lockKey），
+// 否则并发写入同一个键时可能释放另一个写入刚增加的引用
+func (d *DedupStore) replace(key, hash string, write func() error) error {
+	old, err := d.refOf(key)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	if old == nil || old.hash == hash {
+		return nil
+	}
+	return d.releaseRef(old.hash, key)
+}
+
+// releaseRef 删除 key 对内容的引用，没有其他引用时删除内容
+func (d *DedupStore) releaseRef(hash, key string) error {
+	lock := d.lock(hash)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := d.store.DeleteObject(refKey(hash, key)); err != nil {
+		return fmt.Errorf("减少引用计数失败: %w", err)
+	}
+	remaining, err := d.store.ListObjects(&ListObjectsInput{Prefix: dedupRefPrefix + hash + "/", MaxKeys: 1})
+	if err != nil {
+		return fmt.Errorf("读取引用计数失败: %w", err)
+	}
+	if len(remaining.Objects) > 0 {
+		return nil
+	}
+	return d.store.DeleteObject(blobKey(hash))
+}
+
+// RefCount 返回内容被引用的次数
+func (d *DedupStore) RefCount(hash string) (int, error) {
+	objects, err := ListAllObjects(d.store, dedupRefPrefix+hash+"/")
+	if err != nil {
+		return 0, err
+	}
+	return len(objects), nil
+}
+
+// head 获取对象元信息并解析引用，普通对象的引用为 nil
+func (d *DedupStore) head(key string) (*ObjectInfo, *dedupRef, error) {
+	info, err := d.store.HeadObject(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ref, err := parseDedupRef(info.Metadata)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", key, err)
+	}
+	if ref == nil {
+		return info, nil, nil
+	}
+
+	applied := ref.apply(*info)
+	metadata := map[string]string{}
+	for k, v := range info.Metadata {
+		if k != dedupMetaHash && k != dedupMetaSize && k != dedupMetaETag {
+			metadata[k] = v
+		}
+	}
+	applied.Metadata = metadata
+	return &applied, ref, nil
+}
+
+func (d *DedupStore) refOf(key string) (*dedupRef, error) {
+	_, ref, err := d.head(key)
+	return ref, err
+}
+
+// listedRef 解析列举结果中的引用；引用对象的内容是64字节的哈希，其他大小的对象不需要查询
+func (d *DedupStore) listedRef(obj ObjectInfo) (*dedupRef, error) {
+	if obj.Size != sha256.Size*2 {
+		return nil, nil
+	}
+
+	cacheKey := obj.Key + "\n" + obj.ETag
+	d.cacheMu.Lock()
+	ref, ok := d.cache[cacheKey]
+	d.cacheMu.Unlock()
+	if ok {
+		return ref, nil
+	}
+
+	ref, err := d.refOf(obj.Key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.cacheMu.Lock()
+	if len(d.cache) >= dedupCacheLimit {
+		d.cache = map[string]*dedupRef{}
+	}
+	d.cache[cacheKey] = ref
+	d.cacheMu.Unlock()
+	return ref, nil
+}
+
+func (d *DedupStore) lock(hash string) *sync.Mutex {
+	b, _ := hex.DecodeString(hash[:2])
+	return &d.locks[b[0]]
+}
+
+// lockKey 锁定 key 直到返回的函数被调用；同时持有内容锁时须先锁定 key
+func (d *DedupStore) lockKey(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	lock := &d.keyLocks[h.Sum32()%uint32(len(d.keyLocks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// apply 将引用的内容信息写入对象信息
+func (r *dedupRef) apply(obj ObjectInfo) ObjectInfo {
+	obj.Size = r.size
+	obj.ETag = r.etag
+	obj.ContentHash = r.hash
+	return obj
+}
+
+func parseDedupRef(metadata map[string]string) (*dedupRef, error) {
+	hash := metadata[dedupMetaHash]
+	if hash == "" {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(metadata[dedupMetaSize], 10, 64)
+	if err != nil || len(hash) != sha256.Size*2 {
+		return nil, errors.New("无效的去重引用")
+	}
+	return &dedupRef{hash: hash, size: size, etag: metadata[dedupMetaETag]}, nil
+}
+
+// hashContent 计算内容的 SHA-256、MD5 和长度
+func hashContent(content io.Reader) (*dedupRef, error) {
+	sha := sha256.New()
+	sum := md5.New()
+	size, err := io.Copy(io.MultiWriter(sha, sum), content)
+	if err != nil {
+		return nil, err
+	}
+	return &dedupRef{
+		hash: hex.EncodeToString(sha.Sum(nil)),
+		size: size,
+		etag: hex.EncodeToString(sum.Sum(nil)),
+	}, nil
+}
+
+// dedupable 是否对 key 去重：文件夹标记和 system/ 下的内部对象不去重
+func dedupable(key string) bool {
+	return !strings.HasSuffix(key, "/") && !strings.HasPrefix(key, "system/")
+}
+
+// dedupInternal 去重使用的内部对象，列举时隐藏
+func dedupInternal(key string) bool {
+	for _, prefix := range []string{dedupBlobPrefix, dedupRefPrefix, dedupStagingPrefix} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func blobKey(hash string) string {
+	return dedupBlobPrefix + hash[:2] + "/" + hash
+}
+
+func refKey(hash, key string) string {
+	return dedupRefPrefix + hash + "/" + key
+}
+
+func stagingKey(key, id string) string {
+	return dedupStagingPrefix + "multipart/" + id + "/" + key
+}
+
+// dedupIDLength 暂存ID的长度（16字节的十六进制）
+const dedupIDLength = 32
+
+func newDedupID() (string, error) {
+	buf := make([]byte, dedupIDLength/2)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成暂存ID失败: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// dedupPresigner 预签名上传写入暂存对象，完成后由 AdoptStagedObject 转为去重的内容和引用；预签名下载指向引用的内容
+type dedupPresigner struct {
+	d         *DedupStore
+	presigner Presigner
+}
+
+func (p dedupPresigner) PresignPutObject(key string, expires time.Duration, contentType string, contentLength int64) (*PresignedRequest, error) {
+	if !dedupable(key) {
+		return p.presigner.PresignPutObject(key, expires, contentType, contentLength)
+	}
+	id, err := newDedupID()
+	if err != nil {
+		return nil, err
+	}
+	staged := dedupStagingPrefix + "presign/" + id + "/" + key
+	request, err := p.presigner.PresignPutObject(staged, expires, contentType, contentLength)
+	if err != nil {
+		return nil, err
+	}
+	request.StagingKey = staged
+	return request, nil
+}
+
+func (p dedupPresigner) PresignGetObject(key string, expires time.Duration, filename string) (*PresignedRequest, error) {
+	ref, err := p.d.refOf(key)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return p.presigner.PresignGetObject(key, expires, filename)
+	}
+	if filename == "" {
+		filename = path.Base(key)
+	}
+	return p.presigner.PresignGetObject(blobKey(ref.hash), expires, filename)
+}
+
+// dedupProcessor 对引用的内容做处理
+type dedupProcessor struct {
+	d         *DedupStore
+	processor ProcessedObjectGetter
+}
+
+func (p dedupProcessor) GetProcessedObject(key string, process string) (io.ReadCloser, int64, string, error) {
+	ref, err := p.d.refOf(key)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if ref == nil {
+		return p.processor.GetProcessedObject(key, process)
+	}
+	return p.processor.GetProcessedObject(blobKey(ref.hash), process)
+}
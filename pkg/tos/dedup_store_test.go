@@ -0,0 +1,342 @@
+package tos
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDedupStoreConformance(t *testing.T) {
+	testObjectStoreConformance(t, NewDedupStore(NewMemoryStore()))
+	testMultipartConformance(t, NewDedupStore(NewMemoryStore()).(*DedupStore))
+}
+
+// blobCount 返回后端中保存的内容对象数量
+func blobCount(t *testing.T, backend ObjectStore) int {
+	t.Helper()
+	objects, err := ListAllObjects(backend, dedupBlobPrefix)
+	if err != nil {
+		t.Fatalf("列举内容对象失败: %v", err)
+	}
+	return len(objects)
+}
+
+func readObject(t *testing.T, store ObjectStore, key string) string {
+	t.Helper()
+	reader, _, _, err := store.GetObject(key)
+	if err != nil {
+		t.Fatalf("GetObject(%q) 失败: %v", key, err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	return string(data)
+}
+
+func TestDedupStoreSharesContent(t *testing.T) {
+	backend := NewMemoryStore()
+	store := NewDedupStore(backend).(*DedupStore)
+	installer := strings.Repeat("installer", 1000)
+
+	// 可 Seek 的内容和长度未知的流式内容得到同一份内容对象
+	if err := store.PutObject("users/a/setup.exe", strings.NewReader(installer), int64(len(installer)), "", nil); err != nil {
+		t.Fatalf("PutObject 失败: %v", err)
+	}
+	if err := store.PutObject("users/b/tools/setup.exe", io.MultiReader(strings.NewReader(installer)), -1, "", nil); err != nil {
+		t.Fatalf("流式 PutObject 失败: %v", err)
+	}
+	if err := store.CopyObject("users/a/setup.exe", "users/a/backup/setup.exe"); err != nil {
+		t.Fatalf("CopyObject 失败: %v", err)
+	}
+	if n := blobCount(t, backend); n != 1 {
+		t.Fatalf("内容对象数量 = %d, want 1", n)
+	}
+
+	info, err := store.HeadObject("users/a/backup/setup.exe")
+	if err != nil {
+		t.Fatalf("HeadObject 失败: %v", err)
+	}
+	if info.Size != int64(len(installer)) || info.ContentHash == "" || info.Metadata[dedupMetaHash] != "" {
+		t.Errorf("HeadObject = %+v", info)
+	}
+	if count, _ := store.RefCount(info.ContentHash); count != 3 {
+		t.Errorf("引用计数 = %d, want 3", count)
+	}
+	if got := readObject(t, store, "users/b/tools/setup.exe"); got != installer {
+		t.Errorf("读取到 %d 字节", len(got))
+	}
+	reader, err := GetObjectRange(store, "users/a/backup/setup.exe", 9, 9)
+	if err != nil {
+		t.Fatalf("GetObjectRange 失败: %v", err)
+	}
+	if data, _ := io.ReadAll(reader); string(data) != "installer" {
+		t.Errorf("GetObjectRange = %q", data)
+	}
+	reader.Close()
+
+	// 列举时隐藏内部对象，大小为内容的大小
+	output, err := store.ListObjects(&ListObjectsInput{})
+	if err != nil {
+		t.Fatalf("ListObjects 失败: %v", err)
+	}
+	if keys := objectKeys(output.Objects); strings.Join(keys, ",") != "users/a/backup/setup.exe,users/a/setup.exe,users/b/tools/setup.exe" {
+		t.Errorf("ListObjects = %v", keys)
+	}
+	for _, obj := range output.Objects {
+		if obj.Size != int64(len(installer)) || obj.ContentHash != info.ContentHash || obj.ETag != info.ETag {
+			t.Errorf("列举结果 = %+v", obj)
+		}
+	}
+
+	// 覆盖和删除只减少引用计数，最后一个引用删除时删除内容
+	if err := store.PutObject("users/a/setup.exe", strings.NewReader("v2"), 2, "", nil); err != nil {
+		t.Fatalf("覆盖失败: %v", err)
+	}
+	store.DeleteObject("users/b/tools/setup.exe")
+	if n := blobCount(t, backend); n != 2 {
+		t.Errorf("内容对象数量 = %d, want 2", n)
+	}
+	if got := readObject(t, store, "users/a/backup/setup.exe"); got != installer {
+		t.Errorf("剩余引用读取到 %d 字节", len(got))
+	}
+	store.DeleteObject("users/a/backup/setup.exe")
+	if count, _ := store.RefCount(info.ContentHash); count != 0 {
+		t.Errorf("引用计数 = %d, want 0", count)
+	}
+	if n := blobCount(t, backend); n != 1 {
+		t.Errorf("删除最后一个引用后内容对象数量 = %d, want 1", n)
+	}
+
+	// 用相同内容覆盖不改变引用计数
+	v2, _ := store.HeadObject("users/a/setup.exe")
+	store.PutObject("users/a/setup.exe", strings.NewReader("v2"), 2, "", nil)
+	if count, _ := store.RefCount(v2.ContentHash); count != 1 {
+		t.Errorf("相同内容覆盖后引用计数 = %d, want 1", count)
+	}
+}
+
+// slowStore 写入前等待片刻，放大并发操作之间的时间窗口
+type slowStore struct {
+	*MemoryStore
+}
+
+func (s slowStore) PutObject(key string, content io.Reader, size int64, contentType string, metadata map[string]string) error {
+	time.Sleep(time.Millisecond)
+	return s.MemoryStore.PutObject(key, content, size, contentType, metadata)
+}
+
+func TestDedupStoreConcurrentWrites(t *testing.T) {
+	backend := NewMemoryStore()
+	store := NewDedupStore(slowStore{backend}).(*DedupStore)
+	key := "users/a/report.txt"
+	contents := []string{"v1", "v2", "v3", "v4"}
+
+	// 并发覆盖同一个键，最后只剩当前内容的引用，内容对象不会被误删或泄漏
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(content string) {
+			defer wg.Done()
+			if err := store.PutObject(key, strings.NewReader(content), int64(len(content)), "", nil); err != nil {
+				t.Errorf("PutObject 失败: %v", err)
+			}
+		}(contents[i%len(contents)])
+	}
+	wg.Wait()
+
+	info, err := store.HeadObject(key)
+	if err != nil {
+		t.Fatalf("HeadObject 失败: %v", err)
+	}
+	if got := readObject(t, store, key); len(got) != 2 {
+		t.Errorf("读取到 %q", got)
+	}
+	refs, _ := ListAllObjects(backend, dedupRefPrefix)
+	if len(refs) != 1 || refs[0].Key != refKey(info.ContentHash, key) {
+		t.Errorf("引用计数对象 = %v", objectKeys(refs))
+	}
+	if n := blobCount(t, backend); n != 1 {
+		t.Errorf("内容对象数量 = %d, want 1", n)
+	}
+
+	// 同一个键的多个分片上传使用各自的暂存对象
+	first, err := store.CreateMultipartUpload(key, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload 失败: %v", err)
+	}
+	second, err := store.CreateMultipartUpload(key, "text/plain", nil)
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload 失败: %v", err)
+	}
+	firstPart, err := store.UploadPart(key, first, 1, strings.NewReader("first"), 5)
+	if err != nil {
+		t.Fatalf("UploadPart 失败: %v", err)
+	}
+	secondPart, err := store.UploadPart(key, second, 1, strings.NewReader("second"), 6)
+	if err != nil {
+		t.Fatalf("UploadPart 失败: %v", err)
+	}
+	if err := store.CompleteMultipartUpload(key, second, []UploadedPart{*secondPart}); err != nil {
+		t.Fatalf("CompleteMultipartUpload 失败: %v", err)
+	}
+	if got := readObject(t, store, key); got != "second" {
+		t.Errorf("完成第二个上传后读取到 %q", got)
+	}
+	if err := store.CompleteMultipartUpload(key, first, []UploadedPart{*firstPart}); err != nil {
+		t.Fatalf("CompleteMultipartUpload 失败: %v", err)
+	}
+	if got := readObject(t, store, key); got != "first" {
+		t.Errorf("完成第一个上传后读取到 %q", got)
+	}
+	if staged, _ := ListAllObjects(backend, dedupStagingPrefix); len(staged) != 0 {
+		t.Errorf("暂存对象未删除: %v", objectKeys(staged))
+	}
+	if _, err := store.UploadPart(key, "unknown", 1, strings.NewReader("x"), 1); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("无效的上传ID err = %v", err)
+	}
+}
+
+func TestDedupStoreLegacyObjects(t *testing.T) {
+	backend := NewMemoryStore()
+	backend.PutObject("users/a/old.txt", strings.NewReader("legacy"), 6, "text/plain", nil)
+	// 内容恰好是64字节的普通对象不应被当作引用
+	hashLike := strings.Repeat("ab", 32)
+	backend.PutObject("users/a/hash.txt", strings.NewReader(hashLike), 64, "text/plain", nil)
+	store := NewDedupStore(backend)
+
+	if got := readObject(t, store, "users/a/old.txt"); got != "legacy" {
+		t.Errorf("读取开启去重前的对象 = %q", got)
+	}
+	output, err := store.ListObjects(&ListObjectsInput{Prefix: "users/a/"})
+	if err != nil {
+		t.Fatalf("ListObjects 失败: %v", err)
+	}
+	for _, obj := range output.Objects {
+		if obj.ContentHash != "" {
+			t.Errorf("普通对象 %s 不应有内容哈希", obj.Key)
+		}
+	}
+
+	// 复制普通对象得到普通对象，删除不影响其他对象
+	if err := store.CopyObject("users/a/old.txt", "users/a/copy.txt"); err != nil {
+		t.Fatalf("CopyObject 失败: %v", err)
+	}
+	store.DeleteObject("users/a/old.txt")
+	if got := readObject(t, store, "users/a/copy.txt"); got != "legacy" {
+		t.Errorf("读取复制的对象 = %q", got)
+	}
+	if n := blobCount(t, backend); n != 0 {
+		t.Errorf("内容对象数量 = %d, want 0", n)
+	}
+	if _, err := store.HeadObject("users/a/old.txt"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("删除后 HeadObject err = %v", err)
+	}
+}
+
+func TestDedupStoreCapabilities(t *testing.T) {
+	if _, ok := NewDedupStore(NewMemoryStore()).(Presigner); ok {
+		t.Error("后端不支持预签名时去重存储也不应支持")
+	}
+
+	store := NewDedupStore(fakePresignStore{NewMemoryStore()})
+	presigner, ok := store.(Presigner)
+	if !ok {
+		t.Fatal("去重存储应保留后端的预签名能力")
+	}
+	store.PutObject("users/a/report.pdf", bytes.NewReader([]byte("pdf")), 3, "", nil)
+	info, _ := store.HeadObject("users/a/report.pdf")
+	request, err := presigner.PresignGetObject("users/a/report.pdf", time.Minute, "")
+	if err != nil {
+		t.Fatalf("PresignGetObject 失败: %v", err)
+	}
+	if request.URL != "https://example.com/"+blobKey(info.ContentHash)+"?filename=report.pdf" {
+		t.Errorf("预签名下载应指向内容对象: %s", request.URL)
+	}
+}
+
+func TestDedupStorePresignedOverwrite(t *testing.T) {
+	backend := NewMemoryStore()
+	store := NewDedupStore(fakePresignStore{backend})
+	shared := strings.Repeat("shared", 100)
+	store.PutObject("users/a/report.pdf", strings.NewReader(shared), int64(len(shared)), "", nil)
+	store.CopyObject("users/a/report.pdf", "users/a/copy.pdf")
+	old, _ := store.HeadObject("users/a/report.pdf")
+
+	// 预签名上传写入暂存对象，完成前原路径不变
+	request, err := store.(Presigner).PresignPutObject("users/a/report.pdf", time.Minute, "application/pdf", 2)
+	if err != nil {
+		t.Fatalf("PresignPutObject 失败: %v", err)
+	}
+	if !strings.HasPrefix(request.StagingKey, dedupStagingPrefix) || request.URL != "https://example.com/"+request.StagingKey {
+		t.Fatalf("预签名上传应写入暂存对象: %+v", request)
+	}
+	if err := backend.PutObject(request.StagingKey, strings.NewReader("v2"), 2, "application/pdf", nil); err != nil {
+		t.Fatalf("模拟客户端上传失败: %v", err)
+	}
+	if got := readObject(t, store, "users/a/report.pdf"); got != shared {
+		t.Errorf("完成前读取到 %q", got)
+	}
+
+	if err := AdoptStagedObject(store, "users/a/report.pdf", request.StagingKey); err != nil {
+		t.Fatalf("AdoptStagedObject 失败: %v", err)
+	}
+	if got := readObject(t, store, "users/a/report.pdf"); got != "v2" {
+		t.Errorf("完成后读取到 %q", got)
+	}
+	if err := AdoptStagedObject(store, "users/a/report.pdf", request.StagingKey); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("重复转换 err = %v", err)
+	}
+	if staged, _ := ListAllObjects(backend, dedupStagingPrefix); len(staged) != 0 {
+		t.Errorf("暂存对象未删除: %v", objectKeys(staged))
+	}
+
+	// 覆盖释放了原来的引用，删除另一个引用后内容对象被删除
+	if refs, _ := ListAllObjects(backend, dedupRefPrefix+old.ContentHash+"/"); len(refs) != 1 {
+		t.Errorf("覆盖后引用计数对象 = %v, want 1", objectKeys(refs))
+	}
+	store.DeleteObject("users/a/copy.pdf")
+	if _, err := backend.HeadObject(blobKey(old.ContentHash)); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("最后一个引用删除后内容对象应被删除: %v", err)
+	}
+}
+
+// fakePresignStore 为内存存储提供假的预签名能力
+type fakePresignStore struct {
+	*MemoryStore
+}
+
+func (fakePresignStore) PresignPutObject(key string, expires time.Duration, contentType string, contentLength int64) (*PresignedRequest, error) {
+	return &PresignedRequest{URL: "https://example.com/" + key}, nil
+}
+
+func (fakePresignStore) PresignGetObject(key string, expires time.Duration, filename string) (*PresignedRequest, error) {
+	return &PresignedRequest{URL: "https://example.com/" + key + "?filename=" + filename}, nil
+}
+
+func TestStorageStatsDedup(t *testing.T) {
+	store := NewDedupStore(NewMemoryStore())
+	for _, key := range []string{"users/a/1.iso", "users/a/2.iso", "users/b/3.iso"} {
+		store.PutObject(key, strings.NewReader("same-content"), 12, "", nil)
+	}
+	store.PutObject("users/b/other.txt", strings.NewReader("other"), 5, "", nil)
+
+	stats, err := GetStorageStats(store, "")
+	if err != nil {
+		t.Fatalf("GetStorageStats 失败: %v", err)
+	}
+	if stats.FileCount != 4 || stats.LogicalSize != 41 || stats.PhysicalSize != 17 || stats.UsedSpace != 41 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// 只统计前缀下的对象
+	stats, err = GetStorageStats(store, "users/b/")
+	if err != nil {
+		t.Fatalf("GetStorageStats 失败: %v", err)
+	}
+	if stats.FileCount != 2 || stats.LogicalSize != 17 || stats.PhysicalSize != 17 {
+		t.Errorf("users/b/ stats = %+v", stats)
+	}
+}
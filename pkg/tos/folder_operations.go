@@ -0,0 +1,226 @@
+package tos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"bkp-drive/internal/models"
+)
+
+// 文件夹操作错误
+var (
+	// ErrEmptyFolderPrefix 文件夹前缀为空，拒绝对整个存储空间操作
+	ErrEmptyFolderPrefix = errors.New("文件夹路径不能为空")
+	// ErrFolderIntoItself 目标位于源文件夹内部
+	ErrFolderIntoItself = errors.New("不能将文件夹移动或复制到其自身或子文件夹中")
+)
+
+// SnapshotFunc 覆盖 key 之前调用，用于保存即将被覆盖的内容（如历史版本）
+type SnapshotFunc func(key string) error
+
+// beforeOverwrite 将 sourceKey 写入 destKey 之前调用 snapshot，snapshot 为 nil 或源和目标相同时什么都不做
+func beforeOverwrite(snapshot SnapshotFunc, sourceKey, destKey string) error {
+	if snapshot == nil || sourceKey == destKey {
+		return nil
+	}
+	return snapshot(destKey)
+}
+
+// FolderPrefix 将文件夹路径规范化为以 / 结尾的前缀
+func FolderPrefix(folder string) string {
+	return strings.TrimSuffix(folder, "/") + "/"
+}
+
+// IsFolder 判断对象键是否表示文件夹：以 / 结尾，或者没有同名对象但存在以 key/ 为前缀的对象
+func IsFolder(store ObjectStore, key string) (bool, error) {
+	if strings.HasSuffix(key, "/") {
+		return true, nil
+	}
+	if _, err := store.HeadObject(key); err == nil {
+		return false, nil
+	} else if !errors.Is(err, ErrObjectNotFound) {
+		return false, err
+	}
+
+	output, err := store.ListObjects(&ListObjectsInput{Prefix: key + "/", MaxKeys: 1})
+	if err != nil {
+		return false, err
+	}
+	return len(output.Objects) > 0, nil
+}
+
+// ListAllObjects 逐页列出前缀下的所有对象（不使用分隔符，包含文件夹标记对象）
+func ListAllObjects(store ObjectStore, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	input := &ListObjectsInput{Prefix: prefix}
+	for {
+		output, err := store.ListObjects(input)
+		if err != nil {
+			return nil, fmt.Errorf("列出文件夹内容失败: %w", err)
+		}
+		objects = append(objects, output.Objects...)
+		if !output.IsTruncated {
+			return objects, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// DeleteFolder 递归删除文件夹下的所有对象，文件夹标记对象最后删除
+// 部分失败时文件夹和失败的对象保留，重试只会处理剩余的对象
+func DeleteFolder(store ObjectStore, folder string) (*models.BatchOperationResponse, error) {
+	if strings.Trim(folder, "/") == "" {
+		return nil, ErrEmptyFolderPrefix
+	}
+	prefix := FolderPrefix(folder)
+
+	objects, err := ListAllObjects(store, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &folderResult{}
+	hasMarker := false
+	for _, obj := range objects {
+		if obj.Key == prefix {
+			hasMarker = true
+			continue
+		}
+		result.record(obj.Key, store.DeleteObject(obj.Key))
+	}
+	if hasMarker && result.failed == 0 {
+		result.record(prefix, store.DeleteObject(prefix))
+	}
+
+	return result.response("删除文件夹"), nil
+}
+
+// CopyFolder 递归复制文件夹，目标中已存在的同名对象会被覆盖（覆盖前调用 snapshot），因此可以安全重试
+func CopyFolder(store ObjectStore, sourceFolder, destFolder string, snapshot SnapshotFunc) (*models.BatchOperationResponse, error) {
+	source, dest, err := folderPair(sourceFolder, destFolder)
+	if err != nil {
+		return nil, err
+	}
+	if source == dest {
+		return nil, ErrFolderIntoItself
+	}
+
+	objects, err := ListAllObjects(store, source)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &folderResult{}
+	for _, obj := range objects {
+		result.record(obj.Key, copyFolderObject(store, obj.Key, dest+strings.TrimPrefix(obj.Key, source), snapshot))
+	}
+
+	return result.response("复制文件夹"), nil
+}
+
+// MoveFolder 递归移动文件夹（用于移动和重命名）
+// 每个对象复制成功后才删除源对象，源文件夹标记在其他对象全部移动后才删除，
+// 部分失败后重试只会处理仍留在源文件夹中的对象；目标中已存在的同名对象覆盖前调用 snapshot
+func MoveFolder(store ObjectStore, sourceFolder, destFolder string, snapshot SnapshotFunc) (*models.BatchOperationResponse, error) {
+	source, dest, err := folderPair(sourceFolder, destFolder)
+	if err != nil {
+		return nil, err
+	}
+	if source == dest {
+		return (&folderResult{}).response("移动文件夹"), nil
+	}
+
+	objects, err := ListAllObjects(store, source)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &folderResult{}
+	hasMarker := false
+	for _, obj := range objects {
+		if obj.Key == source {
+			hasMarker = true
+			continue
+		}
+		result.record(obj.Key, moveFolderObject(store, obj.Key, dest+strings.TrimPrefix(obj.Key, source), snapshot))
+	}
+
+	if hasMarker {
+		// 部分失败时仍创建目标文件夹，并保留源文件夹，剩余的对象在源文件夹中可见
+		err := store.CopyObject(source, dest)
+		if err == nil && result.failed == 0 {
+			err = store.DeleteObject(source)
+		}
+		result.record(source, err)
+	}
+
+	return result.response("移动文件夹"), nil
+}
+
+// copyFolderObject 保存目标的当前内容后复制
+func copyFolderObject(store ObjectStore, sourceKey, destKey string, snapshot SnapshotFunc) error {
+	if err := beforeOverwrite(snapshot, sourceKey, destKey); err != nil {
+		return err
+	}
+	return store.CopyObject(sourceKey, destKey)
+}
+
+// moveFolderObject 复制后删除源对象；删除失败时保留已复制的目标，重试时会再次覆盖
+func moveFolderObject(store ObjectStore, sourceKey, destKey string, snapshot SnapshotFunc) error {
+	if err := copyFolderObject(store, sourceKey, destKey, snapshot); err != nil {
+		return err
+	}
+	return store.DeleteObject(sourceKey)
+}
+
+// folderPair 规范化源和目标前缀，拒绝空路径和目标位于源内部的情况
+func folderPair(sourceFolder, destFolder string) (string, string, error) {
+	if strings.Trim(sourceFolder, "/") == "" || strings.Trim(destFolder, "/") == "" {
+		return "", "", ErrEmptyFolderPrefix
+	}
+	source := FolderPrefix(sourceFolder)
+	dest := FolderPrefix(destFolder)
+	if dest != source && strings.HasPrefix(dest, source) {
+		return "", "", ErrFolderIntoItself
+	}
+	return source, dest, nil
+}
+
+// folderResult 汇总文件夹操作中每个对象的结果
+type folderResult struct {
+	processed   int
+	failed      int
+	failedItems []string
+}
+
+func (r *folderResult) record(key string, err error) {
+	if err != nil {
+		r.failed++
+		r.failedItems = append(r.failedItems, key)
+		return
+	}
+	r.processed++
+}
+
+// merge 合并一个文件夹操作的结果，整个文件夹操作失败时记为一个失败项
+func (r *folderResult) merge(folder string, result *models.BatchOperationResponse, err error) {
+	if err != nil {
+		r.record(folder, err)
+		return
+	}
+	r.processed += result.Processed
+	r.failed += result.Failed
+	r.failedItems = append(r.failedItems, result.FailedItems...)
+}
+
+func (r *folderResult) response(operation string) *models.BatchOperationResponse {
+	return &models.BatchOperationResponse{
+		Success:     r.failed == 0,
+		Message:     fmt.Sprintf("%s完成，成功: %d, 失败: %d", operation, r.processed, r.failed),
+		Processed:   r.processed,
+		Failed:      r.failed,
+		FailedItems: r.failedItems,
+	}
+}
@@ -0,0 +1,181 @@
+package tos
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// flakyStore 对指定的源对象模拟复制或删除失败
+type flakyStore struct {
+	*MemoryStore
+	failCopy   map[string]bool
+	failDelete map[string]bool
+}
+
+func (s *flakyStore) CopyObject(sourceKey, destKey string) error {
+	if s.failCopy[sourceKey] {
+		return errors.New("模拟复制失败")
+	}
+	return s.MemoryStore.CopyObject(sourceKey, destKey)
+}
+
+func (s *flakyStore) DeleteObject(key string) error {
+	if s.failDelete[key] {
+		return errors.New("模拟删除失败")
+	}
+	return s.MemoryStore.DeleteObject(key)
+}
+
+func allKeys(t *testing.T, store ObjectStore, prefix string) []string {
+	t.Helper()
+	objects, err := ListAllObjects(store, prefix)
+	if err != nil {
+		t.Fatalf("ListAllObjects 失败: %v", err)
+	}
+	keys := objectKeys(objects)
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDeleteFolder(t *testing.T) {
+	store := NewMemoryStore()
+	putTestObjects(t, store, "docs/", "docs/a.txt", "docs/sub/", "docs/sub/b.txt", "docs-other.txt")
+
+	result, err := DeleteFolder(store, "docs")
+	if err != nil {
+		t.Fatalf("DeleteFolder 失败: %v", err)
+	}
+	if !result.Success || result.Processed != 4 {
+		t.Errorf("DeleteFolder = %+v", result)
+	}
+	if got := allKeys(t, store, ""); !reflect.DeepEqual(got, []string{"docs-other.txt"}) {
+		t.Errorf("剩余对象 = %v", got)
+	}
+
+	if _, err := DeleteFolder(store, "/"); !errors.Is(err, ErrEmptyFolderPrefix) {
+		t.Errorf("DeleteFolder(/) err = %v, want ErrEmptyFolderPrefix", err)
+	}
+}
+
+func TestDeleteFolderRetry(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failDelete: map[string]bool{"docs/b.txt": true}}
+	putTestObjects(t, store, "docs/", "docs/a.txt", "docs/b.txt")
+
+	result, err := DeleteFolder(store, "docs/")
+	if err != nil {
+		t.Fatalf("DeleteFolder 失败: %v", err)
+	}
+	if result.Success || result.Processed != 1 || !reflect.DeepEqual(result.FailedItems, []string{"docs/b.txt"}) {
+		t.Errorf("DeleteFolder = %+v", result)
+	}
+	// 部分失败时保留文件夹标记，文件夹仍然可见
+	if got := allKeys(t, store, ""); !reflect.DeepEqual(got, []string{"docs/", "docs/b.txt"}) {
+		t.Errorf("剩余对象 = %v", got)
+	}
+
+	store.failDelete = nil
+	result, err = DeleteFolder(store, "docs/")
+	if err != nil || !result.Success || result.Processed != 2 {
+		t.Fatalf("重试 DeleteFolder = %+v, %v", result, err)
+	}
+	if got := allKeys(t, store, ""); len(got) != 0 {
+		t.Errorf("剩余对象 = %v", got)
+	}
+}
+
+func TestCopyFolder(t *testing.T) {
+	store := NewMemoryStore()
+	putTestObjects(t, store, "docs/", "docs/a.txt", "docs/sub/b.txt")
+
+	result, err := CopyFolder(store, "docs/", "backup/docs", nil)
+	if err != nil || !result.Success || result.Processed != 3 {
+		t.Fatalf("CopyFolder = %+v, %v", result, err)
+	}
+	want := []string{"backup/docs/", "backup/docs/a.txt", "backup/docs/sub/b.txt"}
+	if got := allKeys(t, store, "backup/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("复制结果 = %v, want %v", got, want)
+	}
+	if got := allKeys(t, store, "docs/"); len(got) != 3 {
+		t.Errorf("源文件夹 = %v", got)
+	}
+
+	// 重复复制覆盖已存在的对象，覆盖前调用 snapshot
+	var snapshots []string
+	snapshot := func(key string) error {
+		snapshots = append(snapshots, key)
+		return nil
+	}
+	if result, err := CopyFolder(store, "docs/", "backup/docs/", snapshot); err != nil || !result.Success {
+		t.Errorf("重复 CopyFolder = %+v, %v", result, err)
+	}
+	sort.Strings(snapshots)
+	if !reflect.DeepEqual(snapshots, want) {
+		t.Errorf("snapshot 调用 = %v, want %v", snapshots, want)
+	}
+
+	// snapshot 失败的对象不会被覆盖
+	putTestObjects(t, store, "docs/c.txt")
+	result, err = CopyFolder(store, "docs/", "backup/docs/", func(key string) error {
+		if key == "backup/docs/a.txt" {
+			return errors.New("模拟保存版本失败")
+		}
+		return nil
+	})
+	if err != nil || result.Success || result.Failed != 1 || !reflect.DeepEqual(result.FailedItems, []string{"docs/a.txt"}) {
+		t.Errorf("snapshot 失败时 CopyFolder = %+v, %v", result, err)
+	}
+
+	for _, dest := range []string{"docs", "docs/sub/copy"} {
+		if _, err := CopyFolder(store, "docs/", dest, nil); !errors.Is(err, ErrFolderIntoItself) {
+			t.Errorf("CopyFolder(docs/, %s) err = %v, want ErrFolderIntoItself", dest, err)
+		}
+	}
+}
+
+func TestMoveFolderRetry(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failCopy: map[string]bool{"docs/sub/b.txt": true}}
+	putTestObjects(t, store, "docs/", "docs/a.txt", "docs/sub/b.txt", "docsx/c.txt")
+
+	result, err := MoveFolder(store, "docs/", "archive/docs/", nil)
+	if err != nil {
+		t.Fatalf("MoveFolder 失败: %v", err)
+	}
+	if result.Success || result.Failed != 1 || !reflect.DeepEqual(result.FailedItems, []string{"docs/sub/b.txt"}) {
+		t.Errorf("MoveFolder = %+v", result)
+	}
+	// 失败的对象和源文件夹标记留在原处，目标文件夹已创建
+	if got := allKeys(t, store, "docs/"); !reflect.DeepEqual(got, []string{"docs/", "docs/sub/b.txt"}) {
+		t.Errorf("源文件夹 = %v", got)
+	}
+	if got := allKeys(t, store, "archive/"); !reflect.DeepEqual(got, []string{"archive/docs/", "archive/docs/a.txt"}) {
+		t.Errorf("目标文件夹 = %v", got)
+	}
+
+	store.failCopy = nil
+	result, err = MoveFolder(store, "docs/", "archive/docs/", nil)
+	if err != nil || !result.Success || result.Processed != 2 {
+		t.Fatalf("重试 MoveFolder = %+v, %v", result, err)
+	}
+	want := []string{"archive/docs/", "archive/docs/a.txt", "archive/docs/sub/b.txt", "docsx/c.txt"}
+	if got := allKeys(t, store, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("移动结果 = %v, want %v", got, want)
+	}
+
+	if _, err := MoveFolder(store, "archive/", "archive/docs/inner", nil); !errors.Is(err, ErrFolderIntoItself) {
+		t.Errorf("MoveFolder 到子文件夹 err = %v, want ErrFolderIntoItself", err)
+	}
+}
+
+func TestIsFolder(t *testing.T) {
+	store := NewMemoryStore()
+	putTestObjects(t, store, "a.txt", "implicit/b.txt")
+
+	for key, want := range map[string]bool{"a.txt": false, "implicit": true, "missing": false, "missing/": true} {
+		got, err := IsFolder(store, key)
+		if err != nil || got != want {
+			t.Errorf("IsFolder(%q) = %v, %v, want %v", key, got, err, want)
+		}
+	}
+}
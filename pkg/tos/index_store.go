@@ -0,0 +1,327 @@
+package tos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/fulltext"
+)
+
+// MetaTags 对象的标签，保存在自定义元数据中，多个标签以逗号分隔
+const MetaTags = "tags"
+
+// MetadataIndex 对象元数据索引，由 IndexedStore 在每次写入后更新，列举、搜索和统计直接查询索引
+type MetadataIndex interface {
+	// PutObject 新增或更新对象的记录
+	PutObject(info ObjectInfo) error
+	// DeleteObject 删除对象的记录，记录不存在时不报错
+	DeleteObject(key string) error
+	// ListObjects 与 ObjectStore.ListObjects 的前缀、分隔符和分页语义一致
+	ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error)
+	// SearchObjects 在 req.Folder 下按 req 的条件搜索文件（不含文件夹标记），按 req.Sort 排序（未指定或相同时按键排序），最多返回 limit 个
+	SearchObjects(req *models.SearchRequest, limit int) ([]ObjectInfo, error)
+	// StorageStats 统计 prefix 下的文件和文件夹
+	StorageStats(prefix string) (*models.StorageStats, error)
+}
+
+// ContentIndex 支持全文检索的元数据索引，IndexedStore 更新记录时同时保存从文件中提取的文本
+type ContentIndex interface {
+	// PutContent 保存对象的文本，text 为空表示没有可检索的内容
+	PutContent(key, text string) error
+	// SearchContent 在 req.Folder 下搜索内容匹配 req.Query 且符合 req 其他条件的文件，按 req.Sort 或相关度排序，最多返回 limit 个
+	SearchContent(req *models.SearchRequest, limit int) ([]ContentMatch, error)
+}
+
+// ContentMatch 全文检索的结果
+type ContentMatch struct {
+	ObjectInfo
+	Score   float64
+	Snippet string // 匹配内容的摘要，匹配词以 fulltext.MarkStart 和 fulltext.MarkEnd 标记
+}
+
+// IndexedStore 在存储之上维护元数据索引：写入、复制、删除和完成分片上传成功后更新 prefix 下对象的记录，
+// 列举 prefix 下的对象时查询索引，SearchObjects 和 GetStorageStats 也优先使用索引
+type IndexedStore struct {
+	store            ObjectStore
+	index            MetadataIndex
+	prefix           string
+	metadataPrefixes []string // 只索引元数据、不提取文本的前缀
+}
+
+// indexedStore 带元数据索引的存储，包括包装了 IndexedStore 的匿名结构体
+type indexedStore interface {
+	indexFor(prefix string) MetadataIndex
+	indexObject(key string) error
+}
+
+// NewIndexedStore 只索引 prefix 和 metadataPrefixes 下的对象，metadataPrefixes 下的对象不提取文本，
+// 用于回收站、历史版本等只需统计占用空间的对象；返回的存储保留后端的预签名和内容处理能力
+func NewIndexedStore(store ObjectStore, index MetadataIndex, prefix string, metadataPrefixes ...string) ObjectStore {
+	s := &IndexedStore{
+		store:            store,
+		index:            index,
+		prefix:           prefix,
+		metadataPrefixes: metadataPrefixes,
+	}
+
+	presigner, canPresign := store.(Presigner)
+	processor, canProcess := store.(ProcessedObjectGetter)
+	switch {
+	case canPresign && canProcess:
+		return struct {
+			*IndexedStore
+			Presigner
+			ProcessedObjectGetter
+		}{s, presigner, processor}
+	case canPresign:
+		return struct {
+			*IndexedStore
+			Presigner
+		}{s, presigner}
+	case canProcess:
+		return struct {
+			*IndexedStore
+			ProcessedObjectGetter
+		}{s, processor}
+	}
+	return s
+}
+
+// IndexObject 存储带元数据索引时按存储中的对象更新 key 的记录，
+// 用于预签名直传等绕过本服务写入的对象，没有索引时什么都不做
+func IndexObject(store ObjectStore, key string) error {
+	if indexed, ok := store.(indexedStore); ok {
+		return indexed.indexObject(key)
+	}
+	return nil
+}
+
+// metadataIndex 返回覆盖 prefix 的元数据索引，存储没有索引或 prefix 不在索引范围内时返回 nil
+func metadataIndex(store ObjectStore, prefix string) MetadataIndex {
+	if indexed, ok := store.(indexedStore); ok {
+		return indexed.indexFor(prefix)
+	}
+	return nil
+}
+
+// EnsureBucketExists 确保存储空间可用
+func (s *IndexedStore) EnsureBucketExists() error {
+	return s.store.EnsureBucketExists()
+}
+
+// PutObject 写入对象后更新索引
+func (s *IndexedStore) PutObject(key string, content io.Reader, size int64, contentType string, metadata map[string]string) error {
+	if err := s.store.PutObject(key, content, size, contentType, metadata); err != nil {
+		return err
+	}
+	return s.indexObject(key)
+}
+
+// GetObject 读取对象
+func (s *IndexedStore) GetObject(key string) (io.ReadCloser, int64, string, error) {
+	return s.store.GetObject(key)
+}
+
+// GetObjectRange 按字节范围读取对象
+func (s *IndexedStore) GetObjectRange(key string, offset, length int64) (io.ReadCloser, error) {
+	return GetObjectRange(s.store, key, offset, length)
+}
+
+// HeadObject 获取对象元信息，总是读取存储中的对象
+func (s *IndexedStore) HeadObject(key string) (*ObjectInfo, error) {
+	return s.store.HeadObject(key)
+}
+
+// ListObjects 列举对象，前缀在索引范围内时查询索引
+func (s *IndexedStore) ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error) {
+	if index := s.indexFor(input.Prefix); index != nil {
+		return index.ListObjects(input)
+	}
+	return s.store.ListObjects(input)
+}
+
+// DeleteObject 删除对象后删除索引中的记录
+func (s *IndexedStore) DeleteObject(key string) error {
+	if err := s.store.DeleteObject(key); err != nil {
+		return err
+	}
+	if !s.indexed(key) {
+		return nil
+	}
+	if err := s.index.DeleteObject(key); err != nil {
+		return fmt.Errorf("更新元数据索引失败: %w", err)
+	}
+	return nil
+}
+
+// CopyObject 复制对象后更新目标对象的记录
+func (s *IndexedStore) CopyObject(sourceKey, destKey string) error {
+	if err := s.store.CopyObject(sourceKey, destKey); err != nil {
+		return err
+	}
+	return s.indexObject(destKey)
+}
+
+// SetContentType 修改对象的 Content-Type 后更新记录
+func (s *IndexedStore) SetContentType(key, contentType string) error {
+	if err := SetContentType(s.store, key, contentType); err != nil {
+		return err
+	}
+	return s.indexObject(key)
+}
+
+// AdoptStagedObject 将预签名上传的暂存对象转为 key 上的对象后更新记录
+func (s *IndexedStore) AdoptStagedObject(key, stagingKey string) error {
+	if err := AdoptStagedObject(s.store, key, stagingKey); err != nil {
+		return err
+	}
+	return s.indexObject(key)
+}
+
+// CreateMultipartUpload 创建分片上传任务
+func (s *IndexedStore) CreateMultipartUpload(key, contentType string, metadata map[string]string) (string, error) {
+	uploader, err := s.uploader()
+	if err != nil {
+		return "", err
+	}
+	return uploader.CreateMultipartUpload(key, contentType, metadata)
+}
+
+// UploadPart 上传一个分片
+func (s *IndexedStore) UploadPart(key, uploadID string, partNumber int, content io.Reader, size int64) (*UploadedPart, error) {
+	uploader, err := s.uploader()
+	if err != nil {
+		return nil, err
+	}
+	return uploader.UploadPart(key, uploadID, partNumber, content, size)
+}
+
+// ListParts 列出已上传的分片
+func (s *IndexedStore) ListParts(key, uploadID string) ([]UploadedPart, error) {
+	uploader, err := s.uploader()
+	if err != nil {
+		return nil, err
+	}
+	return uploader.ListParts(key, uploadID)
+}
+
+// CompleteMultipartUpload 合并分片后更新索引
+func (s *IndexedStore) CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error {
+	uploader, err := s.uploader()
+	if err != nil {
+		return err
+	}
+	if err := uploader.CompleteMultipartUpload(key, uploadID, parts); err != nil {
+		return err
+	}
+	return s.indexObject(key)
+}
+
+// AbortMultipartUpload 取消分片上传
+func (s *IndexedStore) AbortMultipartUpload(key, uploadID string) error {
+	uploader, err := s.uploader()
+	if err != nil {
+		return err
+	}
+	return uploader.AbortMultipartUpload(key, uploadID)
+}
+
+func (s *IndexedStore) uploader() (MultipartUploader, error) {
+	uploader, ok := s.store.(MultipartUploader)
+	if !ok {
+		return nil, errors.New("存储后端不支持分片上传")
+	}
+	return uploader, nil
+}
+
+// indexed 判断 key 是否在索引范围内
+func (s *IndexedStore) indexed(key string) bool {
+	if strings.HasPrefix(key, s.prefix) {
+		return true
+	}
+	for _, prefix := range s.metadataPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *IndexedStore) indexFor(prefix string) MetadataIndex {
+	if !s.indexed(prefix) {
+		return nil
+	}
+	return s.index
+}
+
+// indexObject 读取存储中的对象更新记录，对象已不存在时删除记录
+func (s *IndexedStore) indexObject(key string) error {
+	if !s.indexed(key) {
+		return nil
+	}
+
+	info, err := s.store.HeadObject(key)
+	switch {
+	case err == nil:
+		return putRecord(s.store, s.index, *info, strings.HasPrefix(key, s.prefix))
+	case errors.Is(err, ErrObjectNotFound):
+		err = s.index.DeleteObject(key)
+	default:
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("更新元数据索引失败: %w", err)
+	}
+	return nil
+}
+
+// putRecord 保存对象的记录，withContent 为 true 且索引支持全文检索时同时保存从文件中提取的文本
+func putRecord(store ObjectStore, index MetadataIndex, info ObjectInfo, withContent bool) error {
+	if err := index.PutObject(info); err != nil {
+		return fmt.Errorf("更新元数据索引失败: %w", err)
+	}
+	contents, ok := index.(ContentIndex)
+	if !ok || !withContent {
+		return nil
+	}
+
+	text := ""
+	if fulltext.Extractable(ObjectContentType(info), info.Key, info.Size) {
+		content, _, _, err := store.GetObject(info.Key)
+		if err != nil {
+			return fmt.Errorf("读取文件内容失败: %w", err)
+		}
+		// 无法解析的文件（如损坏的 PDF）不影响写入，只是无法按内容搜索
+		text, _ = fulltext.Extract(content, ObjectContentType(info), info.Key)
+		content.Close()
+	}
+	if err := contents.PutContent(info.Key, text); err != nil {
+		return fmt.Errorf("更新元数据索引失败: %w", err)
+	}
+	return nil
+}
+
+// contentIndex 返回覆盖 prefix 且支持全文检索的索引，没有时返回 nil
+func contentIndex(store ObjectStore, prefix string) ContentIndex {
+	contents, _ := metadataIndex(store, prefix).(ContentIndex)
+	return contents
+}
+
+// SupportsContentSearch 判断是否可以在 prefix 下按文件内容搜索
+func SupportsContentSearch(store ObjectStore, prefix string) bool {
+	return contentIndex(store, prefix) != nil
+}
+
+// ObjectTags 返回对象元数据中的标签
+func ObjectTags(obj ObjectInfo) []string {
+	var tags []string
+	for _, tag := range strings.Split(obj.Metadata[MetaTags], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
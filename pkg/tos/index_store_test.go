@@ -0,0 +1,140 @@
+package tos
+
+import (
+	"strings"
+	"testing"
+
+	"bkp-drive/internal/models"
+)
+
+func TestIndexedStoreConformance(t *testing.T) {
+	testObjectStoreConformance(t, NewIndexedStore(NewMemoryStore(), NewMemoryIndex(), ""))
+	testMultipartConformance(t, NewIndexedStore(NewMemoryStore(), NewMemoryIndex(), "").(*IndexedStore))
+}
+
+func TestIndexedStoreMaintainsIndex(t *testing.T) {
+	backend := NewMemoryStore()
+	index := NewMemoryIndex()
+	store := NewIndexedStore(backend, index, "users/")
+
+	indexedKeys := func(prefix string) string {
+		t.Helper()
+		output, err := index.ListObjects(&ListObjectsInput{Prefix: prefix})
+		if err != nil {
+			t.Fatalf("列举索引失败: %v", err)
+		}
+		return strings.Join(objectKeys(output.Objects), ",")
+	}
+
+	putTestObjects(t, store, "users/a/docs/report.pdf", "users/a/notes.md", "system/trash/a/x")
+	if err := store.CopyObject("users/a/notes.md", "users/a/docs/notes.md"); err != nil {
+		t.Fatalf("CopyObject 失败: %v", err)
+	}
+	if err := MoveObject(store, "users/a/docs/report.pdf", "users/a/report.pdf"); err != nil {
+		t.Fatalf("MoveObject 失败: %v", err)
+	}
+	uploadID, _ := store.(MultipartUploader).CreateMultipartUpload("users/a/big.bin", "", nil)
+	part, _ := store.(MultipartUploader).UploadPart("users/a/big.bin", uploadID, 1, strings.NewReader("big"), 3)
+	if err := store.(MultipartUploader).CompleteMultipartUpload("users/a/big.bin", uploadID, []UploadedPart{*part}); err != nil {
+		t.Fatalf("CompleteMultipartUpload 失败: %v", err)
+	}
+
+	// 只索引 prefix 下的对象
+	if got := indexedKeys(""); got != "users/a/big.bin,users/a/docs/notes.md,users/a/notes.md,users/a/report.pdf" {
+		t.Errorf("索引 = %s", got)
+	}
+	if objects, _ := ListAllObjects(store, "system/"); len(objects) != 1 {
+		t.Errorf("索引范围外的对象应从存储列举: %+v", objects)
+	}
+
+	// 绕过索引写入存储的对象在补充索引前不可见
+	backend.PutObject("users/a/direct.txt", strings.NewReader("direct"), 6, "", nil)
+	output, err := store.ListObjects(&ListObjectsInput{Prefix: "users/a/", Delimiter: "/"})
+	if err != nil {
+		t.Fatalf("ListObjects 失败: %v", err)
+	}
+	if got := strings.Join(objectKeys(output.Objects), ","); got != "users/a/big.bin,users/a/notes.md,users/a/report.pdf" {
+		t.Errorf("列举结果 = %s", got)
+	}
+	if strings.Join(output.CommonPrefixes, ",") != "users/a/docs/" {
+		t.Errorf("CommonPrefixes = %v", output.CommonPrefixes)
+	}
+	if err := IndexObject(store, "users/a/direct.txt"); err != nil {
+		t.Fatalf("IndexObject 失败: %v", err)
+	}
+
+	resp, err := SearchObjects(store, &models.SearchRequest{Folder: "users/a/", FileTypes: []string{"document"}})
+	if err != nil || !resp.Success {
+		t.Fatalf("SearchObjects 失败: %v %s", err, resp.Message)
+	}
+	var found []string
+	for _, r := range resp.Results {
+		found = append(found, r.Key)
+	}
+	if got := strings.Join(found, ","); got != "users/a/direct.txt,users/a/docs/notes.md,users/a/notes.md,users/a/report.pdf" {
+		t.Errorf("搜索结果 = %s", got)
+	}
+
+	stats, err := GetStorageStats(store, "users/a/")
+	if err != nil {
+		t.Fatalf("GetStorageStats 失败: %v", err)
+	}
+	if stats.FileCount != 5 || stats.CategoryStats["document"].FileCount != 4 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// 删除后记录随之删除，存储中已不存在的对象补充索引时删除记录
+	store.DeleteObject("users/a/notes.md")
+	backend.DeleteObject("users/a/direct.txt")
+	IndexObject(store, "users/a/direct.txt")
+	if got := indexedKeys("users/a/"); got != "users/a/big.bin,users/a/docs/notes.md,users/a/report.pdf" {
+		t.Errorf("删除后索引 = %s", got)
+	}
+}
+
+func TestIndexedStoreMetadataPrefixes(t *testing.T) {
+	backend := NewMemoryStore()
+	index := NewMemoryIndex()
+	store := NewIndexedStore(backend, index, "users/", "system/trash/")
+
+	for _, key := range []string{"users/a/notes.md", "system/trash/a/notes.md", "system/other/notes.md"} {
+		if err := store.PutObject(key, strings.NewReader("quarterly report"), 16, "text/markdown", nil); err != nil {
+			t.Fatalf("PutObject 失败: %v", err)
+		}
+	}
+	output, _ := index.ListObjects(&ListObjectsInput{})
+	if got := strings.Join(objectKeys(output.Objects), ","); got != "system/trash/a/notes.md,users/a/notes.md" {
+		t.Errorf("索引 = %s", got)
+	}
+
+	// 统计查询索引，绕过索引写入存储的对象不计入
+	backend.PutObject("system/trash/a/direct.bin", strings.NewReader("direct"), 6, "", nil)
+	stats, err := GetStorageStats(store, "system/trash/a/")
+	if err != nil {
+		t.Fatalf("GetStorageStats 失败: %v", err)
+	}
+	if stats.FileCount != 1 || stats.LogicalSize != 16 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// 只索引元数据的前缀不提取文本
+	matches, err := index.SearchContent(&models.SearchRequest{Query: "quarterly"}, 10)
+	if err != nil {
+		t.Fatalf("SearchContent 失败: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Key != "users/a/notes.md" {
+		t.Errorf("全文检索结果 = %+v", matches)
+	}
+}
+
+func TestIndexedStoreCapabilities(t *testing.T) {
+	if _, ok := NewIndexedStore(NewMemoryStore(), NewMemoryIndex(), "").(Presigner); ok {
+		t.Error("后端不支持预签名时带索引的存储也不应支持")
+	}
+	if _, ok := NewIndexedStore(fakePresignStore{NewMemoryStore()}, NewMemoryIndex(), "").(Presigner); !ok {
+		t.Error("带索引的存储应保留后端的预签名能力")
+	}
+	if err := IndexObject(NewMemoryStore(), "users/a/x"); err != nil {
+		t.Errorf("没有索引时 IndexObject 不应报错: %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package tos
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bkp-drive/internal/models"
+)
+
+// 文件列表的排序字段
+const (
+	SortByName     = "name"
+	SortBySize     = "size"
+	SortByModified = "modified"
+)
+
+const (
+	// DefaultListPageSize 文件列表的默认每页条目数
+	DefaultListPageSize = 1000
+	// MaxListPageSize 文件列表每页条目数上限
+	MaxListPageSize = 1000
+)
+
+// 文件列表参数错误
+var (
+	// ErrInvalidListToken 分页令牌无法解析，或与本次请求的排序方式不一致
+	ErrInvalidListToken = errors.New("无效的分页令牌")
+	// ErrInvalidSortField 不支持的排序字段
+	ErrInvalidSortField = errors.New("不支持的排序字段")
+)
+
+// ListFilesOptions 文件列表的分页和排序参数
+type ListFilesOptions struct {
+	PageSize     int    // 0 表示使用默认值
+	Token        string // 上一页返回的 NextToken
+	SortBy       string // name（默认）、size、modified
+	Descending   bool
+	FoldersFirst bool
+}
+
+// listToken 分页令牌的内容，对客户端不透明
+// 按名称升序时直接使用存储后端的游标；其他排序方式记录上一页最后一个条目
+type listToken struct {
+	Order  string `json:"o"`
+	Native string `json:"s,omitempty"`
+	Name   string `json:"n,omitempty"`
+	Folder bool   `json:"f,omitempty"`
+	Size   int64  `json:"z,omitempty"`
+	Time   int64  `json:"t,omitempty"`
+}
+
+// listEntry 排序用的目录条目，文件夹没有大小和修改时间
+type listEntry struct {
+	name   string
+	folder bool
+	object ObjectInfo
+}
+
+// ListFiles 分页列出指定前缀下的文件和文件夹
+// 按名称升序且文件夹不置顶时每页只请求一次存储后端；其他排序方式需要列出整个文件夹后排序
+func ListFiles(store ObjectStore, prefix string, opts ListFilesOptions) (*models.ListResponse, error) {
+	if opts.PageSize <= 0 {
+		opts.PageSize = DefaultListPageSize
+	}
+	if opts.PageSize > MaxListPageSize {
+		opts.PageSize = MaxListPageSize
+	}
+	switch opts.SortBy {
+	case "":
+		opts.SortBy = SortByName
+	case SortByName, SortBySize, SortByModified:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSortField, opts.SortBy)
+	}
+
+	token, err := decodeListToken(opts.Token, opts.order())
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SortBy == SortByName && !opts.Descending && !opts.FoldersFirst {
+		return listFilesNative(store, prefix, opts, token)
+	}
+	return listFilesSorted(store, prefix, opts, token)
+}
+
+// order 排序方式的标识，令牌只能用于相同排序方式的请求
+func (opts ListFilesOptions) order() string {
+	order := opts.SortBy
+	if opts.Descending {
+		order += "-desc"
+	}
+	if opts.FoldersFirst {
+		order += "-ff"
+	}
+	return order
+}
+
+func listFilesNative(store ObjectStore, prefix string, opts ListFilesOptions, token *listToken) (*models.ListResponse, error) {
+	input := &ListObjectsInput{
+		Prefix:    prefix,
+		Delimiter: "/",
+		MaxKeys:   opts.PageSize,
+	}
+	if token != nil {
+		input.ContinuationToken = token.Native
+	}
+
+	output, err := store.ListObjects(input)
+	if err != nil {
+		return &models.ListResponse{
+			Success: false,
+			Message: fmt.Sprintf("列出对象失败: %v", err),
+		}, nil
+	}
+
+	var entries []listEntry
+	for _, obj := range output.Objects {
+		entries = append(entries, listEntry{name: filepath.Base(obj.Key), object: obj})
+	}
+	for _, commonPrefix := range output.CommonPrefixes {
+		entries = append(entries, listEntry{name: filepath.Base(strings.TrimSuffix(commonPrefix, "/")), folder: true})
+	}
+
+	result := listResponse(prefix, entries)
+	if output.IsTruncated {
+		result.HasMore = true
+		result.NextToken = encodeListToken(&listToken{Order: opts.order(), Native: output.NextContinuationToken})
+	}
+	return result, nil
+}
+
+func listFilesSorted(store ObjectStore, prefix string, opts ListFilesOptions, token *listToken) (*models.ListResponse, error) {
+	var entries []listEntry
+
+	input := &ListObjectsInput{Prefix: prefix, Delimiter: "/"}
+	for {
+		output, err := store.ListObjects(input)
+		if err != nil {
+			return &models.ListResponse{
+				Success: false,
+				Message: fmt.Sprintf("列出对象失败: %v", err),
+			}, nil
+		}
+
+		for _, obj := range output.Objects {
+			if obj.Key == prefix {
+				continue
+			}
+			entries = append(entries, listEntry{name: filepath.Base(obj.Key), object: obj})
+		}
+		for _, commonPrefix := range output.CommonPrefixes {
+			entries = append(entries, listEntry{name: filepath.Base(strings.TrimSuffix(commonPrefix, "/")), folder: true})
+		}
+
+		if !output.IsTruncated {
+			break
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+
+	less := entryLess(opts)
+	sort.Slice(entries, func(i, j int) bool {
+		return less(entries[i], entries[j])
+	})
+
+	start := 0
+	if token != nil {
+		cursor := listEntry{
+			name:   token.Name,
+			folder: token.Folder,
+			object: ObjectInfo{Size: token.Size},
+		}
+		if token.Time != 0 {
+			cursor.object.LastModified = time.Unix(0, token.Time)
+		}
+		start = sort.Search(len(entries), func(i int) bool {
+			return less(cursor, entries[i])
+		})
+	}
+
+	end := min(start+opts.PageSize, len(entries))
+	result := listResponse(prefix, entries[start:end])
+	if end < len(entries) {
+		last := entries[end-1]
+		next := &listToken{
+			Order:  opts.order(),
+			Name:   last.name,
+			Folder: last.folder,
+			Size:   last.object.Size,
+		}
+		if !last.object.LastModified.IsZero() {
+			next.Time = last.object.LastModified.UnixNano()
+		}
+		result.HasMore = true
+		result.NextToken = encodeListToken(next)
+	}
+	return result, nil
+}
+
+// entryLess 条目排序规则：可选文件夹置顶，然后按排序字段，相同时按名称升序
+func entryLess(opts ListFilesOptions) func(a, b listEntry) bool {
+	return func(a, b listEntry) bool {
+		if opts.FoldersFirst && a.folder != b.folder {
+			return a.folder
+		}
+
+		cmp := 0
+		switch opts.SortBy {
+		case SortBySize:
+			cmp = compareInt64(a.object.Size, b.object.Size)
+		case SortByModified:
+			cmp = a.object.LastModified.Compare(b.object.LastModified)
+		default:
+			cmp = strings.Compare(a.name, b.name)
+		}
+		if opts.Descending {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		// 同名的文件夹和文件，文件夹在前
+		return a.folder && !b.folder
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// listResponse 将条目转换为响应，跳过当前文件夹自身的标记对象
+func listResponse(prefix string, entries []listEntry) *models.ListResponse {
+	var files []models.FileInfo
+	var folders []string
+
+	for _, entry := range entries {
+		if entry.folder {
+			if entry.name != "" && entry.name != "." {
+				folders = append(folders, entry.name)
+			}
+			continue
+		}
+
+		obj := entry.object
+		// 跳过文件夹标记对象（以 / 结尾且大小为0）
+		if obj.Key == prefix || (strings.HasSuffix(obj.Key, "/") && obj.Size == 0) {
+			continue
+		}
+		files = append(files, models.FileInfo{
+			Key:          obj.Key,
+			Name:         entry.name,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			ContentType:  ObjectContentType(obj),
+			IsFolder:     false,
+			ETag:         obj.ETag,
+		})
+	}
+
+	return &models.ListResponse{
+		Success: true,
+		Message: "列出对象成功",
+		Files:   files,
+		Folders: folders,
+		Total:   len(files) + len(folders),
+	}
+}
+
+func encodeListToken(token *listToken) string {
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListToken(encoded, order string) (*listToken, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidListToken
+	}
+	var token listToken
+	if err := json.Unmarshal(data, &token); err != nil || token.Order != order {
+		return nil, ErrInvalidListToken
+	}
+	return &token, nil
+}
@@ -0,0 +1,132 @@
+package tos
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// listAllPages 按 opts 逐页列出，返回条目名称（文件夹以 / 结尾）和页数
+func listAllPages(t *testing.T, store ObjectStore, prefix string, opts ListFilesOptions) ([]string, int) {
+	t.Helper()
+
+	var names []string
+	pages := 0
+	for {
+		pages++
+		if pages > 100 {
+			t.Fatal("分页未结束")
+		}
+		result, err := ListFiles(store, prefix, opts)
+		if err != nil || !result.Success {
+			t.Fatalf("ListFiles 失败: %v %+v", err, result)
+		}
+		if result.Total > opts.PageSize {
+			t.Fatalf("本页 %d 条，超过 pageSize %d", result.Total, opts.PageSize)
+		}
+		// 同一页内文件夹和文件分开返回，按 foldersFirst 还原顺序只用于断言
+		for _, folder := range result.Folders {
+			names = append(names, folder+"/")
+		}
+		for _, file := range result.Files {
+			names = append(names, file.Name)
+		}
+		if !result.HasMore {
+			if result.NextToken != "" {
+				t.Error("最后一页不应返回 nextToken")
+			}
+			break
+		}
+		opts.Token = result.NextToken
+	}
+	return names, pages
+}
+
+func TestListFilesNativePagination(t *testing.T) {
+	store := NewMemoryStore()
+	putTestObjects(t, store, "photos/")
+	for i := 0; i < 25; i++ {
+		putTestObjects(t, store, fmt.Sprintf("photos/img-%03d.jpg", i))
+	}
+	putTestObjects(t, store, "photos/album/1.jpg", "other.txt")
+
+	names, pages := listAllPages(t, store, "photos/", ListFilesOptions{PageSize: 10})
+	if len(names) != 26 || pages != 3 {
+		t.Fatalf("共 %d 条 %d 页: %v", len(names), pages, names)
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("重复条目 %s", name)
+		}
+		seen[name] = true
+	}
+	if !seen["album/"] || !seen["img-024.jpg"] || seen["photos/"] {
+		t.Errorf("条目 = %v", names)
+	}
+}
+
+func TestListFilesSorted(t *testing.T) {
+	store := NewMemoryStore()
+	for _, obj := range []struct {
+		key  string
+		size int
+	}{{"d/b.txt", 30}, {"d/a.txt", 10}, {"d/c.txt", 20}, {"d/e.txt", 20}, {"d/zz/x", 1}, {"d/aa/x", 1}} {
+		store.PutObject(obj.key, strings.NewReader(strings.Repeat("x", obj.size)), int64(obj.size), "", nil)
+	}
+
+	tests := []struct {
+		opts ListFilesOptions
+		want []string
+	}{
+		{ListFilesOptions{SortBy: SortBySize, Descending: true}, []string{"b.txt", "c.txt", "e.txt", "a.txt", "aa/", "zz/"}},
+		{ListFilesOptions{SortBy: SortBySize, FoldersFirst: true}, []string{"aa/", "zz/", "a.txt", "c.txt", "e.txt", "b.txt"}},
+		{ListFilesOptions{SortBy: SortByName, Descending: true, FoldersFirst: true}, []string{"zz/", "aa/", "e.txt", "c.txt", "b.txt", "a.txt"}},
+	}
+	for _, tt := range tests {
+		// 每页一条时可以得到完整顺序
+		opts := tt.opts
+		opts.PageSize = 1
+		if got, _ := listAllPages(t, store, "d/", opts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v => %v, want %v", opts, got, tt.want)
+		}
+
+		// 其他页大小不能丢失或重复条目
+		for _, pageSize := range []int{2, 4, 100} {
+			opts.PageSize = pageSize
+			got, _ := listAllPages(t, store, "d/", opts)
+			sort.Strings(got)
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%+v => %v", opts, got)
+			}
+		}
+	}
+}
+
+func TestListFilesInvalidOptions(t *testing.T) {
+	store := NewMemoryStore()
+	for i := 0; i < 3; i++ {
+		putTestObjects(t, store, fmt.Sprintf("f/%d.txt", i))
+	}
+
+	first, err := ListFiles(store, "f/", ListFilesOptions{PageSize: 1, SortBy: SortBySize})
+	if err != nil || !first.HasMore {
+		t.Fatalf("ListFiles = %+v, %v", first, err)
+	}
+
+	// 令牌只能用于相同的排序方式
+	if _, err := ListFiles(store, "f/", ListFilesOptions{PageSize: 1, Token: first.NextToken}); !errors.Is(err, ErrInvalidListToken) {
+		t.Errorf("排序方式不一致 err = %v, want ErrInvalidListToken", err)
+	}
+	if _, err := ListFiles(store, "f/", ListFilesOptions{Token: "!!!"}); !errors.Is(err, ErrInvalidListToken) {
+		t.Errorf("无效令牌 err = %v, want ErrInvalidListToken", err)
+	}
+	if _, err := ListFiles(store, "f/", ListFilesOptions{SortBy: "color"}); !errors.Is(err, ErrInvalidSortField) {
+		t.Errorf("无效排序字段 err = %v, want ErrInvalidSortField", err)
+	}
+}
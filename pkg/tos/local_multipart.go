@@ -0,0 +1,222 @@
+package tos
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localUpload 本地分片上传任务信息，保存在 .bkp-uploads/<uploadID>/upload.json
+type localUpload struct {
+	Key         string            `json:"key"`
+	ContentType string            `json:"contentType"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// uploadDir 分片上传任务目录，上传ID只允许十六进制字符，避免路径穿越
+func (ls *LocalStore) uploadDir(uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", ErrUploadNotFound
+	}
+	return filepath.Join(ls.root, localUploadsDir, uploadID), nil
+}
+
+// loadUpload 读取分片上传任务并校验对象键
+func (ls *LocalStore) loadUpload(key, uploadID string) (string, *localUpload, error) {
+	dir, err := ls.uploadDir(uploadID)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+	if err != nil {
+		return "", nil, ErrUploadNotFound
+	}
+	var upload localUpload
+	if err := json.Unmarshal(data, &upload); err != nil || upload.Key != key {
+		return "", nil, ErrUploadNotFound
+	}
+	return dir, &upload, nil
+}
+
+// CreateMultipartUpload 创建分片上传任务
+func (ls *LocalStore) CreateMultipartUpload(key, contentType string, metadata map[string]string) (string, error) {
+	if _, err := ls.objectPath(key); err != nil {
+		return "", err
+	}
+	uploadID, err := newUploadID()
+	if err != nil {
+		return "", err
+	}
+
+	dir, _ := ls.uploadDir(uploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("创建分片上传任务失败: %w", err)
+	}
+	data, err := json.Marshal(&localUpload{Key: key, ContentType: contentType, Metadata: metadata})
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "upload.json"), data, 0o644); err != nil {
+		return "", fmt.Errorf("创建分片上传任务失败: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart 上传分片，分片保存为 <编号>.part，其MD5保存为 <编号>.etag
+func (ls *LocalStore) UploadPart(key, uploadID string, partNumber int, content io.Reader, size int64) (*UploadedPart, error) {
+	if err := validatePartNumber(partNumber); err != nil {
+		return nil, err
+	}
+	dir, _, err := ls.loadUpload(key, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("上传分片失败: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("上传分片失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("上传分片失败: %w", err)
+	}
+	if size >= 0 && written != size {
+		return nil, fmt.Errorf("上传分片失败: 期望 %d 字节，实际 %d 字节", size, written)
+	}
+
+	etag := hex.EncodeToString(hash.Sum(nil))
+	partPath := filepath.Join(dir, strconv.Itoa(partNumber)+".part")
+	if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(partNumber)+".etag"), []byte(etag), 0o644); err != nil {
+		return nil, fmt.Errorf("上传分片失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), partPath); err != nil {
+		return nil, fmt.Errorf("上传分片失败: %w", err)
+	}
+
+	stat, err := os.Stat(partPath)
+	if err != nil {
+		return nil, fmt.Errorf("上传分片失败: %w", err)
+	}
+
+	return &UploadedPart{
+		PartNumber:   partNumber,
+		ETag:         etag,
+		Size:         written,
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// ListParts 列出已上传的分片
+func (ls *LocalStore) ListParts(key, uploadID string) ([]UploadedPart, error) {
+	dir, _, err := ls.loadUpload(key, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("列出分片失败: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("列出分片失败: %w", err)
+	}
+
+	parts := []UploadedPart{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".part")
+		if !ok {
+			continue
+		}
+		number, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		etag, err := os.ReadFile(filepath.Join(dir, name+".etag"))
+		if err != nil {
+			continue
+		}
+		parts = append(parts, UploadedPart{
+			PartNumber:   number,
+			ETag:         string(etag),
+			Size:         stat.Size(),
+			LastModified: stat.ModTime(),
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload 按顺序拼接分片写入最终对象
+func (ls *LocalStore) CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error {
+	if err := validateCompleteParts(parts); err != nil {
+		return err
+	}
+	dir, upload, err := ls.loadUpload(key, uploadID)
+	if err != nil {
+		return fmt.Errorf("完成分片上传失败: %w", err)
+	}
+
+	uploaded, err := ls.ListParts(key, uploadID)
+	if err != nil {
+		return err
+	}
+	byNumber := make(map[int]UploadedPart, len(uploaded))
+	for _, part := range uploaded {
+		byNumber[part.PartNumber] = part
+	}
+
+	var readers []io.Reader
+	var total int64
+	for _, part := range parts {
+		stored, ok := byNumber[part.PartNumber]
+		if !ok || (part.ETag != "" && part.ETag != stored.ETag) {
+			return fmt.Errorf("完成分片上传失败: 分片 %d 不存在或已变化", part.PartNumber)
+		}
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(part.PartNumber)+".part"))
+		if err != nil {
+			return fmt.Errorf("完成分片上传失败: %w", err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+		total += stored.Size
+	}
+
+	if err := ls.PutObject(key, io.MultiReader(readers...), total, upload.ContentType, upload.Metadata); err != nil {
+		return fmt.Errorf("完成分片上传失败: %w", err)
+	}
+
+	os.RemoveAll(dir)
+	return nil
+}
+
+// AbortMultipartUpload 取消分片上传并删除已上传的分片
+func (ls *LocalStore) AbortMultipartUpload(key, uploadID string) error {
+	dir, _, err := ls.loadUpload(key, uploadID)
+	if err != nil {
+		return fmt.Errorf("取消分片上传失败: %w", err)
+	}
+	if err := os.RemoveAll(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("取消分片上传失败: %w", err)
+	}
+	return nil
+}
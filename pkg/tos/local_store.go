@@ -0,0 +1,398 @@
+package tos
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"bkp-drive/pkg/mimetypes"
+)
+
+// 本地存储的内部目录（位于根目录下，不会出现在列举结果中）
+const (
+	localMetaDir    = ".bkp-meta"    // 对象元数据
+	localUploadsDir = ".bkp-uploads" // 进行中的分片上传
+)
+
+// LocalStore 基于本地文件系统的对象存储，对象键映射为根目录下的相对路径，
+// 以 / 结尾的文件夹标记对象映射为目录
+type LocalStore struct {
+	root string
+}
+
+// localObjectMeta 对象的附加元数据，以JSON形式保存在 .bkp-meta 目录中
+type localObjectMeta struct {
+	ContentType string            `json:"contentType"`
+	ETag        string            `json:"etag"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("LOCAL_STORAGE_PATH 不能为空")
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("解析本地存储路径失败: %w", err)
+	}
+
+	return &LocalStore{
+		root: absRoot,
+	}, nil
+}
+
+// EnsureBucketExists 确保根目录存在
+func (ls *LocalStore) EnsureBucketExists() error {
+	for _, dir := range []string{localMetaDir, localUploadsDir} {
+		if err := os.MkdirAll(filepath.Join(ls.root, dir), 0o755); err != nil {
+			return fmt.Errorf("创建本地存储目录失败: %w", err)
+		}
+	}
+	fmt.Printf("本地存储目录 %s 已就绪\n", ls.root)
+	return nil
+}
+
+// objectPath 将对象键转换为文件系统路径，拒绝逃逸出根目录的键
+func (ls *LocalStore) objectPath(key string) (string, error) {
+	trimmed := strings.TrimSuffix(key, "/")
+	if trimmed == "" {
+		return "", fmt.Errorf("对象键不能为空")
+	}
+	if strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return "", fmt.Errorf("非法的对象键: %s", key)
+	}
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("非法的对象键: %s", key)
+		}
+	}
+	if isLocalInternalKey(trimmed) {
+		return "", fmt.Errorf("非法的对象键: %s", key)
+	}
+
+	return filepath.Join(ls.root, filepath.FromSlash(trimmed)), nil
+}
+
+// isLocalInternalKey 判断键是否位于内部目录中
+func isLocalInternalKey(key string) bool {
+	for _, dir := range []string{localMetaDir, localUploadsDir} {
+		if key == dir || strings.HasPrefix(key, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// metaPath 对象元数据文件路径
+func (ls *LocalStore) metaPath(key string) string {
+	return filepath.Join(ls.root, localMetaDir, filepath.FromSlash(strings.TrimSuffix(key, "/"))+".json")
+}
+
+func (ls *LocalStore) readMeta(key string) *localObjectMeta {
+	data, err := os.ReadFile(ls.metaPath(key))
+	if err != nil {
+		return nil
+	}
+	var meta localObjectMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+func (ls *LocalStore) writeMeta(key string, meta *localObjectMeta) error {
+	path := ls.metaPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// PutObject 写入对象，先写入临时文件再重命名，保证读者不会看到写了一半的内容
+func (ls *LocalStore) PutObject(key string, content io.Reader, size int64, contentType string, metadata map[string]string) error {
+	path, err := ls.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	// 文件夹标记对象
+	if strings.HasSuffix(key, "/") {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return fmt.Errorf("创建文件夹失败: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("写入对象失败: %w", err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("写入对象失败: 期望 %d 字节，实际 %d 字节", size, written)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("写入对象失败: %w", err)
+	}
+
+	if contentType == "" {
+		contentType = mimetypes.TypeByKey(key)
+	}
+	meta := &localObjectMeta{
+		ContentType: contentType,
+		ETag:        hex.EncodeToString(hash.Sum(nil)),
+		Metadata:    metadata,
+	}
+	if err := ls.writeMeta(key, meta); err != nil {
+		return fmt.Errorf("保存对象元数据失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetObject 读取对象
+func (ls *LocalStore) GetObject(key string) (io.ReadCloser, int64, string, error) {
+	info, err := ls.HeadObject(key)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	if strings.HasSuffix(key, "/") {
+		return io.NopCloser(strings.NewReader("")), 0, info.ContentType, nil
+	}
+
+	path, _ := ls.objectPath(key)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("下载对象失败: %w", err)
+	}
+
+	return file, info.Size, info.ContentType, nil
+}
+
+// GetObjectRange 按字节范围读取对象
+func (ls *LocalStore) GetObjectRange(key string, offset, length int64) (io.ReadCloser, error) {
+	reader, _, _, err := ls.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if file, ok := reader.(*os.File); ok {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("下载对象失败: %w", err)
+		}
+	}
+	return limitReadCloser(reader, length), nil
+}
+
+// HeadObject 获取对象元信息
+func (ls *LocalStore) HeadObject(key string) (*ObjectInfo, error) {
+	path, err := ls.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil || stat.IsDir() != strings.HasSuffix(key, "/") {
+		return nil, fmt.Errorf("获取对象信息失败: %w", ErrObjectNotFound)
+	}
+
+	return ls.objectInfo(key, stat), nil
+}
+
+// objectInfo 由文件信息和元数据构建对象信息
+func (ls *LocalStore) objectInfo(key string, stat fs.FileInfo) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:          key,
+		LastModified: stat.ModTime(),
+	}
+
+	if stat.IsDir() {
+		info.ContentType = "application/x-directory"
+		info.ETag = "d41d8cd98f00b204e9800998ecf8427e" // 空内容的MD5
+		return info
+	}
+
+	info.Size = stat.Size()
+	if meta := ls.readMeta(key); meta != nil {
+		info.ContentType = meta.ContentType
+		info.ETag = meta.ETag
+		info.Metadata = meta.Metadata
+	} else {
+		// 绕过本服务直接放入目录的文件没有元数据
+		info.ContentType = mimetypes.TypeByKey(key)
+		info.ETag = fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size())
+	}
+
+	return info
+}
+
+// ListObjects 列举对象，目录作为以 / 结尾的文件夹标记对象返回
+func (ls *LocalStore) ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error) {
+	// 从前缀中最深的完整目录开始遍历
+	baseKey := ""
+	if idx := strings.LastIndex(input.Prefix, "/"); idx >= 0 {
+		baseKey = input.Prefix[:idx+1]
+	}
+
+	baseDir := ls.root
+	if baseKey != "" {
+		path, err := ls.objectPath(baseKey)
+		if err != nil {
+			return nil, err
+		}
+		baseDir = path
+	}
+
+	var objects []ObjectInfo
+	err := filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if path == ls.root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(ls.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if isLocalInternalKey(key) || strings.HasPrefix(filepath.Base(path), ".upload-") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			key += "/"
+		}
+
+		// 跳过与前缀无关的子树
+		if !strings.HasPrefix(key, input.Prefix) && !strings.HasPrefix(input.Prefix, key) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, input.Prefix) {
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *ls.objectInfo(key, stat))
+
+		// 有分隔符时，目录下的所有对象都会归入同一个公共前缀，无需继续深入
+		if d.IsDir() && input.Delimiter == "/" && key != input.Prefix {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列出对象失败: %w", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return listSortedObjects(objects, input)
+}
+
+// DeleteObject 删除对象，删除文件夹标记时只删除空目录
+func (ls *LocalStore) DeleteObject(key string) error {
+	path, err := ls.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(key, "/") {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			// 目录非空时保留，子对象仍然存在
+			if entries, readErr := os.ReadDir(path); readErr == nil && len(entries) > 0 {
+				return nil
+			}
+			return fmt.Errorf("删除对象失败: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("删除对象失败: %w", err)
+	}
+	os.Remove(ls.metaPath(key))
+
+	return nil
+}
+
+// CopyObject 复制对象
+func (ls *LocalStore) CopyObject(sourceKey, destKey string) error {
+	info, err := ls.HeadObject(sourceKey)
+	if err != nil {
+		return fmt.Errorf("获取源对象失败: %w", err)
+	}
+
+	reader, size, contentType, err := ls.GetObject(sourceKey)
+	if err != nil {
+		return fmt.Errorf("获取源对象失败: %w", err)
+	}
+	defer reader.Close()
+
+	if err := ls.PutObject(destKey, reader, size, contentType, info.Metadata); err != nil {
+		return fmt.Errorf("复制对象失败: %w", err)
+	}
+
+	return nil
+}
+
+// SetContentType 修改元数据文件中的 Content-Type，没有元数据的文件按当前信息补上
+func (ls *LocalStore) SetContentType(key, contentType string) error {
+	info, err := ls.HeadObject(key)
+	if err != nil {
+		return err
+	}
+
+	meta := ls.readMeta(key)
+	if meta == nil {
+		meta = &localObjectMeta{ETag: info.ETag, Metadata: info.Metadata}
+	}
+	meta.ContentType = contentType
+	if err := ls.writeMeta(key, meta); err != nil {
+		return fmt.Errorf("修改 Content-Type 失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package tos
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"bkp-drive/internal/models"
+	"bkp-drive/pkg/fulltext"
+	"bkp-drive/pkg/searchquery"
+)
+
+// MemoryIndex 基于内存的元数据索引，用于测试和本地调试
+type MemoryIndex struct {
+	objects  map[string]ObjectInfo
+	contents map[string]string
+	mu       sync.RWMutex
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		objects:  make(map[string]ObjectInfo),
+		contents: make(map[string]string),
+	}
+}
+
+// PutObject 新增或更新对象的记录
+func (mi *MemoryIndex) PutObject(info ObjectInfo) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	mi.objects[info.Key] = info
+	return nil
+}
+
+// DeleteObject 删除对象的记录
+func (mi *MemoryIndex) DeleteObject(key string) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	delete(mi.objects, key)
+	delete(mi.contents, key)
+	return nil
+}
+
+// PutContent 保存对象的文本
+func (mi *MemoryIndex) PutContent(key, text string) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+	if _, ok := mi.objects[key]; ok {
+		mi.contents[key] = text
+	}
+	return nil
+}
+
+// ListObjects 按前缀列举记录
+func (mi *MemoryIndex) ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error) {
+	return listSortedObjects(mi.sorted(input.Prefix), input)
+}
+
+// SearchObjects 在 req.Folder 下搜索文件
+func (mi *MemoryIndex) SearchObjects(req *models.SearchRequest, limit int) ([]ObjectInfo, error) {
+	var results []ObjectInfo
+	for _, obj := range mi.sorted(req.Folder) {
+		if isFolderMarker(obj) || !matchesSearchCriteria(obj, req) {
+			continue
+		}
+		results = append(results, obj)
+		if len(results) >= limit && len(req.Sort) == 0 {
+			break
+		}
+	}
+	sortObjects(results, req)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// SearchContent 在 req.Folder 下按内容搜索文件，按相关度排序
+func (mi *MemoryIndex) SearchContent(req *models.SearchRequest, limit int) ([]ContentMatch, error) {
+	terms := fulltext.Terms(req.Query)
+	// Query 用于匹配内容，不再匹配文件名
+	filter := *req
+	filter.Query = ""
+
+	var matches []ContentMatch
+	for _, obj := range mi.sorted(req.Folder) {
+		if isFolderMarker(obj) || !matchesSearchCriteria(obj, &filter) {
+			continue
+		}
+		mi.mu.RLock()
+		text := mi.contents[obj.Key]
+		mi.mu.RUnlock()
+		if score := fulltext.Score(text, terms); score > 0 {
+			matches = append(matches, ContentMatch{ObjectInfo: obj, Score: score, Snippet: fulltext.Snippet(text, terms)})
+		}
+	}
+
+	// 指定了排序条件时按条件排序，否则按相关度排序
+	sort.SliceStable(matches, func(i, j int) bool {
+		if len(req.Sort) > 0 {
+			return searchquery.Compare(req.Sort, searchFields(matches[i].ObjectInfo, req.Folder), searchFields(matches[j].ObjectInfo, req.Folder)) < 0
+		}
+		return matches[i].Score > matches[j].Score
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// StorageStats 统计 prefix 下的文件和文件夹
+func (mi *MemoryIndex) StorageStats(prefix string) (*models.StorageStats, error) {
+	return objectStats(mi.sorted(prefix)), nil
+}
+
+// sorted 按键排序返回 prefix 下的记录
+func (mi *MemoryIndex) sorted(prefix string) []ObjectInfo {
+	mi.mu.RLock()
+	defer mi.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for key, obj := range mi.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, obj)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects
+}
@@ -0,0 +1,362 @@
+package tos
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"bkp-drive/pkg/mimetypes"
+)
+
+// MemoryStore 基于内存的对象存储，列举语义与 ListObjectsV2 一致，用于测试和本地调试
+type MemoryStore struct {
+	objects map[string]*memoryObject
+	uploads map[string]*memoryUpload
+	mu      sync.RWMutex
+	now     func() time.Time
+}
+
+type memoryObject struct {
+	data         []byte
+	contentType  string
+	metadata     map[string]string
+	etag         string
+	lastModified time.Time
+}
+
+// memoryUpload 进行中的分片上传
+type memoryUpload struct {
+	key         string
+	contentType string
+	metadata    map[string]string
+	parts       map[int]*memoryPart
+}
+
+type memoryPart struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string]*memoryObject),
+		uploads: make(map[string]*memoryUpload),
+		now:     time.Now,
+	}
+}
+
+// SetClock 替换对象修改时间使用的时钟，便于测试时间相关的逻辑
+func (ms *MemoryStore) SetClock(now func() time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.now = now
+}
+
+// EnsureBucketExists 内存存储总是可用
+func (ms *MemoryStore) EnsureBucketExists() error {
+	return nil
+}
+
+// PutObject 写入对象
+func (ms *MemoryStore) PutObject(key string, content io.Reader, size int64, contentType string, metadata map[string]string) error {
+	if key == "" {
+		return fmt.Errorf("对象键不能为空")
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("写入对象失败: %w", err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("写入对象失败: 期望 %d 字节，实际 %d 字节", size, len(data))
+	}
+
+	if contentType == "" {
+		contentType = mimetypes.TypeByKey(key)
+	}
+	sum := md5.Sum(data)
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.objects[key] = &memoryObject{
+		data:         data,
+		contentType:  contentType,
+		metadata:     copyMetadata(metadata),
+		etag:         hex.EncodeToString(sum[:]),
+		lastModified: ms.now(),
+	}
+
+	return nil
+}
+
+// GetObject 读取对象
+func (ms *MemoryStore) GetObject(key string) (io.ReadCloser, int64, string, error) {
+	ms.mu.RLock()
+	obj, ok := ms.objects[key]
+	ms.mu.RUnlock()
+	if !ok {
+		return nil, 0, "", fmt.Errorf("下载对象失败: %w", ErrObjectNotFound)
+	}
+
+	return io.NopCloser(bytes.NewReader(obj.data)), int64(len(obj.data)), obj.contentType, nil
+}
+
+// GetObjectRange 按字节范围读取对象
+func (ms *MemoryStore) GetObjectRange(key string, offset, length int64) (io.ReadCloser, error) {
+	ms.mu.RLock()
+	obj, ok := ms.objects[key]
+	ms.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("下载对象失败: %w", ErrObjectNotFound)
+	}
+
+	size := int64(len(obj.data))
+	if offset > size {
+		offset = size
+	}
+	end := min(offset+length, size)
+	return io.NopCloser(bytes.NewReader(obj.data[offset:end])), nil
+}
+
+// HeadObject 获取对象元信息
+func (ms *MemoryStore) HeadObject(key string) (*ObjectInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	obj, ok := ms.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("获取对象信息失败: %w", ErrObjectNotFound)
+	}
+
+	info := obj.info(key)
+	return &info, nil
+}
+
+// ListObjects 列举对象
+func (ms *MemoryStore) ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error) {
+	ms.mu.RLock()
+	objects := make([]ObjectInfo, 0, len(ms.objects))
+	for key, obj := range ms.objects {
+		objects = append(objects, obj.info(key))
+	}
+	ms.mu.RUnlock()
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return listSortedObjects(objects, input)
+}
+
+// DeleteObject 删除对象
+func (ms *MemoryStore) DeleteObject(key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.objects, key)
+	return nil
+}
+
+// CopyObject 复制对象
+func (ms *MemoryStore) CopyObject(sourceKey, destKey string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	obj, ok := ms.objects[sourceKey]
+	if !ok {
+		return fmt.Errorf("获取源对象失败: %w", ErrObjectNotFound)
+	}
+
+	copied := *obj
+	copied.metadata = copyMetadata(obj.metadata)
+	copied.lastModified = ms.now()
+	ms.objects[destKey] = &copied
+
+	return nil
+}
+
+// SetContentType 修改对象的 Content-Type
+func (ms *MemoryStore) SetContentType(key, contentType string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	obj, ok := ms.objects[key]
+	if !ok {
+		return fmt.Errorf("获取对象失败: %w", ErrObjectNotFound)
+	}
+	obj.contentType = contentType
+	return nil
+}
+
+// CreateMultipartUpload 创建分片上传任务
+func (ms *MemoryStore) CreateMultipartUpload(key, contentType string, metadata map[string]string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("对象键不能为空")
+	}
+	uploadID, err := newUploadID()
+	if err != nil {
+		return "", err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.uploads[uploadID] = &memoryUpload{
+		key:         key,
+		contentType: contentType,
+		metadata:    copyMetadata(metadata),
+		parts:       make(map[int]*memoryPart),
+	}
+
+	return uploadID, nil
+}
+
+// lookupUpload 查找分片上传任务，调用方需持有锁
+func (ms *MemoryStore) lookupUpload(key, uploadID string) (*memoryUpload, error) {
+	upload, ok := ms.uploads[uploadID]
+	if !ok || upload.key != key {
+		return nil, ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+// UploadPart 上传分片
+func (ms *MemoryStore) UploadPart(key, uploadID string, partNumber int, content io.Reader, size int64) (*UploadedPart, error) {
+	if err := validatePartNumber(partNumber); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, fmt.Errorf("上传分片失败: %w", err)
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return nil, fmt.Errorf("上传分片失败: 期望 %d 字节，实际 %d 字节", size, len(data))
+	}
+	sum := md5.Sum(data)
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	upload, err := ms.lookupUpload(key, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("上传分片失败: %w", err)
+	}
+	part := &memoryPart{
+		data:         data,
+		etag:         hex.EncodeToString(sum[:]),
+		lastModified: ms.now(),
+	}
+	upload.parts[partNumber] = part
+
+	return &UploadedPart{
+		PartNumber:   partNumber,
+		ETag:         part.etag,
+		Size:         int64(len(data)),
+		LastModified: part.lastModified,
+	}, nil
+}
+
+// ListParts 列出已上传的分片
+func (ms *MemoryStore) ListParts(key, uploadID string) ([]UploadedPart, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	upload, err := ms.lookupUpload(key, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("列出分片失败: %w", err)
+	}
+
+	parts := make([]UploadedPart, 0, len(upload.parts))
+	for number, part := range upload.parts {
+		parts = append(parts, UploadedPart{
+			PartNumber:   number,
+			ETag:         part.etag,
+			Size:         int64(len(part.data)),
+			LastModified: part.lastModified,
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片
+func (ms *MemoryStore) CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error {
+	if err := validateCompleteParts(parts); err != nil {
+		return err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	upload, err := ms.lookupUpload(key, uploadID)
+	if err != nil {
+		return fmt.Errorf("完成分片上传失败: %w", err)
+	}
+
+	var data []byte
+	for _, part := range parts {
+		uploaded, ok := upload.parts[part.PartNumber]
+		if !ok || (part.ETag != "" && part.ETag != uploaded.etag) {
+			return fmt.Errorf("完成分片上传失败: 分片 %d 不存在或已变化", part.PartNumber)
+		}
+		data = append(data, uploaded.data...)
+	}
+
+	contentType := upload.contentType
+	if contentType == "" {
+		contentType = mimetypes.TypeByKey(key)
+	}
+	sum := md5.Sum(data)
+	ms.objects[key] = &memoryObject{
+		data:         data,
+		contentType:  contentType,
+		metadata:     upload.metadata,
+		etag:         hex.EncodeToString(sum[:]),
+		lastModified: ms.now(),
+	}
+	delete(ms.uploads, uploadID)
+
+	return nil
+}
+
+// AbortMultipartUpload 取消分片上传
+func (ms *MemoryStore) AbortMultipartUpload(key, uploadID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, err := ms.lookupUpload(key, uploadID); err != nil {
+		return fmt.Errorf("取消分片上传失败: %w", err)
+	}
+	delete(ms.uploads, uploadID)
+
+	return nil
+}
+
+func (obj *memoryObject) info(key string) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         int64(len(obj.data)),
+		LastModified: obj.lastModified,
+		ETag:         obj.etag,
+		ContentType:  obj.contentType,
+		Metadata:     copyMetadata(obj.metadata),
+	}
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,195 @@
+package tos
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func putTestObjects(t *testing.T, store ObjectStore, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := store.PutObject(key, strings.NewReader(key), int64(len(key)), "", nil); err != nil {
+			t.Fatalf("PutObject(%q) 失败: %v", key, err)
+		}
+	}
+}
+
+func objectKeys(objects []ObjectInfo) []string {
+	keys := []string{}
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestMemoryStoreListWithDelimiter(t *testing.T) {
+	store := NewMemoryStore()
+	putTestObjects(t, store,
+		"docs/",
+		"docs/a.txt",
+		"docs/b/c.txt",
+		"docs/b/d/e.txt",
+		"docs/z.txt",
+		"photos/1.jpg",
+		"readme.md",
+	)
+
+	output, err := store.ListObjects(&ListObjectsInput{Prefix: "docs/", Delimiter: "/"})
+	if err != nil {
+		t.Fatalf("ListObjects 失败: %v", err)
+	}
+
+	if got, want := objectKeys(output.Objects), []string{"docs/", "docs/a.txt", "docs/z.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Objects = %v, want %v", got, want)
+	}
+	if got, want := output.CommonPrefixes, []string{"docs/b/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CommonPrefixes = %v, want %v", got, want)
+	}
+	if output.IsTruncated {
+		t.Errorf("IsTruncated = true, want false")
+	}
+
+	root, err := store.ListObjects(&ListObjectsInput{Delimiter: "/"})
+	if err != nil {
+		t.Fatalf("ListObjects 失败: %v", err)
+	}
+	if got, want := objectKeys(root.Objects), []string{"readme.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("root Objects = %v, want %v", got, want)
+	}
+	if got, want := root.CommonPrefixes, []string{"docs/", "photos/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("root CommonPrefixes = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryStoreListPagination(t *testing.T) {
+	store := NewMemoryStore()
+	putTestObjects(t, store,
+		"a/1.txt",
+		"a/2.txt",
+		"a/sub/x.txt",
+		"a/sub/y.txt",
+		"a/t/z.txt",
+		"a/u.txt",
+	)
+
+	var objects []string
+	var prefixes []string
+	token := ""
+	pages := 0
+	for {
+		output, err := store.ListObjects(&ListObjectsInput{
+			Prefix:            "a/",
+			Delimiter:         "/",
+			MaxKeys:           2,
+			ContinuationToken: token,
+		})
+		if err != nil {
+			t.Fatalf("ListObjects 失败: %v", err)
+		}
+		pages++
+		if n := len(output.Objects) + len(output.CommonPrefixes); n > 2 {
+			t.Fatalf("第 %d 页返回 %d 项，超过 MaxKeys", pages, n)
+		}
+		objects = append(objects, objectKeys(output.Objects)...)
+		prefixes = append(prefixes, output.CommonPrefixes...)
+		if !output.IsTruncated {
+			break
+		}
+		token = output.NextContinuationToken
+	}
+
+	if pages != 3 {
+		t.Errorf("pages = %d, want 3", pages)
+	}
+	if want := []string{"a/1.txt", "a/2.txt", "a/u.txt"}; !reflect.DeepEqual(objects, want) {
+		t.Errorf("objects = %v, want %v", objects, want)
+	}
+	if want := []string{"a/sub/", "a/t/"}; !reflect.DeepEqual(prefixes, want) {
+		t.Errorf("prefixes = %v, want %v", prefixes, want)
+	}
+}
+
+func TestMemoryStoreListInvalidToken(t *testing.T) {
+	store := NewMemoryStore()
+	if _, err := store.ListObjects(&ListObjectsInput{ContinuationToken: "!!!"}); err == nil {
+		t.Fatal("无效的分页令牌应返回错误")
+	}
+}
+
+func TestMemoryStoreObjectMetadata(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	store.SetClock(func() time.Time { return now })
+
+	err := store.PutObject("a.bin", strings.NewReader("hello"), 5, "application/x-test", map[string]string{"owner": "alice"})
+	if err != nil {
+		t.Fatalf("PutObject 失败: %v", err)
+	}
+
+	info, err := store.HeadObject("a.bin")
+	if err != nil {
+		t.Fatalf("HeadObject 失败: %v", err)
+	}
+	if info.Size != 5 || info.ContentType != "application/x-test" || !info.LastModified.Equal(now) {
+		t.Errorf("HeadObject = %+v", info)
+	}
+	if info.ETag != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("ETag = %q, want md5 of content", info.ETag)
+	}
+
+	now = now.Add(time.Hour)
+	if err := store.CopyObject("a.bin", "b.bin"); err != nil {
+		t.Fatalf("CopyObject 失败: %v", err)
+	}
+	copied, err := store.HeadObject("b.bin")
+	if err != nil {
+		t.Fatalf("HeadObject 失败: %v", err)
+	}
+	if copied.ETag != info.ETag || copied.ContentType != info.ContentType || copied.Metadata["owner"] != "alice" {
+		t.Errorf("复制后的对象元数据不一致: %+v", copied)
+	}
+	if !copied.LastModified.Equal(now) {
+		t.Errorf("LastModified = %v, want %v", copied.LastModified, now)
+	}
+
+	reader, size, _, err := store.GetObject("b.bin")
+	if err != nil {
+		t.Fatalf("GetObject 失败: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if size != 5 || string(data) != "hello" {
+		t.Errorf("GetObject = %q (%d)", data, size)
+	}
+}
+
+func TestMemoryStoreNotFound(t *testing.T) {
+	store := NewMemoryStore()
+
+	if _, err := store.HeadObject("missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("HeadObject err = %v, want ErrObjectNotFound", err)
+	}
+	if _, _, _, err := store.GetObject("missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetObject err = %v, want ErrObjectNotFound", err)
+	}
+	if err := store.CopyObject("missing", "dest"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("CopyObject err = %v, want ErrObjectNotFound", err)
+	}
+	if err := store.DeleteObject("missing"); err != nil {
+		t.Errorf("DeleteObject 删除不存在的对象不应报错: %v", err)
+	}
+}
+
+func TestMemoryStoreSizeMismatch(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.PutObject("a", strings.NewReader("abc"), 10, "", nil); err == nil {
+		t.Fatal("长度不一致时应返回错误")
+	}
+	if _, err := store.HeadObject("a"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("写入失败后对象不应存在: %v", err)
+	}
+}
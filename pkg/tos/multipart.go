@@ -0,0 +1,75 @@
+package tos
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrUploadNotFound 分片上传任务不存在（已完成、已取消或已过期）
+var ErrUploadNotFound = errors.New("分片上传任务不存在")
+
+// 分片编号范围，与TOS/S3一致
+const (
+	MinPartNumber = 1
+	MaxPartNumber = 10000
+)
+
+// UploadedPart 已上传的分片
+type UploadedPart struct {
+	PartNumber   int
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// MultipartUploader 支持分片上传的存储后端，语义与TOS/S3的分片上传一致：
+// 分片可以乱序、重复上传（后上传的覆盖先上传的），完成时按分片编号顺序拼接
+type MultipartUploader interface {
+	// CreateMultipartUpload 创建分片上传任务，返回上传ID
+	CreateMultipartUpload(key, contentType string, metadata map[string]string) (string, error)
+	// UploadPart 上传一个分片
+	UploadPart(key, uploadID string, partNumber int, content io.Reader, size int64) (*UploadedPart, error)
+	// ListParts 按分片编号升序列出已上传的分片
+	ListParts(key, uploadID string) ([]UploadedPart, error)
+	// CompleteMultipartUpload 按给定分片合并为最终对象
+	CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error
+	// AbortMultipartUpload 取消分片上传并清理已上传的分片
+	AbortMultipartUpload(key, uploadID string) error
+}
+
+// validatePartNumber 检查分片编号是否合法
+func validatePartNumber(partNumber int) error {
+	if partNumber < MinPartNumber || partNumber > MaxPartNumber {
+		return fmt.Errorf("分片编号必须在 %d 到 %d 之间", MinPartNumber, MaxPartNumber)
+	}
+	return nil
+}
+
+// validateCompleteParts 检查完成上传时的分片列表：不能为空，且分片编号严格递增
+func validateCompleteParts(parts []UploadedPart) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("至少需要一个分片")
+	}
+	for i, part := range parts {
+		if err := validatePartNumber(part.PartNumber); err != nil {
+			return err
+		}
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return fmt.Errorf("分片编号必须严格递增")
+		}
+	}
+	return nil
+}
+
+// newUploadID 为模拟分片上传的存储后端生成上传ID
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成上传ID失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,48 @@
+package tos
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+// PresignedRequest 预签名请求，客户端需使用相同的方法并携带 Headers 中的请求头
+type PresignedRequest struct {
+	Method    string
+	URL       string
+	Headers   map[string]string
+	ExpiresAt time.Time
+	// StagingKey 非空时上传写入该暂存对象而不是请求的键，上传完成后须调用 AdoptStagedObject
+	StagingKey string
+}
+
+// Presigner 支持生成预签名URL的存储后端，客户端可以绕过服务端直接读写对象
+type Presigner interface {
+	// PresignPutObject 生成上传URL，Content-Type 和 Content-Length 会参与签名
+	PresignPutObject(key string, expires time.Duration, contentType string, contentLength int64) (*PresignedRequest, error)
+	// PresignGetObject 生成下载URL，filename 非空时以附件形式下载
+	PresignGetObject(key string, expires time.Duration, filename string) (*PresignedRequest, error)
+}
+
+// StagedObjectAdopter 预签名上传写入暂存对象的存储，上传完成后由 AdoptStagedObject 转为 key 上的对象
+type StagedObjectAdopter interface {
+	AdoptStagedObject(key, stagingKey string) error
+}
+
+// AdoptStagedObject 将预签名上传的暂存对象转为 key 上的对象，stagingKey 为空时什么都不做；
+// 暂存对象不存在（尚未上传或已转换）时返回 ErrObjectNotFound
+func AdoptStagedObject(store ObjectStore, key, stagingKey string) error {
+	if stagingKey == "" {
+		return nil
+	}
+	adopter, ok := store.(StagedObjectAdopter)
+	if !ok {
+		return errors.New("存储后端不支持预签名上传的暂存对象")
+	}
+	return adopter.AdoptStagedObject(key, stagingKey)
+}
+
+// attachmentDisposition 预签名下载的 Content-Disposition
+func attachmentDisposition(filename string) string {
+	return "attachment; filename*=UTF-8''" + url.PathEscape(filename)
+}
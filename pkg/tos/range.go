@@ -0,0 +1,137 @@
+package tos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// RangeGetter 支持按字节范围读取对象的存储后端
+type RangeGetter interface {
+	// GetObjectRange 读取从 offset 开始的 length 个字节
+	GetObjectRange(key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// GetObjectRange 按字节范围读取对象，存储后端不支持范围读取时跳过前面的内容
+func GetObjectRange(store ObjectStore, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("无效的读取范围: %d, %d", offset, length)
+	}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	if getter, ok := store.(RangeGetter); ok {
+		return getter.GetObjectRange(key, offset, length)
+	}
+
+	reader, _, _, err := store.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil && !errors.Is(err, io.EOF) {
+		reader.Close()
+		return nil, fmt.Errorf("读取对象失败: %w", err)
+	}
+	return limitReadCloser(reader, length), nil
+}
+
+// limitReadCloser 限制读取长度，关闭时关闭底层的 reader
+func limitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, n), rc}
+}
+
+// ObjectReadSeeker 基于范围读取的 io.ReadSeeker，供 http.ServeContent 使用
+// Seek 只记录位置，Read 时才从该位置发起范围请求
+type ObjectReadSeeker struct {
+	mu    sync.Mutex
+	store ObjectStore
+	key   string
+	size  int64
+	pos   int64
+	body  io.ReadCloser
+}
+
+func NewObjectReadSeeker(store ObjectStore, key string, size int64) *ObjectReadSeeker {
+	return &ObjectReadSeeker{
+		store: store,
+		key:   key,
+		size:  size,
+	}
+}
+
+func (r *ObjectReadSeeker) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := GetObjectRange(r.store, r.key, r.pos, r.size-r.pos)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.pos += int64(n)
+	if errors.Is(err, io.EOF) && r.pos < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *ObjectReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, fmt.Errorf("无效的 whence: %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("无效的偏移量: %d", pos)
+	}
+
+	if pos != r.pos {
+		r.Close()
+		r.pos = pos
+	}
+	return pos, nil
+}
+
+// ReadAt 实现 io.ReaderAt，供 archive/zip 直接读取存储中的压缩包
+// 从上次读取结束的位置继续读取时复用同一个范围请求
+func (r *ObjectReadSeeker) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r, p[:min(int64(len(p)), r.size-off)])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Close 关闭当前的范围请求
+func (r *ObjectReadSeeker) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
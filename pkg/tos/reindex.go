@@ -0,0 +1,156 @@
+package tos
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 重建索引时发现的不一致
+const (
+	// ReindexOrphaned 存储中有对象，索引中没有记录（例如绕过本服务上传的对象）
+	ReindexOrphaned = "orphaned"
+	// ReindexDangling 索引中有记录，存储中已没有对象（例如批量操作中途崩溃）
+	ReindexDangling = "dangling"
+	// ReindexStale 记录的大小、ETag 或内容哈希与对象不一致
+	ReindexStale = "stale"
+)
+
+// ReindexOptions 重建索引的参数
+type ReindexOptions struct {
+	Prefix   string // 只处理该前缀下的对象和记录
+	PageSize int    // 每次列举的数量，0 表示使用默认值
+	DryRun   bool   // 只报告不一致，不修改索引
+	// MetadataOnly 只索引元数据，不提取文本（回收站、历史版本等 NewIndexedStore 的 metadataPrefixes）
+	MetadataOnly bool
+	// OnChange 每发现一处不一致调用一次
+	OnChange func(kind, key string)
+}
+
+// ReindexReport 重建索引的结果
+type ReindexReport struct {
+	Objects  int // 存储中的对象数
+	Records  int // 索引中原有的记录数
+	Orphaned int
+	Dangling int
+	Stale    int
+}
+
+// Changed 发现的不一致总数
+func (r *ReindexReport) Changed() int {
+	return r.Orphaned + r.Dangling + r.Stale
+}
+
+// Reindex 分页遍历存储和索引（两者都按键排序）进行比对，为孤立对象插入记录、更新过期记录、删除悬空记录
+// store 应为索引之下的存储；遍历期间的写入可能被报告为不一致，再次执行即可
+func Reindex(store ObjectStore, index MetadataIndex, opts ReindexOptions) (*ReindexReport, error) {
+	objects := &objectPager{list: store.ListObjects, input: ListObjectsInput{Prefix: opts.Prefix, MaxKeys: opts.PageSize}}
+	records := &objectPager{list: index.ListObjects, input: ListObjectsInput{Prefix: opts.Prefix, MaxKeys: opts.PageSize}}
+	report := &ReindexReport{}
+
+	obj, err := objects.next()
+	if err != nil {
+		return nil, err
+	}
+	record, err := records.next()
+	if err != nil {
+		return nil, err
+	}
+
+	for obj != nil || record != nil {
+		kind, key := "", ""
+		switch {
+		case record == nil || (obj != nil && obj.Key < record.Key):
+			kind, key = ReindexOrphaned, obj.Key
+		case obj == nil || record.Key < obj.Key:
+			kind, key = ReindexDangling, record.Key
+		case obj.Size != record.Size || obj.ETag != record.ETag || obj.ContentHash != record.ContentHash:
+			kind, key = ReindexStale, obj.Key
+		}
+
+		if kind != "" {
+			if err := reindexObject(store, index, kind, key, report, opts); err != nil {
+				return nil, err
+			}
+		}
+
+		// 前进键较小的一方，键相同时两者都前进
+		current := key
+		if current == "" {
+			current = obj.Key
+		}
+		if obj != nil && obj.Key == current {
+			report.Objects++
+			if obj, err = objects.next(); err != nil {
+				return nil, err
+			}
+		}
+		if record != nil && record.Key == current {
+			report.Records++
+			if record, err = records.next(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// reindexObject 按存储中的对象修正 key 的记录
+func reindexObject(store ObjectStore, index MetadataIndex, kind, key string, report *ReindexReport, opts ReindexOptions) error {
+	switch kind {
+	case ReindexOrphaned:
+		report.Orphaned++
+	case ReindexDangling:
+		report.Dangling++
+	case ReindexStale:
+		report.Stale++
+	}
+	if opts.OnChange != nil {
+		opts.OnChange(kind, key)
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	if kind == ReindexDangling {
+		return index.DeleteObject(key)
+	}
+	// 列举结果不包含 Content-Type 和自定义元数据，需要读取完整的元信息
+	info, err := store.HeadObject(key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return index.DeleteObject(key)
+	}
+	if err != nil {
+		return fmt.Errorf("读取 %s 的元信息失败: %w", key, err)
+	}
+	return putRecord(store, index, *info, !opts.MetadataOnly)
+}
+
+// objectPager 逐个返回分页列举的对象
+type objectPager struct {
+	list  func(input *ListObjectsInput) (*ListObjectsOutput, error)
+	input ListObjectsInput
+	page  []ObjectInfo
+	done  bool
+}
+
+// next 返回下一个对象，没有更多对象时返回 nil
+func (p *objectPager) next() (*ObjectInfo, error) {
+	for len(p.page) == 0 {
+		if p.done {
+			return nil, nil
+		}
+		input := p.input
+		output, err := p.list(&input)
+		if err != nil {
+			return nil, fmt.Errorf("列举对象失败: %w", err)
+		}
+		p.page = output.Objects
+		p.done = !output.IsTruncated
+		p.input.ContinuationToken = output.NextContinuationToken
+	}
+
+	obj := p.page[0]
+	p.page = p.page[1:]
+	return &obj, nil
+}
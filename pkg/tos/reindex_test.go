@@ -0,0 +1,73 @@
+package tos
+
+import (
+	"strings"
+	"testing"
+
+	"bkp-drive/internal/models"
+)
+
+func TestReindex(t *testing.T) {
+	backend := NewMemoryStore()
+	index := NewMemoryIndex()
+	store := NewIndexedStore(backend, index, "users/")
+
+	putTestObjects(t, store, "users/a/1.txt", "users/a/2.txt", "users/a/3.txt", "users/b/4.txt")
+	// 绕过索引写入、删除和覆盖对象
+	putTestObjects(t, backend, "users/a/0.txt", "users/b/5.txt", "system/trash/a/x")
+	backend.DeleteObject("users/a/2.txt")
+	backend.PutObject("users/a/3.txt", strings.NewReader("changed"), 7, "", nil)
+	index.PutObject(ObjectInfo{Key: "users/c/gone.txt", Size: 1})
+
+	var changes []string
+	opts := ReindexOptions{
+		Prefix:   "users/",
+		PageSize: 2,
+		DryRun:   true,
+		OnChange: func(kind, key string) { changes = append(changes, kind+" "+key) },
+	}
+	report, err := Reindex(backend, index, opts)
+	if err != nil {
+		t.Fatalf("Reindex 失败: %v", err)
+	}
+	want := "orphaned users/a/0.txt,dangling users/a/2.txt,stale users/a/3.txt,orphaned users/b/5.txt,dangling users/c/gone.txt"
+	if got := strings.Join(changes, ","); got != want {
+		t.Errorf("不一致 = %s", got)
+	}
+	if report.Objects != 5 || report.Records != 5 || report.Orphaned != 2 || report.Dangling != 2 || report.Stale != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	if output, _ := index.ListObjects(&ListObjectsInput{}); len(output.Objects) != 5 {
+		t.Errorf("试运行不应修改索引: %v", objectKeys(output.Objects))
+	}
+
+	opts.DryRun = false
+	if _, err := Reindex(backend, index, opts); err != nil {
+		t.Fatalf("Reindex 失败: %v", err)
+	}
+	output, _ := index.ListObjects(&ListObjectsInput{})
+	if got := strings.Join(objectKeys(output.Objects), ","); got != "users/a/0.txt,users/a/1.txt,users/a/3.txt,users/b/4.txt,users/b/5.txt" {
+		t.Errorf("重建后索引 = %s", got)
+	}
+	if info, _ := backend.HeadObject("users/a/3.txt"); output.Objects[2].ETag != info.ETag {
+		t.Errorf("过期记录未更新: %+v", output.Objects[2])
+	}
+	if matches, _ := index.SearchContent(&models.SearchRequest{Folder: "users/a/", Query: "changed"}, 10); len(matches) != 1 {
+		t.Errorf("重建时应同时提取文本: %+v", matches)
+	}
+
+	report, err = Reindex(backend, index, opts)
+	if err != nil || report.Changed() != 0 || report.Objects != 5 {
+		t.Errorf("重建后不应再有不一致: %+v %v", report, err)
+	}
+
+	// 回收站等只索引元数据的前缀
+	backend.PutObject("system/trash/a/y", strings.NewReader("changed"), 7, "", nil)
+	report, err = Reindex(backend, index, ReindexOptions{Prefix: "system/trash/", MetadataOnly: true})
+	if err != nil || report.Orphaned != 2 {
+		t.Fatalf("Reindex system/trash/ = %+v %v", report, err)
+	}
+	if matches, _ := index.SearchContent(&models.SearchRequest{Folder: "system/trash/", Query: "changed"}, 10); len(matches) != 0 {
+		t.Errorf("只索引元数据时不应提取文本: %+v", matches)
+	}
+}
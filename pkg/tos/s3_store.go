@@ -0,0 +1,443 @@
+package tos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"bkp-drive/pkg/config"
+	"bkp-drive/pkg/mimetypes"
+)
+
+// s3PartSize 分片上传的分片大小，长度未知的内容按该大小缓冲后分片上传
+const s3PartSize = 16 << 20
+
+// s3CopyObjectMaxSize 单次 CopyObject 支持的最大对象大小
+const s3CopyObjectMaxSize = 5 << 30
+
+// S3Store 基于S3兼容协议的对象存储（MinIO、AWS S3、Ceph RGW 等）
+type S3Store struct {
+	client *minio.Client
+	core   *minio.Core
+	bucket string
+	region string
+}
+
+func NewS3Store(cfg *config.Config) (*S3Store, error) {
+	if cfg.S3Endpoint == "" || cfg.S3BucketName == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT 和 S3_BUCKET_NAME 环境变量必须设置")
+	}
+	if cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+		return nil, fmt.Errorf("S3_ACCESS_KEY 和 S3_SECRET_KEY 环境变量必须设置")
+	}
+
+	endpoint, secure, err := parseS3Endpoint(cfg.S3Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := minio.BucketLookupDNS
+	if cfg.S3UsePathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	return newS3Store(endpoint, cfg.S3BucketName, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure:       secure,
+		Region:       cfg.S3Region,
+		BucketLookup: lookup,
+	})
+}
+
+func newS3Store(endpoint, bucket string, opts *minio.Options) (*S3Store, error) {
+	client, err := minio.New(endpoint, opts)
+	if err != nil {
+		return nil, fmt.Errorf("创建S3客户端失败: %w", err)
+	}
+
+	return &S3Store{
+		client: client,
+		core:   &minio.Core{Client: client},
+		bucket: bucket,
+		region: opts.Region,
+	}, nil
+}
+
+// parseS3Endpoint 解析endpoint，返回 host[:port] 以及是否使用TLS（未写协议时默认https）
+func parseS3Endpoint(endpoint string) (string, bool, error) {
+	if !strings.Contains(endpoint, "://") {
+		return strings.TrimSuffix(endpoint, "/"), true, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("无效的 S3_ENDPOINT: %w", err)
+	}
+	switch u.Scheme {
+	case "http":
+		return u.Host, false, nil
+	case "https":
+		return u.Host, true, nil
+	default:
+		return "", false, fmt.Errorf("无效的 S3_ENDPOINT 协议: %s", u.Scheme)
+	}
+}
+
+// wrapS3Error 将S3的NoSuchKey/404错误转换为 ErrObjectNotFound
+func wrapS3Error(action string, err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", action, ErrObjectNotFound)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// EnsureBucketExists 确保存储桶存在
+func (ss *S3Store) EnsureBucketExists() error {
+	ctx := context.Background()
+
+	exists, err := ss.client.BucketExists(ctx, ss.bucket)
+	if err != nil {
+		return fmt.Errorf("检查存储桶失败: %w", err)
+	}
+	if exists {
+		fmt.Printf("存储桶 %s 已存在\n", ss.bucket)
+		return nil
+	}
+
+	fmt.Printf("存储桶 %s 不存在，正在创建...\n", ss.bucket)
+	if err := ss.client.MakeBucket(ctx, ss.bucket, minio.MakeBucketOptions{Region: ss.region}); err != nil {
+		return fmt.Errorf("创建存储桶失败: %w", err)
+	}
+	fmt.Printf("存储桶 %s 创建成功！\n", ss.bucket)
+
+	return nil
+}
+
+// PutObject 上传对象
+func (ss *S3Store) PutObject(key string, content io.Reader, size int64, contentType string, metadata map[string]string) error {
+	if contentType == "" {
+		contentType = mimetypes.TypeByKey(key)
+	}
+
+	_, err := ss.client.PutObject(context.Background(), ss.bucket, key, content, size, minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: metadata,
+		PartSize:     s3PartSize,
+	})
+	if err != nil {
+		return fmt.Errorf("上传对象失败: %w", err)
+	}
+
+	return nil
+}
+
+// GetObject 下载对象
+func (ss *S3Store) GetObject(key string) (io.ReadCloser, int64, string, error) {
+	object, err := ss.client.GetObject(context.Background(), ss.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, "", wrapS3Error("下载对象失败", err)
+	}
+
+	// minio 的 GetObject 是惰性的，Stat 才会真正发出请求
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, 0, "", wrapS3Error("下载对象失败", err)
+	}
+
+	return object, stat.Size, stat.ContentType, nil
+}
+
+// GetObjectRange 按字节范围下载对象
+func (ss *S3Store) GetObjectRange(key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+
+	body, _, _, err := ss.core.GetObject(context.Background(), ss.bucket, key, opts)
+	if err != nil {
+		return nil, wrapS3Error("下载对象失败", err)
+	}
+	return body, nil
+}
+
+// HeadObject 获取对象元信息
+func (ss *S3Store) HeadObject(key string) (*ObjectInfo, error) {
+	stat, err := ss.client.StatObject(context.Background(), ss.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, wrapS3Error("获取对象信息失败", err)
+	}
+
+	info := s3ObjectInfo(stat)
+	return &info, nil
+}
+
+// ListObjects 列出对象（单页）
+func (ss *S3Store) ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error) {
+	maxKeys := input.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultListMaxKeys
+	}
+
+	output, err := ss.core.ListObjectsV2(ss.bucket, input.Prefix, "", input.ContinuationToken, input.Delimiter, maxKeys)
+	if err != nil {
+		return nil, fmt.Errorf("列出对象失败: %w", err)
+	}
+
+	result := &ListObjectsOutput{
+		IsTruncated:           output.IsTruncated,
+		NextContinuationToken: output.NextContinuationToken,
+	}
+	for _, obj := range output.Contents {
+		result.Objects = append(result.Objects, ObjectInfo{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			ETag:         strings.Trim(obj.ETag, "\""),
+		})
+	}
+	for _, commonPrefix := range output.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix.Prefix)
+	}
+
+	return result, nil
+}
+
+// DeleteObject 删除对象
+func (ss *S3Store) DeleteObject(key string) error {
+	if err := ss.client.RemoveObject(context.Background(), ss.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("删除对象失败: %w", err)
+	}
+	return nil
+}
+
+// CopyObject 服务端复制对象，Content-Type和自定义元数据随对象一起复制
+func (ss *S3Store) CopyObject(sourceKey, destKey string) error {
+	stat, err := ss.client.StatObject(context.Background(), ss.bucket, sourceKey, minio.StatObjectOptions{})
+	if err != nil {
+		return wrapS3Error("复制对象失败", err)
+	}
+	return ss.copyObject(stat, destKey, "")
+}
+
+// SetContentType 将对象复制到自身并替换 Content-Type，自定义元数据保持不变
+func (ss *S3Store) SetContentType(key, contentType string) error {
+	stat, err := ss.client.StatObject(context.Background(), ss.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return wrapS3Error("修改 Content-Type 失败", err)
+	}
+	return ss.copyObject(stat, key, contentType)
+}
+
+// copyObject 复制 source 到 destKey，contentType 为空时沿用源对象的 Content-Type；
+// 超过5GB的对象无法单次复制，改为分片复制（UploadPartCopy）
+func (ss *S3Store) copyObject(source minio.ObjectInfo, destKey, contentType string) error {
+	ctx := context.Background()
+	src := minio.CopySrcOptions{Bucket: ss.bucket, Object: source.Key, MatchETag: source.ETag}
+	dst := minio.CopyDestOptions{Bucket: ss.bucket, Object: destKey}
+
+	// 分片复制不会自动带上源对象的 Content-Type，需要和自定义元数据一起显式设置
+	if contentType != "" || source.Size > s3CopyObjectMaxSize {
+		if contentType == "" {
+			contentType = source.ContentType
+		}
+		dst.ReplaceMetadata = true
+		dst.UserMetadata = s3CopyMetadata(source, contentType)
+	}
+
+	var err error
+	if source.Size <= s3CopyObjectMaxSize {
+		_, err = ss.client.CopyObject(ctx, dst, src)
+	} else {
+		_, err = ss.client.ComposeObject(ctx, dst, src)
+	}
+	if err != nil {
+		return wrapS3Error("复制对象失败", err)
+	}
+	return nil
+}
+
+// s3CopyMetadata 替换元数据复制时目标对象的元数据：源对象的自定义元数据加上 Content-Type
+func s3CopyMetadata(source minio.ObjectInfo, contentType string) map[string]string {
+	metadata := make(map[string]string, len(source.UserMetadata)+1)
+	for k, v := range source.UserMetadata {
+		metadata[k] = v
+	}
+	if contentType != "" {
+		metadata["Content-Type"] = contentType
+	}
+	return metadata
+}
+
+// s3ObjectInfo 转换对象信息，自定义元数据的键统一为小写（与TOS一致）
+func s3ObjectInfo(stat minio.ObjectInfo) ObjectInfo {
+	metadata := make(map[string]string, len(stat.UserMetadata))
+	for k, v := range stat.UserMetadata {
+		metadata[strings.ToLower(k)] = v
+	}
+
+	return ObjectInfo{
+		Key:          stat.Key,
+		Size:         stat.Size,
+		LastModified: stat.LastModified,
+		ETag:         strings.Trim(stat.ETag, "\""),
+		ContentType:  stat.ContentType,
+		Metadata:     metadata,
+	}
+}
+
+// wrapS3UploadError 将分片上传相关的 NoSuchUpload/404 错误转换为 ErrUploadNotFound
+func wrapS3UploadError(action string, err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchUpload" || resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", action, ErrUploadNotFound)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
+
+// CreateMultipartUpload 创建分片上传任务
+func (ss *S3Store) CreateMultipartUpload(key, contentType string, metadata map[string]string) (string, error) {
+	if contentType == "" {
+		contentType = mimetypes.TypeByKey(key)
+	}
+
+	uploadID, err := ss.core.NewMultipartUpload(context.Background(), ss.bucket, key, minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("创建分片上传任务失败: %w", err)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart 上传分片
+func (ss *S3Store) UploadPart(key, uploadID string, partNumber int, content io.Reader, size int64) (*UploadedPart, error) {
+	if err := validatePartNumber(partNumber); err != nil {
+		return nil, err
+	}
+
+	part, err := ss.core.PutObjectPart(context.Background(), ss.bucket, key, uploadID, partNumber, content, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return nil, wrapS3UploadError("上传分片失败", err)
+	}
+
+	return &UploadedPart{
+		PartNumber:   partNumber,
+		ETag:         strings.Trim(part.ETag, "\""),
+		Size:         part.Size,
+		LastModified: part.LastModified,
+	}, nil
+}
+
+// ListParts 列出已上传的分片（自动翻页）
+func (ss *S3Store) ListParts(key, uploadID string) ([]UploadedPart, error) {
+	parts := []UploadedPart{}
+	marker := 0
+	for {
+		output, err := ss.core.ListObjectParts(context.Background(), ss.bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, wrapS3UploadError("列出分片失败", err)
+		}
+
+		for _, part := range output.ObjectParts {
+			parts = append(parts, UploadedPart{
+				PartNumber:   part.PartNumber,
+				ETag:         strings.Trim(part.ETag, "\""),
+				Size:         part.Size,
+				LastModified: part.LastModified,
+			})
+		}
+
+		if !output.IsTruncated {
+			break
+		}
+		marker = output.NextPartNumberMarker
+	}
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片
+func (ss *S3Store) CompleteMultipartUpload(key, uploadID string, parts []UploadedPart) error {
+	if err := validateCompleteParts(parts); err != nil {
+		return err
+	}
+
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+
+	_, err := ss.core.CompleteMultipartUpload(context.Background(), ss.bucket, key, uploadID, completed, minio.PutObjectOptions{})
+	if err != nil {
+		return wrapS3UploadError("完成分片上传失败", err)
+	}
+
+	return nil
+}
+
+// AbortMultipartUpload 取消分片上传
+func (ss *S3Store) AbortMultipartUpload(key, uploadID string) error {
+	if err := ss.core.AbortMultipartUpload(context.Background(), ss.bucket, key, uploadID); err != nil {
+		return wrapS3UploadError("取消分片上传失败", err)
+	}
+	return nil
+}
+
+// PresignPutObject 生成预签名上传URL
+func (ss *S3Store) PresignPutObject(key string, expires time.Duration, contentType string, contentLength int64) (*PresignedRequest, error) {
+	if contentType == "" {
+		contentType = mimetypes.TypeByKey(key)
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Length", strconv.FormatInt(contentLength, 10))
+
+	u, err := ss.client.PresignHeader(context.Background(), http.MethodPut, ss.bucket, key, expires, nil, headers)
+	if err != nil {
+		return nil, fmt.Errorf("生成上传URL失败: %w", err)
+	}
+
+	return &PresignedRequest{
+		Method: http.MethodPut,
+		URL:    u.String(),
+		Headers: map[string]string{
+			"Content-Type":   contentType,
+			"Content-Length": strconv.FormatInt(contentLength, 10),
+		},
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+// PresignGetObject 生成预签名下载URL
+func (ss *S3Store) PresignGetObject(key string, expires time.Duration, filename string) (*PresignedRequest, error) {
+	params := url.Values{}
+	if filename != "" {
+		params.Set("response-content-disposition", attachmentDisposition(filename))
+	}
+
+	u, err := ss.client.PresignedGetObject(context.Background(), ss.bucket, key, expires, params)
+	if err != nil {
+		return nil, fmt.Errorf("生成下载URL失败: %w", err)
+	}
+
+	return &PresignedRequest{
+		Method:    http.MethodGet,
+		URL:       u.String(),
+		Headers:   map[string]string{},
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
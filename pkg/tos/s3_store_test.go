@@ -0,0 +1,546 @@
+package tos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"bkp-drive/pkg/config"
+)
+
+// fakeS3Server 内嵌的最小S3兼容服务，只实现 S3Store 用到的接口，对象保存在 MemoryStore 中
+type fakeS3Server struct {
+	store   *MemoryStore
+	mu      sync.Mutex
+	buckets map[string]bool
+}
+
+func newFakeS3Server() *fakeS3Server {
+	return &fakeS3Server{
+		store:   NewMemoryStore(),
+		buckets: make(map[string]bool),
+	}
+}
+
+// newTestS3Store 启动内嵌S3服务并返回连接到它的 S3Store
+func newTestS3Store(t *testing.T) *S3Store {
+	t.Helper()
+
+	server := httptest.NewTLSServer(newFakeS3Server())
+	t.Cleanup(server.Close)
+
+	store, err := newS3Store(strings.TrimPrefix(server.URL, "https://"), "bkp-test", &minio.Options{
+		Creds:        credentials.NewStaticV4("test-access-key", "test-secret-key", ""),
+		Secure:       true,
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+		Transport:    server.Client().Transport,
+	})
+	if err != nil {
+		t.Fatalf("创建S3客户端失败: %v", err)
+	}
+	if err := store.EnsureBucketExists(); err != nil {
+		t.Fatalf("EnsureBucketExists 失败: %v", err)
+	}
+	return store
+}
+
+func (f *fakeS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+
+	f.mu.Lock()
+	exists := f.buckets[bucket]
+	f.mu.Unlock()
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodPut:
+			f.mu.Lock()
+			f.buckets[bucket] = true
+			f.mu.Unlock()
+		case !exists:
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			f.listObjects(w, r, bucket)
+		case r.Method == http.MethodHead:
+		default:
+			writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+	if !exists {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.createMultipartUpload(w, r, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		f.uploadPart(w, r, key)
+	case r.Method == http.MethodGet && query.Has("uploadId"):
+		f.listParts(w, r, bucket, key)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.completeMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		if err := f.store.AbortMultipartUpload(key, query.Get("uploadId")); err != nil {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.copyObject(w, r, key)
+	case r.Method == http.MethodPut:
+		body, err := readS3Body(r)
+		if err != nil {
+			writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		if err := f.store.PutObject(key, bytes.NewReader(body), int64(len(body)), r.Header.Get("Content-Type"), s3RequestMetadata(r.Header)); err != nil {
+			writeS3Error(w, r, http.StatusInternalServerError, "InternalError")
+			return
+		}
+		info, _ := f.store.HeadObject(key)
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.getObject(w, r, key)
+	case r.Method == http.MethodDelete:
+		f.store.DeleteObject(key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, r, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3Server) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	info, err := f.store.HeadObject(key)
+	if err != nil {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", info.ContentType)
+	header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	header.Set("ETag", `"`+info.ETag+`"`)
+	header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	for k, v := range info.Metadata {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	reader, _, _, err := f.store.GetObject(key)
+	if err != nil {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	defer reader.Close()
+
+	if r.Header.Get("Range") != "" {
+		data, _ := io.ReadAll(reader)
+		header.Del("Content-Length")
+		http.ServeContent(w, r, "", info.LastModified, bytes.NewReader(data))
+		return
+	}
+	io.Copy(w, reader)
+}
+
+func (f *fakeS3Server) copyObject(w http.ResponseWriter, r *http.Request, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+	_, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	if err := f.store.CopyObject(sourceKey, key); err != nil {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	// REPLACE 时使用请求中的 Content-Type 和自定义元数据
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		reader, size, _, _ := f.store.GetObject(key)
+		data, _ := io.ReadAll(reader)
+		f.store.PutObject(key, bytes.NewReader(data), size, r.Header.Get("Content-Type"), s3RequestMetadata(r.Header))
+	}
+	info, _ := f.store.HeadObject(key)
+
+	writeS3XML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		LastModified string
+		ETag         string
+	}{
+		LastModified: info.LastModified.UTC().Format(time.RFC3339),
+		ETag:         `"` + info.ETag + `"`,
+	})
+}
+
+func (f *fakeS3Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	maxKeys, _ := strconv.Atoi(query.Get("max-keys"))
+
+	output, err := f.store.ListObjects(&ListObjectsInput{
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		MaxKeys:           maxKeys,
+		ContinuationToken: query.Get("continuation-token"),
+	})
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		Delimiter             string
+		MaxKeys               int
+		KeyCount              int
+		IsTruncated           bool
+		ContinuationToken     string
+		NextContinuationToken string
+		Contents              []content
+		CommonPrefixes        []commonPrefix
+	}{
+		Name:                  bucket,
+		Prefix:                query.Get("prefix"),
+		Delimiter:             query.Get("delimiter"),
+		MaxKeys:               maxKeys,
+		KeyCount:              len(output.Objects) + len(output.CommonPrefixes),
+		IsTruncated:           output.IsTruncated,
+		ContinuationToken:     query.Get("continuation-token"),
+		NextContinuationToken: output.NextContinuationToken,
+	}
+	for _, obj := range output.Objects {
+		result.Contents = append(result.Contents, content{
+			Key:          obj.Key,
+			LastModified: obj.LastModified.UTC().Format(time.RFC3339),
+			ETag:         `"` + obj.ETag + `"`,
+			Size:         obj.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, prefix := range output.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: prefix})
+	}
+
+	writeS3XML(w, result)
+}
+
+// 分片上传直接复用 MemoryStore 的实现
+
+func (f *fakeS3Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	uploadID, err := f.store.CreateMultipartUpload(key, r.Header.Get("Content-Type"), s3RequestMetadata(r.Header))
+	if err != nil {
+		writeS3Error(w, r, http.StatusInternalServerError, "InternalError")
+		return
+	}
+
+	writeS3XML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Key      string
+		UploadId string
+	}{Key: key, UploadId: uploadID})
+}
+
+func (f *fakeS3Server) uploadPart(w http.ResponseWriter, r *http.Request, key string) {
+	partNumber, _ := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	body, err := readS3Body(r)
+	if err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	part, err := f.store.UploadPart(key, r.URL.Query().Get("uploadId"), partNumber, bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	w.Header().Set("ETag", `"`+part.ETag+`"`)
+}
+
+func (f *fakeS3Server) listParts(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	uploadID := r.URL.Query().Get("uploadId")
+	parts, err := f.store.ListParts(key, uploadID)
+	if err != nil {
+		writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	type part struct {
+		PartNumber   int
+		LastModified string
+		ETag         string
+		Size         int64
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListPartsResult"`
+		Bucket      string
+		Key         string
+		UploadId    string
+		IsTruncated bool
+		Parts       []part `xml:"Part"`
+	}{Bucket: bucket, Key: key, UploadId: uploadID}
+	for _, p := range parts {
+		result.Parts = append(result.Parts, part{
+			PartNumber:   p.PartNumber,
+			LastModified: p.LastModified.UTC().Format(time.RFC3339),
+			ETag:         `"` + p.ETag + `"`,
+			Size:         p.Size,
+		})
+	}
+
+	writeS3XML(w, result)
+}
+
+func (f *fakeS3Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeS3Error(w, r, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	parts := make([]UploadedPart, 0, len(request.Parts))
+	for _, p := range request.Parts {
+		parts = append(parts, UploadedPart{PartNumber: p.PartNumber, ETag: strings.Trim(p.ETag, `"`)})
+	}
+	if err := f.store.CompleteMultipartUpload(key, r.URL.Query().Get("uploadId"), parts); err != nil {
+		if errors.Is(err, ErrUploadNotFound) {
+			writeS3Error(w, r, http.StatusNotFound, "NoSuchUpload")
+		} else {
+			writeS3Error(w, r, http.StatusBadRequest, "InvalidPart")
+		}
+		return
+	}
+	info, _ := f.store.HeadObject(key)
+
+	writeS3XML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: bucket, Key: key, ETag: `"` + info.ETag + `"`})
+}
+
+// readS3Body 读取请求体，兼容 aws-chunked 流式签名格式
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	var data []byte
+	reader := bufio.NewReader(r.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2) // 数据后跟 \r\n
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func s3RequestMetadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for k, v := range header {
+		if name, ok := strings.CutPrefix(strings.ToLower(k), "x-amz-meta-"); ok && len(v) > 0 {
+			metadata[name] = v[0]
+		}
+	}
+	return metadata
+}
+
+func writeS3XML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeS3Error(w http.ResponseWriter, r *http.Request, status int, code string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string
+		Message  string
+		Resource string
+	}{Code: code, Message: code, Resource: r.URL.Path})
+}
+
+func TestS3StoreConformance(t *testing.T) {
+	store := newTestS3Store(t)
+	testObjectStoreConformance(t, store)
+	testMultipartConformance(t, store)
+}
+
+func TestS3StoreUnknownSizeUpload(t *testing.T) {
+	store := newTestS3Store(t)
+
+	// 长度未知时 minio 会走分片上传
+	content := strings.Repeat("x", 1024)
+	if err := store.PutObject("stream.txt", strings.NewReader(content), -1, "text/plain", map[string]string{"source": "pipe"}); err != nil {
+		t.Fatalf("PutObject 失败: %v", err)
+	}
+
+	info, err := store.HeadObject("stream.txt")
+	if err != nil {
+		t.Fatalf("HeadObject 失败: %v", err)
+	}
+	if info.Size != int64(len(content)) || info.ContentType != "text/plain" || info.Metadata["source"] != "pipe" {
+		t.Errorf("HeadObject = %+v", info)
+	}
+}
+
+// TestS3StoreMinIO 设置 BKP_S3_TEST_ENDPOINT 等环境变量后针对真实的 MinIO 运行一致性测试
+func TestS3StoreMinIO(t *testing.T) {
+	endpoint := os.Getenv("BKP_S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("未设置 BKP_S3_TEST_ENDPOINT，跳过 MinIO 测试")
+	}
+
+	store, err := NewS3Store(&config.Config{
+		S3Endpoint:     endpoint,
+		S3Region:       "us-east-1",
+		S3AccessKey:    os.Getenv("BKP_S3_TEST_ACCESS_KEY"),
+		S3SecretKey:    os.Getenv("BKP_S3_TEST_SECRET_KEY"),
+		S3BucketName:   fmt.Sprintf("bkp-test-%d", time.Now().UnixNano()),
+		S3UsePathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store 失败: %v", err)
+	}
+	if err := store.EnsureBucketExists(); err != nil {
+		t.Fatalf("EnsureBucketExists 失败: %v", err)
+	}
+
+	testObjectStoreConformance(t, store)
+	testMultipartConformance(t, store)
+	testS3Presign(t, store, http.DefaultClient)
+}
+
+func TestS3StorePresign(t *testing.T) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	testS3Presign(t, newTestS3Store(t), client)
+}
+
+// testS3Presign 通过预签名URL直接上传和下载
+func testS3Presign(t *testing.T, store *S3Store, client *http.Client) {
+	t.Helper()
+
+	put, err := store.PresignPutObject("presign/a.txt", time.Minute, "text/plain", 5)
+	if err != nil {
+		t.Fatalf("PresignPutObject 失败: %v", err)
+	}
+	u, _ := url.Parse(put.URL)
+	if put.Method != http.MethodPut || u.Query().Get("X-Amz-Signature") == "" || !strings.Contains(u.Query().Get("X-Amz-SignedHeaders"), "content-length") {
+		t.Fatalf("上传URL = %+v", put)
+	}
+
+	req, _ := http.NewRequest(put.Method, put.URL, strings.NewReader("hello"))
+	for k, v := range put.Headers {
+		req.Header.Set(k, v)
+	}
+	req.ContentLength = 5
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("预签名上传失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("预签名上传状态码 = %d", resp.StatusCode)
+	}
+
+	get, err := store.PresignGetObject("presign/a.txt", time.Minute, "报告 a.txt")
+	if err != nil {
+		t.Fatalf("PresignGetObject 失败: %v", err)
+	}
+	u, _ = url.Parse(get.URL)
+	if u.Query().Get("response-content-disposition") != "attachment; filename*=UTF-8''%E6%8A%A5%E5%91%8A%20a.txt" {
+		t.Errorf("response-content-disposition = %q", u.Query().Get("response-content-disposition"))
+	}
+	resp, err = client.Get(get.URL)
+	if err != nil {
+		t.Fatalf("预签名下载失败: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(data) != "hello" {
+		t.Errorf("预签名下载 = %d %q", resp.StatusCode, data)
+	}
+}
+
+func TestParseS3Endpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		host     string
+		secure   bool
+		wantErr  bool
+	}{
+		{"http://localhost:9000", "localhost:9000", false, false},
+		{"https://s3.amazonaws.com", "s3.amazonaws.com", true, false},
+		{"minio.example.com/", "minio.example.com", true, false},
+		{"ftp://example.com", "", false, true},
+	}
+
+	for _, tt := range tests {
+		host, secure, err := parseS3Endpoint(tt.endpoint)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseS3Endpoint(%q) err = %v", tt.endpoint, err)
+			continue
+		}
+		if host != tt.host || secure != tt.secure {
+			t.Errorf("parseS3Endpoint(%q) = %q, %v", tt.endpoint, host, secure)
+		}
+	}
+}
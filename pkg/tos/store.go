@@ -0,0 +1,181 @@
+package tos
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"bkp-drive/pkg/config"
+)
+
+// ErrObjectNotFound 对象不存在，各存储后端返回的错误都会包装该错误
+var ErrObjectNotFound = errors.New("对象不存在")
+
+// ObjectInfo 对象元信息
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	ContentType  string
+	Metadata     map[string]string
+	ContentHash  string // 去重存储中对象内容的 SHA-256，其他对象为空
+}
+
+// ListObjectsInput 列举对象参数
+type ListObjectsInput struct {
+	Prefix            string
+	Delimiter         string
+	MaxKeys           int    // 0 表示使用默认值1000
+	ContinuationToken string // 上一页返回的 NextContinuationToken
+}
+
+// ListObjectsOutput 列举对象结果
+type ListObjectsOutput struct {
+	Objects               []ObjectInfo
+	CommonPrefixes        []string
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// ObjectStore 对象存储后端抽象，处理器只依赖该接口
+type ObjectStore interface {
+	// EnsureBucketExists 确保存储空间可用（不存在时创建）
+	EnsureBucketExists() error
+	// PutObject 写入对象，size 为 -1 表示长度未知
+	PutObject(key string, content io.Reader, size int64, contentType string, metadata map[string]string) error
+	// GetObject 读取对象，返回内容、长度和Content-Type
+	GetObject(key string) (io.ReadCloser, int64, string, error)
+	// HeadObject 获取对象元信息
+	HeadObject(key string) (*ObjectInfo, error)
+	// ListObjects 按前缀列举对象，支持分隔符和分页
+	ListObjects(input *ListObjectsInput) (*ListObjectsOutput, error)
+	// DeleteObject 删除对象，对象不存在时不报错
+	DeleteObject(key string) error
+	// CopyObject 复制对象，保留Content-Type和自定义元数据
+	CopyObject(sourceKey, destKey string) error
+}
+
+// ProcessedObjectGetter 支持内容处理（缩略图、视频截图等）的存储后端
+type ProcessedObjectGetter interface {
+	GetProcessedObject(key string, process string) (io.ReadCloser, int64, string, error)
+}
+
+// 存储后端类型
+const (
+	BackendTOS    = "tos"
+	BackendS3     = "s3"
+	BackendLocal  = "local"
+	BackendMemory = "memory"
+)
+
+// defaultListMaxKeys 列举对象的默认单页数量
+const defaultListMaxKeys = 1000
+
+// NewObjectStore 根据配置创建存储后端，开启去重时在后端之上包装 DedupStore
+func NewObjectStore(cfg *config.Config) (ObjectStore, error) {
+	store, err := newBackendStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.StorageDedup {
+		return NewDedupStore(store), nil
+	}
+	return store, nil
+}
+
+func newBackendStore(cfg *config.Config) (ObjectStore, error) {
+	switch cfg.StorageBackend {
+	case "", BackendTOS:
+		client, err := NewTOSClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case BackendS3:
+		store, err := NewS3Store(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case BackendLocal:
+		store, err := NewLocalStore(cfg.LocalStoragePath)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", cfg.StorageBackend)
+	}
+}
+
+// listSortedObjects 在按键排序的完整对象列表上实现 ListObjectsV2 的前缀、分隔符和分页语义，
+// 供没有原生列举能力的存储后端使用
+func listSortedObjects(objects []ObjectInfo, input *ListObjectsInput) (*ListObjectsOutput, error) {
+	maxKeys := input.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultListMaxKeys
+	}
+
+	after := ""
+	if input.ContinuationToken != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(input.ContinuationToken)
+		if err != nil {
+			return nil, fmt.Errorf("无效的分页令牌: %w", err)
+		}
+		after = string(decoded)
+	}
+
+	output := &ListObjectsOutput{}
+	last := ""
+	count := 0
+
+	start := sort.Search(len(objects), func(i int) bool {
+		return objects[i].Key >= input.Prefix
+	})
+	for i := start; i < len(objects); i++ {
+		obj := objects[i]
+		if !strings.HasPrefix(obj.Key, input.Prefix) {
+			break
+		}
+		if after != "" && obj.Key <= after {
+			continue
+		}
+
+		commonPrefix := ""
+		if input.Delimiter != "" {
+			rest := strings.TrimPrefix(obj.Key, input.Prefix)
+			if idx := strings.Index(rest, input.Delimiter); idx >= 0 {
+				commonPrefix = input.Prefix + rest[:idx+len(input.Delimiter)]
+			}
+		}
+
+		// 公共前缀已经在本页或之前的页中返回过
+		if commonPrefix != "" && (commonPrefix == last || (after != "" && commonPrefix <= after)) {
+			continue
+		}
+
+		if count >= maxKeys {
+			output.IsTruncated = true
+			output.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+
+		if commonPrefix != "" {
+			output.CommonPrefixes = append(output.CommonPrefixes, commonPrefix)
+			last = commonPrefix
+		} else {
+			output.Objects = append(output.Objects, obj)
+			last = obj.Key
+		}
+		count++
+	}
+
+	return output, nil
+}
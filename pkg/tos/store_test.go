@@ -0,0 +1,315 @@
+package tos
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testObjectStoreConformance 各存储后端都必须满足的行为，store 应为空的存储空间
+func testObjectStoreConformance(t *testing.T, store ObjectStore) {
+	t.Helper()
+
+	t.Run("PutGetHead", func(t *testing.T) {
+		err := store.PutObject("conf/a.txt", strings.NewReader("hello"), 5, "text/plain", map[string]string{"owner": "alice"})
+		if err != nil {
+			t.Fatalf("PutObject 失败: %v", err)
+		}
+
+		info, err := store.HeadObject("conf/a.txt")
+		if err != nil {
+			t.Fatalf("HeadObject 失败: %v", err)
+		}
+		if info.Key != "conf/a.txt" || info.Size != 5 || info.ContentType != "text/plain" || info.Metadata["owner"] != "alice" {
+			t.Errorf("HeadObject = %+v", info)
+		}
+		if info.ETag != "5d41402abc4b2a76b9719d911017c592" {
+			t.Errorf("ETag = %q, want md5 of content", info.ETag)
+		}
+		if info.LastModified.IsZero() {
+			t.Error("LastModified 不应为零值")
+		}
+
+		reader, size, contentType, err := store.GetObject("conf/a.txt")
+		if err != nil {
+			t.Fatalf("GetObject 失败: %v", err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(data) != "hello" || size != 5 || contentType != "text/plain" {
+			t.Errorf("GetObject = %q, %d, %q", data, size, contentType)
+		}
+	})
+
+	t.Run("DefaultContentType", func(t *testing.T) {
+		putTestObjects(t, store, "conf/photo.png")
+		info, err := store.HeadObject("conf/photo.png")
+		if err != nil {
+			t.Fatalf("HeadObject 失败: %v", err)
+		}
+		if info.ContentType != "image/png" {
+			t.Errorf("ContentType = %q, want image/png", info.ContentType)
+		}
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		if err := store.CopyObject("conf/a.txt", "conf/copy/a.txt"); err != nil {
+			t.Fatalf("CopyObject 失败: %v", err)
+		}
+		info, err := store.HeadObject("conf/copy/a.txt")
+		if err != nil {
+			t.Fatalf("HeadObject 失败: %v", err)
+		}
+		if info.Size != 5 || info.ContentType != "text/plain" || info.Metadata["owner"] != "alice" {
+			t.Errorf("复制后的对象元数据不一致: %+v", info)
+		}
+	})
+
+	t.Run("SetContentType", func(t *testing.T) {
+		if err := store.PutObject("conf/typed.bin", strings.NewReader("\x89PNG"), 4, "text/plain", map[string]string{"owner": "bob"}); err != nil {
+			t.Fatalf("PutObject 失败: %v", err)
+		}
+		if err := SetContentType(store, "conf/typed.bin", "image/png"); err != nil {
+			t.Fatalf("SetContentType 失败: %v", err)
+		}
+		info, err := store.HeadObject("conf/typed.bin")
+		if err != nil {
+			t.Fatalf("HeadObject 失败: %v", err)
+		}
+		if info.Size != 4 || info.ContentType != "image/png" || info.Metadata["owner"] != "bob" {
+			t.Errorf("修改 Content-Type 后的对象 = %+v", info)
+		}
+		if err := SetContentType(store, "conf/missing.bin", "image/png"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("SetContentType(不存在的对象) = %v, want ErrObjectNotFound", err)
+		}
+		store.DeleteObject("conf/typed.bin")
+	})
+
+	t.Run("List", func(t *testing.T) {
+		putTestObjects(t, store, "conf/list/", "conf/list/1.txt", "conf/list/2.txt", "conf/list/sub/", "conf/list/sub/3.txt", "conf/list/u.txt")
+
+		output, err := store.ListObjects(&ListObjectsInput{Prefix: "conf/list/", Delimiter: "/"})
+		if err != nil {
+			t.Fatalf("ListObjects 失败: %v", err)
+		}
+		if got, want := objectKeys(output.Objects), []string{"conf/list/", "conf/list/1.txt", "conf/list/2.txt", "conf/list/u.txt"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Objects = %v, want %v", got, want)
+		}
+		if got, want := output.CommonPrefixes, []string{"conf/list/sub/"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("CommonPrefixes = %v, want %v", got, want)
+		}
+
+		var keys []string
+		token := ""
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatal("分页未结束")
+			}
+			page, err := store.ListObjects(&ListObjectsInput{Prefix: "conf/list/", MaxKeys: 2, ContinuationToken: token})
+			if err != nil {
+				t.Fatalf("ListObjects 失败: %v", err)
+			}
+			keys = append(keys, objectKeys(page.Objects)...)
+			if !page.IsTruncated {
+				break
+			}
+			token = page.NextContinuationToken
+		}
+		if want := []string{"conf/list/", "conf/list/1.txt", "conf/list/2.txt", "conf/list/sub/", "conf/list/sub/3.txt", "conf/list/u.txt"}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("分页结果 = %v, want %v", keys, want)
+		}
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		putTestObjects(t, store, "conf/range.txt")
+		content := "conf/range.txt"
+
+		for _, r := range []struct {
+			offset, length int64
+			want           string
+		}{{0, 1, "c"}, {5, 5, "range"}, {11, 100, "txt"}, {5, 0, ""}} {
+			reader, err := GetObjectRange(store, "conf/range.txt", r.offset, r.length)
+			if err != nil {
+				t.Fatalf("GetObjectRange(%d, %d) 失败: %v", r.offset, r.length, err)
+			}
+			data, _ := io.ReadAll(reader)
+			reader.Close()
+			if string(data) != r.want {
+				t.Errorf("GetObjectRange(%d, %d) = %q, want %q", r.offset, r.length, data, r.want)
+			}
+		}
+
+		rs := NewObjectReadSeeker(store, "conf/range.txt", int64(len(content)))
+		defer rs.Close()
+		buf := make([]byte, 2)
+		rs.Seek(-3, io.SeekEnd)
+		if _, err := io.ReadFull(rs, buf); err != nil || string(buf) != "tx" {
+			t.Errorf("SeekEnd 后读取 = %q, %v", buf, err)
+		}
+		rs.Seek(5, io.SeekStart)
+		if _, err := io.ReadFull(rs, buf); err != nil || string(buf) != "ra" {
+			t.Errorf("SeekStart 后读取 = %q, %v", buf, err)
+		}
+		if rest, _ := io.ReadAll(rs); string(rest) != "nge.txt" {
+			t.Errorf("读取剩余内容 = %q", rest)
+		}
+
+		for _, r := range []struct {
+			offset int64
+			size   int
+			want   string
+			eof    bool
+		}{{5, 5, "range", false}, {10, 4, ".txt", false}, {11, 5, "txt", true}, {14, 1, "", true}} {
+			buf := make([]byte, r.size)
+			n, err := rs.ReadAt(buf, r.offset)
+			if string(buf[:n]) != r.want || errors.Is(err, io.EOF) != r.eof || (err != nil && !errors.Is(err, io.EOF)) {
+				t.Errorf("ReadAt(%d, %d) = %q, %v", r.offset, r.size, buf[:n], err)
+			}
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		putTestObjects(t, store, "conf/del.txt")
+		if err := store.DeleteObject("conf/del.txt"); err != nil {
+			t.Fatalf("DeleteObject 失败: %v", err)
+		}
+		if _, err := store.HeadObject("conf/del.txt"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("删除后 HeadObject err = %v, want ErrObjectNotFound", err)
+		}
+		if err := store.DeleteObject("conf/del.txt"); err != nil {
+			t.Errorf("删除不存在的对象不应报错: %v", err)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if _, err := store.HeadObject("conf/missing"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("HeadObject err = %v, want ErrObjectNotFound", err)
+		}
+		if _, _, _, err := store.GetObject("conf/missing"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("GetObject err = %v, want ErrObjectNotFound", err)
+		}
+		if err := store.CopyObject("conf/missing", "conf/dest"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("CopyObject err = %v, want ErrObjectNotFound", err)
+		}
+	})
+}
+
+// testMultipartConformance 分片上传在各存储后端上的行为
+func testMultipartConformance(t *testing.T, store interface {
+	ObjectStore
+	MultipartUploader
+}) {
+	t.Helper()
+
+	t.Run("UploadListComplete", func(t *testing.T) {
+		uploadID, err := store.CreateMultipartUpload("mp/big.bin", "application/x-test", map[string]string{"owner": "alice"})
+		if err != nil {
+			t.Fatalf("CreateMultipartUpload 失败: %v", err)
+		}
+
+		// 乱序上传，并重传第2片；除最后一片外S3要求分片不小于5MB
+		first := strings.Repeat("a", 5<<20)
+		for _, p := range []struct {
+			number  int
+			content string
+		}{{2, "xxxx"}, {1, first}, {2, "world"}} {
+			part, err := store.UploadPart("mp/big.bin", uploadID, p.number, strings.NewReader(p.content), int64(len(p.content)))
+			if err != nil {
+				t.Fatalf("UploadPart(%d) 失败: %v", p.number, err)
+			}
+			if part.ETag == "" || part.PartNumber != p.number {
+				t.Errorf("UploadPart = %+v", part)
+			}
+		}
+
+		parts, err := store.ListParts("mp/big.bin", uploadID)
+		if err != nil {
+			t.Fatalf("ListParts 失败: %v", err)
+		}
+		if len(parts) != 2 || parts[0].PartNumber != 1 || parts[1].PartNumber != 2 || parts[1].Size != 5 {
+			t.Fatalf("ListParts = %+v", parts)
+		}
+
+		if _, err := store.HeadObject("mp/big.bin"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("完成前对象不应可见: %v", err)
+		}
+
+		if err := store.CompleteMultipartUpload("mp/big.bin", uploadID, parts); err != nil {
+			t.Fatalf("CompleteMultipartUpload 失败: %v", err)
+		}
+
+		reader, size, contentType, err := store.GetObject("mp/big.bin")
+		if err != nil {
+			t.Fatalf("GetObject 失败: %v", err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(data) != first+"world" || size != int64(len(first))+5 || contentType != "application/x-test" {
+			t.Errorf("GetObject = %d 字节, %d, %q", len(data), size, contentType)
+		}
+		info, err := store.HeadObject("mp/big.bin")
+		if err != nil || info.Metadata["owner"] != "alice" {
+			t.Errorf("HeadObject = %+v, %v", info, err)
+		}
+
+		if _, err := store.ListParts("mp/big.bin", uploadID); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("完成后 ListParts err = %v, want ErrUploadNotFound", err)
+		}
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		uploadID, err := store.CreateMultipartUpload("mp/aborted.bin", "", nil)
+		if err != nil {
+			t.Fatalf("CreateMultipartUpload 失败: %v", err)
+		}
+		if _, err := store.UploadPart("mp/aborted.bin", uploadID, 1, strings.NewReader("abc"), 3); err != nil {
+			t.Fatalf("UploadPart 失败: %v", err)
+		}
+		if err := store.AbortMultipartUpload("mp/aborted.bin", uploadID); err != nil {
+			t.Fatalf("AbortMultipartUpload 失败: %v", err)
+		}
+		if _, err := store.UploadPart("mp/aborted.bin", uploadID, 2, strings.NewReader("abc"), 3); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("取消后 UploadPart err = %v, want ErrUploadNotFound", err)
+		}
+		if _, err := store.HeadObject("mp/aborted.bin"); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("取消后对象不应存在: %v", err)
+		}
+	})
+
+	t.Run("InvalidParts", func(t *testing.T) {
+		uploadID, err := store.CreateMultipartUpload("mp/invalid.bin", "", nil)
+		if err != nil {
+			t.Fatalf("CreateMultipartUpload 失败: %v", err)
+		}
+		defer store.AbortMultipartUpload("mp/invalid.bin", uploadID)
+
+		if _, err := store.UploadPart("mp/invalid.bin", uploadID, 0, strings.NewReader("a"), 1); err == nil {
+			t.Error("分片编号0应返回错误")
+		}
+		if err := store.CompleteMultipartUpload("mp/invalid.bin", uploadID, nil); err == nil {
+			t.Error("空分片列表应返回错误")
+		}
+		if err := store.CompleteMultipartUpload("mp/invalid.bin", uploadID, []UploadedPart{{PartNumber: 1}}); err == nil {
+			t.Error("未上传的分片应返回错误")
+		}
+	})
+}
+
+func TestMemoryStoreConformance(t *testing.T) {
+	testObjectStoreConformance(t, NewMemoryStore())
+	testMultipartConformance(t, NewMemoryStore())
+}
+
+func TestLocalStoreConformance(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore 失败: %v", err)
+	}
+	if err := store.EnsureBucketExists(); err != nil {
+		t.Fatalf("EnsureBucketExists 失败: %v", err)
+	}
+	testObjectStoreConformance(t, store)
+	testMultipartConformance(t, store)
+}
@@ -13,9 +13,15 @@ let selectedFiles = new Set();
 let allFiles = [];
 let uploadCancelToken = null;
 let currentViewMode = 'list'; // 'list' 或 'grid'
+let currentSearch = ''; // 当前的搜索条件，为空时显示文件夹内容
+let smartFolderNames = {}; // 智能文件夹（保存的搜索）路径到名称，用于面包屑显示
+let listNextToken = ''; // 当前文件夹下一页的令牌，为空表示已加载全部条目
+let listLoadingMore = false;
+let listGeneration = 0; // 每次重新加载文件夹时递增，丢弃切换前发出的翻页请求的结果
+let loadMoreObserver = null;
 
 // DOM元素 - 延迟获取避免初始化时元素不存在的问题
-let fileList, breadcrumb, selectionCount, deleteBtn, selectAllBtn, clearSelectionBtn;
+let fileList, breadcrumb, selectionCount, deleteBtn, downloadSelectedBtn, selectAllBtn, clearSelectionBtn;
 let refreshBtn, uploadBtn, uploadFolderBtn, fileInput, folderInput, newFolderBtn;
 let folderModal, notificationBanner, notificationClose, uploadProgressModal;
 let progressFill, progressText, progressPercentage, uploadDetails, cancelUploadBtn;
@@ -23,6 +29,8 @@ let listViewBtn, gridViewBtn, filePreviewModal, previewImage, previewVideo, prev
 let videoSnapshot, fileTitle, filePath, fileLoading, fileError, closeFileModal;
 let downloadFileBtn, retryFileBtn, userInfo, usernameDisplay, logoutBtn;
 let chatMessages, chatInput, sendMessageBtn, toggleAssistant, expandAssistantBtn;
+let searchForm, searchInput, searchContent, saveSearchBtn;
+let sortSelect, foldersFirstToggle;
 
 // 全局状态 - 聊天相关
 let currentFileId = null;
@@ -35,6 +43,7 @@ function initDOMElements() {
     breadcrumb = document.getElementById('breadcrumb');
     selectionCount = document.getElementById('selection-count');
     deleteBtn = document.getElementById('delete-selected-btn');
+    downloadSelectedBtn = document.getElementById('download-selected-btn');
     selectAllBtn = document.getElementById('select-all-btn');
     clearSelectionBtn = document.getElementById('clear-selection-btn');
     refreshBtn = document.getElementById('refresh-btn');
@@ -74,6 +83,12 @@ function initDOMElements() {
     sendMessageBtn = document.getElementById('send-message');
     toggleAssistant = document.getElementById('toggle-assistant');
     expandAssistantBtn = document.getElementById('expand-assistant-btn');
+    searchForm = document.getElementById('search-form');
+    searchInput = document.getElementById('search-input');
+    searchContent = document.getElementById('search-content');
+    saveSearchBtn = document.getElementById('save-search-btn');
+    sortSelect = document.getElementById('sort-select');
+    foldersFirstToggle = document.getElementById('folders-first');
 }
 
 // =============== 认证相关函数 ===============
@@ -241,7 +256,24 @@ function setupEventListeners() {
     selectAllBtn.addEventListener('click', selectAllFiles);
     clearSelectionBtn.addEventListener('click', clearSelection);
     deleteBtn.addEventListener('click', deleteSelectedFiles);
-    refreshBtn.addEventListener('click', () => loadFiles());
+    downloadSelectedBtn.addEventListener('click', () => downloadZip(Array.from(selectedFiles)));
+    refreshBtn.addEventListener('click', () => currentSearch ? searchFiles(currentSearch) : loadFiles());
+
+    // 搜索
+    if (searchForm) {
+        searchForm.addEventListener('submit', (e) => {
+            e.preventDefault();
+            const query = searchInput.value.trim();
+            if (query) {
+                searchFiles(query);
+            } else {
+                loadFiles();
+            }
+        });
+    }
+    if (saveSearchBtn) {
+        saveSearchBtn.addEventListener('click', saveCurrentSearch);
+    }
     
     // 上传文件
     uploadBtn.addEventListener('click', () => fileInput.click());
@@ -326,13 +358,23 @@ function setupEventListeners() {
     if (toggleAssistant) {
         toggleAssistant.addEventListener('click', toggleAssistantSidebar);
     }
+    // 排序方式改变时从第一页重新加载
+    if (sortSelect) {
+        sortSelect.addEventListener('change', () => loadFiles());
+    }
+    if (foldersFirstToggle) {
+        foldersFirstToggle.addEventListener('change', () => loadFiles());
+    }
     if (expandAssistantBtn) {
         expandAssistantBtn.addEventListener('click', toggleAssistantSidebar);
     }
 }
 
-// 加载文件列表
+// 加载文件列表，只加载第一页，滚动到底部或点击“加载更多”时加载后续页面
 async function loadFiles(path = currentPath) {
+    const generation = ++listGeneration;
+    listNextToken = '';
+    listLoadingMore = false;
     try {
         showLoading();
         // 确保path是字符串
@@ -340,52 +382,21 @@ async function loadFiles(path = currentPath) {
             path = currentPath;
         }
         currentPath = path;
+        currentSearch = '';
         
-        const response = await fetch(`${API_BASE_URL}/files?prefix=${encodeURIComponent(path)}`, {
+        const response = await fetch(`${API_BASE_URL}/files?${listParams(path, '')}`, {
             headers: getAuthHeaders()
         });
         const result = await response.json();
-        
-        console.log('API Response:', result); // 调试日志
+        if (generation !== listGeneration) {
+            return;
+        }
         
         if (result.success) {
-            // 处理API返回的数据结构
-            allFiles = [];
-            
-            // 处理文件夹
-            if (result.folders && Array.isArray(result.folders)) {
-                result.folders.forEach(folderName => {
-                    // 确保文件夹名称格式一致
-                    const cleanName = folderName.replace(/\/$/, ''); // 移除末尾斜杠用于显示
-                    // 构建完整的文件夹路径
-                    const folderKey = (path || '') + cleanName + '/';
-                    
-                    console.log('Processing folder:', { folderName, cleanName, folderKey, currentPath: path });
-                    
-                    allFiles.push({
-                        name: cleanName,
-                        key: folderKey,
-                        isFolder: true,
-                        size: 0,
-                        lastModified: null
-                    });
-                });
-            }
-            
-            // 处理文件
-            if (result.files && Array.isArray(result.files)) {
-                result.files.forEach(file => {
-                    allFiles.push({
-                        name: file.name || file.key,
-                        key: file.key,
-                        isFolder: false,
-                        size: file.size || 0,
-                        lastModified: file.lastModified || file.lastModified
-                    });
-                });
-            }
-            
+            allFiles = listEntries(result, path);
+            listNextToken = result.hasMore ? result.nextToken : '';
             renderFiles(allFiles);
+            renderLoadMore();
             updateBreadcrumb();
         } else {
             showError('加载文件失败: ' + result.error);
@@ -395,8 +406,241 @@ async function loadFiles(path = currentPath) {
     }
 }
 
+// 加载当前文件夹的下一页并追加到列表末尾
+async function loadMoreFiles() {
+    if (!listNextToken || listLoadingMore || currentSearch) {
+        return;
+    }
+    const generation = listGeneration;
+    const path = currentPath;
+    listLoadingMore = true;
+    renderLoadMore();
+    try {
+        const response = await fetch(`${API_BASE_URL}/files?${listParams(path, listNextToken)}`, {
+            headers: getAuthHeaders()
+        });
+        const result = await response.json();
+        if (generation !== listGeneration) {
+            return;
+        }
+        if (!result.success) {
+            showAlert('加载更多失败: ' + (result.error || result.message), 'error');
+            return;
+        }
+
+        const entries = listEntries(result, path);
+        allFiles = allFiles.concat(entries);
+        listNextToken = result.hasMore ? result.nextToken : '';
+        appendFiles(entries);
+    } catch (error) {
+        if (generation === listGeneration) {
+            showAlert('网络错误: ' + error.message, 'error');
+        }
+    } finally {
+        if (generation === listGeneration) {
+            listLoadingMore = false;
+            renderLoadMore();
+        }
+    }
+}
+
+// 文件列表的查询参数：排序方式来自工具栏，token 为空时请求第一页
+function listParams(path, token) {
+    const [sortBy, order] = (sortSelect ? sortSelect.value : 'name:asc').split(':');
+    const params = new URLSearchParams({ prefix: path, sortBy, order });
+    params.set('foldersFirst', foldersFirstToggle && !foldersFirstToggle.checked ? 'false' : 'true');
+    if (token) {
+        params.set('token', token);
+    }
+    return params;
+}
+
+// 将一页列举结果转换为列表条目，按服务端的排序方式排列文件夹和文件
+function listEntries(result, path) {
+    const entries = [];
+    
+    // 处理文件夹
+    if (result.folders && Array.isArray(result.folders)) {
+        result.folders.forEach(folderName => {
+            // 确保文件夹名称格式一致
+            const cleanName = folderName.replace(/\/$/, ''); // 移除末尾斜杠用于显示
+            entries.push({
+                name: cleanName,
+                key: (path || '') + cleanName + '/',
+                isFolder: true,
+                size: 0,
+                lastModified: null
+            });
+        });
+    }
+    
+    // 处理文件
+    if (result.files && Array.isArray(result.files)) {
+        result.files.forEach(file => {
+            entries.push({
+                name: file.name || file.key,
+                key: file.key,
+                isFolder: false,
+                size: file.size || 0,
+                lastModified: file.lastModified || null
+            });
+        });
+    }
+    
+    // 接口分别返回文件夹和文件，不置顶文件夹时按与服务端相同的规则合并
+    if (foldersFirstToggle && !foldersFirstToggle.checked) {
+        entries.sort(compareEntries);
+    }
+
+    // 保存的搜索显示为智能文件夹，打开时列出实时搜索结果
+    if (result.smartFolders && Array.isArray(result.smartFolders)) {
+        const smart = result.smartFolders.map(search => {
+            smartFolderNames[search.path] = search.name;
+            return {
+                name: search.name,
+                key: search.path,
+                isFolder: true,
+                isSmart: true,
+                size: 0,
+                lastModified: null
+            };
+        });
+        entries.unshift(...smart);
+    }
+    return entries;
+}
+
+// 与服务端相同的排序规则：按排序字段，相同时按名称升序，同名时文件夹在前
+function compareEntries(a, b) {
+    const [sortBy, order] = (sortSelect ? sortSelect.value : 'name:asc').split(':');
+    let cmp = 0;
+    if (sortBy === 'size') {
+        cmp = a.size - b.size;
+    } else if (sortBy === 'modified') {
+        cmp = (a.lastModified ? Date.parse(a.lastModified) : 0) - (b.lastModified ? Date.parse(b.lastModified) : 0);
+    } else {
+        cmp = a.name < b.name ? -1 : a.name > b.name ? 1 : 0;
+    }
+    if (order === 'desc') {
+        cmp = -cmp;
+    }
+    if (cmp !== 0) {
+        return cmp;
+    }
+    if (a.name !== b.name) {
+        return a.name < b.name ? -1 : 1;
+    }
+    return (b.isFolder ? 1 : 0) - (a.isFolder ? 1 : 0);
+}
+
+// 在列表末尾显示“加载更多”，进入可视区域时自动加载下一页
+function renderLoadMore() {
+    if (loadMoreObserver) {
+        loadMoreObserver.disconnect();
+        loadMoreObserver = null;
+    }
+    const existing = document.getElementById('load-more');
+    if (existing) {
+        existing.remove();
+    }
+    if (!listNextToken || currentSearch) {
+        return;
+    }
+
+    const loadMore = document.createElement('div');
+    loadMore.id = 'load-more';
+    loadMore.className = 'load-more';
+    loadMore.innerHTML = `<button class="btn btn-small" ${listLoadingMore ? 'disabled' : ''}>${listLoadingMore ? '加载中...' : '加载更多'}</button>`;
+    loadMore.querySelector('button').addEventListener('click', loadMoreFiles);
+    fileList.appendChild(loadMore);
+
+    if (!listLoadingMore && 'IntersectionObserver' in window) {
+        loadMoreObserver = new IntersectionObserver(entries => {
+            if (entries.some(entry => entry.isIntersecting)) {
+                loadMoreFiles();
+            }
+        });
+        loadMoreObserver.observe(loadMore);
+    }
+}
+
+// 在当前文件夹中搜索，query 为搜索条件（如 report type:pdf size:>10MB sort:modified）
+async function searchFiles(query) {
+    try {
+        showLoading();
+        currentSearch = query;
+        // 搜索结果不分页，丢弃正在加载的文件夹下一页
+        listGeneration++;
+        listNextToken = '';
+        listLoadingMore = false;
+
+        const params = new URLSearchParams({ q: query, folder: currentPath, limit: '200' });
+        if (searchContent && searchContent.checked) {
+            params.set('content', 'true');
+        }
+        const response = await fetch(`${API_BASE_URL}/search?${params}`, {
+            headers: getAuthHeaders()
+        });
+        const result = await response.json();
+
+        if (!response.ok || !result.success) {
+            // 语法错误的提示包含出错位置
+            showAlert(result.error || result.message || '搜索失败', 'error');
+            renderFiles(allFiles);
+            return;
+        }
+
+        // 搜索结果显示相对路径，便于区分不同文件夹中的同名文件
+        allFiles = (result.results || []).map(file => ({
+            name: file.key,
+            key: file.key,
+            isFolder: false,
+            size: file.size || 0,
+            lastModified: file.lastModified,
+            snippet: file.snippet
+        }));
+        renderFiles(allFiles, '没有找到匹配的文件');
+    } catch (error) {
+        showError('网络错误: ' + error.message);
+    }
+}
+
+// 将当前搜索框中的条件保存为智能文件夹
+async function saveCurrentSearch() {
+    const query = searchInput.value.trim();
+    if (!query) {
+        showAlert('请先输入搜索条件', 'error');
+        return;
+    }
+    const name = prompt('智能文件夹名称', query);
+    if (!name || !name.trim()) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`${API_BASE_URL}/saved-searches`, {
+            method: 'POST',
+            headers: { ...getAuthHeaders(), 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                name: name.trim(),
+                query,
+                folder: smartFolderNames[currentPath] ? '' : currentPath,
+                content: !!(searchContent && searchContent.checked)
+            })
+        });
+        const result = await response.json();
+        if (!response.ok || !result.success) {
+            showAlert(result.error || '保存搜索失败', 'error');
+            return;
+        }
+        showAlert(`已保存为智能文件夹「${result.search.name}」`, 'success');
+    } catch (error) {
+        showError('网络错误: ' + error.message);
+    }
+}
+
 // 渲染文件列表
-function renderFiles(files) {
+function renderFiles(files, emptyMessage = '此文件夹为空') {
     // 设置视图模式
     fileList.className = `file-list ${currentViewMode}-view`;
     
@@ -404,7 +648,7 @@ function renderFiles(files) {
         fileList.innerHTML = `
             <div class="empty-state">
                 <div class="empty-state-icon">📂</div>
-                <p>此文件夹为空</p>
+                <p>${emptyMessage}</p>
             </div>
         `;
         return;
@@ -418,6 +662,16 @@ function renderFiles(files) {
     updateSelectionUI();
 }
 
+// 将下一页的条目追加到列表末尾，已显示的条目和缩略图保持不变
+function appendFiles(files) {
+    const template = document.createElement('template');
+    template.innerHTML = files.map(file => createFileItem(file)).join('');
+    setupFileItemListeners(template.content);
+    const loadMore = document.getElementById('load-more');
+    fileList.insertBefore(template.content, loadMore);
+    updateSelectionUI();
+}
+
 // 创建文件项HTML
 function createFileItem(file) {
     const isFolder = file.isFolder;
@@ -443,6 +697,19 @@ function createFileItem(file) {
     const imageExts = ['jpg', 'jpeg', 'png', 'gif', 'webp', 'bmp'];
     const isImage = !isFolder && imageExts.includes(ext);
     
+    // 智能文件夹只能打开，不能选择、下载或删除
+    if (file.isSmart) {
+        return `
+            <div class="file-item smart-folder" data-path="${file.key}" data-is-folder="true">
+                ${icon}
+                <div class="file-info">
+                    <div class="file-name">${file.name}</div>
+                    <div class="file-meta"><span>保存的搜索</span></div>
+                </div>
+            </div>
+        `;
+    }
+    
     return `
         <div class="file-item" data-path="${file.key}" data-is-folder="${isFolder}">
             <input type="checkbox" class="file-checkbox" data-path="${file.key}">
@@ -452,19 +719,20 @@ function createFileItem(file) {
                 <div class="file-meta">
                     ${metaInfo}
                 </div>
+                ${file.snippet ? `<div class="file-snippet">${file.snippet}</div>` : ''}
             </div>
             <div class="file-actions">
-                ${!isFolder ? `<button class="action-btn download-btn" data-path="${file.key}" title="下载文件">下载</button>` : ''}
+                <button class="action-btn download-btn" data-path="${file.key}" data-is-folder="${isFolder}" title="${isFolder ? '打包下载文件夹' : '下载文件'}">下载</button>
                 <button class="action-btn delete-btn" data-path="${file.key}" data-is-folder="${isFolder}">删除</button>
             </div>
         </div>
     `;
 }
 
-// 设置文件项事件监听器
-function setupFileItemListeners() {
+// 设置 root 中文件项的事件监听器
+function setupFileItemListeners(root = document) {
     // 文件项点击
-    document.querySelectorAll('.file-item').forEach(item => {
+    root.querySelectorAll('.file-item').forEach(item => {
         item.addEventListener('click', (e) => {
             if (e.target.type === 'checkbox' || e.target.classList.contains('action-btn')) {
                 return;
@@ -501,20 +769,24 @@ function setupFileItemListeners() {
     });
     
     // 复选框
-    document.querySelectorAll('.file-checkbox').forEach(checkbox => {
+    root.querySelectorAll('.file-checkbox').forEach(checkbox => {
         checkbox.addEventListener('change', handleCheckboxChange);
     });
     
     // 下载按钮
-    document.querySelectorAll('.download-btn').forEach(btn => {
+    root.querySelectorAll('.download-btn').forEach(btn => {
         btn.addEventListener('click', (e) => {
             e.stopPropagation();
-            downloadFile(btn.dataset.path);
+            if (btn.dataset.isFolder === 'true') {
+                downloadZip([btn.dataset.path]);
+            } else {
+                downloadFile(btn.dataset.path);
+            }
         });
     });
     
     // 删除按钮
-    document.querySelectorAll('.delete-btn').forEach(btn => {
+    root.querySelectorAll('.delete-btn').forEach(btn => {
         btn.addEventListener('click', (e) => {
             e.stopPropagation();
             const filePath = btn.dataset.path;
@@ -524,18 +796,18 @@ function setupFileItemListeners() {
     });
     
     // 异步加载缩略图
-    loadThumbnails();
+    loadThumbnails(root);
 }
 
-// 异步加载所有缩略图
-async function loadThumbnails() {
+// 异步加载 root 中的缩略图
+async function loadThumbnails(root = document) {
     // 如果用户未登录，跳过缩略图加载
     if (!authToken) {
         return;
     }
     
     // 加载图片缩略图
-    const imageContainers = document.querySelectorAll('.file-image-container');
+    const imageContainers = root.querySelectorAll('.file-image-container');
     imageContainers.forEach(async container => {
         const fileKey = container.dataset.fileKey;
         const size = parseInt(container.dataset.size);
@@ -557,7 +829,7 @@ async function loadThumbnails() {
     });
     
     // 加载视频缩略图
-    const videoContainers = document.querySelectorAll('.video-thumbnail-container');
+    const videoContainers = root.querySelectorAll('.video-thumbnail-container');
     videoContainers.forEach(async container => {
         const fileKey = container.dataset.fileKey;
         const size = parseInt(container.dataset.size);
@@ -633,6 +905,45 @@ async function downloadFile(filePath) {
     }
 }
 
+// 将多个文件和文件夹打包为 zip 下载，文件夹由服务端递归打包
+async function downloadZip(items) {
+    if (items.length === 0) return;
+
+    try {
+        showAlert('正在打包下载...', 'success');
+
+        const response = await fetch(`${API_BASE_URL}/download/zip`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ items })
+        });
+
+        if (!response.ok) {
+            const result = await response.json().catch(() => ({}));
+            throw new Error(result.error || `${response.status} ${response.statusText}`);
+        }
+
+        const blob = await response.blob();
+        const fileName = items.length === 1
+            ? `${items[0].replace(/\/$/, '').split('/').pop()}.zip`
+            : 'download.zip';
+
+        const downloadUrl = window.URL.createObjectURL(blob);
+        const link = document.createElement('a');
+        link.href = downloadUrl;
+        link.download = fileName;
+        document.body.appendChild(link);
+        link.click();
+        document.body.removeChild(link);
+        window.URL.revokeObjectURL(downloadUrl);
+
+        showAlert('下载开始', 'success');
+    } catch (error) {
+        console.error('打包下载失败:', error);
+        showAlert('打包下载失败: ' + error.message, 'error');
+    }
+}
+
 // 删除文件或文件夹
 async function deleteFile(filePath, isFolder = false) {
     const itemType = isFolder ? '文件夹' : '文件';
@@ -649,13 +960,8 @@ async function deleteFile(filePath, isFolder = false) {
     console.log('Deleting:', filePath, 'isFolder:', isFolder);
     
     try {
-        if (isFolder) {
-            // 递归删除文件夹及其内容
-            await deleteFolderRecursively(filePath);
-        } else {
-            // 删除单个文件
-            await deleteSingleItem(filePath);
-        }
+        // 文件夹路径以 / 结尾，服务端会递归删除其中的所有内容
+        await deleteSingleItem(filePath);
         
         showSuccess(`${itemType}删除成功`);
         loadFiles();
@@ -664,78 +970,6 @@ async function deleteFile(filePath, isFolder = false) {
     }
 }
 
-// 递归删除文件夹
-async function deleteFolderRecursively(folderPath) {
-    console.log('开始递归删除文件夹:', folderPath);
-    
-    // 获取文件夹内的所有内容
-    const allItems = await getAllItemsInFolder(folderPath);
-    
-    if (allItems.length > 0) {
-        console.log('文件夹内容:', allItems);
-        
-        // 使用批量删除API删除所有内容
-        const response = await fetch(`${API_BASE_URL}/batch/delete`, {
-            method: 'POST',
-            headers: getAuthHeaders(),
-            body: JSON.stringify({
-                items: allItems
-            })
-        });
-        
-        const result = await response.json();
-        if (!result.success) {
-            throw new Error(result.error || '批量删除内容失败');
-        }
-        
-        console.log('批量删除结果:', result);
-    }
-    
-    // 最后删除文件夹本身
-    await deleteSingleItem(folderPath);
-}
-
-// 获取文件夹内的所有项目（递归）
-async function getAllItemsInFolder(folderPath) {
-    const allItems = [];
-    
-    async function scanFolder(path) {
-        try {
-            const response = await fetch(`${API_BASE_URL}/files?prefix=${encodeURIComponent(path)}`);
-            const result = await response.json();
-            
-            if (!result.success) {
-                console.warn('无法扫描文件夹:', path);
-                return;
-            }
-            
-            // 添加文件
-            if (result.files && Array.isArray(result.files)) {
-                result.files.forEach(file => {
-                    allItems.push(file.key);
-                });
-            }
-            
-            // 递归处理子文件夹
-            if (result.folders && Array.isArray(result.folders)) {
-                for (const folderName of result.folders) {
-                    const subFolderPath = path + folderName + (folderName.endsWith('/') ? '' : '/');
-                    await scanFolder(subFolderPath);
-                    // 将子文件夹也加入删除列表
-                    allItems.push(subFolderPath);
-                }
-            }
-        } catch (error) {
-            console.error('扫描文件夹出错:', path, error);
-        }
-    }
-    
-    await scanFolder(folderPath);
-    
-    // 确保父文件夹最后被删除（排序确保深层文件夹先被删除）
-    return allItems.sort((a, b) => b.split('/').length - a.split('/').length);
-}
-
 // 删除单个项目
 async function deleteSingleItem(itemPath) {
     const encodedPath = itemPath.split('/').map(part => encodeURIComponent(part)).join('/');
@@ -746,7 +980,7 @@ async function deleteSingleItem(itemPath) {
     
     const result = await response.json();
     if (!result.success) {
-        throw new Error(result.error || '删除失败');
+        throw new Error(result.error || result.message || '删除失败');
     }
 }
 
@@ -800,44 +1034,21 @@ async function deleteSelectedFiles() {
     }
     
     try {
-        // 收集所有需要删除的项目（包括文件夹内容）
-        const allItemsToDelete = new Set();
-        
-        for (const itemPath of selectedItems) {
-            if (itemPath.endsWith('/')) {
-                // 这是一个文件夹，需要递归获取其内容
-                console.log('处理文件夹:', itemPath);
-                const folderContents = await getAllItemsInFolder(itemPath);
-                folderContents.forEach(item => allItemsToDelete.add(item));
-                allItemsToDelete.add(itemPath);
-            } else {
-                // 这是一个文件
-                allItemsToDelete.add(itemPath);
-            }
-        }
-        
-        const finalItemsList = Array.from(allItemsToDelete)
-            .sort((a, b) => b.split('/').length - a.split('/').length); // 深层项目优先删除
-        
-        console.log('最终删除列表:', finalItemsList);
+        // 以 / 结尾的文件夹由服务端递归删除
+        const response = await fetch(`${API_BASE_URL}/batch/delete`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({
+                items: selectedItems
+            })
+        });
         
-        if (finalItemsList.length > 0) {
-            const response = await fetch(`${API_BASE_URL}/batch/delete`, {
-                method: 'POST',
-                headers: getAuthHeaders(),
-                body: JSON.stringify({
-                    items: finalItemsList
-                })
-            });
-            
-            const result = await response.json();
-            if (result.success) {
-                showSuccess(`批量删除成功，共删除 ${finalItemsList.length} 个项目`);
-            } else {
-                showError('批量删除失败: ' + result.error);
-            }
+        const result = await response.json();
+        if (result.success) {
+            showSuccess(result.message || '批量删除成功');
+        } else {
+            showError('批量删除失败: ' + (result.error || result.message));
         }
-        
         selectedFiles.clear();
         loadFiles();
     } catch (error) {
@@ -849,6 +1060,7 @@ async function deleteSelectedFiles() {
 function updateSelectionUI() {
     selectionCount.textContent = `已选择: ${selectedFiles.size} 项`;
     deleteBtn.disabled = selectedFiles.size === 0;
+    downloadSelectedBtn.disabled = selectedFiles.size === 0;
     
     // 更新文件项选中状态
     document.querySelectorAll('.file-item').forEach(item => {
@@ -867,6 +1079,15 @@ function updateBreadcrumb() {
     const parts = pathStr ? pathStr.split('/').filter(p => p) : [];
     let breadcrumbHTML = '<span class="breadcrumb-item" data-path="">根目录</span>';
     
+    // 智能文件夹显示保存的搜索的名称
+    if (smartFolderNames[pathStr]) {
+        breadcrumb.innerHTML = breadcrumbHTML + `<span class="breadcrumb-item" data-path="${pathStr}">🔎 ${smartFolderNames[pathStr]}</span>`;
+        document.querySelectorAll('.breadcrumb-item').forEach(item => {
+            item.addEventListener('click', () => loadFiles(item.dataset.path));
+        });
+        return;
+    }
+    
     let buildPath = '';
     parts.forEach(part => {
         buildPath += part + '/';
@@ -964,6 +1185,9 @@ async function createFolder() {
 
 // 工具函数
 function getFileIcon(file, isFolder) {
+    if (file.isSmart) {
+        return '<div class="file-icon">🔎</div>';
+    }
     if (isFolder) {
         return '<div class="file-icon">📁</div>';
     }
@@ -1079,6 +1303,7 @@ function switchViewMode(mode) {
     
     // 重新渲染文件列表
     renderFiles(allFiles);
+    renderLoadMore();
 }
 
 function formatFileSize(bytes) {
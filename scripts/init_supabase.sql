@@ -11,6 +11,9 @@ CREATE TABLE IF NOT EXISTS users (
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- 用户的存储配额（字节），NULL 表示使用 USER_QUOTA_MB 默认配额，0 表示不限制
+ALTER TABLE users ADD COLUMN IF NOT EXISTS quota_bytes BIGINT;
+
 -- 创建索引以提升查询性能
 CREATE INDEX IF NOT EXISTS idx_users_user_id ON users(user_id);
 CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
@@ -21,9 +24,55 @@ COMMENT ON COLUMN users.id IS '自增主键';
 COMMENT ON COLUMN users.user_id IS '用户唯一标识符，bkp-开头';
 COMMENT ON COLUMN users.username IS '用户名';
 COMMENT ON COLUMN users.password IS 'bcrypt加密的密码hash';
+COMMENT ON COLUMN users.quota_bytes IS '存储配额（字节），NULL 表示使用默认配额，0 表示不限制';
 COMMENT ON COLUMN users.created_at IS '创建时间';
 COMMENT ON COLUMN users.updated_at IS '更新时间';
 
+-- 文件元数据索引表（METADATA_INDEX=true 时使用），每次写入存储后更新
+-- key 使用 "C" 排序规则，与对象存储的列举顺序一致，按前缀查询可以使用主键索引
+CREATE TABLE IF NOT EXISTS files (
+    key TEXT COLLATE "C" PRIMARY KEY,  -- 完整对象键
+    owner VARCHAR(12) NOT NULL DEFAULT '',  -- 所属用户ID
+    size BIGINT NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    category VARCHAR(16) NOT NULL,  -- image、video、audio、document、archive、code、other
+    etag VARCHAR(64) NOT NULL DEFAULT '',
+    content_hash VARCHAR(64) NOT NULL DEFAULT '',  -- 去重存储中内容的 SHA-256
+    is_folder BOOLEAN NOT NULL DEFAULT FALSE,  -- 文件夹标记
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    last_modified TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_files_owner_modified ON files(owner, last_modified DESC);
+CREATE INDEX IF NOT EXISTS idx_files_owner_category ON files(owner, category);
+CREATE INDEX IF NOT EXISTS idx_files_owner_size ON files(owner, size);
+CREATE INDEX IF NOT EXISTS idx_files_tags ON files USING GIN (tags);
+
+-- 全文检索：从文本、Markdown、代码、PDF 和 docx 中提取的文本，simple 配置只按空白和标点分词，不做词干处理
+-- simple 配置把一整段中文当作一个词，content_terms 为服务端分词后的文本（中日韩文字按相邻两字切分），tsvector 由它生成；新增该列前已保存的 content 需重新上传文件才会生成分词
+ALTER TABLE files ADD COLUMN IF NOT EXISTS content TEXT NOT NULL DEFAULT '';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS content_terms TEXT NOT NULL DEFAULT '';
+-- 旧版本的 content_tsv 由 content 生成，需删除后按 content_terms 重建
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'files' AND column_name = 'content_tsv' AND generation_expression NOT LIKE '%content_terms%'
+    ) THEN
+        ALTER TABLE files DROP COLUMN content_tsv;
+    END IF;
+END $$;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS content_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', content_terms)) STORED;
+CREATE INDEX IF NOT EXISTS idx_files_content ON files USING GIN (content_tsv);
+
+COMMENT ON TABLE files IS '文件元数据索引';
+COMMENT ON COLUMN files.owner IS '所属用户ID，不在用户空间内的对象为空';
+COMMENT ON COLUMN files.last_modified IS '对象在存储中的修改时间';
+COMMENT ON COLUMN files.content IS '从文件中提取的文本，不支持的类型为空';
+COMMENT ON COLUMN files.content_terms IS 'content 分词后以空格连接的文本，用于生成 content_tsv';
+
 -- 创建更新时间自动更新函数
 CREATE OR REPLACE FUNCTION update_updated_at_column()
 RETURNS TRIGGER AS $$
@@ -39,6 +88,11 @@ CREATE TRIGGER update_users_updated_at
     FOR EACH ROW
     EXECUTE FUNCTION update_updated_at_column();
 
+CREATE TRIGGER update_files_updated_at
+    BEFORE UPDATE ON files
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
 -- 可选：插入测试数据（密码为 "test123" 的bcrypt hash）
 -- INSERT INTO users (user_id, username, password) VALUES
 -- ('bkp-testuser', 'testuser', '$2a$10$example_hash_here');